@@ -3,6 +3,7 @@ package byzcoin
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/dedis/onet/network"
@@ -69,9 +70,10 @@ func (c *Client) AddTransaction(tx ClientTransaction) (*AddTxResponse, error) {
 }
 
 // AddTransactionAndWait adds a transaction and will wait for it to be included
-// in the ledger, up to a maximum of wait block intervals. It does not return
-// any feedback on the transaction. The Client's Roster and ID should be
-// initialized before calling this method (see NewClientFromConfig).
+// in the ledger, up to a maximum of wait block intervals. If wait is bigger
+// than 0 and the transaction got refused, an error holding the reason of the
+// refusal is returned together with the reply. The Client's Roster and ID
+// should be initialized before calling this method (see NewClientFromConfig).
 func (c *Client) AddTransactionAndWait(tx ClientTransaction, wait int) (*AddTxResponse, error) {
 	reply := &AddTxResponse{}
 	err := c.SendProtobuf(c.Roster.List[0], &AddTxRequest{
@@ -83,6 +85,9 @@ func (c *Client) AddTransactionAndWait(tx ClientTransaction, wait int) (*AddTxRe
 	if err != nil {
 		return nil, err
 	}
+	if wait > 0 && !reply.Accepted {
+		return reply, errors.New("transaction is in block, but got refused: " + reply.Error)
+	}
 	return reply, nil
 }
 
@@ -104,6 +109,209 @@ func (c *Client) GetProof(key []byte) (*GetProofResponse, error) {
 	return reply, nil
 }
 
+// GetProofAt is like GetProof, but returns the proof for the key as it was
+// stored in the given block of the skipchain. The proof can be verified with
+// the genesis skipblock and its Latest field holds the requested block.
+func (c *Client) GetProofAt(key []byte, blockID skipchain.SkipBlockID) (*GetProofResponse, error) {
+	reply := &GetProofResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &GetProof{
+		Version: CurrentVersion,
+		ID:      c.ID,
+		Key:     key,
+		BlockID: blockID,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// GetSignerCounters sends a request to get the next expected counters of the
+// given signer identities, as returned by darc.Identity.String. The next
+// instruction signed by these identities must use these counters.
+func (c *Client) GetSignerCounters(ids ...string) (*GetSignerCountersResponse, error) {
+	reply := &GetSignerCountersResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &GetSignerCounters{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+		SignerIDs:   ids,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Simulate asks the node on index 0 of the roster to execute the
+// transaction on its current state, without storing it. The reply tells
+// whether the transaction would be accepted and which state changes it
+// would produce. The counters of the signers must be the next expected
+// ones, as returned by GetSignerCounters.
+func (c *Client) Simulate(tx ClientTransaction) (*SimulateResponse, error) {
+	reply := &SimulateResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &SimulateRequest{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+		Transaction: tx,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// GetInstanceHistory returns the state changes of the instance, skipping the
+// first start ones and returning at most count of them. The Total field of
+// the reply can be used to fetch the following pages. If count is 0, the
+// maximum number of state changes of the service is returned.
+func (c *Client) GetInstanceHistory(id InstanceID, start, count int) (*GetInstanceHistoryResponse, error) {
+	reply := &GetInstanceHistoryResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &GetInstanceHistory{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+		InstanceID:  id,
+		Start:       start,
+		Count:       count,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// AddPendingTx stores a partially signed transaction on the node on index 0
+// of the roster, so that the other signers can add their signatures with
+// SignPendingTx. Every instruction must hold all its signers, with an empty
+// signature for the missing ones, see Instruction.CoSign.
+func (c *Client) AddPendingTx(tx ClientTransaction) (*AddPendingTxResponse, error) {
+	reply := &AddPendingTxResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &AddPendingTx{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+		Transaction: tx,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// SignPendingTx adds signatures to the pending transaction with the given ID.
+// The transaction is submitted once its signatures satisfy the rules of its
+// darcs.
+func (c *Client) SignPendingTx(id []byte, sigs []InstructionSignature) (*SignPendingTxResponse, error) {
+	reply := &SignPendingTxResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &SignPendingTx{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+		ID:          id,
+		Signatures:  sigs,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// GetPendingTxs returns the transactions that wait for signatures on the
+// node on index 0 of the roster.
+func (c *Client) GetPendingTxs() (*GetPendingTxsResponse, error) {
+	reply := &GetPendingTxsResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &GetPendingTxs{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// GetDarcReferences returns the instances controlled by the darc with the
+// given base ID and the darcs that delegate to it.
+func (c *Client) GetDarcReferences(id darc.ID) (*GetDarcReferencesResponse, error) {
+	reply := &GetDarcReferencesResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &GetDarcReferences{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+		DarcID:      id,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// GetDarcHistory returns the versions of the darc with the given base ID, the
+// oldest first, for at most count state changes of the darc after skipping
+// the first start ones. The Total field of the reply can be used to fetch the
+// following pages. If count is 0, the maximum of the service is used. The
+// proof of every version is verified.
+func (c *Client) GetDarcHistory(id darc.ID, start, count int) (*GetDarcHistoryResponse, error) {
+	reply := &GetDarcHistoryResponse{}
+	err := c.SendProtobuf(c.Roster.List[0], &GetDarcHistory{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+		DarcID:      id,
+		Start:       start,
+		Count:       count,
+	}, reply)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range reply.Versions {
+		if err := v.Proof.Verify(c.ID); err != nil {
+			return nil, fmt.Errorf("proof of version %d: %s", v.Darc.Version, err)
+		}
+		if !v.Proof.InclusionProof.Match() {
+			return nil, fmt.Errorf("proof of version %d doesn't contain the darc", v.Darc.Version)
+		}
+	}
+	return reply, nil
+}
+
+// StreamBlocks subscribes to the new blocks of the skipchain, by opening a
+// streaming connection to the node on index 0 of the roster. Every new block
+// is sent on the blocks channel, together with its decoded body. This method
+// blocks until stop is closed, in which case it returns nil, or until the
+// connection fails, in which case it returns the error that stopped the
+// stream. The connection is closed when the method returns.
+func (c *Client) StreamBlocks(blocks chan<- *StreamingResponse, stop <-chan bool) error {
+	conn, err := c.Stream(c.Roster.List[0], &StreamingRequest{
+		Version:     CurrentVersion,
+		SkipchainID: c.ID,
+	})
+	if err != nil {
+		return err
+	}
+	// Closing the connection unblocks ReadMessage.
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+		}
+		conn.Close()
+	}()
+	for {
+		resp := &StreamingResponse{}
+		if err := conn.ReadMessage(resp); err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return err
+			}
+		}
+		select {
+		case blocks <- resp:
+		case <-stop:
+			return nil
+		}
+	}
+}
+
 // GetGenDarc uses the GetProof method to fetch the latest version of the
 // Genesis Darc from ByzCoin and parses it.
 func (c *Client) GetGenDarc() (*darc.Darc, error) {
@@ -128,29 +336,31 @@ func (c *Client) GetGenDarc() (*darc.Darc, error) {
 	if len(darcID) != 32 {
 		return nil, errors.New("genesis darc ID is wrong length")
 	}
+	return c.GetDarc(darcID)
+}
 
-	p, err = c.GetProof(darcID)
+// GetDarc uses the GetProof method to fetch the latest version of the darc
+// with the given base ID from ByzCoin.
+func (c *Client) GetDarc(id darc.ID) (*darc.Darc, error) {
+	p, err := c.GetProof(id)
 	if err != nil {
 		return nil, err
 	}
 	if !p.Proof.InclusionProof.Match() {
-		return nil, errors.New("cannot find genesis Darc")
+		return nil, errors.New("cannot find Darc")
 	}
 
-	_, vs, err = p.Proof.KeyValue()
-
+	_, vs, err := p.Proof.KeyValue()
+	if err != nil {
+		return nil, err
+	}
 	if len(vs) < 2 {
 		return nil, errors.New("not enough records")
 	}
-	contractBuf = vs[1]
-	if string(contractBuf) != ContractDarcID {
-		return nil, errors.New("expected contract to be darc but got: " + string(contractBuf))
-	}
-	d, err := darc.NewFromProtobuf(vs[0])
-	if err != nil {
-		return nil, err
+	if string(vs[1]) != ContractDarcID {
+		return nil, errors.New("expected contract to be darc but got: " + string(vs[1]))
 	}
-	return d, nil
+	return darc.NewFromProtobuf(vs[0])
 }
 
 // GetChainConfig uses the GetProof method to fetch the chain config
@@ -32,7 +32,10 @@ func TestClient_GetProof(t *testing.T) {
 	// Create a new transaction.
 	value := []byte{5, 6, 7, 8}
 	kind := "dummy"
-	tx, err := createOneClientTx(d.GetBaseID(), kind, value, signer)
+	counters, err := c.GetSignerCounters(signer.Identity().String())
+	require.Nil(t, err)
+	require.Equal(t, []uint64{1}, counters.Counters)
+	tx, err := createOneClientTx(d.GetBaseID(), kind, value, signer, counters.Counters[0])
 	require.Nil(t, err)
 	_, err = c.AddTransaction(tx)
 	require.Nil(t, err)
@@ -59,3 +62,131 @@ func TestClient_GetProof(t *testing.T) {
 	require.Equal(t, k, newId)
 	require.Equal(t, value, vs[0])
 }
+
+func TestClient_AddTransactionAndWait(t *testing.T) {
+	l := onet.NewTCPTest(cothority.Suite)
+	servers, roster, _ := l.GenTree(3, true)
+	registerDummy(servers)
+	defer l.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	msg, err := DefaultGenesisMsg(CurrentVersion, roster, []string{"spawn:dummy", "spawn:invalid"}, signer.Identity())
+	require.Nil(t, err)
+	msg.BlockInterval = 100 * time.Millisecond
+	d := msg.GenesisDarc
+
+	c, _, err := NewLedger(msg, false)
+	require.Nil(t, err)
+
+	tx, err := createOneClientTx(d.GetBaseID(), dummyContract, []byte{1}, signer, 1)
+	require.Nil(t, err)
+	reply, err := c.AddTransactionAndWait(tx, 10)
+	require.Nil(t, err)
+	require.True(t, reply.Accepted)
+
+	// The contract refuses the transaction, and we should learn why.
+	tx, err = createOneClientTx(d.GetBaseID(), invalidContract, []byte{2}, signer, 2)
+	require.Nil(t, err)
+	reply, err = c.AddTransactionAndWait(tx, 10)
+	require.NotNil(t, err)
+	require.False(t, reply.Accepted)
+	require.Contains(t, reply.Error, "this invalid contract always returns an error")
+	require.Contains(t, err.Error(), reply.Error)
+}
+
+func TestClient_Simulate(t *testing.T) {
+	l := onet.NewTCPTest(cothority.Suite)
+	servers, roster, _ := l.GenTree(3, true)
+	registerDummy(servers)
+	defer l.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	msg, err := DefaultGenesisMsg(CurrentVersion, roster, []string{"spawn:dummy", "spawn:invalid"}, signer.Identity())
+	require.Nil(t, err)
+	msg.BlockInterval = 100 * time.Millisecond
+	d := msg.GenesisDarc
+
+	c, _, err := NewLedger(msg, false)
+	require.Nil(t, err)
+
+	tx, err := createOneClientTx(d.GetBaseID(), dummyContract, []byte{1}, signer, 1)
+	require.Nil(t, err)
+	reply, err := c.Simulate(tx)
+	require.Nil(t, err)
+	require.True(t, reply.Accepted)
+	// Only the state change of the new instance is returned, not the ones
+	// stored by the service next to it.
+	require.Equal(t, 1, len(reply.StateChanges))
+	id := NewInstanceID(tx.Instructions[0].Hash())
+	require.Equal(t, id.Slice(), reply.StateChanges[0].InstanceID)
+	require.Equal(t, []byte{1}, reply.StateChanges[0].Value)
+
+	tx, err = createOneClientTx(d.GetBaseID(), invalidContract, []byte{2}, signer, 1)
+	require.Nil(t, err)
+	reply, err = c.Simulate(tx)
+	require.Nil(t, err)
+	require.False(t, reply.Accepted)
+	require.Contains(t, reply.Error, "this invalid contract always returns an error")
+	require.Equal(t, 0, len(reply.StateChanges))
+
+	// Nothing got stored.
+	time.Sleep(2 * msg.BlockInterval)
+	pr, err := c.GetProof(id.Slice())
+	require.Nil(t, err)
+	require.False(t, pr.Proof.InclusionProof.Match())
+	ctrs, err := c.GetSignerCounters(signer.Identity().String())
+	require.Nil(t, err)
+	require.Equal(t, uint64(1), ctrs.Counters[0])
+}
+
+func TestClient_StreamBlocks(t *testing.T) {
+	l := onet.NewTCPTest(cothority.Suite)
+	servers, roster, _ := l.GenTree(3, true)
+	registerDummy(servers)
+	defer l.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	msg, err := DefaultGenesisMsg(CurrentVersion, roster, []string{"spawn:dummy"}, signer.Identity())
+	require.Nil(t, err)
+	msg.BlockInterval = 100 * time.Millisecond
+	d := msg.GenesisDarc
+
+	c, _, err := NewLedger(msg, false)
+	require.Nil(t, err)
+
+	blocks := make(chan *StreamingResponse, 10)
+	stop := make(chan bool)
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- c.StreamBlocks(blocks, stop)
+	}()
+
+	// Give the stream the time to be set up.
+	time.Sleep(msg.BlockInterval)
+
+	tx, err := createOneClientTx(d.GetBaseID(), dummyContract, []byte{1}, signer, 1)
+	require.Nil(t, err)
+	_, err = c.AddTransactionAndWait(tx, 10)
+	require.Nil(t, err)
+
+	select {
+	case resp := <-blocks:
+		require.True(t, resp.Block.SkipChainID().Equal(c.ID))
+		require.Equal(t, 1, resp.Block.Index)
+		require.Equal(t, 1, len(resp.Body.TxResults))
+		require.True(t, resp.Body.TxResults[0].Accepted)
+		require.Equal(t, tx.Instructions.Hash(),
+			resp.Body.TxResults[0].ClientTransaction.Instructions.Hash())
+	case <-time.After(10 * msg.BlockInterval):
+		require.Fail(t, "didn't receive the new block")
+	}
+
+	// The stream returns once it is stopped.
+	close(stop)
+	select {
+	case err := <-stopped:
+		require.Nil(t, err)
+	case <-time.After(10 * msg.BlockInterval):
+		require.Fail(t, "the stream didn't stop")
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/byzcoin/bcadmin/lib"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+func contractSpawn(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return errors.New("need the contract ID")
+	}
+	contractID := c.Args().First()
+	return sendContractInstruction(c, true, func(instr *byzcoin.Instruction, args byzcoin.Arguments) {
+		instr.Spawn = &byzcoin.Spawn{
+			ContractID: contractID,
+			Args:       args,
+		}
+	}, func(sc byzcoin.StateChange) bool {
+		return sc.StateAction == byzcoin.Create && string(sc.ContractID) == contractID
+	})
+}
+
+func contractInvoke(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return errors.New("need the command")
+	}
+	command := c.Args().First()
+	return sendContractInstruction(c, false, func(instr *byzcoin.Instruction, args byzcoin.Arguments) {
+		instr.Invoke = &byzcoin.Invoke{
+			Command: command,
+			Args:    args,
+		}
+	}, nil)
+}
+
+func contractDelete(c *cli.Context) error {
+	return sendContractInstruction(c, false, func(instr *byzcoin.Instruction, args byzcoin.Arguments) {
+		instr.Delete = &byzcoin.Delete{}
+	}, nil)
+}
+
+// sendContractInstruction sends the instruction filled in by fill to the
+// instance given by the --instance flag, which is the genesis darc if
+// genesisDefault is true and the flag is not given. The instances of the
+// state changes for which created returns true are printed as the new
+// instances.
+func sendContractInstruction(c *cli.Context, genesisDefault bool,
+	fill func(*byzcoin.Instruction, byzcoin.Arguments),
+	created func(byzcoin.StateChange) bool) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	var iid byzcoin.InstanceID
+	switch inst := c.String("instance"); {
+	case inst != "":
+		buf, err := hex.DecodeString(strings.TrimPrefix(inst, "darc:"))
+		if err != nil {
+			return err
+		}
+		if len(buf) != 32 {
+			return errors.New("instance ID must be 32 bytes long")
+		}
+		iid = byzcoin.NewInstanceID(buf)
+	case genesisDefault:
+		iid = byzcoin.NewInstanceID(cfg.GenesisDarc.GetBaseID())
+	default:
+		return errors.New("--instance flag is required")
+	}
+
+	args, err := parseArguments(c.StringSlice("arg"))
+	if err != nil {
+		return err
+	}
+	darcID, err := instanceDarc(cl, iid)
+	if err != nil {
+		return err
+	}
+
+	instr := byzcoin.Instruction{InstanceID: iid}
+	fill(&instr, args)
+	scs, err := sendInstruction(c, cfg, cl, darcID, instr)
+	if err != nil {
+		return err
+	}
+	if c.String("export") != "" {
+		return nil
+	}
+	if created == nil {
+		fmt.Fprintf(c.App.Writer, "Instance ID: %x\n", iid.Slice())
+		return nil
+	}
+	for _, sc := range scs {
+		if created(sc) {
+			fmt.Fprintf(c.App.Writer, "Instance ID: %x\n", sc.InstanceID)
+		}
+	}
+	return nil
+}
+
+// parseArguments returns the arguments given as name=value. The value is a
+// string, unless it starts with one of:
+//   - hex: for bytes given in hex
+//   - uint64: for a number stored as 8 bytes in little-endian
+//   - file: for the content of a file, like an encoded protobuf message
+//   - string: for a string that starts with one of these prefixes
+func parseArguments(in []string) (byzcoin.Arguments, error) {
+	var args byzcoin.Arguments
+	for _, a := range in {
+		i := strings.Index(a, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("argument '%s' is not given as name=value", a)
+		}
+		name, value := a[:i], a[i+1:]
+		var buf []byte
+		var err error
+		switch {
+		case strings.HasPrefix(value, "hex:"):
+			buf, err = hex.DecodeString(value[len("hex:"):])
+		case strings.HasPrefix(value, "uint64:"):
+			var n uint64
+			n, err = strconv.ParseUint(value[len("uint64:"):], 10, 64)
+			buf = make([]byte, 8)
+			binary.LittleEndian.PutUint64(buf, n)
+		case strings.HasPrefix(value, "file:"):
+			buf, err = ioutil.ReadFile(value[len("file:"):])
+		case strings.HasPrefix(value, "string:"):
+			buf = []byte(value[len("string:"):])
+		default:
+			buf = []byte(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("argument '%s': %s", name, err)
+		}
+		args = append(args, byzcoin.Argument{Name: name, Value: buf})
+	}
+	return args, nil
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/byzcoin/bcadmin/lib"
+	"github.com/dedis/cothority/byzcoin/darc"
+	"github.com/dedis/cothority/byzcoin/darc/expression"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// darcArg returns the darc ID given as first argument, or the ID of the
+// genesis darc if there is no argument.
+func darcArg(c *cli.Context, cfg lib.Config) (darc.ID, error) {
+	if c.NArg() == 0 {
+		return cfg.GenesisDarc.GetBaseID(), nil
+	}
+	return hex.DecodeString(strings.TrimPrefix(c.Args().First(), "darc:"))
+}
+
+func darcRefs(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+	id, err := darcArg(c, cfg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := cl.GetDarcReferences(id)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "darc %x controls %d instances:\n", id, len(resp.Instances))
+	for _, iid := range resp.Instances {
+		fmt.Fprintf(c.App.Writer, "  %x\n", iid.Slice())
+	}
+	fmt.Fprintf(c.App.Writer, "%d darcs delegate to it:\n", len(resp.Darcs))
+	for _, d := range resp.Darcs {
+		fmt.Fprintf(c.App.Writer, "  %x\n", []byte(d))
+	}
+	return nil
+}
+
+// darcHistoryPage is the number of state changes of a darc whose versions are
+// fetched at once.
+const darcHistoryPage = 20
+
+func darcHistory(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+	id, err := darcArg(c, cfg)
+	if err != nil {
+		return err
+	}
+
+	// The client verifies the proofs of the versions.
+	for start := 0; ; start += darcHistoryPage {
+		resp, err := cl.GetDarcHistory(id, start, darcHistoryPage)
+		if err != nil {
+			return err
+		}
+		for _, v := range resp.Versions {
+			fmt.Fprintf(c.App.Writer, "version %d in block %d, proof verified:\n", v.Darc.Version, v.BlockIndex)
+			fmt.Fprintln(c.App.Writer, v.Darc.String())
+			if len(v.Signatures) == 0 {
+				fmt.Fprintln(c.App.Writer, "signed by: unknown, the darc has not been given as argument")
+				continue
+			}
+			var signers []string
+			for _, sig := range v.Signatures {
+				signers = append(signers, sig.Signer.String())
+			}
+			fmt.Fprintf(c.App.Writer, "signed by: %s\n", strings.Join(signers, ", "))
+		}
+		if start+darcHistoryPage >= resp.Total {
+			break
+		}
+	}
+	return nil
+}
+
+func darcShow(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+	id, err := darcArg(c, cfg)
+	if err != nil {
+		return err
+	}
+
+	d, err := cl.GetDarc(id)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, d.String())
+	delegated := d.DelegatedDarcs()
+	if len(delegated) > 0 {
+		fmt.Fprintln(c.App.Writer, "Resolved identities:")
+	}
+	seen := map[string]bool{string(id): true}
+	for _, did := range delegated {
+		printDelegation(c, cl, did, seen, "  ")
+	}
+	return nil
+}
+
+// printDelegation prints the identities that can sign for the darc id, and
+// the ones of the darcs it delegates to in turn. The darcs in seen are only
+// printed once.
+func printDelegation(c *cli.Context, cl *byzcoin.Client, id darc.ID, seen map[string]bool, indent string) {
+	name := darc.NewIdentityDarc(id).String()
+	if seen[string(id)] {
+		fmt.Fprintf(c.App.Writer, "%s%s: see above\n", indent, name)
+		return
+	}
+	seen[string(id)] = true
+	d, err := cl.GetDarc(id)
+	if err != nil {
+		fmt.Fprintf(c.App.Writer, "%s%s: not found: %s\n", indent, name, err)
+		return
+	}
+	fmt.Fprintf(c.App.Writer, "%s%s signs with \"%s\"\n", indent, name, d.Rules.GetSignExpr())
+	// Only the sign rule is used when a darc is delegated to.
+	signRules := darc.Darc{Rules: darc.Rules{List: []darc.Rule{{
+		Action: "_sign",
+		Expr:   d.Rules.GetSignExpr(),
+	}}}}
+	for _, did := range signRules.DelegatedDarcs() {
+		printDelegation(c, cl, did, seen, indent+"  ")
+	}
+}
+
+func darcSpawn(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	parent := cfg.GenesisDarc.GetBaseID()
+	if from := c.String("from"); from != "" {
+		parent, err = hex.DecodeString(strings.TrimPrefix(from, "darc:"))
+		if err != nil {
+			return err
+		}
+	}
+
+	var owners []darc.Identity
+	for _, o := range c.StringSlice("owner") {
+		id, err := darc.ParseIdentity(o)
+		if err != nil {
+			return errors.New("couldn't parse owner: " + err.Error())
+		}
+		owners = append(owners, id)
+	}
+	if len(owners) == 0 {
+		id, err := signerIdentity(c, cfg)
+		if err != nil {
+			return err
+		}
+		owners = append(owners, id)
+	}
+
+	d := darc.NewDarc(darc.InitRulesWith(owners, owners, "invoke:evolve"),
+		[]byte(c.String("desc")))
+	for _, r := range c.StringSlice("rule") {
+		action, expr, err := parseRule(r)
+		if err != nil {
+			return err
+		}
+		if err := d.Rules.AddRule(action, expr); err != nil {
+			return err
+		}
+	}
+	dBuf, err := d.ToProto()
+	if err != nil {
+		return err
+	}
+
+	instr := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(parent),
+		Spawn: &byzcoin.Spawn{
+			ContractID: byzcoin.ContractDarcID,
+			Args: []byzcoin.Argument{{
+				Name:  "darc",
+				Value: dBuf,
+			}},
+		},
+	}
+	if _, err := sendInstruction(c, cfg, cl, parent, instr); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, d.String())
+	fmt.Fprintf(c.App.Writer, "Darc ID: %x\n", d.GetBaseID())
+	return nil
+}
+
+func darcEvolve(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+	id, err := darcArg(c, cfg)
+	if err != nil {
+		return err
+	}
+
+	d, err := cl.GetDarc(id)
+	if err != nil {
+		return err
+	}
+	d2 := d.Copy()
+	if err := d2.EvolveFrom(d); err != nil {
+		return err
+	}
+	if c.IsSet("desc") {
+		d2.Description = []byte(c.String("desc"))
+	}
+	for _, a := range c.StringSlice("delete") {
+		if err := d2.Rules.DeleteRules(darc.Action(a)); err != nil {
+			return err
+		}
+	}
+	for _, r := range c.StringSlice("replace") {
+		action, expr, err := parseRule(r)
+		if err != nil {
+			return err
+		}
+		if err := d2.Rules.UpdateRule(action, expr); err != nil {
+			return err
+		}
+	}
+	for _, r := range c.StringSlice("rule") {
+		action, expr, err := parseRule(r)
+		if err != nil {
+			return err
+		}
+		if err := d2.Rules.AddRule(action, expr); err != nil {
+			return err
+		}
+	}
+	if expr := c.String("sign"); expr != "" {
+		if err := d2.Rules.UpdateSign(expression.Expr(expr)); err != nil {
+			return err
+		}
+	}
+	if expr := c.String("evolve"); expr != "" {
+		if err := d2.Rules.UpdateEvolution(expression.Expr(expr)); err != nil {
+			return err
+		}
+	}
+	d2Buf, err := d2.ToProto()
+	if err != nil {
+		return err
+	}
+
+	instr := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(id),
+		Invoke: &byzcoin.Invoke{
+			Command: byzcoin.CmdDarcEvolve,
+			Args: []byzcoin.Argument{{
+				Name:  "darc",
+				Value: d2Buf,
+			}},
+		},
+	}
+	if _, err := sendInstruction(c, cfg, cl, id, instr); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.App.Writer, d2.String())
+	return nil
+}
+
+// parseRule splits a rule given as action=expression. As actions don't
+// contain a '=', the comparisons of the expression are kept.
+func parseRule(r string) (darc.Action, expression.Expr, error) {
+	i := strings.Index(r, "=")
+	if i <= 0 {
+		return "", nil, fmt.Errorf("rule '%s' is not given as action=expression", r)
+	}
+	return darc.Action(r[:i]), expression.Expr(r[i+1:]), nil
+}
+
+// signerIdentity returns the identity of the signer given by the --key flag,
+// or the admin identity.
+func signerIdentity(c *cli.Context, cfg lib.Config) (darc.Identity, error) {
+	if c.String("key") == "" {
+		return cfg.AdminIdentity, nil
+	}
+	signer, err := loadSigner(c, cfg)
+	if err != nil {
+		return darc.Identity{}, err
+	}
+	return signer.Identity(), nil
+}
+
+// sendInstruction signs the instruction, which is verified by the darc with
+// the given base ID, and sends it to ByzCoin. The transaction is simulated
+// first, and the state changes of the simulation are returned. If the
+// --export flag is given, the instruction is stored unsigned in that file
+// instead, with the signers of the --signer flag, so that they can sign it
+// offline.
+func sendInstruction(c *cli.Context, cfg lib.Config, cl *byzcoin.Client, darcID darc.ID, instr byzcoin.Instruction) ([]byzcoin.StateChange, error) {
+	instr.Nonce = byzcoin.GenNonce()
+	instr.Index = 0
+	instr.Length = 1
+
+	fn := c.String("export")
+	if fn == "" {
+		signer, err := loadSigner(c, cfg)
+		if err != nil {
+			return nil, err
+		}
+		counters, err := cl.GetSignerCounters(signer.Identity().String())
+		if err != nil {
+			return nil, err
+		}
+		instr.SignerCounter = counters.Counters
+		if err := instr.SignBy(darcID, *signer); err != nil {
+			return nil, err
+		}
+		tx := byzcoin.ClientTransaction{
+			Instructions: []byzcoin.Instruction{instr},
+		}
+		sim, err := cl.Simulate(tx)
+		if err != nil {
+			return nil, err
+		}
+		if !sim.Accepted {
+			return nil, errors.New("transaction refused: " + sim.Error)
+		}
+		_, err = cl.AddTransactionAndWait(tx, 10)
+		if err != nil {
+			return nil, err
+		}
+		return sim.StateChanges, nil
+	}
+
+	var ids []string
+	for _, s := range c.StringSlice("signer") {
+		id, err := darc.ParseIdentity(s)
+		if err != nil {
+			return nil, errors.New("couldn't parse signer: " + err.Error())
+		}
+		instr.Signatures = append(instr.Signatures, darc.Signature{Signer: id})
+		ids = append(ids, id.String())
+	}
+	if len(ids) == 0 {
+		id, err := signerIdentity(c, cfg)
+		if err != nil {
+			return nil, err
+		}
+		instr.Signatures = []darc.Signature{{Signer: id}}
+		ids = []string{id.String()}
+	}
+	counters, err := cl.GetSignerCounters(ids...)
+	if err != nil {
+		return nil, err
+	}
+	instr.SignerCounter = counters.Counters
+	err = lib.SaveUnsignedTx(fn, lib.UnsignedTx{
+		Transaction: byzcoin.ClientTransaction{
+			Instructions: []byzcoin.Instruction{instr},
+		},
+		DarcIDs: []darc.ID{darcID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(c.App.Writer, "Exported the unsigned transaction to %s.\n", fn)
+	return nil, nil
+}
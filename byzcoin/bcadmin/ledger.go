@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/byzcoin/bcadmin/lib"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// getBlock returns the block of the ledger with the given index, or the
+// latest block if index is negative.
+func getBlock(cfg lib.Config, index int) (*skipchain.SkipBlock, error) {
+	cl := skipchain.NewClient()
+	if index >= 0 {
+		return cl.GetSingleBlockByIndex(&cfg.Roster, cfg.ByzCoinID, index)
+	}
+	reply, err := cl.GetUpdateChain(&cfg.Roster, cfg.ByzCoinID)
+	if err != nil {
+		return nil, err
+	}
+	if len(reply.Update) == 0 {
+		return nil, errors.New("no block found")
+	}
+	return reply.Update[len(reply.Update)-1], nil
+}
+
+// decodeBlock returns the header and the body of a ByzCoin block.
+func decodeBlock(sb *skipchain.SkipBlock) (*byzcoin.DataHeader, *byzcoin.DataBody, error) {
+	var header byzcoin.DataHeader
+	err := protobuf.DecodeWithConstructors(sb.Data, &header, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, nil, errors.New("couldn't unmarshal header: " + err.Error())
+	}
+	var body byzcoin.DataBody
+	err = protobuf.DecodeWithConstructors(sb.Payload, &body, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, nil, errors.New("couldn't unmarshal body: " + err.Error())
+	}
+	return &header, &body, nil
+}
+
+// indexArg returns the block index given as first argument, or -1 for the
+// latest block if there is no argument.
+func indexArg(c *cli.Context) (int, error) {
+	if c.NArg() == 0 {
+		return -1, nil
+	}
+	index, err := strconv.Atoi(c.Args().First())
+	if err != nil {
+		return 0, errors.New("couldn't parse block index: " + err.Error())
+	}
+	if index < 0 {
+		return 0, errors.New("block index must not be negative")
+	}
+	return index, nil
+}
+
+// printTxs prints the transactions of the body, with their instructions.
+func printTxs(w io.Writer, body *byzcoin.DataBody) {
+	for i, tx := range body.TxResults {
+		if tx.Accepted {
+			fmt.Fprintf(w, "  tx %d: accepted\n", i)
+		} else {
+			fmt.Fprintf(w, "  tx %d: refused: %s\n", i, tx.Error)
+		}
+		for j, instr := range tx.ClientTransaction.Instructions {
+			fmt.Fprintf(w, "    instruction %d: %s on instance %x, %d signatures\n",
+				j, instr.Action(), instr.InstanceID.Slice(), len(instr.Signatures))
+		}
+	}
+}
+
+func ledgerBlock(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, _, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+	index, err := indexArg(c)
+	if err != nil {
+		return err
+	}
+
+	sb, err := getBlock(cfg, index)
+	if err != nil {
+		return err
+	}
+	header, body, err := decodeBlock(sb)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "block %d: %x\n", sb.Index, sb.Hash)
+	fmt.Fprintf(c.App.Writer, "timestamp: %s\n", time.Unix(0, header.Timestamp))
+	fmt.Fprintf(c.App.Writer, "collection root: %x\n", header.CollectionRoot)
+	fmt.Fprintf(c.App.Writer, "transactions hash: %x\n", header.ClientTransactionHash)
+	fmt.Fprintf(c.App.Writer, "state changes hash: %x\n", header.StateChangesHash)
+	fmt.Fprintf(c.App.Writer, "%d transactions:\n", len(body.TxResults))
+	printTxs(c.App.Writer, body)
+	return nil
+}
+
+func ledgerTxs(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, _, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	return walkBlocks(c, cfg, func(sb *skipchain.SkipBlock, header *byzcoin.DataHeader, body *byzcoin.DataBody) error {
+		var accepted int
+		for _, tx := range body.TxResults {
+			if tx.Accepted {
+				accepted++
+			}
+		}
+		fmt.Fprintf(c.App.Writer, "block %d: %d accepted, %d refused\n", sb.Index,
+			accepted, len(body.TxResults)-accepted)
+		printTxs(c.App.Writer, body)
+		return nil
+	})
+}
+
+// walkBlocks calls f with every block from the --from flag up to the --to
+// flag, or up to the latest block if --to is not given.
+func walkBlocks(c *cli.Context, cfg lib.Config,
+	f func(*skipchain.SkipBlock, *byzcoin.DataHeader, *byzcoin.DataBody) error) error {
+	from := c.Int("from")
+	to := c.Int("to")
+	if from < 0 {
+		return errors.New("--from must not be negative")
+	}
+	if c.IsSet("to") && to < from {
+		return errors.New("--to must not be smaller than --from")
+	}
+
+	cl := skipchain.NewClient()
+	for next := from; !c.IsSet("to") || next <= to; {
+		// The conode returns the blocks in batches.
+		end := next + 100
+		if c.IsSet("to") && end > to+1 {
+			end = to + 1
+		}
+		blocks, err := cl.GetBlocksByIndexRange(&cfg.Roster, cfg.ByzCoinID, next, end)
+		if err != nil {
+			return err
+		}
+		if len(blocks) == 0 {
+			if next == from {
+				return fmt.Errorf("no block with index %d", from)
+			}
+			return nil
+		}
+		for _, sb := range blocks {
+			header, body, err := decodeBlock(sb)
+			if err != nil {
+				return fmt.Errorf("block %d: %s", sb.Index, err)
+			}
+			if err := f(sb, header, body); err != nil {
+				return err
+			}
+		}
+		next = blocks[len(blocks)-1].Index + 1
+	}
+	return nil
+}
+
+func ledgerInstance(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	if c.NArg() == 0 {
+		return errors.New("need the instance ID")
+	}
+	idBuf, err := hex.DecodeString(c.Args().First())
+	if err != nil {
+		return err
+	}
+	if len(idBuf) != 32 {
+		return errors.New("instance ID must be 32 bytes long")
+	}
+
+	resp, err := cl.GetProof(idBuf)
+	if err != nil {
+		return err
+	}
+	if err := resp.Proof.Verify(cfg.ByzCoinID); err != nil {
+		return err
+	}
+	if !resp.Proof.InclusionProof.Match() {
+		return errors.New("instance not found")
+	}
+	_, vs, err := resp.Proof.KeyValue()
+	if err != nil {
+		return err
+	}
+	if len(vs) < 3 {
+		return errors.New("not enough records")
+	}
+
+	fmt.Fprintf(c.App.Writer, "instance %x in block %d, proof verified\n", idBuf, resp.Proof.Latest.Index)
+	fmt.Fprintf(c.App.Writer, "contract: %s\n", vs[1])
+	fmt.Fprintf(c.App.Writer, "darc: %x\n", vs[2])
+	if fn := c.String("out"); fn != "" {
+		fmt.Fprintf(c.App.Writer, "value of %d bytes written to %s\n", len(vs[0]), fn)
+		return ioutil.WriteFile(fn, vs[0], 0644)
+	}
+	fmt.Fprintf(c.App.Writer, "value: %x\n", vs[0])
+	return nil
+}
+
+// The types below are the JSON form of the blocks written by ledger export.
+type (
+	blockJSON struct {
+		Index                 int      `json:"index"`
+		Hash                  string   `json:"hash"`
+		Timestamp             int64    `json:"timestamp"`
+		CollectionRoot        string   `json:"collection_root"`
+		ClientTransactionHash string   `json:"client_transaction_hash"`
+		StateChangesHash      string   `json:"state_changes_hash"`
+		Transactions          []txJSON `json:"transactions"`
+	}
+	txJSON struct {
+		Accepted     bool              `json:"accepted"`
+		Error        string            `json:"error,omitempty"`
+		Instructions []instructionJSON `json:"instructions"`
+	}
+	instructionJSON struct {
+		InstanceID string            `json:"instance_id"`
+		Action     string            `json:"action"`
+		Args       map[string]string `json:"args,omitempty"`
+		Signers    []string          `json:"signers"`
+	}
+)
+
+// newBlockJSON returns the JSON form of the block, with the byte slices in
+// hex.
+func newBlockJSON(sb *skipchain.SkipBlock, header *byzcoin.DataHeader, body *byzcoin.DataBody) blockJSON {
+	b := blockJSON{
+		Index:                 sb.Index,
+		Hash:                  hex.EncodeToString(sb.Hash),
+		Timestamp:             header.Timestamp,
+		CollectionRoot:        hex.EncodeToString(header.CollectionRoot),
+		ClientTransactionHash: hex.EncodeToString(header.ClientTransactionHash),
+		StateChangesHash:      hex.EncodeToString(header.StateChangesHash),
+		Transactions:          []txJSON{},
+	}
+	for _, tx := range body.TxResults {
+		t := txJSON{
+			Accepted:     tx.Accepted,
+			Error:        tx.Error,
+			Instructions: []instructionJSON{},
+		}
+		for _, instr := range tx.ClientTransaction.Instructions {
+			var args byzcoin.Arguments
+			switch instr.GetType() {
+			case byzcoin.SpawnType:
+				args = instr.Spawn.Args
+			case byzcoin.InvokeType:
+				args = instr.Invoke.Args
+			}
+			i := instructionJSON{
+				InstanceID: hex.EncodeToString(instr.InstanceID.Slice()),
+				Action:     instr.Action(),
+				Signers:    []string{},
+			}
+			if len(args) > 0 {
+				i.Args = make(map[string]string)
+				for _, a := range args {
+					i.Args[a.Name] = hex.EncodeToString(a.Value)
+				}
+			}
+			for _, sig := range instr.Signatures {
+				i.Signers = append(i.Signers, sig.Signer.String())
+			}
+			t.Instructions = append(t.Instructions, i)
+		}
+		b.Transactions = append(b.Transactions, t)
+	}
+	return b
+}
+
+func ledgerExport(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, _, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	w := c.App.Writer
+	if fn := c.String("out"); fn != "" {
+		f, err := os.Create(fn)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	return walkBlocks(c, cfg, func(sb *skipchain.SkipBlock, header *byzcoin.DataHeader, body *byzcoin.DataBody) error {
+		return enc.Encode(newBlockJSON(sb, header, body))
+	})
+}
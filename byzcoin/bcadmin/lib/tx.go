@@ -0,0 +1,63 @@
+package lib
+
+import (
+	"errors"
+	"io/ioutil"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/byzcoin/darc"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// UnsignedTx is a transaction that is exported to be signed offline. Its
+// instructions already hold their signers, with empty signatures.
+type UnsignedTx struct {
+	Transaction byzcoin.ClientTransaction
+	// DarcIDs are the base IDs of the darcs that verify the instructions,
+	// one for every instruction.
+	DarcIDs []darc.ID
+}
+
+// Complete returns true if every signer of the transaction signed it.
+func (utx UnsignedTx) Complete() bool {
+	for _, instr := range utx.Transaction.Instructions {
+		for _, sig := range instr.Signatures {
+			if len(sig.Signature) == 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// SaveUnsignedTx stores the transaction in the file fn.
+func SaveUnsignedTx(fn string, utx UnsignedTx) error {
+	if len(utx.DarcIDs) != len(utx.Transaction.Instructions) {
+		return errors.New("need one darc ID for every instruction")
+	}
+	buf, err := protobuf.Encode(&utx)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn, buf, 0644)
+}
+
+// LoadUnsignedTx reads a transaction stored by SaveUnsignedTx from the file fn.
+func LoadUnsignedTx(fn string) (*UnsignedTx, error) {
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	var utx UnsignedTx
+	err = protobuf.DecodeWithConstructors(buf, &utx,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, err
+	}
+	if len(utx.DarcIDs) != len(utx.Transaction.Instructions) {
+		return nil, errors.New("need one darc ID for every instruction")
+	}
+	return &utx, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -67,11 +68,377 @@ var cmds = cli.Commands{
 			},
 			cli.StringFlag{
 				Name:  "identity",
-				Usage: "the identity of the signer who will be allowed to access the contract (e.g. ed25519:a35020c70b8d735...0357))",
+				Usage: "the identity of the signer who will be allowed to access the contract, as type:key where type is darc, ed25519, x509ec, secp256k1 or bls (e.g. ed25519:a35020c70b8d735...0357), or an expression of identities",
 			},
 		},
 		Action: add,
 	},
+	{
+		Name:      "history",
+		Usage:     "show the state changes of an instance",
+		Aliases:   []string{"h"},
+		ArgsUsage: "instanceID",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "bc",
+				EnvVar: "BC",
+				Usage:  "the ByzCoin config to use",
+			},
+			cli.IntFlag{
+				Name:  "start",
+				Usage: "the number of state changes to skip",
+			},
+			cli.IntFlag{
+				Name:  "count",
+				Usage: "the maximum number of state changes to show, 0 for all",
+			},
+		},
+		Action: history,
+	},
+	{
+		Name:  "darc",
+		Usage: "inspect the darcs of the ledger",
+		Subcommands: []cli.Command{
+			{
+				Name:      "show",
+				Usage:     "show a darc and the identities of the darcs it delegates to",
+				Aliases:   []string{"s"},
+				ArgsUsage: "[darcID]",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use",
+					},
+				},
+				Action: darcShow,
+			},
+			{
+				Name:    "spawn",
+				Usage:   "spawn a new darc",
+				Aliases: []string{"sp"},
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use",
+					},
+					cli.StringFlag{
+						Name:  "from",
+						Usage: "the ID of the darc that spawns the new darc, the genesis darc if not given",
+					},
+					cli.StringSliceFlag{
+						Name:  "owner",
+						Usage: "an owner of the new darc, as type:key, the signer if not given",
+					},
+					cli.StringFlag{
+						Name:  "desc",
+						Usage: "the description of the new darc",
+					},
+					cli.StringSliceFlag{
+						Name:  "rule",
+						Usage: "a rule to add, as action=expression",
+					},
+				}, signFlags...),
+				Action: darcSpawn,
+			},
+			{
+				Name:      "evolve",
+				Usage:     "evolve a darc, changing its rules or description",
+				Aliases:   []string{"e"},
+				ArgsUsage: "[darcID]",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use",
+					},
+					cli.StringSliceFlag{
+						Name:  "rule",
+						Usage: "a rule to add, as action=expression",
+					},
+					cli.StringSliceFlag{
+						Name:  "replace",
+						Usage: "a rule to replace, as action=expression",
+					},
+					cli.StringSliceFlag{
+						Name:  "delete",
+						Usage: "the action of a rule to delete",
+					},
+					cli.StringFlag{
+						Name:  "sign",
+						Usage: "the new expression of the _sign rule",
+					},
+					cli.StringFlag{
+						Name:  "evolve",
+						Usage: "the new expression of the _evolve rule",
+					},
+					cli.StringFlag{
+						Name:  "desc",
+						Usage: "the new description of the darc",
+					},
+				}, signFlags...),
+				Action: darcEvolve,
+			},
+			{
+				Name:      "refs",
+				Usage:     "show the instances controlled by a darc and the darcs delegating to it",
+				Aliases:   []string{"r"},
+				ArgsUsage: "[darcID]",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use",
+					},
+				},
+				Action: darcRefs,
+			},
+			{
+				Name:      "history",
+				Usage:     "show all the versions of a darc with the signatures that authorised them",
+				Aliases:   []string{"h"},
+				ArgsUsage: "[darcID]",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use",
+					},
+				},
+				Action: darcHistory,
+			},
+		},
+	},
+	{
+		Name:  "tx",
+		Usage: "handle transactions that wait for signatures",
+		Subcommands: []cli.Command{
+			{
+				Name:      "sign",
+				Usage:     "add our signatures to a pending transaction",
+				Aliases:   []string{"s"},
+				ArgsUsage: "transactionID",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use",
+					},
+					cli.StringFlag{
+						Name:  "key",
+						Usage: "the file of the key to sign with, the admin key if not given",
+					},
+				},
+				Action: txSign,
+			},
+			{
+				Name:      "sign-offline",
+				Usage:     "add our signatures to a transaction exported with --export",
+				Aliases:   []string{"so"},
+				ArgsUsage: "file",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use, only needed for the admin key",
+					},
+					cli.StringFlag{
+						Name:  "key",
+						Usage: "the file of the key to sign with, the admin key if not given",
+					},
+				},
+				Action: txSignOffline,
+			},
+			{
+				Name:      "submit",
+				Usage:     "send a transaction exported with --export, or make it pending if signatures are missing",
+				ArgsUsage: "file",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use",
+					},
+				},
+				Action: txSubmit,
+			},
+			{
+				Name:    "list-pending",
+				Usage:   "show the transactions that wait for signatures",
+				Aliases: []string{"l"},
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use",
+					},
+				},
+				Action: txListPending,
+			},
+		},
+	},
+	{
+		Name:  "contract",
+		Usage: "send instructions to the instances of any contract",
+		Subcommands: []cli.Command{
+			{
+				Name:      "spawn",
+				Usage:     "spawn a new instance of a contract",
+				Aliases:   []string{"s"},
+				ArgsUsage: "contractID",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use",
+					},
+					cli.StringFlag{
+						Name:  "instance",
+						Usage: "the ID of the instance that spawns the new instance, the genesis darc if not given",
+					},
+					contractArgFlag,
+				}, signFlags...),
+				Action: contractSpawn,
+			},
+			{
+				Name:      "invoke",
+				Usage:     "invoke a command of an instance",
+				Aliases:   []string{"i"},
+				ArgsUsage: "command",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use",
+					},
+					cli.StringFlag{
+						Name:  "instance",
+						Usage: "the ID of the instance",
+					},
+					contractArgFlag,
+				}, signFlags...),
+				Action: contractInvoke,
+			},
+			{
+				Name:    "delete",
+				Usage:   "delete an instance",
+				Aliases: []string{"d"},
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use",
+					},
+					cli.StringFlag{
+						Name:  "instance",
+						Usage: "the ID of the instance",
+					},
+				}, signFlags...),
+				Action: contractDelete,
+			},
+		},
+	},
+	{
+		Name:  "ledger",
+		Usage: "inspect the blocks and the instances of the ledger",
+		Subcommands: []cli.Command{
+			{
+				Name:      "block",
+				Usage:     "show a block with its header and its transactions",
+				Aliases:   []string{"b"},
+				ArgsUsage: "[index]",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use",
+					},
+				},
+				Action: ledgerBlock,
+			},
+			{
+				Name:  "txs",
+				Usage: "list the transactions of a range of blocks, accepted or refused",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use",
+					},
+				}, rangeFlags...),
+				Action: ledgerTxs,
+			},
+			{
+				Name:      "instance",
+				Usage:     "show the value of an instance, with its contract and darc",
+				Aliases:   []string{"i"},
+				ArgsUsage: "instanceID",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use",
+					},
+					cli.StringFlag{
+						Name:  "out",
+						Usage: "write the value to this file instead of showing it",
+					},
+				},
+				Action: ledgerInstance,
+			},
+			{
+				Name:  "export",
+				Usage: "export a range of blocks as JSON, one block per line",
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use",
+					},
+					cli.StringFlag{
+						Name:  "out",
+						Usage: "the file to write to, the standard output if not given",
+					},
+				}, rangeFlags...),
+				Action: ledgerExport,
+			},
+		},
+	},
+}
+
+// rangeFlags are the flags of the commands that go through a range of blocks.
+var rangeFlags = []cli.Flag{
+	cli.IntFlag{
+		Name:  "from",
+		Usage: "the index of the first block",
+	},
+	cli.IntFlag{
+		Name:  "to",
+		Usage: "the index of the last block, the latest block if not given",
+	},
+}
+
+// contractArgFlag is the flag of the arguments of a contract instruction.
+var contractArgFlag = cli.StringSliceFlag{
+	Name:  "arg",
+	Usage: "an argument of the instruction, as name=value where value is a string, or hex:, uint64: or file: followed by the value",
+}
+
+// signFlags are the flags of the commands that send an instruction.
+var signFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "key",
+		Usage: "the file of the key to sign with, the admin key if not given",
+	},
+	cli.StringFlag{
+		Name:  "export",
+		Usage: "store the unsigned transaction in this file instead of sending it",
+	},
+	cli.StringSliceFlag{
+		Name:  "signer",
+		Usage: "with --export, an identity that has to sign the transaction, the signer if not given",
+	},
 }
 
 var cliApp = cli.NewApp()
@@ -248,14 +615,20 @@ func add(c *cli.Context) error {
 			},
 		},
 	}
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return err
+	}
 	instr := byzcoin.Instruction{
 		InstanceID: byzcoin.NewInstanceID(d2.GetBaseID()),
+		Nonce:      byzcoin.GenNonce(),
 		Index:      0,
 		Length:     1,
 		Invoke:     &invoke,
 		Signatures: []darc.Signature{
 			darc.Signature{Signer: signer.Identity()},
 		},
+		SignerCounter: []uint64{counters.Counters[0]},
 	}
 	err = instr.SignBy(d2.GetBaseID(), *signer)
 	if err != nil {
@@ -272,6 +645,55 @@ func add(c *cli.Context) error {
 	return nil
 }
 
+func history(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	_, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	if c.NArg() == 0 {
+		return errors.New("need the instance ID")
+	}
+	idBuf, err := hex.DecodeString(c.Args().First())
+	if err != nil {
+		return err
+	}
+	if len(idBuf) != 32 {
+		return errors.New("instance ID must be 32 bytes long")
+	}
+	id := byzcoin.NewInstanceID(idBuf)
+
+	start := c.Int("start")
+	left := c.Int("count")
+	for {
+		resp, err := cl.GetInstanceHistory(id, start, left)
+		if err != nil {
+			return err
+		}
+		for _, e := range resp.Entries {
+			sc := e.StateChange
+			fmt.Fprintf(c.App.Writer, "block %d: %s contract %s darc %x value %x\n",
+				e.BlockIndex, sc.StateAction, sc.ContractID, sc.DarcID, sc.Value)
+		}
+		start += len(resp.Entries)
+		if left > 0 {
+			left -= len(resp.Entries)
+			if left <= 0 {
+				break
+			}
+		}
+		if len(resp.Entries) == 0 || start >= resp.Total {
+			break
+		}
+	}
+	return nil
+}
+
 type configPrivate struct {
 	Owner darc.Signer
 }
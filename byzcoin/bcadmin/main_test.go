@@ -2,13 +2,18 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoin/bcadmin/lib"
+	"github.com/dedis/cothority/byzcoin/darc"
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/app"
 	"github.com/dedis/onet/log"
@@ -97,4 +102,143 @@ func TestCli(t *testing.T) {
 	require.NoError(t, err)
 	require.Contains(t, string(b.Bytes()), "Roster: tcp://127.0.0.1")
 	require.Contains(t, string(b.Bytes()), "spawn:xxx - \"ed25519:XXX\"")
+
+	log.Lvl1("history: ")
+	cfg, _, err := lib.LoadConfig(ol.(string))
+	require.NoError(t, err)
+	b = &bytes.Buffer{}
+	cliApp.Writer = b
+	cliApp.ErrWriter = b
+	args = []string{"bcadmin", "history", fmt.Sprintf("%x", cfg.GenesisDarc.GetBaseID())}
+	err = cliApp.Run(args)
+	require.NoError(t, err)
+	require.Contains(t, string(b.Bytes()), "block 0: Create contract darc")
+	require.Contains(t, string(b.Bytes()), "block 1: Update contract darc")
+
+	log.Lvl1("darc spawn: ")
+	id := darc.NewSignerEd25519(nil, nil).Identity()
+	b = &bytes.Buffer{}
+	cliApp.Writer = b
+	cliApp.ErrWriter = b
+	args = []string{"bcadmin", "darc", "spawn", "--desc", "second darc",
+		"--rule", "spawn:xxx=" + id.String()}
+	err = cliApp.Run(args)
+	require.NoError(t, err)
+	out := string(b.Bytes())
+	require.Contains(t, out, "Darc ID: ")
+	darcID := strings.TrimSpace(out[strings.Index(out, "Darc ID: ")+len("Darc ID: "):])
+
+	log.Lvl1("darc evolve: ")
+	args = []string{"bcadmin", "darc", "evolve", darcID, "--rule",
+		"invoke:foo=" + id.String(), "--replace", "spawn:xxx=" + cfg.AdminIdentity.String()}
+	err = cliApp.Run(args)
+	require.NoError(t, err)
+
+	b = &bytes.Buffer{}
+	cliApp.Writer = b
+	cliApp.ErrWriter = b
+	args = []string{"bcadmin", "darc", "show", darcID}
+	err = cliApp.Run(args)
+	require.NoError(t, err)
+	require.Contains(t, string(b.Bytes()), "invoke:foo - \""+id.String()+"\"")
+	require.Contains(t, string(b.Bytes()), "spawn:xxx - \""+cfg.AdminIdentity.String()+"\"")
+
+	log.Lvl1("darc evolve offline: ")
+	txFile := path.Join(dir, "tx.bin")
+	args = []string{"bcadmin", "darc", "evolve", darcID, "--delete", "invoke:foo",
+		"--export", txFile}
+	err = cliApp.Run(args)
+	require.NoError(t, err)
+	// The transaction is only sent once it is signed.
+	args = []string{"bcadmin", "tx", "sign-offline", txFile}
+	err = cliApp.Run(args)
+	require.NoError(t, err)
+	b = &bytes.Buffer{}
+	cliApp.Writer = b
+	cliApp.ErrWriter = b
+	args = []string{"bcadmin", "tx", "submit", txFile}
+	err = cliApp.Run(args)
+	require.NoError(t, err)
+	require.Contains(t, string(b.Bytes()), "accepted")
+
+	b = &bytes.Buffer{}
+	cliApp.Writer = b
+	cliApp.ErrWriter = b
+	args = []string{"bcadmin", "darc", "show", darcID}
+	err = cliApp.Run(args)
+	require.NoError(t, err)
+	require.NotContains(t, string(b.Bytes()), "invoke:foo")
+
+	log.Lvl1("contract spawn: ")
+	owners := []darc.Identity{cfg.AdminIdentity}
+	d := darc.NewDarc(darc.InitRules(owners, owners), []byte("contract darc"))
+	require.NoError(t, d.Rules.AddRule("delete:darc", d.Rules.GetSignExpr()))
+	dBuf, err := d.ToProto()
+	require.NoError(t, err)
+	dFile := path.Join(dir, "darc.bin")
+	require.NoError(t, ioutil.WriteFile(dFile, dBuf, 0644))
+	b = &bytes.Buffer{}
+	cliApp.Writer = b
+	cliApp.ErrWriter = b
+	args = []string{"bcadmin", "contract", "spawn", "darc", "--arg", "darc=file:" + dFile}
+	err = cliApp.Run(args)
+	require.NoError(t, err)
+	require.Contains(t, string(b.Bytes()), fmt.Sprintf("Instance ID: %x", d.GetBaseID()))
+
+	log.Lvl1("contract delete: ")
+	args = []string{"bcadmin", "contract", "delete", "--instance", fmt.Sprintf("%x", d.GetBaseID())}
+	err = cliApp.Run(args)
+	require.NoError(t, err)
+	args = []string{"bcadmin", "darc", "show", fmt.Sprintf("%x", d.GetBaseID())}
+	require.Error(t, cliApp.Run(args))
+
+	log.Lvl1("ledger: ")
+	b = &bytes.Buffer{}
+	cliApp.Writer = b
+	cliApp.ErrWriter = b
+	args = []string{"bcadmin", "ledger", "block", "1"}
+	err = cliApp.Run(args)
+	require.NoError(t, err)
+	require.Contains(t, string(b.Bytes()), "block 1: ")
+	require.Contains(t, string(b.Bytes()), "tx 0: accepted")
+	require.Contains(t, string(b.Bytes()), "invoke:evolve")
+
+	b = &bytes.Buffer{}
+	cliApp.Writer = b
+	cliApp.ErrWriter = b
+	args = []string{"bcadmin", "ledger", "instance", fmt.Sprintf("%x", cfg.GenesisDarc.GetBaseID())}
+	err = cliApp.Run(args)
+	require.NoError(t, err)
+	require.Contains(t, string(b.Bytes()), "contract: darc")
+
+	exportFile := path.Join(dir, "blocks.json")
+	args = []string{"bcadmin", "ledger", "export", "--from", "1", "--to", "2", "--out", exportFile}
+	err = cliApp.Run(args)
+	require.NoError(t, err)
+	buf, err := ioutil.ReadFile(exportFile)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(buf)), "\n")
+	require.Equal(t, 2, len(lines))
+	var block blockJSON
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &block))
+	require.Equal(t, 1, block.Index)
+	require.True(t, block.Transactions[0].Accepted)
+}
+
+func TestParseArguments(t *testing.T) {
+	args, err := parseArguments([]string{"a=text", "b=hex:0102", "c=uint64:258",
+		"d=string:hex:01", "e="})
+	require.NoError(t, err)
+	require.Equal(t, []byte("text"), args.Search("a"))
+	require.Equal(t, []byte{1, 2}, args.Search("b"))
+	require.Equal(t, []byte{2, 1, 0, 0, 0, 0, 0, 0}, args.Search("c"))
+	require.Equal(t, []byte("hex:01"), args.Search("d"))
+	require.Equal(t, 5, len(args))
+
+	_, err = parseArguments([]string{"noequal"})
+	require.Error(t, err)
+	_, err = parseArguments([]string{"a=hex:xyz"})
+	require.Error(t, err)
+	_, err = parseArguments([]string{"a=uint64:-1"})
+	require.Error(t, err)
 }
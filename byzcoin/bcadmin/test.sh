@@ -19,6 +19,12 @@ testCreateStoreRead(){
 	[ -z "$BC" ] && exit 1
     testOK ./"$APP" add spawn:xxx -identity ed25519:foo
 	testGrep "ed25519:foo" ./"$APP" show
+	testGrep "ed25519:foo" ./"$APP" darc show
+	testOK ./"$APP" darc spawn -desc test -rule spawn:xxx=ed25519:5866666666666666666666666666666666666666666666666666666666666666
+	testFail ./"$APP" contract spawn -arg noequal xxx
+	testFail ./"$APP" contract invoke update
+	testGrep "accepted" ./"$APP" ledger block 1
+	testOK ./"$APP" ledger export -out blocks.json
 }
 
 main
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/byzcoin/bcadmin/lib"
+	"github.com/dedis/cothority/byzcoin/darc"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// loadSigner returns the signer stored in the file given by the --key flag,
+// or the admin signer if the flag is not given.
+func loadSigner(c *cli.Context, cfg lib.Config) (*darc.Signer, error) {
+	if fn := c.String("key"); fn != "" {
+		return lib.LoadSigner(fn)
+	}
+	return lib.LoadKey(cfg.AdminIdentity)
+}
+
+func txSign(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	signer, err := loadSigner(c, cfg)
+	if err != nil {
+		return err
+	}
+
+	if c.NArg() == 0 {
+		return errors.New("need the transaction ID")
+	}
+	txID, err := hex.DecodeString(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	resp, err := cl.GetPendingTxs()
+	if err != nil {
+		return err
+	}
+	var tx *byzcoin.ClientTransaction
+	for _, ptx := range resp.Transactions {
+		if bytes.Equal(ptx.ID, txID) {
+			tx = &ptx.Transaction
+			break
+		}
+	}
+	if tx == nil {
+		return errors.New("unknown pending transaction")
+	}
+
+	id := signer.Identity()
+	var sigs []byzcoin.InstructionSignature
+	for i, instr := range tx.Instructions {
+		if !needsSignature(instr, id) {
+			continue
+		}
+		darcID, err := instanceDarc(cl, instr.InstanceID)
+		if err != nil {
+			return err
+		}
+		sig, err := instr.CoSign(darcID, *signer)
+		if err != nil {
+			return err
+		}
+		sigs = append(sigs, byzcoin.InstructionSignature{Index: i, Signature: sig})
+	}
+	if len(sigs) == 0 {
+		return errors.New("the transaction doesn't need a signature of " + id.String())
+	}
+
+	signResp, err := cl.SignPendingTx(txID, sigs)
+	if err != nil {
+		return err
+	}
+	if signResp.Submitted {
+		fmt.Fprintln(c.App.Writer, "Signed, the transaction has all its signatures and is submitted.")
+	} else {
+		fmt.Fprintln(c.App.Writer, "Signed, the transaction waits for other signatures.")
+	}
+	return nil
+}
+
+// needsSignature returns true if id is a signer of instr that didn't sign yet.
+func needsSignature(instr byzcoin.Instruction, id darc.Identity) bool {
+	for _, sig := range instr.Signatures {
+		if len(sig.Signature) == 0 && sig.Signer.Equal(&id) {
+			return true
+		}
+	}
+	return false
+}
+
+// instanceDarc returns the ID of the darc that controls the instance.
+func instanceDarc(cl *byzcoin.Client, id byzcoin.InstanceID) (darc.ID, error) {
+	resp, err := cl.GetProof(id.Slice())
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Proof.InclusionProof.Match() {
+		return nil, fmt.Errorf("instance %x not found", id.Slice())
+	}
+	_, values, err := resp.Proof.KeyValue()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) < 3 {
+		return nil, errors.New("invalid proof of instance")
+	}
+	return darc.ID(values[2]), nil
+}
+
+func txListPending(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	_, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := cl.GetPendingTxs()
+	if err != nil {
+		return err
+	}
+	for _, ptx := range resp.Transactions {
+		fmt.Fprintf(c.App.Writer, "transaction %x, expires %s\n", ptx.ID,
+			time.Unix(ptx.Expiry, 0).Format(time.RFC3339))
+		for i, instr := range ptx.Transaction.Instructions {
+			var signed, missing []string
+			for _, sig := range instr.Signatures {
+				if len(sig.Signature) == 0 {
+					missing = append(missing, sig.Signer.String())
+				} else {
+					signed = append(signed, sig.Signer.String())
+				}
+			}
+			fmt.Fprintf(c.App.Writer, "  instruction %d: %s on %x\n", i, instr.Action(), instr.InstanceID.Slice())
+			fmt.Fprintf(c.App.Writer, "    signed: %s\n", strings.Join(signed, ", "))
+			fmt.Fprintf(c.App.Writer, "    missing: %s\n", strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
+
+func txSignOffline(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return errors.New("need the file of the transaction")
+	}
+	fn := c.Args().First()
+	utx, err := lib.LoadUnsignedTx(fn)
+	if err != nil {
+		return err
+	}
+
+	// Only the admin key needs the config, as no conode is contacted.
+	var cfg lib.Config
+	if bcArg := c.String("bc"); bcArg != "" {
+		cfg, _, err = lib.LoadConfig(bcArg)
+		if err != nil {
+			return err
+		}
+	} else if c.String("key") == "" {
+		return errors.New("--key or --bc flag is required")
+	}
+	signer, err := loadSigner(c, cfg)
+	if err != nil {
+		return err
+	}
+
+	id := signer.Identity()
+	signed := 0
+	for i, instr := range utx.Transaction.Instructions {
+		if !needsSignature(instr, id) {
+			continue
+		}
+		sig, err := instr.CoSign(utx.DarcIDs[i], *signer)
+		if err != nil {
+			return err
+		}
+		for j := range instr.Signatures {
+			if instr.Signatures[j].Signer.Equal(&id) {
+				instr.Signatures[j] = sig
+			}
+		}
+		signed++
+	}
+	if signed == 0 {
+		return errors.New("the transaction doesn't need a signature of " + id.String())
+	}
+	if err := lib.SaveUnsignedTx(fn, *utx); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "Signed %d instructions.\n", signed)
+	return nil
+}
+
+func txSubmit(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return errors.New("--bc flag is required")
+	}
+
+	_, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	if c.NArg() == 0 {
+		return errors.New("need the file of the transaction")
+	}
+	utx, err := lib.LoadUnsignedTx(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	if utx.Complete() {
+		_, err = cl.AddTransactionAndWait(utx.Transaction, 10)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.App.Writer, "The transaction has been accepted.")
+		return nil
+	}
+	// The other signers add their signatures with "tx sign".
+	resp, err := cl.AddPendingTx(utx.Transaction)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.Writer, "The transaction waits for signatures with ID %x.\n", resp.ID)
+	return nil
+}
@@ -0,0 +1,143 @@
+package byzcoin
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+
+	"github.com/dedis/cothority/byzcoin/darc"
+	"github.com/dedis/cothority/byzcoin/darc/expression"
+)
+
+// blockContext describes the block in which the instructions are executed.
+// The darc rules can compare its attributes, so it must be the same for the
+// leader and for the nodes verifying the block.
+type blockContext struct {
+	// index of the block
+	index int
+	// timestamp of the block, as in the DataHeader
+	timestamp int64
+}
+
+// hash returns the digest of the transactions with the given hash, executed
+// in the block.
+func (bc blockContext) hash(txHash []byte) []byte {
+	h := sha256.New()
+	h.Write(txHash)
+	binary.Write(h, binary.LittleEndian, int64(bc.index))
+	binary.Write(h, binary.LittleEndian, bc.timestamp)
+	return h.Sum(nil)
+}
+
+// seconds returns the timestamp of the block as a Unix time in seconds.
+func (bc blockContext) seconds() int64 {
+	return bc.timestamp / 1e9
+}
+
+// blockCollection is the view given to the contracts. Next to the state, it
+// knows the block in which the instructions are executed.
+type blockCollection struct {
+	roCollection
+	bc blockContext
+}
+
+// lastUpdateContractID denotes the time of the last update of an instance,
+// which is stored in the collection by the service and cannot be changed by
+// instructions.
+const lastUpdateContractID = "lastupdate"
+
+// lastUpdateKey returns the key under which the time of the last update of
+// the instance is stored in the collection.
+func lastUpdateKey(iid []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("lastupdate_"))
+	h.Write(iid)
+	return h.Sum(nil)
+}
+
+// getLastUpdate returns the Unix time in seconds of the block in which the
+// instance has been changed for the last time. It returns false if the time
+// is unknown, like for the instances that haven't been changed since it is
+// stored.
+func getLastUpdate(c CollectionView, iid []byte) (int64, bool) {
+	value, _, _, err := c.GetValues(lastUpdateKey(iid))
+	if err != nil || len(value) != 8 {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(value)), true
+}
+
+// lastUpdateStateChanges returns the state changes that store the time of the
+// block as the time of the last update of the instances changed by scs. The
+// time of a removed instance is removed, too.
+func lastUpdateStateChanges(c CollectionView, scs StateChanges, bc blockContext) StateChanges {
+	var ids [][]byte
+	removed := make(map[string]bool)
+	darcs := make(map[string]darc.ID)
+	for _, sc := range scs {
+		key := string(sc.InstanceID)
+		if _, ok := removed[key]; !ok {
+			ids = append(ids, sc.InstanceID)
+		}
+		removed[key] = sc.StateAction == Remove
+		darcs[key] = sc.DarcID
+	}
+
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(bc.seconds()))
+	var out StateChanges
+	for _, iid := range ids {
+		key := lastUpdateKey(iid)
+		_, exists := getLastUpdate(c, iid)
+		switch {
+		case removed[string(iid)] && exists:
+			out = append(out, NewStateChange(Remove, NewInstanceID(key),
+				lastUpdateContractID, nil, darcs[string(iid)]))
+		case removed[string(iid)]:
+		case exists:
+			out = append(out, NewStateChange(Update, NewInstanceID(key),
+				lastUpdateContractID, buf, darcs[string(iid)]))
+		default:
+			out = append(out, NewStateChange(Create, NewInstanceID(key),
+				lastUpdateContractID, buf, darcs[string(iid)]))
+		}
+	}
+	return out
+}
+
+// blockTime returns the time of the block in which the instructions are
+// executed, in seconds since the Unix epoch. If c doesn't know the block, the
+// local time is returned.
+func blockTime(c CollectionView) int64 {
+	if bcoll, ok := c.(*blockCollection); ok {
+		return bcoll.bc.seconds()
+	}
+	return time.Now().Unix()
+}
+
+// darcAttributes returns the attributes of the block and of the instance
+// that can be used in the comparisons of darc rules:
+//   - block_index is the index of the block
+//   - block_time is the Unix time in seconds of the block
+//   - last_update is the Unix time in seconds of the block of the last
+//     change of the instance
+//
+// If c doesn't know in which block the instructions are executed, the
+// attributes are unknown.
+func darcAttributes(c CollectionView, iid InstanceID) expression.AttrFn {
+	bcoll, ok := c.(*blockCollection)
+	if !ok {
+		return nil
+	}
+	return func(name string) (int64, bool) {
+		switch name {
+		case "block_index":
+			return int64(bcoll.bc.index), true
+		case darc.TimeAttr:
+			return bcoll.bc.seconds(), true
+		case "last_update":
+			return getLastUpdate(c, iid.Slice())
+		}
+		return 0, false
+	}
+}
@@ -0,0 +1,93 @@
+package byzcoin
+
+import (
+	"testing"
+
+	"github.com/dedis/cothority/byzcoin/collection"
+	"github.com/dedis/cothority/byzcoin/darc"
+	"github.com/dedis/cothority/byzcoin/darc/expression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockContext_LastUpdate(t *testing.T) {
+	coll, err := collection.NewTrie(nil, nil, collectionFields()...)
+	require.Nil(t, err)
+	c := &roCollection{coll}
+	bc := blockContext{index: 1, timestamp: 5e9}
+	a, b := id("a"), id("b")
+	dID := darc.ID(id("darc").Slice())
+
+	// The first change of an instance creates its record, even if it is
+	// changed twice.
+	scs := lastUpdateStateChanges(c, StateChanges{
+		NewStateChange(Create, a, "dummy", nil, dID),
+		NewStateChange(Create, b, "dummy", nil, dID),
+		NewStateChange(Update, a, "dummy", nil, dID),
+	}, bc)
+	require.Equal(t, 2, len(scs))
+	require.Equal(t, lastUpdateKey(a.Slice()), scs[0].InstanceID)
+	require.Equal(t, lastUpdateKey(b.Slice()), scs[1].InstanceID)
+	for _, sc := range scs {
+		require.Equal(t, Create, sc.StateAction)
+		require.Nil(t, storeInColl(coll, &sc))
+	}
+	last, ok := getLastUpdate(c, a.Slice())
+	require.True(t, ok)
+	require.Equal(t, int64(5), last)
+
+	// The next changes update the record, and removing the instance
+	// removes it.
+	bc = blockContext{index: 2, timestamp: 7e9}
+	scs = lastUpdateStateChanges(c, StateChanges{
+		NewStateChange(Update, a, "dummy", nil, dID),
+		NewStateChange(Remove, b, "dummy", nil, dID),
+	}, bc)
+	require.Equal(t, 2, len(scs))
+	require.Equal(t, Update, scs[0].StateAction)
+	require.Equal(t, Remove, scs[1].StateAction)
+	for _, sc := range scs {
+		require.Nil(t, storeInColl(coll, &sc))
+	}
+	last, ok = getLastUpdate(c, a.Slice())
+	require.True(t, ok)
+	require.Equal(t, int64(7), last)
+	_, ok = getLastUpdate(c, b.Slice())
+	require.False(t, ok)
+}
+
+func TestBlockContext_DarcAttributes(t *testing.T) {
+	signer := darc.NewSignerEd25519(nil, nil)
+	ids := []darc.Identity{signer.Identity()}
+	d := darc.NewDarc(darc.InitRules(ids, ids), []byte("locked darc"))
+	// The owner can only spawn after block 10, and only if the darc
+	// hasn't been changed for 100 seconds.
+	expr := expression.Expr(string(d.Rules.GetSignExpr()) +
+		" & block_index >= 10 & block_time >= last_update + 100")
+	require.Nil(t, d.Rules.AddRule("spawn:dummy", expr))
+	darcBuf, err := d.ToProto()
+	require.Nil(t, err)
+
+	coll, err := collection.NewTrie(nil, nil, collectionFields()...)
+	require.Nil(t, err)
+	dID := NewInstanceID(d.GetBaseID())
+	for _, sc := range []StateChange{
+		NewStateChange(Create, dID, ContractDarcID, darcBuf, d.GetBaseID()),
+		NewStateChange(Create, NewInstanceID(lastUpdateKey(dID.Slice())),
+			lastUpdateContractID, make([]byte, 8), d.GetBaseID()),
+	} {
+		require.Nil(t, storeInColl(coll, &sc))
+	}
+	instr, err := createInstr(d.GetBaseID(), "dummy", nil, signer, 1)
+	require.Nil(t, err)
+
+	verify := func(index int, seconds int64) error {
+		bc := blockContext{index: index, timestamp: seconds * 1e9}
+		return instr.VerifyDarcSignature(&blockCollection{roCollection{coll}, bc})
+	}
+	require.NotNil(t, verify(9, 100))
+	require.NotNil(t, verify(10, 99))
+	require.Nil(t, verify(10, 100))
+
+	// Without a block, the attributes are unknown.
+	require.NotNil(t, instr.VerifyDarcSignature(&roCollection{coll}))
+}
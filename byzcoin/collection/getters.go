@@ -12,6 +12,9 @@ import (
 type Getter struct {
 	collection *Collection
 	key        []byte
+	// trie is set if the getter has been returned by a Trie, in which case
+	// collection only holds the fields.
+	trie *Trie
 }
 
 // Constructors
@@ -19,7 +22,7 @@ type Getter struct {
 // Get returns a getter object, the result of a search of a given key on the collection.
 // It takes as parameter the key we search in the collection.
 func (c *Collection) Get(key []byte) Getter {
-	return Getter{c, key}
+	return Getter{c, key, nil}
 }
 
 // Methods
@@ -27,6 +30,12 @@ func (c *Collection) Get(key []byte) Getter {
 // Record returns a Record object that correspond to the result of the key search.
 // The Record will contain a boolean "match" that is true if the search was successful and false otherwise.
 func (g Getter) Record() (Record, error) {
+	if g.trie != nil {
+		if len(g.key) == 0 {
+			return Record{}, errors.New("cannot create a record with no key")
+		}
+		return g.trie.record(g.key)
+	}
 	g.collection.Lock()
 	defer g.collection.Unlock()
 	if len(g.key) == 0 {
@@ -62,6 +71,12 @@ func (g Getter) Record() (Record, error) {
 // The location the proof points to can contains the actual key.
 // It can also contain another key, effectively proving that the key is absent from the collection.
 func (g Getter) Proof() (Proof, error) {
+	if g.trie != nil {
+		if len(g.key) == 0 {
+			return Proof{}, errors.New("cannot create a proof with no key")
+		}
+		return g.trie.proof(g.key)
+	}
 	g.collection.Lock()
 	defer g.collection.Unlock()
 	if len(g.key) == 0 {
@@ -0,0 +1,711 @@
+package collection
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/dedis/protobuf"
+)
+
+// trieCacheSize is the maximum number of nodes read from the NodeStore that
+// are kept in memory.
+const trieCacheSize = 1 << 16
+
+// NodeStore is the storage backend of a Trie. It holds the encoded nodes of
+// the tree, indexed by their label.
+type NodeStore interface {
+	// GetNode returns the encoded node with the given label, or nil if
+	// there is no such node.
+	GetNode(label []byte) ([]byte, error)
+}
+
+// Trie is a Merkle-tree with the same structure, labels and proofs as a
+// Collection, but whose nodes are loaded on demand from a NodeStore instead
+// of being kept in memory. The nodes are immutable and indexed by their
+// label, so every modification only creates new nodes. The nodes that are
+// not yet stored are kept in memory until the Trie is flushed.
+//
+// Clone returns a copy-on-write snapshot of the Trie, which makes it cheap
+// to try out modifications that might be discarded later.
+type Trie struct {
+	sync.Mutex
+	store NodeStore
+	cache *nodeCache
+	layer *trieLayer
+	root  [sha256.Size]byte
+
+	// fields are held in a collection without nodes, so that the Records
+	// and Proofs returned by the Trie can decode their values.
+	verifier *Collection
+}
+
+// trieLayer holds the nodes created by a Trie that are not in the NodeStore.
+// A layer can have a parent layer, that holds the nodes of the Trie it has
+// been cloned from.
+type trieLayer struct {
+	sync.Mutex
+	nodes  map[[sha256.Size]byte]*dump
+	parent *trieLayer
+}
+
+// nodeCache keeps the nodes read from the NodeStore. It is shared by all
+// clones of a Trie.
+type nodeCache struct {
+	sync.Mutex
+	nodes map[[sha256.Size]byte]*dump
+	size  int
+}
+
+// Constructors
+
+// NewTrie returns a Trie whose nodes are read from store. If root is nil, an
+// empty Trie is created, with the same root as an empty Collection with the
+// same fields. Else the node with the label root must be in the store. The
+// store can be nil, in which case the Trie is only held in memory and cannot
+// be flushed.
+func NewTrie(store NodeStore, root []byte, fields ...Field) (*Trie, error) {
+	t := &Trie{
+		store:    store,
+		cache:    &nodeCache{nodes: make(map[[sha256.Size]byte]*dump), size: trieCacheSize},
+		layer:    newTrieLayer(nil),
+		verifier: &Collection{fields: fields},
+	}
+
+	if root == nil {
+		placeholder := t.putPlaceholder()
+		rootNode, err := t.putBranch(placeholder, placeholder)
+		if err != nil {
+			return nil, err
+		}
+		t.root = rootNode.Label
+		return t, nil
+	}
+
+	if len(root) != sha256.Size {
+		return nil, errors.New("wrong length of root label")
+	}
+	copy(t.root[:], root)
+	if _, err := t.load(t.root); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func newTrieLayer(parent *trieLayer) *trieLayer {
+	return &trieLayer{nodes: make(map[[sha256.Size]byte]*dump), parent: parent}
+}
+
+// Getters
+
+// GetRoot returns the label of the root of the Trie.
+func (t *Trie) GetRoot() []byte {
+	t.Lock()
+	defer t.Unlock()
+	root := t.root
+	return root[:]
+}
+
+// Get returns a getter object for the given key.
+func (t *Trie) Get(key []byte) Getter {
+	return Getter{t.verifier, key, t}
+}
+
+// Keys returns the keys of all the records of the Trie, in the order of the
+// paths of the keys. It has to load every node of the Trie.
+func (t *Trie) Keys() ([][]byte, error) {
+	t.Lock()
+	defer t.Unlock()
+	var keys [][]byte
+	var walk func(label [sha256.Size]byte) error
+	walk = func(label [sha256.Size]byte) error {
+		d, err := t.load(label)
+		if err != nil {
+			return err
+		}
+		if d.leaf() {
+			if !placeholder(d) {
+				keys = append(keys, copyBytes(d.Key))
+			}
+			return nil
+		}
+		if err = walk(d.Children.Left); err != nil {
+			return err
+		}
+		return walk(d.Children.Right)
+	}
+	if err := walk(t.root); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Methods
+
+// Clone returns a snapshot of the Trie. Modifications of the clone are not
+// seen by the original Trie and the other way round. The clone shares the
+// nodes of the original, so it is cheap to create.
+func (t *Trie) Clone() *Trie {
+	t.Lock()
+	defer t.Unlock()
+	return &Trie{
+		store:    t.store,
+		cache:    t.cache,
+		layer:    newTrieLayer(t.layer),
+		root:     t.root,
+		verifier: t.verifier,
+	}
+}
+
+// Squash moves the nodes created by the clone into the Trie it has been
+// cloned from, and shares its nodes from then on, so that a clone of a
+// clone doesn't have to look up its nodes in a long chain of snapshots. The
+// content of the original Trie is not changed, but it keeps the new nodes
+// in memory until it is flushed or reset.
+func (t *Trie) Squash() {
+	t.Lock()
+	defer t.Unlock()
+	parent := t.layer.parent
+	if parent == nil {
+		return
+	}
+	t.layer.Lock()
+	parent.Lock()
+	for label, d := range t.layer.nodes {
+		parent.nodes[label] = d
+	}
+	parent.Unlock()
+	t.layer.Unlock()
+	t.layer = parent
+}
+
+// Add adds a new key with the given values. It returns an error if the key
+// is already present.
+func (t *Trie) Add(key []byte, values ...interface{}) error {
+	if len(key) == 0 {
+		return errors.New("cannot add an empty key")
+	}
+	rawValues, err := t.encode(values)
+	if err != nil {
+		return err
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	root, err := t.load(t.root)
+	if err != nil {
+		return err
+	}
+	path := sha256.Sum256(key)
+	newRoot, err := t.add(root, 0, path[:], key, rawValues)
+	if err != nil {
+		return err
+	}
+	t.root = newRoot.Label
+	return nil
+}
+
+// Set replaces the values of an existing key. Values equal to Same{} are
+// left unchanged. It returns an error if the key is not present.
+func (t *Trie) Set(key []byte, values ...interface{}) error {
+	if len(values) != len(t.verifier.fields) {
+		return errors.New("wrong number of values")
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	root, err := t.load(t.root)
+	if err != nil {
+		return err
+	}
+	path := sha256.Sum256(key)
+	newRoot, err := t.set(root, 0, path[:], key, values)
+	if err != nil {
+		return err
+	}
+	t.root = newRoot.Label
+	return nil
+}
+
+// Remove removes the key from the Trie. It returns an error if the key is
+// not present.
+func (t *Trie) Remove(key []byte) error {
+	t.Lock()
+	defer t.Unlock()
+	root, err := t.load(t.root)
+	if err != nil {
+		return err
+	}
+	path := sha256.Sum256(key)
+	newRoot, err := t.remove(root, 0, path[:], key)
+	if err != nil {
+		return err
+	}
+	t.root = newRoot.Label
+	return nil
+}
+
+// Flush gives the root of the Trie and all nodes reachable from it that are
+// not yet in the NodeStore to the store function, indexed by their label. If
+// store returns nil, the nodes are expected to be in the NodeStore and the
+// Trie only keeps them in its cache. Clones of the Trie are not affected.
+func (t *Trie) Flush(store func(root []byte, nodes map[[sha256.Size]byte][]byte) error) error {
+	t.Lock()
+	defer t.Unlock()
+	if t.store == nil {
+		return errors.New("cannot flush a trie without store")
+	}
+
+	nodes := make(map[[sha256.Size]byte][]byte)
+	if err := t.collect(t.root, nodes); err != nil {
+		return err
+	}
+	root := t.root
+	if err := store(root[:], nodes); err != nil {
+		return err
+	}
+	for label := range nodes {
+		t.cache.put(t.layer.get(label))
+	}
+	t.layer = newTrieLayer(nil)
+	return nil
+}
+
+// Reset replaces the content of the Trie by the tree with the given root,
+// whose nodes must be in the NodeStore. The nodes that have not been flushed
+// are dropped. Clones of the Trie are not affected.
+func (t *Trie) Reset(root []byte) error {
+	if len(root) != sha256.Size {
+		return errors.New("wrong length of root label")
+	}
+	var label [sha256.Size]byte
+	copy(label[:], root)
+
+	t.Lock()
+	defer t.Unlock()
+	layer := t.layer
+	t.layer = newTrieLayer(nil)
+	if _, err := t.load(label); err != nil {
+		t.layer = layer
+		return err
+	}
+	t.root = label
+	return nil
+}
+
+// SyncTrie downloads the tree with the given root from a remote source. The
+// fetch function must return the encoded nodes with the given labels, in the
+// same order. Every node is checked against its label before it is given to
+// the store function, so the source doesn't need to be trusted. The nodes
+// are fetched and stored in chunks of at most chunkSize nodes. Once it
+// returns, a Trie with this root can be created from the store.
+func SyncTrie(root []byte, chunkSize int,
+	fetch func(labels [][]byte) ([][]byte, error),
+	store func(nodes map[[sha256.Size]byte][]byte) error) error {
+	if len(root) != sha256.Size {
+		return errors.New("wrong length of root label")
+	}
+	if chunkSize <= 0 {
+		return errors.New("chunk size must be positive")
+	}
+	var rootLabel [sha256.Size]byte
+	copy(rootLabel[:], root)
+
+	queue := [][sha256.Size]byte{rootLabel}
+	seen := map[[sha256.Size]byte]bool{rootLabel: true}
+	for len(queue) > 0 {
+		chunk := queue
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		queue = queue[len(chunk):]
+
+		labels := make([][]byte, len(chunk))
+		for index := range chunk {
+			labels[index] = append([]byte{}, chunk[index][:]...)
+		}
+		bufs, err := fetch(labels)
+		if err != nil {
+			return err
+		}
+		if len(bufs) != len(chunk) {
+			return errors.New("wrong number of nodes")
+		}
+
+		nodes := make(map[[sha256.Size]byte][]byte)
+		for index, buf := range bufs {
+			d := &dump{}
+			if err = protobuf.Decode(buf, d); err != nil {
+				return err
+			}
+			if d.Label != chunk[index] || !d.consistent() {
+				return fmt.Errorf("got an invalid node for %x", chunk[index])
+			}
+			nodes[d.Label] = buf
+			if d.leaf() {
+				continue
+			}
+			for _, child := range [][sha256.Size]byte{d.Children.Left, d.Children.Right} {
+				if !seen[child] {
+					seen[child] = true
+					queue = append(queue, child)
+				}
+			}
+		}
+		if err = store(nodes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Private methods (trie) (nodes)
+
+// collect encodes the nodes of the subtree starting at label that are held
+// in the layers of the Trie. As the NodeStore only holds complete subtrees,
+// the children of a stored node don't need to be visited.
+func (t *Trie) collect(label [sha256.Size]byte, nodes map[[sha256.Size]byte][]byte) error {
+	if _, ok := nodes[label]; ok {
+		return nil
+	}
+	d := t.layer.get(label)
+	if d == nil {
+		return nil
+	}
+	buf, err := protobuf.Encode(d)
+	if err != nil {
+		return err
+	}
+	nodes[label] = buf
+	if d.leaf() {
+		return nil
+	}
+	if err = t.collect(d.Children.Left, nodes); err != nil {
+		return err
+	}
+	return t.collect(d.Children.Right, nodes)
+}
+
+// load returns the node with the given label, first looking in the layers,
+// then in the cache and finally in the NodeStore.
+func (t *Trie) load(label [sha256.Size]byte) (*dump, error) {
+	if d := t.layer.get(label); d != nil {
+		return d, nil
+	}
+	if d := t.cache.get(label); d != nil {
+		return d, nil
+	}
+	if t.store == nil {
+		return nil, fmt.Errorf("node %x not found", label)
+	}
+
+	buf, err := t.store.GetNode(label[:])
+	if err != nil {
+		return nil, err
+	}
+	if buf == nil {
+		return nil, fmt.Errorf("node %x not found", label)
+	}
+	d := &dump{}
+	if err = protobuf.Decode(buf, d); err != nil {
+		return nil, err
+	}
+	if d.Label != label || !d.consistent() {
+		return nil, fmt.Errorf("node %x is corrupted", label)
+	}
+	t.cache.put(d)
+	return d, nil
+}
+
+func (t *Trie) children(d *dump) (left *dump, right *dump, err error) {
+	left, err = t.load(d.Children.Left)
+	if err != nil {
+		return
+	}
+	right, err = t.load(d.Children.Right)
+	return
+}
+
+func (t *Trie) putLeaf(key []byte, values [][]byte) *dump {
+	d := &dump{Key: key, Values: values}
+	d.Label = (&toHash{true, key, values, [sha256.Size]byte{}, [sha256.Size]byte{}}).hash()
+	t.layer.put(d)
+	return d
+}
+
+func (t *Trie) putPlaceholder() *dump {
+	values := make([][]byte, len(t.verifier.fields))
+	for index := range t.verifier.fields {
+		values[index] = t.verifier.fields[index].Placeholder()
+	}
+	return t.putLeaf([]byte{}, values)
+}
+
+func (t *Trie) putBranch(left *dump, right *dump) (*dump, error) {
+	values := make([][]byte, len(t.verifier.fields))
+	for index := range t.verifier.fields {
+		parentValue, err := t.verifier.fields[index].Parent(left.Values[index], right.Values[index])
+		if err != nil {
+			return nil, err
+		}
+		values[index] = parentValue
+	}
+
+	d := &dump{Values: values}
+	d.Children.Left = left.Label
+	d.Children.Right = right.Label
+	d.Label = (&toHash{false, []byte{}, values, left.Label, right.Label}).hash()
+	t.layer.put(d)
+	return d, nil
+}
+
+func (t *Trie) encode(values []interface{}) ([][]byte, error) {
+	if len(values) != len(t.verifier.fields) {
+		return nil, errors.New("wrong number of values")
+	}
+	rawValues := make([][]byte, len(values))
+	for index := range values {
+		rawValues[index] = t.verifier.fields[index].Encode(values[index])
+	}
+	return rawValues, nil
+}
+
+func placeholder(d *dump) bool {
+	return d.leaf() && len(d.Key) == 0
+}
+
+// Private methods (trie) (manipulators)
+
+// The manipulators follow the same algorithms as the ones of Collection, so
+// that the same operations give the same tree. They work recursively on the
+// subtree starting at d, at the given depth, and return the new root of the
+// subtree.
+
+func (t *Trie) add(d *dump, depth int, path []byte, key []byte, values [][]byte) (*dump, error) {
+	if d.leaf() {
+		if placeholder(d) {
+			return t.putLeaf(key, values), nil
+		}
+		if bytes.Equal(d.Key, key) {
+			return nil, errors.New("key collision")
+		}
+
+		// Replace the leaf by a branch holding the leaf and a
+		// placeholder, then add the key to the branch.
+		collisionPath := sha256.Sum256(d.Key)
+		empty := t.putPlaceholder()
+		var branch *dump
+		var err error
+		if bit(collisionPath[:], depth) {
+			branch, err = t.putBranch(empty, d)
+		} else {
+			branch, err = t.putBranch(d, empty)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return t.add(branch, depth, path, key, values)
+	}
+
+	left, right, err := t.children(d)
+	if err != nil {
+		return nil, err
+	}
+	if bit(path, depth) {
+		right, err = t.add(right, depth+1, path, key, values)
+	} else {
+		left, err = t.add(left, depth+1, path, key, values)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t.putBranch(left, right)
+}
+
+func (t *Trie) set(d *dump, depth int, path []byte, key []byte, values []interface{}) (*dump, error) {
+	if d.leaf() {
+		if placeholder(d) || !bytes.Equal(d.Key, key) {
+			return nil, errors.New("key not found")
+		}
+		rawValues := make([][]byte, len(values))
+		for index := range values {
+			if _, same := values[index].(Same); same {
+				rawValues[index] = d.Values[index]
+			} else {
+				rawValues[index] = t.verifier.fields[index].Encode(values[index])
+			}
+		}
+		return t.putLeaf(d.Key, rawValues), nil
+	}
+
+	left, right, err := t.children(d)
+	if err != nil {
+		return nil, err
+	}
+	if bit(path, depth) {
+		right, err = t.set(right, depth+1, path, key, values)
+	} else {
+		left, err = t.set(left, depth+1, path, key, values)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t.putBranch(left, right)
+}
+
+func (t *Trie) remove(d *dump, depth int, path []byte, key []byte) (*dump, error) {
+	if d.leaf() {
+		if placeholder(d) || !bytes.Equal(d.Key, key) {
+			return nil, errors.New("key not found")
+		}
+		return t.putPlaceholder(), nil
+	}
+
+	left, right, err := t.children(d)
+	if err != nil {
+		return nil, err
+	}
+	if bit(path, depth) {
+		right, err = t.remove(right, depth+1, path, key)
+	} else {
+		left, err = t.remove(left, depth+1, path, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Like in Collection, a branch that only holds a leaf and a
+	// placeholder is replaced by the leaf, except for the root.
+	if depth > 0 {
+		if placeholder(left) && right.leaf() {
+			return right, nil
+		}
+		if placeholder(right) && left.leaf() {
+			return left, nil
+		}
+	}
+	return t.putBranch(left, right)
+}
+
+// Private methods (trie) (getters)
+
+func (t *Trie) record(key []byte) (Record, error) {
+	t.Lock()
+	defer t.Unlock()
+	path := sha256.Sum256(key)
+
+	cursor, err := t.load(t.root)
+	if err != nil {
+		return Record{}, err
+	}
+	for depth := 0; !cursor.leaf(); depth++ {
+		if bit(path[:], depth) {
+			cursor, err = t.load(cursor.Children.Right)
+		} else {
+			cursor, err = t.load(cursor.Children.Left)
+		}
+		if err != nil {
+			return Record{}, err
+		}
+	}
+
+	if placeholder(cursor) || !bytes.Equal(cursor.Key, key) {
+		return recordKeyMismatch(t.verifier, key), nil
+	}
+	return Record{t.verifier, 0, []byte{}, true, copyBytes(cursor.Key), copyValues(cursor.Values)}, nil
+}
+
+func (t *Trie) proof(key []byte) (Proof, error) {
+	t.Lock()
+	defer t.Unlock()
+	proof := Proof{Key: copyBytes(key), collection: t.verifier}
+	path := sha256.Sum256(key)
+
+	cursor, err := t.load(t.root)
+	if err != nil {
+		return proof, err
+	}
+	proof.Root = copyDump(cursor)
+
+	for depth := 0; !cursor.leaf(); depth++ {
+		left, right, err := t.children(cursor)
+		if err != nil {
+			return proof, err
+		}
+		proof.Steps = append(proof.Steps, step{copyDump(left), copyDump(right)})
+
+		if bit(path[:], depth) {
+			cursor = right
+		} else {
+			cursor = left
+		}
+	}
+	return proof, nil
+}
+
+// The nodes of a Trie are shared by all its clones, so the callers only get
+// copies of them.
+
+func copyBytes(b []byte) []byte {
+	return append([]byte{}, b...)
+}
+
+func copyValues(values [][]byte) [][]byte {
+	c := make([][]byte, len(values))
+	for index := range values {
+		c[index] = copyBytes(values[index])
+	}
+	return c
+}
+
+func copyDump(d *dump) dump {
+	c := dump{Values: copyValues(d.Values), Children: d.Children, Label: d.Label}
+	if d.leaf() {
+		c.Key = copyBytes(d.Key)
+	}
+	return c
+}
+
+// trieLayer
+
+func (l *trieLayer) get(label [sha256.Size]byte) *dump {
+	for ; l != nil; l = l.parent {
+		l.Lock()
+		d := l.nodes[label]
+		l.Unlock()
+		if d != nil {
+			return d
+		}
+	}
+	return nil
+}
+
+func (l *trieLayer) put(d *dump) {
+	l.Lock()
+	defer l.Unlock()
+	l.nodes[d.Label] = d
+}
+
+// nodeCache
+
+func (c *nodeCache) get(label [sha256.Size]byte) *dump {
+	c.Lock()
+	defer c.Unlock()
+	return c.nodes[label]
+}
+
+func (c *nodeCache) put(d *dump) {
+	c.Lock()
+	defer c.Unlock()
+	if len(c.nodes) >= c.size {
+		// Evict a random node, which is good enough as the nodes
+		// close to the root are read again very soon.
+		for label := range c.nodes {
+			delete(c.nodes, label)
+			break
+		}
+	}
+	c.nodes[d.Label] = d
+}
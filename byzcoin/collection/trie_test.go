@@ -0,0 +1,275 @@
+package collection
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testNodeStore map[[sha256.Size]byte][]byte
+
+func (s testNodeStore) GetNode(label []byte) ([]byte, error) {
+	var l [sha256.Size]byte
+	copy(l[:], label)
+	return s[l], nil
+}
+
+func (s testNodeStore) put(root []byte, nodes map[[sha256.Size]byte][]byte) error {
+	for label, buf := range nodes {
+		s[label] = buf
+	}
+	return nil
+}
+
+func trieTestKey(index int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(index))
+	return key
+}
+
+func TestTrieEmpty(t *testing.T) {
+	trie, err := NewTrie(nil, nil, Data{}, Data{})
+	require.Nil(t, err)
+	require.Equal(t, New(Data{}, Data{}).GetRoot(), trie.GetRoot())
+
+	record, err := trie.Get([]byte("key")).Record()
+	require.Nil(t, err)
+	require.False(t, record.Match())
+	_, err = trie.Get([]byte{}).Record()
+	require.NotNil(t, err)
+
+	require.NotNil(t, trie.Flush(testNodeStore{}.put))
+}
+
+// The Trie must give the same roots, records and proofs as a Collection
+// for the same operations.
+func TestTrieCollection(t *testing.T) {
+	coll := New(Data{})
+	trie, err := NewTrie(nil, nil, Data{})
+	require.Nil(t, err)
+
+	rnd := rand.New(rand.NewSource(0))
+	present := make(map[int]bool)
+	for i := 0; i < 1000; i++ {
+		index := rnd.Intn(200)
+		key := trieTestKey(index)
+		value := []byte{byte(i)}
+
+		switch rnd.Intn(3) {
+		case 0:
+			require.Equal(t, coll.Add(key, value) == nil, trie.Add(key, value) == nil)
+			present[index] = true
+		case 1:
+			require.Equal(t, coll.Set(key, value) == nil, trie.Set(key, value) == nil)
+		case 2:
+			require.Equal(t, coll.Remove(key) == nil, trie.Remove(key) == nil)
+			delete(present, index)
+		}
+		require.Equal(t, coll.GetRoot(), trie.GetRoot())
+	}
+
+	for index := 0; index < 200; index++ {
+		key := trieTestKey(index)
+
+		record, err := trie.Get(key).Record()
+		require.Nil(t, err)
+		require.Equal(t, present[index], record.Match())
+		if record.Match() {
+			collRecord, err := coll.Get(key).Record()
+			require.Nil(t, err)
+			values, err := record.Values()
+			require.Nil(t, err)
+			collValues, err := collRecord.Values()
+			require.Nil(t, err)
+			require.Equal(t, collValues, values)
+		}
+
+		proof, err := trie.Get(key).Proof()
+		require.Nil(t, err)
+		collProof, err := coll.Get(key).Proof()
+		require.Nil(t, err)
+		require.True(t, proof.Consistent())
+		require.Equal(t, present[index], proof.Match())
+		require.Equal(t, coll.Serialize(collProof), coll.Serialize(proof))
+	}
+}
+
+func TestTrieClone(t *testing.T) {
+	trie, err := NewTrie(nil, nil, Data{})
+	require.Nil(t, err)
+	require.Nil(t, trie.Add([]byte("a"), []byte("1")))
+
+	clone := trie.Clone()
+	require.Nil(t, clone.Add([]byte("b"), []byte("2")))
+	require.Nil(t, clone.Set([]byte("a"), []byte("3")))
+	require.Nil(t, trie.Remove([]byte("a")))
+
+	record, err := trie.Get([]byte("b")).Record()
+	require.Nil(t, err)
+	require.False(t, record.Match())
+
+	record, err = clone.Get([]byte("a")).Record()
+	require.Nil(t, err)
+	values, err := record.Values()
+	require.Nil(t, err)
+	require.Equal(t, []byte("3"), values[0])
+}
+
+func TestTrieSquash(t *testing.T) {
+	trie, err := NewTrie(nil, nil, Data{})
+	require.Nil(t, err)
+	require.Nil(t, trie.Add([]byte("a"), []byte("1")))
+
+	base := trie.Clone()
+	clone := base
+	for i := 0; i < 10; i++ {
+		next := clone.Clone()
+		require.Nil(t, next.Add(trieTestKey(i), []byte{byte(i)}))
+		next.Squash()
+		require.True(t, next.layer == base.layer)
+		clone = next
+	}
+
+	// The squashed clones don't change the content of the tries they
+	// have been cloned from.
+	record, err := base.Get(trieTestKey(0)).Record()
+	require.Nil(t, err)
+	require.False(t, record.Match())
+	for i := 0; i < 10; i++ {
+		record, err = clone.Get(trieTestKey(i)).Record()
+		require.Nil(t, err)
+		require.True(t, record.Match())
+	}
+
+	// A Trie that is not a clone is left as it is.
+	layer := trie.layer
+	trie.Squash()
+	require.True(t, trie.layer == layer)
+}
+
+func TestTrieKeys(t *testing.T) {
+	trie, err := NewTrie(nil, nil, Data{})
+	require.Nil(t, err)
+	keys, err := trie.Keys()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(keys))
+
+	present := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		key := trieTestKey(i)
+		require.Nil(t, trie.Add(key, []byte{byte(i)}))
+		present[string(key)] = true
+	}
+	require.Nil(t, trie.Remove(trieTestKey(42)))
+	delete(present, string(trieTestKey(42)))
+
+	keys, err = trie.Keys()
+	require.Nil(t, err)
+	require.Equal(t, len(present), len(keys))
+	for _, key := range keys {
+		require.True(t, present[string(key)])
+	}
+	// The order of the keys doesn't depend on the order they were added.
+	other, err := NewTrie(nil, nil, Data{})
+	require.Nil(t, err)
+	for i := 99; i >= 0; i-- {
+		if i != 42 {
+			require.Nil(t, other.Add(trieTestKey(i), []byte{byte(i)}))
+		}
+	}
+	otherKeys, err := other.Keys()
+	require.Nil(t, err)
+	require.Equal(t, keys, otherKeys)
+}
+
+func TestTrieFlush(t *testing.T) {
+	store := testNodeStore{}
+	trie, err := NewTrie(store, nil, Data{})
+	require.Nil(t, err)
+	for index := 0; index < 64; index++ {
+		require.Nil(t, trie.Add(trieTestKey(index), []byte{byte(index)}))
+	}
+	clone := trie.Clone()
+	require.Nil(t, trie.Flush(store.put))
+	root := trie.GetRoot()
+
+	// The clone still sees the nodes that have been released.
+	require.Nil(t, clone.Remove(trieTestKey(0)))
+
+	// A new trie reads everything from the store.
+	trie2, err := NewTrie(store, root, Data{})
+	require.Nil(t, err)
+	for index := 0; index < 64; index++ {
+		record, err := trie2.Get(trieTestKey(index)).Record()
+		require.Nil(t, err)
+		require.True(t, record.Match())
+	}
+	require.Nil(t, trie2.Add(trieTestKey(64), []byte{64}))
+	require.Nil(t, trie.Add(trieTestKey(64), []byte{64}))
+	require.Equal(t, trie.GetRoot(), trie2.GetRoot())
+
+	// A corrupted node is detected.
+	var rootLabel [sha256.Size]byte
+	copy(rootLabel[:], root)
+	store[rootLabel] = store[rootLabel][1:]
+	_, err = NewTrie(store, root, Data{})
+	require.NotNil(t, err)
+
+	_, err = NewTrie(store, make([]byte, sha256.Size), Data{})
+	require.NotNil(t, err)
+}
+
+func TestTrieSync(t *testing.T) {
+	remote := testNodeStore{}
+	trie, err := NewTrie(remote, nil, Data{})
+	require.Nil(t, err)
+	for index := 0; index < 100; index++ {
+		require.Nil(t, trie.Add(trieTestKey(index), []byte{byte(index)}))
+	}
+	require.Nil(t, trie.Flush(remote.put))
+	root := trie.GetRoot()
+
+	fetches := 0
+	fetch := func(labels [][]byte) ([][]byte, error) {
+		fetches++
+		require.True(t, len(labels) <= 16)
+		bufs := make([][]byte, len(labels))
+		for i, label := range labels {
+			bufs[i], _ = remote.GetNode(label)
+		}
+		return bufs, nil
+	}
+	local := testNodeStore{}
+	store := func(nodes map[[sha256.Size]byte][]byte) error {
+		return local.put(nil, nodes)
+	}
+	require.Nil(t, SyncTrie(root, 16, fetch, store))
+	require.True(t, fetches > 1)
+
+	synced, err := NewTrie(local, root, Data{})
+	require.Nil(t, err)
+	for index := 0; index < 100; index++ {
+		record, err := synced.Get(trieTestKey(index)).Record()
+		require.Nil(t, err)
+		require.True(t, record.Match())
+	}
+
+	// A wrong node is refused.
+	bad := func(labels [][]byte) ([][]byte, error) {
+		bufs, err := fetch(labels)
+		bufs[0] = bufs[0][1:]
+		return bufs, err
+	}
+	require.NotNil(t, SyncTrie(root, 16, bad, store))
+
+	// Reset moves a trie to another root.
+	empty, err := NewTrie(local, nil, Data{})
+	require.Nil(t, err)
+	require.Nil(t, empty.Reset(root))
+	require.Equal(t, root, empty.GetRoot())
+	require.NotNil(t, empty.Reset(make([]byte, sha256.Size)))
+	require.Equal(t, root, empty.GetRoot())
+}
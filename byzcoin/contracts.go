@@ -3,9 +3,11 @@ package byzcoin
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoin/collection"
 	"github.com/dedis/cothority/byzcoin/darc"
 	"github.com/dedis/cothority/byzcoin/viewchange"
 	"github.com/dedis/kyber/sign/cosi"
@@ -47,6 +49,17 @@ func loadConfigFromColl(coll CollectionView) (*ChainConfig, error) {
 	return &config, nil
 }
 
+// loadBlockConfig returns the configuration stored in coll, which applies to
+// the whole block built on top of it. It returns nil if there is no
+// configuration yet, which is the case before the genesis block.
+func loadBlockConfig(coll *collection.Trie) *ChainConfig {
+	config, err := loadConfigFromColl(&roCollection{coll})
+	if err != nil {
+		return nil
+	}
+	return config
+}
+
 // LoadDarcFromColl loads a darc which should be stored in key.
 func LoadDarcFromColl(coll CollectionView, key []byte) (*darc.Darc, error) {
 	rec, err := coll.Get(key).Record()
@@ -128,6 +141,22 @@ func invokeContractConfig(cdb CollectionView, inst Instruction, coins []Coin) (s
 		if err = newConfig.sanityCheck(); err != nil {
 			return
 		}
+		var oldConfig *ChainConfig
+		oldConfig, err = loadConfigFromColl(cdb)
+		if err != nil {
+			return
+		}
+		if newConfig.Version < oldConfig.Version {
+			err = fmt.Errorf("cannot lower the version from %d to %d",
+				oldConfig.Version, newConfig.Version)
+			return
+		}
+		if newConfig.Fees != nil {
+			if _, _, err = loadFeeCoin(cdb, newConfig.Fees.RewardCoin.Slice()); err != nil {
+				err = errors.New("invalid reward coin: " + err.Error())
+				return
+			}
+		}
 		sc = []StateChange{
 			NewStateChange(Update, NewInstanceID(nil), ContractConfigID, configBuf, darcID),
 		}
@@ -204,6 +233,12 @@ func spawnContractConfig(cdb CollectionView, inst Instruction, coins []Coin) (sc
 	interval, _ := binary.Varint(intervalBuf)
 	bsBuf := inst.Spawn.Args.Search("max_block_size")
 	maxsz, _ := binary.Varint(bsBuf)
+	snapBuf := inst.Spawn.Args.Search("snapshot_interval")
+	snapInterval, _ := binary.Varint(snapBuf)
+	// Genesis blocks without a version have been created before the
+	// version was stored.
+	versionBuf := inst.Spawn.Args.Search("version")
+	version, _ := binary.Varint(versionBuf)
 
 	rosterBuf := inst.Spawn.Args.Search("roster")
 	roster := onet.Roster{}
@@ -214,9 +249,11 @@ func spawnContractConfig(cdb CollectionView, inst Instruction, coins []Coin) (sc
 
 	// create the config to be stored by state changes
 	config := ChainConfig{
-		BlockInterval: time.Duration(interval),
-		Roster:        roster,
-		MaxBlockSize:  int(maxsz),
+		BlockInterval:    time.Duration(interval),
+		Roster:           roster,
+		MaxBlockSize:     int(maxsz),
+		SnapshotInterval: int(snapInterval),
+		Version:          Version(version),
 	}
 	if err = config.sanityCheck(); err != nil {
 		return
@@ -238,6 +275,7 @@ func spawnContractConfig(cdb CollectionView, inst Instruction, coins []Coin) (sc
 // ContractDarc accepts the following instructions:
 //   - Spawn - creates a new darc
 //   - Invoke.Evolve - evolves an existing darc
+//   - Delete - removes a darc that no instance and no other darc depend on
 func (s *Service) ContractDarc(cdb CollectionView, inst Instruction, coins []Coin) (sc []StateChange, cOut []Coin, err error) {
 	cOut = coins
 	err = inst.VerifyDarcSignature(cdb)
@@ -292,8 +330,41 @@ func (s *Service) ContractDarc(cdb CollectionView, inst Instruction, coins []Coi
 			return nil, nil, errors.New("invalid command: " + inst.Invoke.Command)
 		}
 	case DeleteType:
-		return nil, nil, errors.New("delete on a Darc instance is not supported")
+		var darcID darc.ID
+		_, _, darcID, err = cdb.GetValues(inst.InstanceID.Slice())
+		if err != nil {
+			return
+		}
+		// Before the chain stores the reverse indexes of the darcs,
+		// nothing tells whether the darc is still used.
+		if chainVersion(cdb) < versionStateIndexes {
+			err = errors.New("darcs cannot be deleted before the chain stores their references")
+			return
+		}
+		if err = checkDarcUnused(cdb, darcID); err != nil {
+			return
+		}
+		return []StateChange{
+			NewStateChange(Remove, inst.InstanceID, ContractDarcID, nil, darcID),
+		}, coins, nil
 	default:
 		return nil, nil, errors.New("unknown instruction type")
 	}
 }
+
+// checkDarcUnused returns an error if the darc with the given base ID still
+// controls an instance or if another darc delegates to it, so that it cannot
+// be deleted.
+func checkDarcUnused(cdb CollectionView, id darc.ID) error {
+	refs, _, err := getDarcRefs(cdb, id)
+	if err != nil {
+		return err
+	}
+	if len(refs.Instances) > 0 {
+		return fmt.Errorf("darc still controls %d instances", len(refs.Instances))
+	}
+	if len(refs.Darcs) > 0 {
+		return fmt.Errorf("%d darcs still delegate to this darc", len(refs.Darcs))
+	}
+	return nil
+}
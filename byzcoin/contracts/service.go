@@ -28,5 +28,6 @@ func newService(c *onet.Context) (onet.Service, error) {
 	}
 	byzcoin.RegisterContract(c, ContractValueID, ContractValue)
 	byzcoin.RegisterContract(c, ContractCoinID, ContractCoin)
+	byzcoin.RegisterContract(c, ContractWasmID, ContractWasm)
 	return s, nil
 }
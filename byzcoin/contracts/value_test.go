@@ -42,6 +42,7 @@ func TestValue_Spawn(t *testing.T) {
 					Value: myvalue,
 				}},
 			},
+			SignerCounter: []uint64{1},
 		}},
 	}
 	require.Nil(t, ctx.Instructions[0].SignBy(gDarc.GetBaseID(), signer))
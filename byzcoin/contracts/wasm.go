@@ -0,0 +1,323 @@
+package contracts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/byzcoin/darc"
+	"github.com/dedis/protobuf"
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/perlin-network/life/compiler"
+	"github.com/perlin-network/life/exec"
+)
+
+// The wasm contract stores WebAssembly code in an instance and executes it
+// in a sandboxed virtual machine. This allows to add new business logic to
+// ByzCoin without recompiling and redeploying the conodes.
+//
+// The code is executed deterministically: floating point operations are
+// refused and every executed instruction, as well as every byte copied from
+// or to the virtual machine, costs one unit of gas. If the code uses more
+// than WasmGasLimit units of gas, the instruction is refused.
+//
+// The code can import the following functions from the "env" module. All
+// pointers and lengths are i32, all functions return an i32:
+//  - byzcoin_arg_size(namePtr, nameLen) returns the size of the argument
+//    with the given name, or -1 if the argument doesn't exist
+//  - byzcoin_arg_read(namePtr, nameLen, dstPtr) copies the argument with the
+//    given name to dstPtr and returns its size
+//  - byzcoin_state_size() returns the size of the state of the instance
+//  - byzcoin_state_read(dstPtr) copies the state of the instance to dstPtr
+//    and returns its size
+//  - byzcoin_state_write(srcPtr, len) replaces the state of the instance
+//    with len bytes from srcPtr
+//  - byzcoin_get_size(keyPtr, keyLen) returns the size of the value of the
+//    instance stored under the given key, or -1 if it doesn't exist
+//  - byzcoin_get_read(keyPtr, keyLen, dstPtr) copies the value of the
+//    instance stored under the given key to dstPtr and returns its size
+//
+// Every exported function that can be called by the contract takes no
+// argument and returns an i32, where 0 means success and any other value
+// is an error code that refuses the instruction.
+
+// ContractWasmID denotes a contract that executes WebAssembly code.
+var ContractWasmID = "wasm"
+
+// WasmGasLimit is the maximum amount of gas a single instruction can use
+// when executing WebAssembly code.
+var WasmGasLimit uint64 = 10000000
+
+// wasmInitFunction is called, if it is exported, when the instance is
+// spawned. It cannot be invoked afterwards.
+const wasmInitFunction = "init"
+
+// wasmMemoryPages is the number of 64kB pages of memory available to the
+// code.
+const wasmMemoryPages = 16
+
+// wasmTableSize is the maximum number of entries in the function table.
+const wasmTableSize = 1024
+
+// wasmImportModule is the only module the code can import functions from.
+const wasmImportModule = "env"
+
+// WasmInstance is the value stored in an instance of the wasm contract.
+type WasmInstance struct {
+	// Code is the WebAssembly binary code of the contract.
+	Code []byte
+	// State is the data of the contract, it can only be changed by the
+	// code.
+	State []byte
+}
+
+// ContractWasm executes WebAssembly code stored in the instance.
+// Spawning a new instance stores the code given in the argument "code" and
+// calls the "init" function of the code, if it is exported, with the
+// arguments of the spawn instruction.
+// Invoking an instance calls the exported function with the name of the
+// command, with the arguments of the invoke instruction.
+// Deleting the instance removes it.
+func ContractWasm(cdb byzcoin.CollectionView, inst byzcoin.Instruction, c []byzcoin.Coin) (sc []byzcoin.StateChange, cOut []byzcoin.Coin, err error) {
+	cOut = c
+
+	err = inst.VerifyDarcSignature(cdb)
+	if err != nil {
+		return
+	}
+
+	var value []byte
+	var darcID darc.ID
+	value, _, darcID, err = cdb.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	switch inst.GetType() {
+	case byzcoin.SpawnType:
+		wi := WasmInstance{Code: inst.Spawn.Args.Search("code")}
+		if len(wi.Code) == 0 {
+			return nil, nil, errors.New("need code argument")
+		}
+		env := &wasmEnv{cdb: cdb, args: inst.Spawn.Args}
+		if err = env.run(wi.Code, wasmInitFunction, false); err != nil {
+			return nil, nil, err
+		}
+		wi.State = env.state
+		var wiBuf []byte
+		wiBuf, err = protobuf.Encode(&wi)
+		if err != nil {
+			return nil, nil, errors.New("couldn't encode WasmInstance: " + err.Error())
+		}
+		return []byzcoin.StateChange{
+			byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""),
+				ContractWasmID, wiBuf, darcID),
+		}, c, nil
+	case byzcoin.InvokeType:
+		var wi WasmInstance
+		if err = protobuf.Decode(value, &wi); err != nil {
+			return nil, nil, errors.New("couldn't unmarshal instance data: " + err.Error())
+		}
+		if inst.Invoke.Command == wasmInitFunction {
+			return nil, nil, errors.New("cannot invoke " + wasmInitFunction)
+		}
+		env := &wasmEnv{cdb: cdb, args: inst.Invoke.Args, state: wi.State}
+		if err = env.run(wi.Code, inst.Invoke.Command, true); err != nil {
+			return nil, nil, err
+		}
+		wi.State = env.state
+		var wiBuf []byte
+		wiBuf, err = protobuf.Encode(&wi)
+		if err != nil {
+			return nil, nil, errors.New("couldn't encode WasmInstance: " + err.Error())
+		}
+		return []byzcoin.StateChange{
+			byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+				ContractWasmID, wiBuf, darcID),
+		}, c, nil
+	case byzcoin.DeleteType:
+		return byzcoin.StateChanges{
+			byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID, ContractWasmID, nil, darcID),
+		}, c, nil
+	}
+	return nil, nil, errors.New("didn't find any instruction")
+}
+
+// wasmEnv is the environment of one execution of WebAssembly code. It
+// resolves the functions imported by the code.
+type wasmEnv struct {
+	cdb   byzcoin.CollectionView
+	args  byzcoin.Arguments
+	state []byte
+}
+
+// run executes the exported function fn of the code. If mustExist is false
+// and the code doesn't export fn, nothing is executed.
+func (env *wasmEnv) run(code []byte, fn string, mustExist bool) error {
+	if err := checkWasmImports(code); err != nil {
+		return errors.New("couldn't load wasm code: " + err.Error())
+	}
+	vm, err := exec.NewVirtualMachine(code, exec.VMConfig{
+		DefaultMemoryPages:   wasmMemoryPages,
+		MaxMemoryPages:       wasmMemoryPages,
+		DefaultTableSize:     wasmTableSize,
+		MaxTableSize:         wasmTableSize,
+		GasLimit:             WasmGasLimit,
+		DisableFloatingPoint: true,
+	}, env, &compiler.SimpleGasPolicy{GasPerInstruction: 1})
+	if err != nil {
+		return errors.New("couldn't load wasm code: " + err.Error())
+	}
+	entry, ok := vm.GetFunctionExport(fn)
+	if !ok {
+		if mustExist {
+			return errors.New("wasm code doesn't export " + fn)
+		}
+		return nil
+	}
+	ret, err := vm.Run(entry)
+	if err != nil {
+		return errors.New("wasm execution failed: " + err.Error())
+	}
+	if ret != 0 {
+		return fmt.Errorf("wasm function %s returned error code %d", fn, ret)
+	}
+	return nil
+}
+
+// checkWasmImports returns an error if the code imports anything else than
+// the host functions of wasmHostFunctions, so that the virtual machine never
+// has to resolve an unknown import.
+func checkWasmImports(code []byte) error {
+	m, err := wasm.ReadModule(bytes.NewReader(code), nil)
+	if err != nil {
+		return err
+	}
+	if m.Import == nil {
+		return nil
+	}
+	for _, entry := range m.Import.Entries {
+		if _, ok := entry.Type.(wasm.FuncImport); !ok {
+			return fmt.Errorf("cannot import %s.%s: only functions can be imported",
+				entry.ModuleName, entry.FieldName)
+		}
+		if entry.ModuleName != wasmImportModule {
+			return errors.New("unknown module: " + entry.ModuleName)
+		}
+		if _, ok := wasmHostFunctions[entry.FieldName]; !ok {
+			return errors.New("unknown function: " + entry.FieldName)
+		}
+	}
+	return nil
+}
+
+// wasmHostFunctions holds the functions the code can import, which are
+// described at the top of this file.
+var wasmHostFunctions = map[string]func(env *wasmEnv) exec.FunctionImport{
+	"byzcoin_arg_size": func(env *wasmEnv) exec.FunctionImport {
+		return func(vm *exec.VirtualMachine) int64 {
+			arg := env.args.Search(string(wasmMemory(vm, 0, 1)))
+			if arg == nil {
+				return -1
+			}
+			return int64(len(arg))
+		}
+	},
+	"byzcoin_arg_read": func(env *wasmEnv) exec.FunctionImport {
+		return func(vm *exec.VirtualMachine) int64 {
+			arg := env.args.Search(string(wasmMemory(vm, 0, 1)))
+			return wasmWrite(vm, 2, arg)
+		}
+	},
+	"byzcoin_state_size": func(env *wasmEnv) exec.FunctionImport {
+		return func(vm *exec.VirtualMachine) int64 {
+			return int64(len(env.state))
+		}
+	},
+	"byzcoin_state_read": func(env *wasmEnv) exec.FunctionImport {
+		return func(vm *exec.VirtualMachine) int64 {
+			return wasmWrite(vm, 0, env.state)
+		}
+	},
+	"byzcoin_state_write": func(env *wasmEnv) exec.FunctionImport {
+		return func(vm *exec.VirtualMachine) int64 {
+			env.state = append([]byte{}, wasmMemory(vm, 0, 1)...)
+			return int64(len(env.state))
+		}
+	},
+	"byzcoin_get_size": func(env *wasmEnv) exec.FunctionImport {
+		return func(vm *exec.VirtualMachine) int64 {
+			v, _, _, err := env.cdb.GetValues(wasmMemory(vm, 0, 1))
+			if err != nil || v == nil {
+				return -1
+			}
+			return int64(len(v))
+		}
+	},
+	"byzcoin_get_read": func(env *wasmEnv) exec.FunctionImport {
+		return func(vm *exec.VirtualMachine) int64 {
+			v, _, _, err := env.cdb.GetValues(wasmMemory(vm, 0, 1))
+			if err != nil || v == nil {
+				return -1
+			}
+			return wasmWrite(vm, 2, v)
+		}
+	},
+}
+
+// ResolveFunc returns the host functions available to the code. The imports
+// are checked by checkWasmImports before the code is loaded, so an unknown
+// import can only stop the execution if it is called.
+func (env *wasmEnv) ResolveFunc(module, field string) exec.FunctionImport {
+	fn, ok := wasmHostFunctions[field]
+	if module != wasmImportModule || !ok {
+		return func(vm *exec.VirtualMachine) int64 {
+			panic("unknown function: " + module + "." + field)
+		}
+	}
+	return fn(env)
+}
+
+// ResolveGlobal is never called, as checkWasmImports refuses the code that
+// imports globals.
+func (env *wasmEnv) ResolveGlobal(module, field string) int64 {
+	return 0
+}
+
+// wasmMemory returns the part of the memory of the virtual machine that
+// starts at the pointer given in the local ptr and whose length is given in
+// the local length of the current frame. It panics if the memory is out of bounds, which stops the
+// execution.
+func wasmMemory(vm *exec.VirtualMachine, ptr, length int) []byte {
+	locals := vm.GetCurrentFrame().Locals
+	start := int64(uint32(locals[ptr]))
+	l := int64(uint32(locals[length]))
+	if start+l > int64(len(vm.Memory)) {
+		panic("memory access out of bounds")
+	}
+	wasmChargeGas(vm, uint64(l))
+	return vm.Memory[start : start+l]
+}
+
+// wasmWrite copies data to the memory of the virtual machine, at the
+// pointer given in the local dst of the current frame, and returns the
+// length of data.
+func wasmWrite(vm *exec.VirtualMachine, dst int, data []byte) int64 {
+	start := int64(uint32(vm.GetCurrentFrame().Locals[dst]))
+	if start+int64(len(data)) > int64(len(vm.Memory)) {
+		panic("memory access out of bounds")
+	}
+	wasmChargeGas(vm, uint64(len(data)))
+	copy(vm.Memory[start:], data)
+	return int64(len(data))
+}
+
+// wasmChargeGas adds the given amount of gas to the gas used by the virtual
+// machine and stops the execution if the limit is exceeded.
+func wasmChargeGas(vm *exec.VirtualMachine, amount uint64) {
+	vm.Gas += amount
+	if vm.Config.GasLimit > 0 && vm.Gas > vm.Config.GasLimit {
+		panic("gas limit exceeded")
+	}
+}
@@ -0,0 +1,134 @@
+package contracts
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+// wasmCounter is a WebAssembly module that imports byzcoin_state_read and
+// byzcoin_state_write and exports the following functions:
+//  - increment adds one to the first byte of the state
+//  - fail returns the error code 1
+//  - loop never returns
+var wasmCounter = []byte{
+	// magic and version
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// type section: (i32)->i32, (i32, i32)->i32, ()->i32
+	0x01, 0x10, 0x03,
+	0x60, 0x01, 0x7f, 0x01, 0x7f,
+	0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f,
+	0x60, 0x00, 0x01, 0x7f,
+	// import section
+	0x02, 0x34, 0x02,
+	0x03, 'e', 'n', 'v',
+	0x12, 'b', 'y', 'z', 'c', 'o', 'i', 'n', '_', 's', 't', 'a', 't', 'e', '_', 'r', 'e', 'a', 'd',
+	0x00, 0x00,
+	0x03, 'e', 'n', 'v',
+	0x13, 'b', 'y', 'z', 'c', 'o', 'i', 'n', '_', 's', 't', 'a', 't', 'e', '_', 'w', 'r', 'i', 't', 'e',
+	0x00, 0x01,
+	// function section
+	0x03, 0x04, 0x03, 0x02, 0x02, 0x02,
+	// memory section: one page
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	// export section
+	0x07, 0x1b, 0x03,
+	0x09, 'i', 'n', 'c', 'r', 'e', 'm', 'e', 'n', 't', 0x00, 0x02,
+	0x04, 'f', 'a', 'i', 'l', 0x00, 0x03,
+	0x04, 'l', 'o', 'o', 'p', 0x00, 0x04,
+	// code section
+	0x0a, 0x2e, 0x03,
+	// increment
+	0x1d, 0x00,
+	0x41, 0x00, 0x10, 0x00, 0x1a, // state_read(0)
+	0x41, 0x00, 0x41, 0x00, 0x2d, 0x00, 0x00, // mem[0]
+	0x41, 0x01, 0x6a, 0x3a, 0x00, 0x00, // mem[0] = mem[0] + 1
+	0x41, 0x00, 0x41, 0x01, 0x10, 0x01, 0x1a, // state_write(0, 1)
+	0x41, 0x00, 0x0b,
+	// fail
+	0x04, 0x00, 0x41, 0x01, 0x0b,
+	// loop
+	0x09, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x41, 0x00, 0x0b,
+}
+
+func TestWasm_Spawn(t *testing.T) {
+	ct := newCT("spawn:wasm")
+	inst := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractWasmID,
+			Args:       byzcoin.Arguments{{Name: "code", Value: wasmCounter}},
+		},
+	}
+	require.Nil(t, inst.SignBy(gdarc.GetBaseID(), gsigner))
+
+	sc, _, err := ContractWasm(ct, inst, []byzcoin.Coin{})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(sc))
+	require.Equal(t, byzcoin.Create, sc[0].StateAction)
+	require.Equal(t, inst.DeriveID("").Slice(), sc[0].InstanceID)
+	var wi WasmInstance
+	require.Nil(t, protobuf.Decode(sc[0].Value, &wi))
+	require.Equal(t, wasmCounter, wi.Code)
+	require.Equal(t, 0, len(wi.State))
+
+	// Refuse invalid code.
+	inst.Spawn.Args = byzcoin.Arguments{{Name: "code", Value: []byte("not wasm")}}
+	require.Nil(t, inst.SignBy(gdarc.GetBaseID(), gsigner))
+	_, _, err = ContractWasm(ct, inst, []byzcoin.Coin{})
+	require.NotNil(t, err)
+
+	// Refuse code that imports an unknown function.
+	code := bytes.Replace(wasmCounter, []byte("byzcoin_state_read"),
+		[]byte("byzcoin_state_sent"), 1)
+	inst.Spawn.Args = byzcoin.Arguments{{Name: "code", Value: code}}
+	require.Nil(t, inst.SignBy(gdarc.GetBaseID(), gsigner))
+	_, _, err = ContractWasm(ct, inst, []byzcoin.Coin{})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "unknown function")
+}
+
+func TestWasm_Invoke(t *testing.T) {
+	ct := newCT("invoke:increment", "invoke:fail", "invoke:loop", "invoke:unknown")
+	wiBuf, err := protobuf.Encode(&WasmInstance{Code: wasmCounter})
+	require.Nil(t, err)
+	addr := byzcoin.InstanceID{}
+	ct.Store(addr, wiBuf, ContractWasmID, gdarc.GetBaseID())
+
+	invoke := func(cmd string) ([]byzcoin.StateChange, error) {
+		inst := byzcoin.Instruction{
+			InstanceID: addr,
+			Invoke:     &byzcoin.Invoke{Command: cmd},
+		}
+		require.Nil(t, inst.SignBy(gdarc.GetBaseID(), gsigner))
+		sc, _, err := ContractWasm(ct, inst, []byzcoin.Coin{})
+		return sc, err
+	}
+
+	for i := 1; i <= 2; i++ {
+		sc, err := invoke("increment")
+		require.Nil(t, err)
+		require.Equal(t, 1, len(sc))
+		require.Equal(t, byzcoin.Update, sc[0].StateAction)
+		var wi WasmInstance
+		require.Nil(t, protobuf.Decode(sc[0].Value, &wi))
+		require.Equal(t, []byte{byte(i)}, wi.State)
+		ct.Store(addr, sc[0].Value, ContractWasmID, gdarc.GetBaseID())
+	}
+
+	_, err = invoke("fail")
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "error code 1")
+
+	_, err = invoke("unknown")
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "doesn't export")
+
+	// The endless loop must be stopped by the gas limit.
+	_, err = invoke("loop")
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "gas")
+}
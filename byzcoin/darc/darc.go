@@ -38,22 +38,37 @@ import (
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/btcsuite/btcd/btcec"
 	"github.com/dedis/cothority"
 	"github.com/dedis/cothority/byzcoin/darc/expression"
 	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/pairing/bn256"
+	"github.com/dedis/kyber/sign/bls"
 	"github.com/dedis/kyber/sign/schnorr"
 	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/kyber/util/random"
 	"github.com/dedis/protobuf"
 )
 
 const evolve = "_evolve"
 const sign = "_sign"
 
+// blsSuite is the pairing suite of the BLS keys.
+var blsSuite = bn256.NewSuite()
+
+// TimeAttr is the attribute that holds the current time in seconds since the
+// Unix epoch. If it is known when verifying a request, it is used instead of
+// the local time to check the expiry of session keys.
+const TimeAttr = "block_time"
+
 // GetDarc is a callback function that we expect the user of this library to
 // supply in some of our methods. The user is free to choose how he/she wants
 // to store the darc. Hence, during verification, we need a way to retrieve an
@@ -192,6 +207,29 @@ func (d Darc) GetBaseID() ID {
 	return d.BaseID
 }
 
+// DelegatedDarcs returns the IDs of the darcs that the rules of the darc
+// delegate to with a darc identity, in the order of the rules and without
+// duplicates.
+func (d Darc) DelegatedDarcs() []ID {
+	var ids []ID
+	seen := make(map[string]bool)
+	Y := expression.InitParser(func(s string) bool {
+		if strings.HasPrefix(s, "darc:") && !seen[s] {
+			seen[s] = true
+			if id, err := hex.DecodeString(s[5:]); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		return true
+	})
+	for _, rule := range d.Rules.List {
+		// An invalid expression still delegates to the darcs found
+		// before the error.
+		expression.Evaluate(Y, rule.Expr)
+	}
+	return ids
+}
+
 // NewRules creates an empty Rules.
 func NewRules() Rules {
 	return Rules{[]Rule{}}
@@ -418,9 +456,16 @@ func (r *Request) Verify(d *Darc) error {
 // argument. This function will ignore darcs in Darc.VerificationDarcs, please
 // use Darc.Verify if you wish to use it.
 func (r *Request) VerifyWithCB(d *Darc, getDarc GetDarc) error {
-	if len(r.Signatures) == 0 {
-		return errors.New("no signatures - nothing to verify")
-	}
+	return r.VerifyWithAttrs(d, getDarc, nil)
+}
+
+// VerifyWithAttrs is like VerifyWithCB, but the attributes used in the
+// comparisons of the expression are looked up with attrFn. The session keys
+// must be allowed to sign the action of the request and are checked against
+// the time given by the TimeAttr attribute, or the local time if it is
+// unknown. An identity with an empty signature did not sign the request: it
+// is skipped and doesn't count for the expression.
+func (r *Request) VerifyWithAttrs(d *Darc, getDarc GetDarc, attrFn expression.AttrFn) error {
 	if len(r.Signatures) != len(r.Identities) {
 		return fmt.Errorf("signatures and identities have unequal length - %d != %d",
 			len(r.Signatures), len(r.Identities))
@@ -432,14 +477,27 @@ func (r *Request) VerifyWithCB(d *Darc, getDarc GetDarc) error {
 	if !d.Rules.Contains(r.Action) {
 		return fmt.Errorf("VerifyWithCB: action '%v' does not exist", r.Action)
 	}
+	now := time.Now().Unix()
+	if attrFn != nil {
+		if t, ok := attrFn(TimeAttr); ok {
+			now = t
+		}
+	}
 	digest := r.Hash()
+	var validIDs []string
 	for i, id := range r.Identities {
-		if err := id.Verify(digest, r.Signatures[i]); err != nil {
+		if len(r.Signatures[i]) == 0 {
+			continue
+		}
+		if err := id.verifyAction(digest, r.Signatures[i], r.Action, now); err != nil {
 			return err
 		}
+		validIDs = append(validIDs, id.ruleStrings()...)
+	}
+	if len(validIDs) == 0 {
+		return errors.New("no signatures - nothing to verify")
 	}
-	validIDs := r.GetIdentityStrings()
-	err := EvalExpr(d.Rules.Get(r.Action), getDarc, validIDs...)
+	err := EvalExprWithAttrs(d.Rules.Get(r.Action), getDarc, attrFn, validIDs...)
 	if err != nil {
 		return err
 	}
@@ -537,6 +595,7 @@ func verifyOneEvolution(newDarc, prevDarc *Darc, getDarc func(string, bool) *Dar
 	if err := EvalExprWithSigs(
 		prevDarc.Rules.GetEvolutionExpr(),
 		getDarc,
+		evolve,
 		newDarc.Signatures...); err != nil {
 		return err
 	}
@@ -555,8 +614,9 @@ func verifyOneEvolution(newDarc, prevDarc *Darc, getDarc func(string, bool) *Dar
 
 	// perform the verification
 	digest := req.Hash()
+	now := time.Now().Unix()
 	for _, sig := range newDarc.Signatures {
-		if err := sig.Signer.Verify(digest, sig.Signature); err != nil {
+		if err := sig.Signer.verifyAction(digest, sig.Signature, evolve, now); err != nil {
 			return err
 		}
 	}
@@ -574,11 +634,15 @@ func verifyEvolutionRecursive(newDarc, prevDarc *Darc, getDarc func(string, bool
 }
 
 // EvalExprWithSigs is a simple wrapper around EvalExpr that extracts Signer
-// from Signature.
-func EvalExprWithSigs(expr expression.Expr, getDarc GetDarc, sigs ...Signature) error {
-	signers := make([]string, len(sigs))
-	for i, sig := range sigs {
-		signers[i] = sig.Signer.String()
+// from Signature. The signatures of session keys whose certificate doesn't
+// allow the action are ignored.
+func EvalExprWithSigs(expr expression.Expr, getDarc GetDarc, a Action, sigs ...Signature) error {
+	var signers []string
+	for _, sig := range sigs {
+		if sig.Signer.Type() == 3 && !sig.Signer.Session.Allows(a) {
+			continue
+		}
+		signers = append(signers, sig.Signer.ruleStrings()...)
 	}
 	if err := EvalExpr(expr, getDarc, signers...); err != nil {
 		return err
@@ -589,7 +653,15 @@ func EvalExprWithSigs(expr expression.Expr, getDarc GetDarc, sigs ...Signature)
 // EvalExpr checks whether the expression evaluates to true given a list of
 // identities.
 func EvalExpr(expr expression.Expr, getDarc GetDarc, ids ...string) error {
-	Y := expression.InitParser(func(s string) bool {
+	return EvalExprWithAttrs(expr, getDarc, nil, ids...)
+}
+
+// EvalExprWithAttrs checks whether the expression evaluates to true given a
+// list of identities, where the attributes used in comparisons are looked up
+// with attrFn. The same attributes are used in the expressions of delegated
+// darcs.
+func EvalExprWithAttrs(expr expression.Expr, getDarc GetDarc, attrFn expression.AttrFn, ids ...string) error {
+	Y := expression.InitParserWithAttrs(func(s string) bool {
 		if strings.HasPrefix(s, "darc") {
 			// getDarc is responsible for returning the latest Darc
 			d := getDarc(s, true)
@@ -605,7 +677,7 @@ func EvalExpr(expr expression.Expr, getDarc GetDarc, ids ...string) error {
 			}
 			// Recursively evaluate the sign expression until we
 			// find the final signer with a ed25519 key.
-			if err := EvalExpr(d.Rules.GetSignExpr(), getDarc, ids...); err != nil {
+			if err := EvalExprWithAttrs(d.Rules.GetSignExpr(), getDarc, attrFn, ids...); err != nil {
 				return false
 			}
 			return true
@@ -616,7 +688,7 @@ func EvalExpr(expr expression.Expr, getDarc GetDarc, ids ...string) error {
 			}
 		}
 		return false
-	})
+	}, attrFn)
 	res, err := expression.Evaluate(Y, expr)
 	if err != nil {
 		return fmt.Errorf("evaluation failed on '%s' with error: %v", expr, err)
@@ -635,6 +707,12 @@ func (s Signer) Type() int {
 		return 1
 	case s.X509EC != nil:
 		return 2
+	case s.Session != nil:
+		return 3
+	case s.Secp256k1 != nil:
+		return 4
+	case s.BLS != nil:
+		return 5
 	default:
 		return -1
 	}
@@ -648,6 +726,13 @@ func (s Signer) Identity() Identity {
 		return NewIdentityEd25519(s.Ed25519.Point)
 	case 2:
 		return NewIdentityX509EC(s.X509EC.Point)
+	case 3:
+		id := s.Session.Identity
+		return Identity{Session: &id}
+	case 4:
+		return NewIdentitySecp256k1(s.Secp256k1.Point)
+	case 5:
+		return NewIdentityBLS(s.BLS.Point)
 	default:
 		return Identity{}
 	}
@@ -665,6 +750,12 @@ func (s Signer) Sign(msg []byte) ([]byte, error) {
 		return s.Ed25519.Sign(msg)
 	case 2:
 		return s.X509EC.Sign(msg)
+	case 3:
+		return schnorr.Sign(cothority.Suite, s.Session.Secret, msg)
+	case 4:
+		return s.Secp256k1.Sign(msg)
+	case 5:
+		return s.BLS.Sign(msg)
 	default:
 		return nil, errors.New("unknown signer type")
 	}
@@ -675,7 +766,15 @@ func (s Signer) GetPrivate() (kyber.Scalar, error) {
 	switch s.Type() {
 	case 1:
 		return s.Ed25519.Secret, nil
-	case 0, 2:
+	case 3:
+		return s.Session.Secret, nil
+	case 5:
+		secret := blsSuite.G2().Scalar()
+		if err := secret.UnmarshalBinary(s.BLS.Secret); err != nil {
+			return nil, err
+		}
+		return secret, nil
+	case 0, 2, 4:
 		return nil, errors.New("signer lacks a private key")
 	default:
 		return nil, errors.New("signer is of unknown type")
@@ -695,6 +794,12 @@ func (id Identity) Equal(id2 *Identity) bool {
 		return id.Ed25519.Equal(id2.Ed25519)
 	case 2:
 		return id.X509EC.Equal(id2.X509EC)
+	case 3:
+		return id.Session.Equal(id2.Session)
+	case 4:
+		return id.Secp256k1.Equal(id2.Secp256k1)
+	case 5:
+		return id.BLS.Equal(id2.BLS)
 	}
 	return false
 }
@@ -709,6 +814,12 @@ func (id Identity) Type() int {
 		return 1
 	case id.X509EC != nil:
 		return 2
+	case id.Session != nil:
+		return 3
+	case id.Secp256k1 != nil:
+		return 4
+	case id.BLS != nil:
+		return 5
 	}
 	return -1
 }
@@ -722,6 +833,12 @@ func (id Identity) TypeString() string {
 		return "ed25519"
 	case 2:
 		return "x509ec"
+	case 3:
+		return "session"
+	case 4:
+		return "secp256k1"
+	case 5:
+		return "bls"
 	default:
 		return "No identity"
 	}
@@ -736,14 +853,99 @@ func (id Identity) String() string {
 		return fmt.Sprintf("%s:%s", id.TypeString(), id.Ed25519.Point.String())
 	case 2:
 		return fmt.Sprintf("%s:%x", id.TypeString(), id.X509EC.Public)
+	case 3:
+		return fmt.Sprintf("%s:%s", id.TypeString(), id.Session.Point.String())
+	case 4:
+		return fmt.Sprintf("%s:%x", id.TypeString(), id.Secp256k1.Public)
+	case 5:
+		publics := make([]string, len(id.BLS.Publics))
+		for i, public := range id.BLS.Publics {
+			publics[i] = hex.EncodeToString(public)
+		}
+		return fmt.Sprintf("%s:%s", id.TypeString(), strings.Join(publics, "+"))
 	default:
 		return "No identity"
 	}
 }
 
+// ruleStrings returns the strings of the identity that are matched against
+// the ids in the expressions of the rules. A session key signs in the name of
+// its delegator, and aggregated BLS keys sign for every key.
+func (id Identity) ruleStrings() []string {
+	switch id.Type() {
+	case 3:
+		return id.Session.Delegator.ruleStrings()
+	case 5:
+		res := make([]string, len(id.BLS.Publics))
+		for i, public := range id.BLS.Publics {
+			res[i] = NewIdentityBLS(public).String()
+		}
+		return res
+	}
+	return []string{id.String()}
+}
+
+// ParseIdentity returns the identity given by its string representation, as
+// returned by Identity.String. Session keys cannot be parsed, as their string
+// doesn't hold the certificate.
+func ParseIdentity(in string) (Identity, error) {
+	fields := strings.SplitN(in, ":", 2)
+	if len(fields) != 2 {
+		return Identity{}, errors.New("identity must be of the form type:key")
+	}
+	if fields[0] == "bls" {
+		var publics [][]byte
+		for _, h := range strings.Split(fields[1], "+") {
+			public, err := hex.DecodeString(h)
+			if err != nil {
+				return Identity{}, err
+			}
+			publics = append(publics, public)
+		}
+		id := NewIdentityBLS(publics...)
+		if _, err := id.BLS.points(); err != nil {
+			return Identity{}, err
+		}
+		return id, nil
+	}
+
+	buf, err := hex.DecodeString(fields[1])
+	if err != nil {
+		return Identity{}, err
+	}
+	switch fields[0] {
+	case "darc":
+		return NewIdentityDarc(buf), nil
+	case "ed25519":
+		point := cothority.Suite.Point()
+		if err := point.UnmarshalBinary(buf); err != nil {
+			return Identity{}, err
+		}
+		return NewIdentityEd25519(point), nil
+	case "x509ec":
+		if _, err := x509.ParsePKIXPublicKey(buf); err != nil {
+			return Identity{}, err
+		}
+		return NewIdentityX509EC(buf), nil
+	case "secp256k1":
+		if _, err := btcec.ParsePubKey(buf, btcec.S256()); err != nil {
+			return Identity{}, err
+		}
+		return NewIdentitySecp256k1(buf), nil
+	}
+	return Identity{}, fmt.Errorf("unknown identity type '%s'", fields[0])
+}
+
 // Verify returns nil if the signature is correct, or an error if something
-// went wrong.
+// went wrong. The certificate of a session key must not be expired, but its
+// actions are only checked when verifying a request.
 func (id Identity) Verify(msg, sig []byte) error {
+	return id.VerifyAt(msg, sig, time.Now().Unix())
+}
+
+// VerifyAt is like Verify, but the expiry of a session key is checked against
+// the time now, given in seconds since the Unix epoch.
+func (id Identity) VerifyAt(msg, sig []byte, now int64) error {
 	switch id.Type() {
 	case 0:
 		return errors.New("cannot verify a darc-signature")
@@ -751,11 +953,26 @@ func (id Identity) Verify(msg, sig []byte) error {
 		return id.Ed25519.Verify(msg, sig)
 	case 2:
 		return id.X509EC.Verify(msg, sig)
+	case 3:
+		return id.Session.Verify(msg, sig, now)
+	case 4:
+		return id.Secp256k1.Verify(msg, sig)
+	case 5:
+		return id.BLS.Verify(msg, sig)
 	default:
 		return errors.New("unknown identity")
 	}
 }
 
+// verifyAction is like Verify, but a session key must also be allowed to
+// sign the action, and its certificate must be valid at the time now.
+func (id Identity) verifyAction(msg, sig []byte, a Action, now int64) error {
+	if id.Type() == 3 && !id.Session.Allows(a) {
+		return fmt.Errorf("session key is not allowed to sign action '%v'", a)
+	}
+	return id.VerifyAt(msg, sig, now)
+}
+
 // NewIdentityDarc creates a new darc identity struct given a darc ID.
 func NewIdentityDarc(id ID) Identity {
 	return Identity{
@@ -804,6 +1021,258 @@ func (idkc IdentityX509EC) Equal(idkc2 *IdentityX509EC) bool {
 	return bytes.Compare(idkc.Public, idkc2.Public) == 0
 }
 
+// NewIdentitySecp256k1 creates a new secp256k1 identity struct given a public
+// key in the SEC1 format.
+func NewIdentitySecp256k1(public []byte) Identity {
+	return Identity{
+		Secp256k1: &IdentitySecp256k1{
+			Public: public,
+		},
+	}
+}
+
+// Equal returns true if both IdentitySecp256k1 point to the same data.
+func (ids IdentitySecp256k1) Equal(ids2 *IdentitySecp256k1) bool {
+	return bytes.Equal(ids.Public, ids2.Public)
+}
+
+// secp256k1HalfOrder is used to refuse the signatures that are not in the
+// canonical low-S form.
+var secp256k1HalfOrder = new(big.Int).Rsh(btcec.S256().N, 1)
+
+// Verify returns nil if sig is a signature of the sha256 digest of msg. The
+// signature is given as R followed by S, both on 32 bytes, and S must be in
+// the lower half of the order of the curve.
+func (ids IdentitySecp256k1) Verify(msg, sig []byte) error {
+	public, err := btcec.ParsePubKey(ids.Public, btcec.S256())
+	if err != nil {
+		return err
+	}
+	if len(sig) != 64 {
+		return errors.New("secp256k1 signature must have 64 bytes")
+	}
+	s := &btcec.Signature{
+		R: new(big.Int).SetBytes(sig[:32]),
+		S: new(big.Int).SetBytes(sig[32:]),
+	}
+	if s.S.Cmp(secp256k1HalfOrder) > 0 {
+		return errors.New("secp256k1 signature is not canonical")
+	}
+	digest := sha256.Sum256(msg)
+	if !s.Verify(digest[:], public) {
+		return errors.New("Wrong signature")
+	}
+	return nil
+}
+
+// NewIdentityBLS creates a new BLS identity struct given the public keys. If
+// there is more than one key, it can only be used with an aggregated
+// signature, see AggregateSignaturesBLS. The keys are sorted, so that the
+// same keys always give the same identity, whatever their order.
+func NewIdentityBLS(publics ...[]byte) Identity {
+	sorted := append([][]byte{}, publics...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+	return Identity{
+		BLS: &IdentityBLS{
+			Publics: sorted,
+		},
+	}
+}
+
+// AggregateIdentitiesBLS returns the BLS identity of all the keys of the
+// given BLS identities. An instruction can then be signed by all the keys
+// with a single aggregated signature.
+func AggregateIdentitiesBLS(ids ...Identity) (Identity, error) {
+	var publics [][]byte
+	for _, id := range ids {
+		if id.Type() != 5 {
+			return Identity{}, errors.New("only BLS identities can be aggregated")
+		}
+		publics = append(publics, id.BLS.Publics...)
+	}
+	agg := NewIdentityBLS(publics...)
+	if _, err := agg.BLS.points(); err != nil {
+		return Identity{}, err
+	}
+	return agg, nil
+}
+
+// AggregateSignaturesBLS returns the aggregation of the signatures created by
+// the BLS signers of the keys of an aggregated identity.
+func AggregateSignaturesBLS(sigs ...[]byte) ([]byte, error) {
+	agg := blsSuite.G1().Point().Null()
+	for _, sig := range sigs {
+		s := blsSuite.G1().Point()
+		if err := s.UnmarshalBinary(sig); err != nil {
+			return nil, err
+		}
+		agg.Add(agg, s)
+	}
+	return agg.MarshalBinary()
+}
+
+// Equal returns true if both IdentityBLS hold the same keys.
+func (idb IdentityBLS) Equal(idb2 *IdentityBLS) bool {
+	if len(idb.Publics) != len(idb2.Publics) {
+		return false
+	}
+	for i := range idb.Publics {
+		if !bytes.Equal(idb.Publics[i], idb2.Publics[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// points returns the public keys, which must be valid, different and sorted.
+// Unsorted keys are refused, as the string of the identity, which is used to
+// look up its signer counter, depends on their order.
+func (idb IdentityBLS) points() ([]kyber.Point, error) {
+	if len(idb.Publics) == 0 {
+		return nil, errors.New("no BLS public key")
+	}
+	points := make([]kyber.Point, len(idb.Publics))
+	for i, public := range idb.Publics {
+		if i > 0 {
+			switch bytes.Compare(idb.Publics[i-1], public) {
+			case 0:
+				return nil, errors.New("duplicate BLS public key")
+			case 1:
+				return nil, errors.New("BLS public keys are not sorted")
+			}
+		}
+		points[i] = blsSuite.G2().Point()
+		if err := points[i].UnmarshalBinary(public); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+// hashablePoint is implemented by the points of the bn256 curve, which can
+// be derived from a message.
+type hashablePoint interface {
+	Hash([]byte) kyber.Point
+}
+
+// blsMessage returns the message that is signed by the BLS key public. The
+// key is appended to the message, so that the aggregated keys cannot be
+// chosen to cancel each other.
+func blsMessage(msg, public []byte) []byte {
+	return append(append([]byte{}, msg...), public...)
+}
+
+// Verify returns nil if sig is the signature of msg by the key, or the
+// aggregation of the signatures of msg by all the keys.
+func (idb IdentityBLS) Verify(msg, sig []byte) error {
+	points, err := idb.points()
+	if err != nil {
+		return err
+	}
+	s := blsSuite.G1().Point()
+	if err := s.UnmarshalBinary(sig); err != nil {
+		return err
+	}
+	// e(sig, g2) must be the product of e(H(msg_i), public_i), the group
+	// GT being written additively.
+	right := blsSuite.Pair(s, blsSuite.G2().Point().Base())
+	left := blsSuite.GT().Point().Null()
+	for i, point := range points {
+		hm := blsSuite.G1().Point().(hashablePoint).Hash(blsMessage(msg, idb.Publics[i]))
+		left.Add(left, blsSuite.Pair(hm, point))
+	}
+	if !left.Equal(right) {
+		return errors.New("Wrong signature")
+	}
+	return nil
+}
+
+// NewIdentitySession creates a session identity for the public key point,
+// with a certificate signed by the delegator that allows the key to sign the
+// actions until expiry, given in seconds since the Unix epoch.
+func NewIdentitySession(delegator Signer, point kyber.Point, expiry int64, actions ...Action) (Identity, error) {
+	ids := &IdentitySession{
+		Point:     point,
+		Delegator: delegator.Identity(),
+		Expiry:    expiry,
+		Actions:   actions,
+	}
+	if err := ids.checkDelegator(); err != nil {
+		return Identity{}, err
+	}
+	var err error
+	ids.Signature, err = delegator.Sign(ids.Hash())
+	if err != nil {
+		return Identity{}, err
+	}
+	return Identity{Session: ids}, nil
+}
+
+// Hash returns the digest of the certificate, which is signed by the
+// delegator.
+func (ids IdentitySession) Hash() []byte {
+	h := sha256.New()
+	if ids.Point != nil {
+		h.Write([]byte(ids.Point.String()))
+	}
+	h.Write([]byte(ids.Delegator.String()))
+	binary.Write(h, binary.LittleEndian, ids.Expiry)
+	for _, a := range ids.Actions {
+		h.Write([]byte(a))
+		h.Write([]byte{0})
+	}
+	return h.Sum(nil)
+}
+
+// Equal returns true if both IdentitySession hold the same key and
+// certificate.
+func (ids IdentitySession) Equal(ids2 *IdentitySession) bool {
+	return bytes.Equal(ids.Hash(), ids2.Hash()) &&
+		bytes.Equal(ids.Signature, ids2.Signature)
+}
+
+// Allows returns true if the certificate allows the session key to sign the
+// action.
+func (ids IdentitySession) Allows(a Action) bool {
+	for _, allowed := range ids.Actions {
+		if allowed == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify returns nil if the certificate is correctly signed and not expired
+// at the time now, given in seconds since the Unix epoch, and if the
+// signature of the session key is correct. The actions are not checked, see
+// Allows.
+func (ids IdentitySession) Verify(msg, sig []byte, now int64) error {
+	if ids.Point == nil {
+		return errors.New("session key is missing")
+	}
+	if err := ids.checkDelegator(); err != nil {
+		return err
+	}
+	if err := ids.Delegator.Verify(ids.Hash(), ids.Signature); err != nil {
+		return errors.New("wrong certificate of session key: " + err.Error())
+	}
+	if now > ids.Expiry {
+		return errors.New("session key expired")
+	}
+	return schnorr.Verify(cothority.Suite, ids.Point, msg, sig)
+}
+
+// checkDelegator returns an error if the delegator cannot sign certificates.
+func (ids IdentitySession) checkDelegator() error {
+	switch ids.Delegator.Type() {
+	case 1, 2:
+		return nil
+	}
+	return errors.New("the delegator of a session key must be an ed25519 or a x509ec identity")
+}
+
 type sigRS struct {
 	R *big.Int
 	S *big.Int
@@ -847,6 +1316,81 @@ func (eds SignerEd25519) Sign(msg []byte) ([]byte, error) {
 	return schnorr.Sign(cothority.Suite, eds.Secret, msg)
 }
 
+// NewSignerSecp256k1 initializes a new SignerSecp256k1 signer given the
+// private key as a big-endian number. If it is nil, a new key pair is
+// generated.
+func NewSignerSecp256k1(private []byte) (Signer, error) {
+	var priv *btcec.PrivateKey
+	if private == nil {
+		var err error
+		priv, err = btcec.NewPrivateKey(btcec.S256())
+		if err != nil {
+			return Signer{}, err
+		}
+	} else {
+		priv, _ = btcec.PrivKeyFromBytes(btcec.S256(), private)
+	}
+	return Signer{Secp256k1: &SignerSecp256k1{
+		Point:  priv.PubKey().SerializeCompressed(),
+		Secret: priv.Serialize(),
+	}}, nil
+}
+
+// Sign creates a canonical ECDSA signature on the sha256 digest of the
+// message, see IdentitySecp256k1.Verify.
+func (ss SignerSecp256k1) Sign(msg []byte) ([]byte, error) {
+	priv, _ := btcec.PrivKeyFromBytes(btcec.S256(), ss.Secret)
+	digest := sha256.Sum256(msg)
+	sig, err := priv.Sign(digest[:])
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 64)
+	r, s := sig.R.Bytes(), sig.S.Bytes()
+	copy(buf[32-len(r):32], r)
+	copy(buf[64-len(s):], s)
+	return buf, nil
+}
+
+// NewSignerBLS initializes a new SignerBLS signer given public and private
+// keys on the bn256 curve. If either of the given keys is nil, then a new key
+// pair is generated.
+func NewSignerBLS(public kyber.Point, private kyber.Scalar) Signer {
+	if public == nil || private == nil {
+		private, public = bls.NewKeyPair(blsSuite, random.New())
+	}
+	pointBuf, _ := public.MarshalBinary()
+	secretBuf, _ := private.MarshalBinary()
+	return Signer{BLS: &SignerBLS{
+		Point:  pointBuf,
+		Secret: secretBuf,
+	}}
+}
+
+// Sign creates a BLS signature on the message, see IdentityBLS.Verify.
+func (sb SignerBLS) Sign(msg []byte) ([]byte, error) {
+	secret := blsSuite.G2().Scalar()
+	if err := secret.UnmarshalBinary(sb.Secret); err != nil {
+		return nil, err
+	}
+	return bls.Sign(blsSuite, secret, blsMessage(msg, sb.Point))
+}
+
+// NewSignerSession creates a new session key with a certificate signed by the
+// delegator, that allows the key to sign the actions until expiry, given in
+// seconds since the Unix epoch.
+func NewSignerSession(delegator Signer, expiry int64, actions ...Action) (Signer, error) {
+	kp := key.NewKeyPair(cothority.Suite)
+	id, err := NewIdentitySession(delegator, kp.Public, expiry, actions...)
+	if err != nil {
+		return Signer{}, err
+	}
+	return Signer{Session: &SignerSession{
+		Identity: *id.Session,
+		Secret:   kp.Private,
+	}}, nil
+}
+
 // Hash computes the digest of the request, the identities and signatures are
 // not included.
 func (r Request) Hash() []byte {
@@ -861,11 +1405,12 @@ func (r Request) Hash() []byte {
 }
 
 // GetIdentityStrings returns a slice of identity strings, this is useful for
-// creating a parser.
+// creating a parser. A session key is given as the string of its delegator,
+// and aggregated BLS keys as the strings of every key.
 func (r Request) GetIdentityStrings() []string {
-	res := make([]string, len(r.Identities))
-	for i, id := range r.Identities {
-		res[i] = id.String()
+	var res []string
+	for _, id := range r.Identities {
+		res = append(res, id.ruleStrings()...)
 	}
 	return res
 }
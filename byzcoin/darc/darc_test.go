@@ -2,6 +2,7 @@ package darc
 
 import (
 	"testing"
+	"time"
 
 	"github.com/dedis/cothority/byzcoin/darc/expression"
 	"github.com/stretchr/testify/require"
@@ -354,6 +355,21 @@ func TestDarc_Delegation(t *testing.T) {
 	require.Nil(t, td5.darc.VerifyWithCB(getDarc, true))
 }
 
+func TestDarc_DelegatedDarcs(t *testing.T) {
+	td := createDarc(2, "testdarc")
+	require.Nil(t, td.darc.DelegatedDarcs())
+
+	id1 := NewIdentityDarc(createDarc(1, "delegate1").darc.GetBaseID()).String()
+	id2 := NewIdentityDarc(createDarc(1, "delegate2").darc.GetBaseID()).String()
+	require.Nil(t, td.darc.Rules.AddRule("spawn:coin", expression.InitOrExpr(id1, id2)))
+	require.Nil(t, td.darc.Rules.AddRule("invoke:transfer",
+		expression.InitThresholdExpr(1, id2, td.owners[0].Identity().String())))
+	ids := td.darc.DelegatedDarcs()
+	require.Equal(t, 2, len(ids))
+	require.Equal(t, id1, NewIdentityDarc(ids[0]).String())
+	require.Equal(t, id2, NewIdentityDarc(ids[1]).String())
+}
+
 // TestDarc_DelegationChain creates a chain of delegation and we will try to
 // evolve the first darc using the signature of the last darc in the chain.
 func TestDarc_DelegationChain(t *testing.T) {
@@ -395,6 +411,159 @@ func TestDarc_DelegationChain(t *testing.T) {
 	require.Nil(t, td.darc.VerifyWithCB(getDarc, true))
 }
 
+// TestDarc_Threshold checks that an evolution needs the signatures of the
+// number of owners given in the threshold expression.
+func TestDarc_Threshold(t *testing.T) {
+	td := createDarc(3, "threshold")
+	ids := make([]string, len(td.ids))
+	for i, id := range td.ids {
+		ids[i] = id.String()
+	}
+	require.Nil(t, td.darc.Rules.UpdateEvolution(expression.InitThresholdExpr(2, ids...)))
+
+	dNew := td.darc.Copy()
+	require.Nil(t, localEvolution(dNew, td.darc, td.owners[0]))
+	require.NotNil(t, dNew.Verify(true))
+	// The same signer twice doesn't count twice.
+	require.Nil(t, localEvolution(dNew, td.darc, td.owners[0], td.owners[0]))
+	require.NotNil(t, dNew.Verify(true))
+	require.Nil(t, localEvolution(dNew, td.darc, td.owners[0], td.owners[2]))
+	require.Nil(t, dNew.Verify(true))
+
+	sigs := dNew.Signatures
+	getDarc := func(string, bool) *Darc { return nil }
+	require.Nil(t, EvalExprWithSigs(td.darc.Rules.GetEvolutionExpr(), getDarc, evolve, sigs...))
+	require.NotNil(t, EvalExprWithSigs(td.darc.Rules.GetEvolutionExpr(), getDarc, evolve, sigs[0]))
+}
+
+// TestDarc_Session checks that a session key can sign in the name of its
+// delegator, but only the actions of its certificate and until its expiry.
+func TestDarc_Session(t *testing.T) {
+	td := createDarc(1, "session")
+	require.Nil(t, td.darc.Rules.AddRule("spawn:coin", td.darc.Rules.GetSignExpr()))
+	require.Nil(t, td.darc.Rules.AddRule("invoke:transfer", td.darc.Rules.GetSignExpr()))
+	expiry := time.Now().Add(time.Hour).Unix()
+	session, err := NewSignerSession(td.owners[0], expiry, "spawn:coin")
+	require.Nil(t, err)
+	id := session.Identity()
+	require.True(t, id.Equal(&id))
+	require.False(t, id.Equal(&td.ids[0]))
+
+	req, err := InitAndSignRequest(td.darc.GetBaseID(), "spawn:coin", []byte("msg"), session)
+	require.Nil(t, err)
+	require.Nil(t, req.Verify(td.darc))
+	require.Nil(t, id.Verify(req.Hash(), req.Signatures[0]))
+
+	// The time given by the attributes is after the expiry.
+	attrs := func(name string) (int64, bool) {
+		return expiry + 1, name == TimeAttr
+	}
+	require.NotNil(t, req.VerifyWithAttrs(td.darc, nil, attrs))
+	require.NotNil(t, id.VerifyAt(req.Hash(), req.Signatures[0], expiry+1))
+
+	// The action is not in the certificate.
+	req, err = InitAndSignRequest(td.darc.GetBaseID(), "invoke:transfer", []byte("msg"), session)
+	require.Nil(t, err)
+	require.NotNil(t, req.Verify(td.darc))
+	sig := Signature{Signer: id, Signature: req.Signatures[0]}
+	expr := td.darc.Rules.GetSignExpr()
+	require.NotNil(t, EvalExprWithSigs(expr, nil, "invoke:transfer", sig))
+	require.Nil(t, EvalExprWithSigs(expr, nil, "spawn:coin", sig))
+
+	// The certificate must be signed by the delegator.
+	forged := session.Identity()
+	forged.Session.Expiry++
+	require.NotNil(t, forged.Verify(req.Hash(), req.Signatures[0]))
+
+	// Only a key can delegate to a session key.
+	_, err = NewSignerSession(session, expiry, "spawn:coin")
+	require.NotNil(t, err)
+}
+
+func TestDarc_Secp256k1(t *testing.T) {
+	signer, err := NewSignerSecp256k1(nil)
+	require.Nil(t, err)
+	id := signer.Identity()
+	msg := []byte("message")
+	sig, err := signer.Sign(msg)
+	require.Nil(t, err)
+	require.Equal(t, 64, len(sig))
+	require.Nil(t, id.Verify(msg, sig))
+	require.NotNil(t, id.Verify([]byte("other message"), sig))
+
+	// The same private key gives the same identity.
+	signer2, err := NewSignerSecp256k1(signer.Secp256k1.Secret)
+	require.Nil(t, err)
+	id2 := signer2.Identity()
+	require.True(t, id.Equal(&id2))
+
+	parsed, err := ParseIdentity(id.String())
+	require.Nil(t, err)
+	require.True(t, id.Equal(&parsed))
+}
+
+// TestDarc_BLS checks that a rule needing several BLS keys accepts a single
+// aggregated signature.
+func TestDarc_BLS(t *testing.T) {
+	signers := []Signer{NewSignerBLS(nil, nil), NewSignerBLS(nil, nil)}
+	ids := []Identity{signers[0].Identity(), signers[1].Identity()}
+	rules := InitRules(ids, ids)
+	require.Nil(t, rules.AddRule("spawn:coin", expression.InitAndExpr(ids[0].String(), ids[1].String())))
+	d := NewDarc(rules, []byte("bls"))
+
+	agg, err := AggregateIdentitiesBLS(ids...)
+	require.Nil(t, err)
+	req := NewRequest(d.GetBaseID(), "spawn:coin", []byte("msg"), []Identity{agg}, nil)
+	digest := req.Hash()
+	var sigs [][]byte
+	for _, s := range signers {
+		sig, err := s.Sign(digest)
+		require.Nil(t, err)
+		require.Nil(t, s.Identity().Verify(digest, sig))
+		sigs = append(sigs, sig)
+	}
+	aggSig, err := AggregateSignaturesBLS(sigs...)
+	require.Nil(t, err)
+	req.Signatures = [][]byte{aggSig}
+	require.Nil(t, req.Verify(d))
+
+	// A signature of only one of the keys is refused.
+	req.Signatures = [][]byte{sigs[0]}
+	require.NotNil(t, req.Verify(d))
+
+	// A key cannot be aggregated twice.
+	_, err = AggregateIdentitiesBLS(ids[0], ids[0])
+	require.NotNil(t, err)
+
+	parsed, err := ParseIdentity(agg.String())
+	require.Nil(t, err)
+	require.True(t, agg.Equal(&parsed))
+
+	// The order of the keys doesn't change the identity, but unsorted
+	// keys are refused.
+	reversed, err := AggregateIdentitiesBLS(ids[1], ids[0])
+	require.Nil(t, err)
+	require.Equal(t, agg.String(), reversed.String())
+	unsorted := Identity{BLS: &IdentityBLS{
+		Publics: [][]byte{agg.BLS.Publics[1], agg.BLS.Publics[0]},
+	}}
+	require.NotNil(t, unsorted.Verify(digest, aggSig))
+	_, err = ParseIdentity(unsorted.String())
+	require.NotNil(t, err)
+}
+
+func TestParseIdentity(t *testing.T) {
+	for _, id := range []Identity{createIdentity(), NewIdentityDarc([]byte("darc"))} {
+		parsed, err := ParseIdentity(id.String())
+		require.Nil(t, err)
+		require.True(t, id.Equal(&parsed))
+	}
+	for _, s := range []string{"ed25519", "ed25519:xyz", "ed25519:00", "unknown:00", "bls:00"} {
+		_, err := ParseIdentity(s)
+		require.NotNil(t, err)
+	}
+}
+
 func TestDarc_X509(t *testing.T) {
 	// TODO
 }
@@ -5,13 +5,30 @@ the syntax we use is from: https://en.wikipedia.org/wiki/Extended_Backus%E2%80%9
 
 	expr = term, [ '&', term ]*
 	term = factor, [ '|', factor ]*
-	factor = '(', expr, ')' | id
+	factor = '(', expr, ')' | id | threshold | comparison
+	threshold = 'threshold', '(', number, [ ',', arg ]*, ')'
+	arg = '(', expr, ')' | id | threshold | comparison
+	comparison = operand, ( '<' | '<=' | '==' | '!=' | '>=' | '>' ), operand
+	operand = number | attr, [ '+', number ]
 	id = [0-9a-z]+, ':', [0-9a-f]+
+	attr = [a-z_]+
+	number = [0-9]+
 
 Examples:
 
         ed25519:deadbeef // every id evaluates to a boolean
 	(a:a & b:b) | (c:c & d:d)
+	threshold(2, a:a, b:b, (c:c & d:d))
+	a:a & block_index >= 10000
+
+A threshold evaluates to true if at least the given number of its arguments
+evaluate to true. The number must be between 1 and the number of arguments,
+and an id cannot be given twice, otherwise the expression is invalid.
+
+A comparison compares integers, which are either numbers or attributes of the
+context in which the expression is evaluated, such as the index of the
+current block. The values of the attributes are given by an AttrFn. A
+comparison with an unknown attribute evaluates to false.
 
 In the simplest case, the evaluation of an expression is performed against a
 set of valid ids.  Suppose we have the expression (a:a & b:b) | (c:c & d:d),
@@ -19,15 +36,14 @@ and the set of valid ids is [a:a, b:b], then the expression will evaluate to
 true.  If the set of valid ids is [a:a, c:c], then the expression will evaluate
 to false. However, the user is able to provide a ValueCheckFn to customise how
 the expressions are evaluated.
-
-EXTENSION - NOT YET IMPLEMENTED:
-To support threshold signatures, we extend the syntax to include the following.
-	thexpr = '[', id, [ ',', id ]*, ']', '/', digit
 */
 package expression
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"strconv"
 	"strings"
 
 	parsec "github.com/prataprc/goparsec"
@@ -41,20 +57,37 @@ const failedToCast = "evauluation failed - result is not bool"
 // TODO it is useful if we can return (bool, error).
 type ValueCheckFn func(string) bool
 
+// AttrFn returns the value of the attribute with the given name, and false
+// if the attribute is unknown.
+type AttrFn func(string) (int64, bool)
+
 // Expr represents the unprocess expression of our DSL.
 type Expr []byte
 
 // InitParser creates the root parser
 func InitParser(fn ValueCheckFn) parsec.Parser {
+	return InitParserWithAttrs(fn, nil)
+}
+
+// InitParserWithAttrs creates the root parser, where the attributes used in
+// comparisons are looked up with attrFn. If attrFn is nil, every comparison
+// with an attribute evaluates to false.
+func InitParserWithAttrs(fn ValueCheckFn, attrFn AttrFn) parsec.Parser {
 	// Y is root Parser, usually called as `s` in CFG theory.
 	var Y parsec.Parser
-	var sum, value parsec.Parser // circular rats
+	var sum, value, threshold parsec.Parser // circular rats
 
 	// Terminal rats
 	var openparan = parsec.Token(`\(`, "OPENPARAN")
 	var closeparan = parsec.Token(`\)`, "CLOSEPARAN")
 	var andop = parsec.Token(`&`, "AND")
 	var orop = parsec.Token(`\|`, "OR")
+	var comma = parsec.Token(`,`, "COMMA")
+	var thresholdop = parsec.Token(`threshold`, "THRESHOLD")
+	var number = parsec.Token(`[0-9]+`, "NUMBER")
+	var attr = parsec.Token(`[a-z_]+`, "ATTR")
+	var plus = parsec.Token(`\+`, "PLUS")
+	var cmpop = parsec.Token(`(<=|>=|==|!=|<|>)`, "CMP")
 
 	// NonTerminal rats
 	// andop -> "&" |  "|"
@@ -66,11 +99,24 @@ func InitParser(fn ValueCheckFn) parsec.Parser {
 	// (andop prod)*
 	var prodK = parsec.Kleene(nil, parsec.And(many2many, sumOp, &value), nil)
 
+	// operand -> number | attr ("+" number)?
+	var operand = parsec.OrdChoice(operandNode(attrFn), number,
+		parsec.And(many2many, attr, parsec.Maybe(one2one, parsec.And(many2many, plus, number))))
+
+	// comparison -> operand cmpop operand
+	var comparison = parsec.And(comparisonNode, operand, cmpop, operand)
+
+	// (, arg)*, where the ids are kept as terminals to find duplicates
+	var argsK = parsec.Kleene(nil, parsec.And(many2many, comma,
+		parsec.OrdChoice(one2one, id(), groupExpr, &threshold, comparison)))
+
 	// Circular rats come to life
 	// sum -> prod (andop prod)*
 	sum = parsec.And(sumNode(fn), &value, prodK)
-	// value -> id | "(" expr ")"
-	value = parsec.OrdChoice(exprValueNode(fn), id(), groupExpr)
+	// threshold -> "threshold" "(" number (, arg)* ")"
+	threshold = parsec.And(thresholdNode(fn), thresholdop, openparan, number, argsK, closeparan)
+	// value -> id | "(" expr ")" | threshold | comparison
+	value = parsec.OrdChoice(exprValueNode(fn), id(), groupExpr, &threshold, comparison)
 	// expr  -> sum
 	Y = parsec.OrdChoice(one2one, sum)
 	return Y
@@ -117,6 +163,12 @@ func InitOrExpr(ids ...string) Expr {
 	return Expr(strings.Join(ids, " | "))
 }
 
+// InitThresholdExpr creates an expression that is true if at least n of the
+// IDs are valid.
+func InitThresholdExpr(n int, ids ...string) Expr {
+	return Expr(fmt.Sprintf("threshold(%d, %s)", n, strings.Join(ids, ", ")))
+}
+
 func id() parsec.Parser {
 	return func(s parsec.Scanner) (parsec.ParsecNode, parsec.Scanner) {
 		_, s = s.SkipAny(`^[  \n\t]+`)
@@ -145,6 +197,104 @@ func sumNode(fn ValueCheckFn) func(ns []parsec.ParsecNode) parsec.ParsecNode {
 	}
 }
 
+func thresholdNode(fn ValueCheckFn) func(ns []parsec.ParsecNode) parsec.ParsecNode {
+	return func(ns []parsec.ParsecNode) parsec.ParsecNode {
+		if len(ns) != 5 {
+			return nil
+		}
+		n, err := strconv.Atoi(ns[2].(*parsec.Terminal).Value)
+		if err != nil {
+			return nil
+		}
+		args := ns[3].([]parsec.ParsecNode)
+		if n < 1 || n > len(args) {
+			return nil
+		}
+		seen := make(map[string]bool)
+		var count int
+		for _, x := range args {
+			arg := x.([]parsec.ParsecNode)[1]
+			val, ok := arg.(bool)
+			if term, isID := arg.(*parsec.Terminal); isID {
+				if seen[term.Value] {
+					return nil
+				}
+				seen[term.Value] = true
+				val, ok = fn(term.Value), true
+			}
+			if !ok {
+				return nil
+			}
+			if val {
+				count++
+			}
+		}
+		return count >= n
+	}
+}
+
+// unknownAttr is the operand of a comparison with an attribute that doesn't
+// have a value.
+type unknownAttr struct{}
+
+func operandNode(attrFn AttrFn) func(ns []parsec.ParsecNode) parsec.ParsecNode {
+	return func(ns []parsec.ParsecNode) parsec.ParsecNode {
+		if len(ns) == 0 {
+			return nil
+		}
+		if term, ok := ns[0].(*parsec.Terminal); ok {
+			n, err := strconv.ParseInt(term.Value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			return n
+		}
+		// attr ("+" number)?
+		nodes := ns[0].([]parsec.ParsecNode)
+		if attrFn == nil {
+			return unknownAttr{}
+		}
+		val, ok := attrFn(nodes[0].(*parsec.Terminal).Value)
+		if !ok {
+			return unknownAttr{}
+		}
+		if sum, ok := nodes[1].([]parsec.ParsecNode); ok {
+			n, err := strconv.ParseInt(sum[1].(*parsec.Terminal).Value, 10, 64)
+			if err != nil || val > math.MaxInt64-n {
+				return nil
+			}
+			val += n
+		}
+		return val
+	}
+}
+
+func comparisonNode(ns []parsec.ParsecNode) parsec.ParsecNode {
+	if len(ns) != 3 {
+		return nil
+	}
+	a, okA := ns[0].(int64)
+	b, okB := ns[2].(int64)
+	if !okA || !okB {
+		return false
+	}
+	switch ns[1].(*parsec.Terminal).Value {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case ">=":
+		return a >= b
+	case ">":
+		return a > b
+	}
+	return nil
+}
+
 func exprValueNode(fn ValueCheckFn) func(ns []parsec.ParsecNode) parsec.ParsecNode {
 	return func(ns []parsec.ParsecNode) parsec.ParsecNode {
 		if len(ns) == 0 {
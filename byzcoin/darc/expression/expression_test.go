@@ -207,3 +207,125 @@ func TestEval_DefaultParser(t *testing.T) {
 		t.Fatal("evaluation should return false")
 	}
 }
+
+func TestParsing_Threshold(t *testing.T) {
+	valid := []struct {
+		expr string
+		res  bool
+	}{
+		{"threshold(1, a:a)", true},
+		{"threshold(2, a:a, b:b, c:c)", true},
+		{"threshold(3, a:a, b:b, c:c)", false},
+		{"threshold(2,a:a,c:c,d:d)", false},
+		{"threshold(2, c:c, (a:a & b:b), d:d)", false},
+		{"threshold(2, c:c, (a:a & b:b), (d:d | b:b))", true},
+		{"threshold(2, threshold(1, c:c, a:a), b:b) & a:a", true},
+		{"c:c | threshold(2, a:a, b:b)", true},
+	}
+	for _, v := range valid {
+		ok, err := DefaultParser(Expr(v.expr), "a:a", "b:b")
+		if err != nil {
+			t.Fatalf("%s: %s", v.expr, err)
+		}
+		if ok != v.res {
+			t.Fatalf("%s: wrong result", v.expr)
+		}
+	}
+
+	invalid := []string{
+		"threshold(0, a:a)",
+		"threshold(3, a:a, b:b)",
+		"threshold(1)",
+		"threshold(1, a:a, a:a)",
+		"threshold(a:a, b:b)",
+		"threshold(1, a:a",
+		"threshold(-1, a:a)",
+	}
+	for _, expr := range invalid {
+		if _, err := DefaultParser(Expr(expr), "a:a", "b:b"); err == nil {
+			t.Fatalf("%s: expect an error", expr)
+		}
+	}
+}
+
+func TestInitThreshold(t *testing.T) {
+	expr := InitThresholdExpr(2, "a:a", "b:b", "c:c")
+	if string(expr) != "threshold(2, a:a, b:b, c:c)" {
+		t.Fatalf("wrong expression %s", expr)
+	}
+	ok, err := DefaultParser(expr, "a:a", "c:c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok != true {
+		t.Fatal("evaluation should return true")
+	}
+}
+
+func TestParsing_Comparison(t *testing.T) {
+	attrs := func(name string) (int64, bool) {
+		switch name {
+		case "block_index":
+			return 100, true
+		case "last_update":
+			return 40, true
+		}
+		return 0, false
+	}
+	valid := []struct {
+		expr string
+		res  bool
+	}{
+		{"block_index >= 100", true},
+		{"block_index > 100", false},
+		{"block_index<101", true},
+		{"block_index == 100 & a:a", true},
+		{"block_index != 100 | b:b", false},
+		{"99 <= block_index", true},
+		{"block_index >= last_update + 60", true},
+		{"block_index >= last_update + 61", false},
+		{"a:a & (b:b | block_index > 50)", true},
+		{"threshold(2, a:a, b:b, block_index > 50)", true},
+		{"unknown > 0 | unknown <= 0", false},
+	}
+	for _, v := range valid {
+		ok, err := Evaluate(InitParserWithAttrs(func(s string) bool {
+			return s == "a:a"
+		}, attrs), Expr(v.expr))
+		if err != nil {
+			t.Fatalf("%s: %s", v.expr, err)
+		}
+		if ok != v.res {
+			t.Fatalf("%s: wrong result", v.expr)
+		}
+	}
+
+	// Without attributes, the comparisons are false.
+	ok, err := DefaultParser(Expr("block_index >= 0 | 1 > 0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok != true {
+		t.Fatal("comparison of numbers should be true")
+	}
+	ok, err = DefaultParser(Expr("block_index >= 0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok != false {
+		t.Fatal("comparison with unknown attribute should be false")
+	}
+
+	invalid := []string{
+		"block_index >",
+		"block_index => 1",
+		"block_index >= -1",
+		"block_index + 1 >= 1 +",
+		"block_index >= 99999999999999999999",
+	}
+	for _, expr := range invalid {
+		if _, err := Evaluate(InitParserWithAttrs(trueFn, attrs), Expr(expr)); err == nil {
+			t.Fatalf("%s: expect an error", expr)
+		}
+	}
+}
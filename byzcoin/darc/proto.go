@@ -53,8 +53,8 @@ type Darc struct {
 	VerificationDarcs []*Darc
 }
 
-// Identity is a generic structure can be either an Ed25519 public key, a Darc
-// or a X509 Identity.
+// Identity is a generic structure can be either an Ed25519 public key, a Darc,
+// a X509 Identity, a session key, a secp256k1 public key or BLS public keys.
 type Identity struct {
 	// Darc identity
 	Darc *IdentityDarc
@@ -62,6 +62,12 @@ type Identity struct {
 	Ed25519 *IdentityEd25519
 	// Public-key identity
 	X509EC *IdentityX509EC
+	// Session-key identity
+	Session *IdentitySession
+	// Public-key identity
+	Secp256k1 *IdentitySecp256k1
+	// Public-key identity
+	BLS *IdentityBLS
 }
 
 // IdentityEd25519 holds a Ed25519 public key (Point)
@@ -74,6 +80,37 @@ type IdentityX509EC struct {
 	Public []byte
 }
 
+// IdentitySecp256k1 holds a secp256k1 public key in the SEC1 format, as used
+// by Bitcoin and Ethereum.
+type IdentitySecp256k1 struct {
+	Public []byte
+}
+
+// IdentityBLS holds BLS public keys on the bn256 curve. If there is more than
+// one key, the signature is the aggregation of the signatures of all the
+// keys.
+type IdentityBLS struct {
+	Publics [][]byte
+}
+
+// IdentitySession holds a short-lived Ed25519 public key together with a
+// certificate of a long-term identity, the delegator, that allows the key to
+// sign some actions in its name until the expiry.
+type IdentitySession struct {
+	// Point is the public key of the session
+	Point kyber.Point
+	// Delegator is the long-term identity that signed the certificate, it
+	// must be an Ed25519 or a X509EC identity
+	Delegator Identity
+	// Expiry is the time in seconds since the Unix epoch after which the
+	// session key is not valid anymore
+	Expiry int64
+	// Actions the session key is allowed to sign
+	Actions []Action
+	// Signature of the delegator on the certificate
+	Signature []byte
+}
+
 // IdentityDarc is a structure that points to a Darc with a given ID on a
 // skipchain. The signer should belong to the Darc.
 type IdentityDarc struct {
@@ -92,8 +129,11 @@ type Signature struct {
 
 // Signer is a generic structure that can hold different types of signers
 type Signer struct {
-	Ed25519 *SignerEd25519
-	X509EC  *SignerX509EC
+	Ed25519   *SignerEd25519
+	X509EC    *SignerX509EC
+	Session   *SignerSession
+	Secp256k1 *SignerSecp256k1
+	BLS       *SignerBLS
 }
 
 // SignerEd25519 holds a public and private keys necessary to sign Darcs
@@ -109,6 +149,25 @@ type SignerX509EC struct {
 	secret []byte
 }
 
+// SignerSession holds the private key of a session and its certificate.
+type SignerSession struct {
+	Identity IdentitySession
+	Secret   kyber.Scalar
+}
+
+// SignerSecp256k1 holds a secp256k1 key pair, the public key is in the
+// compressed SEC1 format.
+type SignerSecp256k1 struct {
+	Point  []byte
+	Secret []byte
+}
+
+// SignerBLS holds a BLS key pair on the bn256 curve.
+type SignerBLS struct {
+	Point  []byte
+	Secret []byte
+}
+
 // Request is the structure that the client must provide to be verified
 type Request struct {
 	BaseID     ID
@@ -0,0 +1,99 @@
+package byzcoin
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoin/darc"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// getBlockAt returns the block of the skipchain with the given index.
+func (s *Service) getBlockAt(scID skipchain.SkipBlockID, index int) (*skipchain.SkipBlock, error) {
+	sb, err := s.db().GetByIndex(scID, index)
+	if err != nil {
+		return nil, err
+	}
+	if sb == nil {
+		return nil, errors.New("no block with this index")
+	}
+	return sb, nil
+}
+
+// darcSignatures returns the signatures of the accepted instruction of the
+// block that stored the darc given by darcBuf, which is an instruction with a
+// "darc" argument. If the darc has been stored otherwise, e.g. by a contract
+// that creates it from other arguments, no signatures are returned.
+func darcSignatures(sb *skipchain.SkipBlock, darcBuf []byte) ([]darc.Signature, error) {
+	var body DataBody
+	err := protobuf.DecodeWithConstructors(sb.Payload, &body, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, errors.New("couldn't unmarshal body: " + err.Error())
+	}
+	for _, tx := range body.TxResults {
+		if !tx.Accepted {
+			continue
+		}
+		for _, instr := range tx.ClientTransaction.Instructions {
+			var args Arguments
+			switch {
+			case instr.Spawn != nil:
+				args = instr.Spawn.Args
+			case instr.Invoke != nil:
+				args = instr.Invoke.Args
+			}
+			if bytes.Equal(args.Search("darc"), darcBuf) {
+				return instr.Signatures, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// darcVersion returns the version of the darc stored by the entry of its
+// history, with the proof that it is in the state after the block of the
+// entry.
+func (s *Service) darcVersion(scID skipchain.SkipBlockID, id darc.ID, e HistoryEntry) (*DarcVersion, error) {
+	d, err := darc.NewFromProtobuf(e.StateChange.Value)
+	if err != nil {
+		return nil, err
+	}
+	sb, err := s.getBlockAt(scID, e.BlockIndex)
+	if err != nil {
+		return nil, err
+	}
+	var header DataHeader
+	err = protobuf.DecodeWithConstructors(sb.Data, &header, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, errors.New("couldn't unmarshal header: " + err.Error())
+	}
+	coll, err := s.getCollection(scID).viewAt(header.CollectionRoot)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := NewProofAt(coll, s.db(), scID, sb, id)
+	if err != nil {
+		return nil, err
+	}
+	// The body of the block might have been pruned.
+	full, err := s.skService().GetFullBlock(sb.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPayload(full); err != nil {
+		return nil, err
+	}
+	sigs, err := darcSignatures(full, e.StateChange.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &DarcVersion{
+		Darc:       *d,
+		BlockIndex: e.BlockIndex,
+		Signatures: sigs,
+		Proof:      *proof,
+	}, nil
+}
@@ -0,0 +1,446 @@
+package byzcoin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/dedis/cothority/byzcoin/collection"
+	"github.com/dedis/cothority/byzcoin/darc"
+	"github.com/dedis/protobuf"
+)
+
+// darcRefsContractID denotes the reverse index of a darc, which lists the
+// instances and the darcs that depend on it. It is stored in the collection by
+// the service and cannot be changed by instructions.
+const darcRefsContractID = "darcrefs"
+
+// The reverse index of a darc is stored with one key per reference, so that
+// changing a reference doesn't depend on how many references the darc has.
+// The references of each kind are numbered from 0. The key of a slot holds the
+// ID of the referring instance, and the key of the pair of the darc and that
+// instance holds the number of its slot. The key of the darc holds the number
+// of references of each kind. When a reference is removed, the last reference
+// of the same kind moves to the freed slot.
+
+// darcRefKind is the kind of a reference to a darc.
+type darcRefKind byte
+
+const (
+	// refInstance is an instance controlled by the darc.
+	refInstance darcRefKind = iota
+	// refDarc is a darc delegating to the darc.
+	refDarc
+)
+
+// darcRefsCount is the number of references of each kind to a darc.
+type darcRefsCount struct {
+	Instances int
+	Darcs     int
+}
+
+// of returns the number of references of the given kind.
+func (rc *darcRefsCount) of(kind darcRefKind) *int {
+	if kind == refDarc {
+		return &rc.Darcs
+	}
+	return &rc.Instances
+}
+
+// darcReferences is the reverse index of a darc.
+type darcReferences struct {
+	// Instances are the IDs of the instances that are controlled by the
+	// darc, except the darc itself.
+	Instances [][]byte
+	// Darcs are the base IDs of the darcs that delegate to the darc with a
+	// darc identity in their rules.
+	Darcs [][]byte
+}
+
+// darcRefsKey returns the key under which the number of references to the
+// darc is stored in the collection.
+func darcRefsKey(id darc.ID) []byte {
+	h := sha256.New()
+	h.Write([]byte("darcrefs_"))
+	h.Write(id)
+	return h.Sum(nil)
+}
+
+// darcRefSlotKey returns the key of the slot of a reference to the darc.
+func darcRefSlotKey(id darc.ID, kind darcRefKind, slot int) []byte {
+	h := sha256.New()
+	h.Write([]byte("darcrefs_slot_"))
+	h.Write(id)
+	h.Write([]byte{byte(kind)})
+	binary.Write(h, binary.LittleEndian, uint64(slot))
+	return h.Sum(nil)
+}
+
+// darcRefPairKey returns the key of the pair of the darc and the instance
+// referring to it.
+func darcRefPairKey(id darc.ID, kind darcRefKind, ref []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("darcrefs_pair_"))
+	h.Write(id)
+	h.Write([]byte{byte(kind)})
+	h.Write(ref)
+	return h.Sum(nil)
+}
+
+// getDarcRefs returns the reverse index of the darc with the given base ID.
+// It returns false if nothing depends on the darc.
+func getDarcRefs(c CollectionView, id darc.ID) (*darcReferences, bool, error) {
+	v := newDarcRefsView(c)
+	rc, err := v.count(id)
+	if err != nil {
+		return nil, false, err
+	}
+	refs := &darcReferences{}
+	if refs.Instances, err = v.list(id, refInstance, rc.Instances); err != nil {
+		return nil, false, err
+	}
+	if refs.Darcs, err = v.list(id, refDarc, rc.Darcs); err != nil {
+		return nil, false, err
+	}
+	return refs, rc.Instances+rc.Darcs > 0, nil
+}
+
+// isInternalContract returns true for the contract IDs of the values that the
+// service stores in the collection next to the instances.
+func isInternalContract(contractID string) bool {
+	switch contractID {
+	case lastUpdateContractID, signerCounterContractID, darcRefsContractID:
+		return true
+	}
+	return false
+}
+
+// publicStateChanges returns scs without the state changes of the values that
+// the service stores next to the instances.
+func publicStateChanges(scs StateChanges) StateChanges {
+	var out StateChanges
+	for _, sc := range scs {
+		if !isInternalContract(string(sc.ContractID)) {
+			out = append(out, sc)
+		}
+	}
+	return out
+}
+
+// darcRefsView reads the keys of the reverse indexes from a collection and
+// keeps the changes made to them, in the order they were first changed, so
+// that every node gets the same state changes.
+type darcRefsView struct {
+	c       CollectionView
+	order   []string
+	values  map[string][]byte
+	darcs   map[string]darc.ID
+	orig    map[string][]byte
+	existed map[string]bool
+}
+
+func newDarcRefsView(c CollectionView) *darcRefsView {
+	return &darcRefsView{
+		c:       c,
+		values:  make(map[string][]byte),
+		darcs:   make(map[string]darc.ID),
+		orig:    make(map[string][]byte),
+		existed: make(map[string]bool),
+	}
+}
+
+// get returns the value of the key, and false if it doesn't exist.
+func (v *darcRefsView) get(key []byte) ([]byte, bool, error) {
+	if value, ok := v.values[string(key)]; ok {
+		return value, value != nil, nil
+	}
+	value, contractID, _, err := v.c.GetValues(key)
+	if err == errKeyNotSet {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if contractID != darcRefsContractID {
+		return nil, false, errors.New("not a reverse index of a darc")
+	}
+	return value, true, nil
+}
+
+// set changes the value of the key, which is removed if value is nil.
+func (v *darcRefsView) set(key, value []byte, id darc.ID) error {
+	k := string(key)
+	if _, ok := v.values[k]; !ok {
+		orig, existed, err := v.get(key)
+		if err != nil {
+			return err
+		}
+		v.order = append(v.order, k)
+		v.orig[k] = orig
+		v.existed[k] = existed
+	}
+	v.values[k] = value
+	v.darcs[k] = id
+	return nil
+}
+
+// count returns the number of references to the darc.
+func (v *darcRefsView) count(id darc.ID) (darcRefsCount, error) {
+	rc := darcRefsCount{}
+	value, ok, err := v.get(darcRefsKey(id))
+	if err != nil || !ok {
+		return rc, err
+	}
+	err = protobuf.Decode(value, &rc)
+	return rc, err
+}
+
+func (v *darcRefsView) setCount(id darc.ID, rc darcRefsCount) error {
+	if rc.Instances == 0 && rc.Darcs == 0 {
+		return v.set(darcRefsKey(id), nil, id)
+	}
+	buf, err := protobuf.Encode(&rc)
+	if err != nil {
+		return err
+	}
+	return v.set(darcRefsKey(id), buf, id)
+}
+
+// list returns the n references of the given kind to the darc, in the order
+// of their slots.
+func (v *darcRefsView) list(id darc.ID, kind darcRefKind, n int) ([][]byte, error) {
+	var refs [][]byte
+	for slot := 0; slot < n; slot++ {
+		ref, ok, err := v.get(darcRefSlotKey(id, kind, slot))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("missing slot of a darc reference")
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// add stores the reference to the darc, unless it is already stored.
+func (v *darcRefsView) add(id darc.ID, kind darcRefKind, ref []byte) error {
+	pair := darcRefPairKey(id, kind, ref)
+	if _, ok, err := v.get(pair); err != nil || ok {
+		return err
+	}
+	rc, err := v.count(id)
+	if err != nil {
+		return err
+	}
+	n := rc.of(kind)
+	if err := v.set(darcRefSlotKey(id, kind, *n), ref, id); err != nil {
+		return err
+	}
+	if err := v.set(pair, slotBuf(*n), id); err != nil {
+		return err
+	}
+	*n++
+	return v.setCount(id, rc)
+}
+
+// remove removes the reference to the darc, if it is stored.
+func (v *darcRefsView) remove(id darc.ID, kind darcRefKind, ref []byte) error {
+	pair := darcRefPairKey(id, kind, ref)
+	buf, ok, err := v.get(pair)
+	if err != nil || !ok {
+		return err
+	}
+	if len(buf) != 8 {
+		return errors.New("invalid slot of a darc reference")
+	}
+	slot := int(binary.LittleEndian.Uint64(buf))
+	rc, err := v.count(id)
+	if err != nil {
+		return err
+	}
+	n := rc.of(kind)
+	last := *n - 1
+	if slot < 0 || slot > last {
+		return errors.New("invalid slot of a darc reference")
+	}
+	if slot != last {
+		lastRef, ok, err := v.get(darcRefSlotKey(id, kind, last))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("missing slot of a darc reference")
+		}
+		if err := v.set(darcRefSlotKey(id, kind, slot), lastRef, id); err != nil {
+			return err
+		}
+		if err := v.set(darcRefPairKey(id, kind, lastRef), slotBuf(slot), id); err != nil {
+			return err
+		}
+	}
+	if err := v.set(darcRefSlotKey(id, kind, last), nil, id); err != nil {
+		return err
+	}
+	if err := v.set(pair, nil, id); err != nil {
+		return err
+	}
+	*n = last
+	return v.setCount(id, rc)
+}
+
+// stateChanges returns the state changes of all the keys that changed.
+func (v *darcRefsView) stateChanges() StateChanges {
+	var out StateChanges
+	for _, k := range v.order {
+		value := v.values[k]
+		iid := NewInstanceID([]byte(k))
+		id := v.darcs[k]
+		switch {
+		case value == nil && v.existed[k]:
+			out = append(out, NewStateChange(Remove, iid, darcRefsContractID, nil, id))
+		case value == nil:
+		case !v.existed[k]:
+			out = append(out, NewStateChange(Create, iid, darcRefsContractID, value, id))
+		case !bytes.Equal(value, v.orig[k]):
+			out = append(out, NewStateChange(Update, iid, darcRefsContractID, value, id))
+		}
+	}
+	return out
+}
+
+func slotBuf(slot int) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(slot))
+	return buf
+}
+
+// darcRef is a reference of an instance to a darc.
+type darcRef struct {
+	id   string
+	kind darcRefKind
+}
+
+// instanceRefs returns the references of an instance with the given contract
+// and value: its darc and, if it is a darc, the darcs it delegates to.
+func instanceRefs(iid []byte, contractID string, value []byte, darcID darc.ID) map[darcRef]bool {
+	refs := make(map[darcRef]bool)
+	// A darc doesn't reference itself, neither as its own darc nor by
+	// delegating to itself, so that it can still be deleted.
+	if len(darcID) > 0 && !bytes.Equal(darcID, iid) {
+		refs[darcRef{string(darcID), refInstance}] = true
+	}
+	if contractID == ContractDarcID {
+		if d, err := darc.NewFromProtobuf(value); err == nil {
+			for _, id := range d.DelegatedDarcs() {
+				if !bytes.Equal(id, iid) {
+					refs[darcRef{string(id), refDarc}] = true
+				}
+			}
+		}
+	}
+	return refs
+}
+
+// darcRefsStateChanges returns the state changes that update the reverse
+// indexes of the darcs when scs are applied to c.
+func darcRefsStateChanges(c CollectionView, scs StateChanges) (StateChanges, error) {
+	v := newDarcRefsView(c)
+	if err := v.apply(scs); err != nil {
+		return nil, err
+	}
+	return v.stateChanges(), nil
+}
+
+// backfillDarcRefs is like darcRefsStateChanges, but the instances already
+// stored in coll are indexed first. It is used when a chain starts to store
+// the reverse indexes, so that they are complete from then on.
+func backfillDarcRefs(coll *collection.Trie, scs StateChanges) (StateChanges, error) {
+	c := &roCollection{coll}
+	keys, err := coll.Keys()
+	if err != nil {
+		return nil, err
+	}
+	v := newDarcRefsView(c)
+	for _, key := range keys {
+		value, contractID, darcID, err := c.GetValues(key)
+		if err != nil {
+			return nil, err
+		}
+		if isInternalContract(contractID) {
+			continue
+		}
+		for _, ref := range sortedRefs(instanceRefs(key, contractID, value, darcID)) {
+			if err := v.add(darc.ID(ref.id), ref.kind, key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := v.apply(scs); err != nil {
+		return nil, err
+	}
+	return v.stateChanges(), nil
+}
+
+// apply changes the references of the instances changed by scs.
+func (v *darcRefsView) apply(scs StateChanges) error {
+	// current holds the references of the instances changed so far, nil
+	// if the instance doesn't exist.
+	current := make(map[string]map[darcRef]bool)
+	getCurrent := func(iid []byte) map[darcRef]bool {
+		if refs, ok := current[string(iid)]; ok {
+			return refs
+		}
+		value, contractID, darcID, err := v.c.GetValues(iid)
+		if err != nil {
+			return nil
+		}
+		return instanceRefs(iid, contractID, value, darcID)
+	}
+
+	for _, sc := range scs {
+		if isInternalContract(string(sc.ContractID)) {
+			continue
+		}
+		old := getCurrent(sc.InstanceID)
+		var refs map[darcRef]bool
+		if sc.StateAction != Remove {
+			refs = instanceRefs(sc.InstanceID, string(sc.ContractID), sc.Value, sc.DarcID)
+		}
+		// The references are changed in the order of the darcs, so
+		// that every node gets the same state changes.
+		for _, ref := range sortedRefs(old) {
+			if !refs[ref] {
+				if err := v.remove(darc.ID(ref.id), ref.kind, sc.InstanceID); err != nil {
+					return err
+				}
+			}
+		}
+		for _, ref := range sortedRefs(refs) {
+			if !old[ref] {
+				if err := v.add(darc.ID(ref.id), ref.kind, sc.InstanceID); err != nil {
+					return err
+				}
+			}
+		}
+		current[string(sc.InstanceID)] = refs
+	}
+	return nil
+}
+
+// sortedRefs returns the references sorted by darc and kind.
+func sortedRefs(refs map[darcRef]bool) []darcRef {
+	var out []darcRef
+	for ref := range refs {
+		out = append(out, ref)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].id != out[j].id {
+			return out[i].id < out[j].id
+		}
+		return out[i].kind < out[j].kind
+	})
+	return out
+}
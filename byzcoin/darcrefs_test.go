@@ -0,0 +1,105 @@
+package byzcoin
+
+import (
+	"testing"
+
+	"github.com/dedis/cothority/byzcoin/collection"
+	"github.com/dedis/cothority/byzcoin/darc"
+	"github.com/dedis/cothority/byzcoin/darc/expression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDarcRefs(t *testing.T) {
+	coll, err := collection.NewTrie(nil, nil, collectionFields()...)
+	require.Nil(t, err)
+	c := &roCollection{coll}
+	store := func(scs StateChanges) StateChanges {
+		refScs, err := darcRefsStateChanges(c, scs)
+		require.Nil(t, err)
+		for _, sc := range append(scs, refScs...) {
+			require.Nil(t, storeInColl(coll, &sc))
+		}
+		return refScs
+	}
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	ids := []darc.Identity{signer.Identity()}
+	d1 := darc.NewDarc(darc.InitRules(ids, ids), []byte("first darc"))
+	d1Buf, err := d1.ToProto()
+	require.Nil(t, err)
+	d2 := darc.NewDarc(darc.InitRules(ids, ids), []byte("second darc"))
+	require.Nil(t, d2.Rules.AddRule("spawn:dummy", expression.InitOrExpr(
+		d1.GetIdentityString(), ids[0].String())))
+	d2Buf, err := d2.ToProto()
+	require.Nil(t, err)
+	d1ID, d2ID := d1.GetBaseID(), d2.GetBaseID()
+	a, b, c1 := id("a"), id("b"), id("c")
+
+	// The darcs don't reference themselves, but the second darc delegates
+	// to the first one.
+	refScs := store(StateChanges{
+		NewStateChange(Create, NewInstanceID(d1ID), ContractDarcID, d1Buf, d1ID),
+		NewStateChange(Create, NewInstanceID(d2ID), ContractDarcID, d2Buf, d2ID),
+		NewStateChange(Create, a, "dummy", nil, d1ID),
+		NewStateChange(Create, b, "dummy", nil, d2ID),
+		NewStateChange(Create, c1, "dummy", nil, d1ID),
+	})
+	// Every reference is stored with its slot and its pair, next to the
+	// number of references of each darc.
+	require.Equal(t, 4*2+2, len(refScs))
+	refs, ok, err := getDarcRefs(c, d1ID)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, [][]byte{a.Slice(), c1.Slice()}, refs.Instances)
+	require.Equal(t, [][]byte{d2ID}, refs.Darcs)
+	refs, ok, err = getDarcRefs(c, d2ID)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, [][]byte{b.Slice()}, refs.Instances)
+	require.Nil(t, refs.Darcs)
+	require.NotNil(t, checkDarcUnused(c, d1ID))
+
+	// Updating an instance without changing its darc doesn't change the
+	// index.
+	require.Equal(t, 0, len(store(StateChanges{
+		NewStateChange(Update, a, "dummy", []byte{1}, d1ID),
+	})))
+
+	// Moving an instance to the other darc, and removing the delegation,
+	// moves the last instance to the freed slot.
+	require.Nil(t, d2.Rules.UpdateRule("spawn:dummy", expression.Expr(ids[0].String())))
+	d2Buf, err = d2.ToProto()
+	require.Nil(t, err)
+	store(StateChanges{
+		NewStateChange(Update, a, "dummy", nil, d2ID),
+		NewStateChange(Update, NewInstanceID(d2ID), ContractDarcID, d2Buf, d2ID),
+	})
+	refs, ok, err = getDarcRefs(c, d1ID)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, [][]byte{c1.Slice()}, refs.Instances)
+	require.Nil(t, refs.Darcs)
+	refs, _, err = getDarcRefs(c, d2ID)
+	require.Nil(t, err)
+	require.Equal(t, [][]byte{b.Slice(), a.Slice()}, refs.Instances)
+
+	// Moving the last instance leaves the first darc unused.
+	store(StateChanges{
+		NewStateChange(Update, c1, "dummy", nil, d2ID),
+	})
+	_, ok, err = getDarcRefs(c, d1ID)
+	require.Nil(t, err)
+	require.False(t, ok)
+	require.Nil(t, checkDarcUnused(c, d1ID))
+
+	// Removing the instances removes them from the index.
+	store(StateChanges{
+		NewStateChange(Remove, a, "", nil, nil),
+		NewStateChange(Remove, b, "", nil, nil),
+		NewStateChange(Remove, c1, "", nil, nil),
+	})
+	_, ok, err = getDarcRefs(c, d2ID)
+	require.Nil(t, err)
+	require.False(t, ok)
+	require.Nil(t, checkDarcUnused(c, d2ID))
+}
@@ -0,0 +1,189 @@
+package byzcoin
+
+import (
+	"bytes"
+	"errors"
+	"math"
+
+	"github.com/dedis/cothority/byzcoin/collection"
+	"github.com/dedis/cothority/byzcoin/darc"
+	"github.com/dedis/protobuf"
+)
+
+// feeCoinContractID is the contract of the coin instances that pay and
+// receive the fees. It is the coin contract defined in the contracts
+// package, which cannot be imported from here.
+const feeCoinContractID = "coin"
+
+// feeFetchAction must be allowed by the darc of the coin paying the fee.
+const feeFetchAction = "invoke:fetch"
+
+// transactionFee returns the part of the fee of the transaction that depends
+// on its size.
+func (fr FeeRules) transactionFee(ctx ClientTransaction) (uint64, error) {
+	buf, err := protobuf.Encode(&ctx)
+	if err != nil {
+		return 0, err
+	}
+	return feeMul(fr.PricePerByte, uint64(len(buf)))
+}
+
+// addInstructionFee adds the fee of executing one instruction of the given
+// contract to fee.
+func (fr FeeRules) addInstructionFee(fee uint64, contractID string) (uint64, error) {
+	fee, err := feeAdd(fee, fr.PricePerInstruction)
+	if err != nil {
+		return 0, err
+	}
+	for _, cp := range fr.ContractPrices {
+		if cp.ContractID == contractID {
+			return feeAdd(fee, cp.Price)
+		}
+	}
+	return fee, nil
+}
+
+// feeCoin returns the coin given in the first instruction of the transaction
+// to pay the fee, or nil if there is none.
+func (ctx ClientTransaction) feeCoin() []byte {
+	if len(ctx.Instructions) == 0 {
+		return nil
+	}
+	return ctx.Instructions[0].FeeCoin
+}
+
+// verifyPayer checks that the coin given in the first instruction of the
+// transaction can pay the fee: it must be a coin of the same type as the
+// RewardCoin, and the signers of the first instruction must be allowed to
+// fetch coins from it. As the coin is part of the hash of the first
+// instruction, it cannot be replaced without invalidating its signatures.
+func (fr FeeRules) verifyPayer(coll CollectionView, ctx ClientTransaction) error {
+	if len(ctx.Instructions) == 0 {
+		return errors.New("no instructions")
+	}
+	for _, instr := range ctx.Instructions[1:] {
+		if len(instr.FeeCoin) > 0 {
+			return errors.New("only the first instruction can give a fee coin")
+		}
+	}
+	feeCoin := ctx.feeCoin()
+	if len(feeCoin) == 0 {
+		return errors.New("no coin given to pay the fee")
+	}
+	payer, _, err := loadFeeCoin(coll, feeCoin)
+	if err != nil {
+		return errors.New("couldn't load fee coin: " + err.Error())
+	}
+	reward, _, err := loadFeeCoin(coll, fr.RewardCoin.Slice())
+	if err != nil {
+		return errors.New("couldn't load reward coin: " + err.Error())
+	}
+	if !payer.Name.Equal(reward.Name) {
+		return errors.New("fee coin is not of the same type as the reward coin")
+	}
+
+	d, err := getInstanceDarc(coll, NewInstanceID(feeCoin))
+	if err != nil {
+		return errors.New("darc of fee coin not found: " + err.Error())
+	}
+	expr := d.Rules.Get(feeFetchAction)
+	if expr == nil {
+		return errors.New("darc of fee coin has no rule for " + feeFetchAction)
+	}
+	return darc.EvalExprWithSigs(expr, getDarcFromColl(coll), feeFetchAction,
+		ctx.Instructions[0].Signatures...)
+}
+
+// payFee returns the state changes that move fee coins from the coin given in
+// the first instruction to the RewardCoin. If partial is true and the coin doesn't
+// hold enough, all of its coins are moved, else an error is returned.
+func (fr FeeRules) payFee(coll CollectionView, ctx ClientTransaction, fee uint64, partial bool) (StateChanges, error) {
+	feeCoin := ctx.feeCoin()
+	if fee == 0 || bytes.Equal(feeCoin, fr.RewardCoin.Slice()) {
+		return nil, nil
+	}
+	payer, payerDarc, err := loadFeeCoin(coll, feeCoin)
+	if err != nil {
+		return nil, err
+	}
+	if payer.Value < fee {
+		if !partial {
+			return nil, errors.New("not enough coins to pay the fee")
+		}
+		fee = payer.Value
+	}
+	reward, rewardDarc, err := loadFeeCoin(coll, fr.RewardCoin.Slice())
+	if err != nil {
+		return nil, err
+	}
+	if err = payer.SafeSub(fee); err != nil {
+		return nil, err
+	}
+	if err = reward.SafeAdd(fee); err != nil {
+		return nil, err
+	}
+	payerBuf, err := protobuf.Encode(payer)
+	if err != nil {
+		return nil, err
+	}
+	rewardBuf, err := protobuf.Encode(reward)
+	if err != nil {
+		return nil, err
+	}
+	return StateChanges{
+		NewStateChange(Update, NewInstanceID(feeCoin), feeCoinContractID, payerBuf, payerDarc),
+		NewStateChange(Update, fr.RewardCoin, feeCoinContractID, rewardBuf, rewardDarc),
+	}, nil
+}
+
+// chargeRefused charges the fee of a transaction that got refused by a
+// contract on a clone of the collection as it was before the transaction. It
+// also stores the signer counters of the instructions that have been
+// verified, so that the refused transaction cannot be replayed to drain the
+// coin. It returns the new collection and the state changes. If nothing can
+// be charged, the collection is returned unchanged.
+func (fr FeeRules) chargeRefused(coll *collection.Trie, ctx ClientTransaction, fee uint64, counters StateChanges) (*collection.Trie, StateChanges) {
+	feeScs, err := fr.payFee(&roCollection{coll}, ctx, fee, true)
+	if err != nil {
+		return coll, nil
+	}
+	scs := append(feeScs, counters...)
+	collFee := coll.Clone()
+	for _, sc := range scs {
+		if err := storeInColl(collFee, &sc); err != nil {
+			return coll, nil
+		}
+	}
+	return collFee, scs
+}
+
+// loadFeeCoin returns the coin stored in the instance id, together with the
+// ID of its darc.
+func loadFeeCoin(coll CollectionView, id []byte) (*Coin, darc.ID, error) {
+	value, contractID, darcID, err := coll.GetValues(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if contractID != feeCoinContractID {
+		return nil, nil, errors.New("instance is not a coin but a " + contractID)
+	}
+	var coin Coin
+	if err = protobuf.Decode(value, &coin); err != nil {
+		return nil, nil, errors.New("couldn't unmarshal coin: " + err.Error())
+	}
+	return &coin, darcID, nil
+}
+
+func feeAdd(a, b uint64) (uint64, error) {
+	if a > math.MaxUint64-b {
+		return 0, errors.New("fee overflow")
+	}
+	return a + b, nil
+}
+
+func feeMul(a, b uint64) (uint64, error) {
+	if a != 0 && b > math.MaxUint64/a {
+		return 0, errors.New("fee overflow")
+	}
+	return a * b, nil
+}
@@ -0,0 +1,120 @@
+package byzcoin
+
+import (
+	"testing"
+
+	"github.com/dedis/cothority/byzcoin/collection"
+	"github.com/dedis/cothority/byzcoin/darc"
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeeRules_InstructionFee(t *testing.T) {
+	fr := FeeRules{
+		PricePerInstruction: 2,
+		ContractPrices:      []ContractPrice{{ContractID: "expensive", Price: 10}},
+	}
+	fee, err := fr.addInstructionFee(0, "cheap")
+	require.Nil(t, err)
+	require.Equal(t, uint64(2), fee)
+	fee, err = fr.addInstructionFee(fee, "expensive")
+	require.Nil(t, err)
+	require.Equal(t, uint64(14), fee)
+
+	fr.PricePerByte = 1 << 62
+	_, err = fr.transactionFee(ClientTransaction{
+		Instructions: Instructions{{FeeCoin: make([]byte, 32)}},
+	})
+	require.NotNil(t, err)
+}
+
+func TestFeeRules_Pay(t *testing.T) {
+	signer := darc.NewSignerEd25519(nil, nil)
+	ids := []darc.Identity{signer.Identity()}
+	d := darc.NewDarc(darc.InitRules(ids, ids), []byte("coin darc"))
+	require.Nil(t, d.Rules.AddRule(feeFetchAction, d.Rules.GetSignExpr()))
+	darcBuf, err := d.ToProto()
+	require.Nil(t, err)
+
+	coll, err := collection.NewTrie(nil, nil, collectionFields()...)
+	require.Nil(t, err)
+	require.Nil(t, storeInColl(coll, &StateChange{
+		StateAction: Create,
+		InstanceID:  NewInstanceID(d.GetBaseID()).Slice(),
+		ContractID:  []byte(ContractDarcID),
+		Value:       darcBuf,
+		DarcID:      d.GetBaseID(),
+	}))
+	payer := NewInstanceID([]byte("payer"))
+	reward := NewInstanceID([]byte("reward"))
+	storeCoin := func(id InstanceID, value uint64) {
+		buf, err := protobuf.Encode(&Coin{Value: value})
+		require.Nil(t, err)
+		sc := NewStateChange(Update, id, feeCoinContractID, buf, d.GetBaseID())
+		if _, _, _, err := getValueContract(&roCollection{coll}, id.Slice()); err != nil {
+			sc.StateAction = Create
+		}
+		require.Nil(t, storeInColl(coll, &sc))
+	}
+	coinValue := func(c *collection.Trie, id InstanceID) uint64 {
+		coin, _, err := loadFeeCoin(&roCollection{c}, id.Slice())
+		require.Nil(t, err)
+		return coin.Value
+	}
+	storeCoin(payer, 10)
+	storeCoin(reward, 0)
+
+	fr := FeeRules{RewardCoin: reward}
+	ctx := ClientTransaction{
+		Instructions: Instructions{{
+			Signatures: []darc.Signature{{Signer: signer.Identity()}},
+			FeeCoin:    payer.Slice(),
+		}},
+	}
+	require.Nil(t, fr.verifyPayer(&roCollection{coll}, ctx))
+
+	// Another signer is not allowed to pay with this coin.
+	other := darc.NewSignerEd25519(nil, nil)
+	ctxOther := ClientTransaction{
+		Instructions: Instructions{{
+			Signatures: []darc.Signature{{Signer: other.Identity()}},
+			FeeCoin:    payer.Slice(),
+		}},
+	}
+	require.NotNil(t, fr.verifyPayer(&roCollection{coll}, ctxOther))
+
+	// Only the first instruction can give the fee coin.
+	ctxSecond := ClientTransaction{
+		Instructions: Instructions{ctx.Instructions[0], {FeeCoin: payer.Slice()}},
+	}
+	require.NotNil(t, fr.verifyPayer(&roCollection{coll}, ctxSecond))
+
+	// The reward coin must exist.
+	frWrong := FeeRules{RewardCoin: NewInstanceID([]byte("unknown"))}
+	require.NotNil(t, frWrong.verifyPayer(&roCollection{coll}, ctx))
+
+	scs, err := fr.payFee(&roCollection{coll}, ctx, 4, false)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(scs))
+	for _, sc := range scs {
+		require.Nil(t, storeInColl(coll, &sc))
+	}
+	require.Equal(t, uint64(6), coinValue(coll, payer))
+	require.Equal(t, uint64(4), coinValue(coll, reward))
+
+	// Not enough coins left.
+	_, err = fr.payFee(&roCollection{coll}, ctx, 7, false)
+	require.NotNil(t, err)
+
+	// A refused transaction pays what is left and consumes the counters.
+	counter := NewStateChange(Create, NewInstanceID(signerCounterKey(signer.Identity().String())),
+		signerCounterContractID, make([]byte, 8), d.GetBaseID())
+	collFee, scs := fr.chargeRefused(coll, ctx, 7, StateChanges{counter})
+	require.Equal(t, 3, len(scs))
+	require.Equal(t, uint64(0), coinValue(collFee, payer))
+	require.Equal(t, uint64(10), coinValue(collFee, reward))
+	_, _, _, err = getValueContract(&roCollection{collFee}, signerCounterKey(signer.Identity().String()))
+	require.Nil(t, err)
+	// The original collection didn't change.
+	require.Equal(t, uint64(6), coinValue(coll, payer))
+}
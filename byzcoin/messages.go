@@ -13,6 +13,17 @@ func init() {
 	network.RegisterMessages(
 		&CreateGenesisBlock{}, &CreateGenesisBlockResponse{},
 		&AddTxRequest{}, &AddTxResponse{},
+		&GetSignerCounters{}, &GetSignerCountersResponse{},
+		&SimulateRequest{}, &SimulateResponse{},
+		&GetInstanceHistory{}, &GetInstanceHistoryResponse{},
+		&GetSnapshot{}, &GetSnapshotResponse{},
+		&GetSnapshotNodes{}, &GetSnapshotNodesResponse{},
+		&AddPendingTx{}, &AddPendingTxResponse{},
+		&SignPendingTx{}, &SignPendingTxResponse{},
+		&GetPendingTxs{}, &GetPendingTxsResponse{},
+		&GetDarcReferences{}, &GetDarcReferencesResponse{},
+		&GetDarcHistory{}, &GetDarcHistoryResponse{},
+		&StreamingRequest{}, &StreamingResponse{},
 	)
 }
 
@@ -22,4 +33,10 @@ func init() {
 type Version int
 
 // CurrentVersion is what we're running now
-const CurrentVersion Version = 1
+const CurrentVersion Version = 2
+
+// versionStateIndexes is the first version of a chain that stores the signer
+// counters, the time of the last update of the instances and the reverse
+// indexes of the darcs next to the instances. Older chains only store them
+// once update_config raises the version of their ChainConfig.
+const versionStateIndexes Version = 2
@@ -0,0 +1,235 @@
+package byzcoin
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dedis/cothority/byzcoin/darc"
+	"github.com/dedis/cothority/skipchain"
+)
+
+// pendingTxExpiry is how long a partially signed transaction is kept in the
+// pool of pending transactions.
+var pendingTxExpiry = 24 * time.Hour
+
+// maxPendingTxs is the maximum number of pending transactions of a
+// skipchain.
+const maxPendingTxs = 1000
+
+// maxPendingTxsPerSigner is the maximum number of pending transactions of a
+// skipchain added by the same signer, so that one signer cannot fill the
+// pool.
+const maxPendingTxsPerSigner = 20
+
+// pendingTxPool holds the partially signed transactions of every skipchain,
+// until they got all their signatures or expire. It is only kept in memory.
+type pendingTxPool struct {
+	sync.Mutex
+	txsMap map[string]map[string]pendingEntry
+}
+
+// pendingEntry is a pending transaction with the signers that signed it when
+// it was added, which are charged for it.
+type pendingEntry struct {
+	ptx     PendingTx
+	signers []string
+}
+
+func newPendingTxPool() pendingTxPool {
+	return pendingTxPool{
+		txsMap: make(map[string]map[string]pendingEntry),
+	}
+}
+
+// expire removes the expired transactions of the skipchain key. The caller
+// must hold the lock.
+func (p *pendingTxPool) expire(key string) map[string]pendingEntry {
+	txs, ok := p.txsMap[key]
+	if !ok {
+		txs = make(map[string]pendingEntry)
+		p.txsMap[key] = txs
+	}
+	now := time.Now().Unix()
+	for id, e := range txs {
+		if e.ptx.Expiry <= now {
+			delete(txs, id)
+		}
+	}
+	return txs
+}
+
+// add stores a new pending transaction, added by the given signers.
+func (p *pendingTxPool) add(key string, ptx PendingTx, signers []string) error {
+	p.Lock()
+	defer p.Unlock()
+
+	txs := p.expire(key)
+	if _, ok := txs[string(ptx.ID)]; ok {
+		return errors.New("transaction is already pending")
+	}
+	if len(txs) >= maxPendingTxs {
+		return errors.New("too many pending transactions")
+	}
+	count := make(map[string]int)
+	for _, e := range txs {
+		for _, signer := range e.signers {
+			count[signer]++
+		}
+	}
+	for _, signer := range signers {
+		if count[signer] >= maxPendingTxsPerSigner {
+			return fmt.Errorf("too many pending transactions of %s", signer)
+		}
+	}
+	txs[string(ptx.ID)] = pendingEntry{ptx: ptx, signers: signers}
+	return nil
+}
+
+// update calls fn with a copy of the pending transaction and stores the
+// changes if fn returns no error.
+func (p *pendingTxPool) update(key string, id []byte, fn func(*ClientTransaction) error) error {
+	p.Lock()
+	defer p.Unlock()
+
+	txs := p.expire(key)
+	e, ok := txs[string(id)]
+	if !ok {
+		return errors.New("unknown pending transaction")
+	}
+	tx := e.ptx.Transaction.copy()
+	if err := fn(&tx); err != nil {
+		return err
+	}
+	e.ptx.Transaction = tx
+	txs[string(id)] = e
+	return nil
+}
+
+// take removes the pending transaction from the pool and returns it.
+func (p *pendingTxPool) take(key string, id []byte) (ClientTransaction, bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	txs := p.expire(key)
+	e, ok := txs[string(id)]
+	if !ok {
+		return ClientTransaction{}, false
+	}
+	delete(txs, string(id))
+	return e.ptx.Transaction, true
+}
+
+// list returns the pending transactions of the skipchain key, the first to
+// expire first.
+func (p *pendingTxPool) list(key string) []PendingTx {
+	p.Lock()
+	defer p.Unlock()
+
+	var res []PendingTx
+	for _, e := range p.expire(key) {
+		res = append(res, e.ptx)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Expiry < res[j].Expiry
+	})
+	return res
+}
+
+// copy returns a copy of the transaction where the signatures of the
+// instructions can be changed without changing the original.
+func (ctx ClientTransaction) copy() ClientTransaction {
+	instrs := make(Instructions, len(ctx.Instructions))
+	for i, instr := range ctx.Instructions {
+		instr.Signatures = append([]darc.Signature(nil), instr.Signatures...)
+		instrs[i] = instr
+	}
+	ctx.Instructions = instrs
+	return ctx
+}
+
+// checkPendingTx verifies the signatures that are already in the
+// transaction and the counters of their signers. It returns true if the
+// signatures collected so far satisfy the rules of the darc of every
+// instruction, so that the transaction can be submitted, and the sorted
+// identities of the signers that signed at least one instruction. The
+// instructions are checked as if they were in the next block, and their
+// instances must exist.
+func (s *Service) checkPendingTx(scID skipchain.SkipBlockID, tx ClientTransaction) (bool, []string, error) {
+	latest, err := s.db().GetLatestByID(scID)
+	if err != nil {
+		return false, nil, err
+	}
+	bc := blockContext{index: latest.Index + 1, timestamp: time.Now().UnixNano()}
+	coll := &blockCollection{roCollection{s.getCollection(scID).coll}, bc}
+
+	complete := true
+	allSigned := true
+	signed := make(map[string]bool)
+	for i, instr := range tx.Instructions {
+		if len(instr.Signatures) == 0 {
+			return false, nil, fmt.Errorf("instruction %d has no signers", i)
+		}
+		if len(instr.SignerCounter) != len(instr.Signatures) {
+			return false, nil, fmt.Errorf("instruction %d: got %d signer counters for %d signatures",
+				i, len(instr.SignerCounter), len(instr.Signatures))
+		}
+		d, err := getInstanceDarc(coll, instr.InstanceID)
+		if err != nil {
+			return false, nil, fmt.Errorf("instruction %d: darc not found: %s", i, err)
+		}
+		req, err := instr.ToDarcRequest(d.GetBaseID())
+		if err != nil {
+			return false, nil, fmt.Errorf("instruction %d: %s", i, err)
+		}
+		digest := req.Hash()
+		var sigs []darc.Signature
+		for j, sig := range instr.Signatures {
+			// The counter is checked for the signers that didn't sign
+			// yet too, as their signature would be refused later on.
+			id := sig.Signer.String()
+			ctr, err := getSignerCounter(coll, id)
+			if err != nil {
+				return false, nil, err
+			}
+			if instr.SignerCounter[j] != ctr+1 {
+				return false, nil, fmt.Errorf("instruction %d: counter of %s is %d, expected %d",
+					i, id, instr.SignerCounter[j], ctr+1)
+			}
+			if len(sig.Signature) == 0 {
+				allSigned = false
+				continue
+			}
+			if err := sig.Signer.VerifyAt(digest, sig.Signature, blockTime(coll)); err != nil {
+				return false, nil, fmt.Errorf("instruction %d: invalid signature of %s: %s", i, sig.Signer, err)
+			}
+			signed[id] = true
+			sigs = append(sigs, sig)
+		}
+		// A threshold or an OR rule can be satisfied before every signer
+		// signed.
+		action := darc.Action(instr.Action())
+		if darc.EvalExprWithSigs(d.Rules.Get(action), getDarcFromColl(coll), action, sigs...) != nil {
+			complete = false
+		}
+	}
+	var signers []string
+	for id := range signed {
+		signers = append(signers, id)
+	}
+	sort.Strings(signers)
+	if !complete && !allSigned {
+		return false, signers, nil
+	}
+
+	// Either the rules are satisfied, or all the signers signed and the
+	// transaction will never pass, so it must be verified like in a block.
+	for i, instr := range tx.Instructions {
+		if err := instr.VerifyDarcSignature(coll); err != nil {
+			return false, nil, fmt.Errorf("instruction %d: %s", i, err)
+		}
+	}
+	return true, signers, nil
+}
@@ -43,6 +43,56 @@ func NewProof(c CollectionView, s *skipchain.SkipBlockDB, id skipchain.SkipBlock
 	return
 }
 
+// NewProofAt is like NewProof, but proves the state of the collection c at
+// the block target instead of the latest block. The links go from the block
+// id to target, and c must be the state of the collection after target has
+// been applied.
+func NewProofAt(c CollectionView, s *skipchain.SkipBlockDB, id skipchain.SkipBlockID,
+	target *skipchain.SkipBlock, key []byte) (p *Proof, err error) {
+	p = &Proof{}
+	p.InclusionProof, err = c.Get(key).Proof()
+	if err != nil {
+		return
+	}
+	sb := s.GetByID(id)
+	if sb == nil {
+		return nil, errors.New("didn't find skipchain")
+	}
+	if sb.Index > target.Index {
+		return nil, errors.New("the requested block is before the given ID")
+	}
+	p.Links = []skipchain.ForwardLink{{
+		From:      []byte{},
+		To:        id,
+		NewRoster: sb.Roster,
+	}}
+	for !sb.Hash.Equal(target.Hash) {
+		// Take the highest forward link that doesn't jump over the
+		// target.
+		var next *skipchain.SkipBlock
+		for i := len(sb.ForwardLink) - 1; i >= 0 && next == nil; i-- {
+			link := sb.ForwardLink[i]
+			if link == nil || link.IsEmpty() {
+				continue
+			}
+			to := s.GetByID(link.To)
+			if to == nil {
+				return nil, errors.New("missing block in chain")
+			}
+			if to.Index <= target.Index {
+				p.Links = append(p.Links, *link)
+				next = to
+			}
+		}
+		if next == nil {
+			return nil, errors.New("no forward link to the requested block")
+		}
+		sb = next
+	}
+	p.Latest = *sb
+	return
+}
+
 // ErrorVerifyCollection is returned if the collection-proof itself
 // is not properly set up.
 var ErrorVerifyCollection = errors.New("collection inclusion proof is wrong")
@@ -63,6 +63,9 @@ type CreateGenesisBlock struct {
 	// Maximum block size. Zero (or not present in protobuf) means use the default, 4 megs.
 	// optional
 	MaxBlockSize int
+	// SnapshotInterval is the number of blocks between two snapshots of
+	// the state. Zero means use the default, 1000 blocks.
+	SnapshotInterval int `protobuf:"opt"`
 }
 
 // CreateGenesisBlockResponse holds the genesis-block of the new skipchain.
@@ -90,6 +93,12 @@ type AddTxRequest struct {
 type AddTxResponse struct {
 	// Version of the protocol
 	Version Version
+	// Accepted is true if the transaction has been included in a block and
+	// has been accepted. It is only set if InclusionWait is bigger than 0.
+	Accepted bool `protobuf:"opt"`
+	// Error holds the reason why the transaction got refused. It is only
+	// set if InclusionWait is bigger than 0 and Accepted is false.
+	Error string `protobuf:"opt"`
 }
 
 // GetProof returns the proof that the given key is in the collection.
@@ -101,6 +110,10 @@ type GetProof struct {
 	// ID is any block that is known to us in the skipchain, can be the genesis
 	// block or any later block. The proof returned will be starting at this block.
 	ID skipchain.SkipBlockID
+	// BlockID, if given, is the block whose state is proven, instead of
+	// the latest one. It must not be before ID. The proof can then be
+	// verified against the CollectionRoot of this block.
+	BlockID skipchain.SkipBlockID `protobuf:"opt"`
 }
 
 // GetProofResponse can be used together with the Genesis block to proof that
@@ -113,6 +126,327 @@ type GetProofResponse struct {
 	Proof Proof
 }
 
+// GetSignerCounters is a request to get the counters that the next
+// instruction of the given signer identities must use.
+type GetSignerCounters struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// SignerIDs holds the string representation of the identities, as
+	// returned by darc.Identity.String.
+	SignerIDs []string
+}
+
+// GetSignerCountersResponse holds the next expected counters of the signers,
+// in the same order as in the request. An identity that never signed an
+// accepted instruction has to start with the counter 1.
+type GetSignerCountersResponse struct {
+	// Version of the protocol
+	Version Version
+	// Counters are the next expected counters of the signers.
+	Counters []uint64
+}
+
+// SimulateRequest asks the service to execute a transaction on the current
+// state of the skipchain, without storing anything.
+type SimulateRequest struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// Transaction to be simulated
+	Transaction ClientTransaction
+}
+
+// SimulateResponse holds the result of executing the transaction.
+type SimulateResponse struct {
+	// Version of the protocol
+	Version Version
+	// Accepted is true if the transaction would be accepted.
+	Accepted bool
+	// Error holds the reason why the transaction would be refused.
+	Error string `protobuf:"opt"`
+	// StateChanges are the changes the transaction would make to the
+	// instances, without the values stored by the service, like the signer
+	// counters. If the transaction is refused, they only hold the fee that
+	// would be paid anyway.
+	StateChanges []StateChange
+	// Coins are the coins that are left after the last instruction.
+	Coins []Coin
+}
+
+// GetInstanceHistory asks for the state changes of an instance, in the order
+// they have been applied. As an instance can have many state changes, they
+// are returned by pages.
+type GetInstanceHistory struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// InstanceID of the instance
+	InstanceID InstanceID
+	// Start is the number of state changes to skip.
+	Start int
+	// Count is the maximum number of state changes to return. If it is 0,
+	// or bigger than the maximum of the service, the maximum is used.
+	Count int `protobuf:"opt"`
+}
+
+// GetInstanceHistoryResponse holds one page of the state changes of an
+// instance.
+type GetInstanceHistoryResponse struct {
+	// Version of the protocol
+	Version Version
+	// Entries are the state changes, starting at the requested one.
+	Entries []HistoryEntry
+	// Total is the number of state changes of the instance.
+	Total int
+}
+
+// HistoryEntry is a state change together with the index of the block that
+// holds it.
+type HistoryEntry struct {
+	// BlockIndex is the index of the block holding the state change.
+	BlockIndex int
+	// StateChange is the change of the instance.
+	StateChange StateChange
+}
+
+// Snapshot is the state of a skipchain after one of its blocks, identified
+// by the root of the trie holding it. The root must be the CollectionRoot of
+// the header of the block.
+type Snapshot struct {
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// BlockID is the hash of the block after which the state is taken.
+	BlockID skipchain.SkipBlockID
+	// Index is the index of the block.
+	Index int
+	// CollectionRoot is the root of the trie of the state.
+	CollectionRoot []byte
+}
+
+// GetSnapshot asks a conode for the latest snapshot it has taken of the
+// state of a skipchain.
+type GetSnapshot struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+}
+
+// GetSnapshotResponse holds the latest snapshot of the conode, signed by it.
+type GetSnapshotResponse struct {
+	// Version of the protocol
+	Version Version
+	// Snapshot is the latest snapshot.
+	Snapshot Snapshot
+	// Signature is the schnorr signature of the conode on the hash of
+	// the snapshot.
+	Signature []byte
+}
+
+// GetSnapshotNodes asks for the nodes of the trie of a snapshot, to
+// download the state chunk by chunk.
+type GetSnapshotNodes struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// Labels of the nodes to return.
+	Labels [][]byte
+}
+
+// GetSnapshotNodesResponse holds the encoded nodes of the trie, in the order
+// of the labels of the request.
+type GetSnapshotNodesResponse struct {
+	// Version of the protocol
+	Version Version
+	// Nodes are the encoded nodes.
+	Nodes [][]byte
+}
+
+// AddPendingTx stores a partially signed transaction in the pool of pending
+// transactions of the conode, where the other signers can find it and add
+// their signatures. As the identities are part of the signed digest, every
+// instruction must already hold all its signers, with an empty signature for
+// the missing ones. At least one of the signers must already have signed.
+type AddPendingTx struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// Transaction is the partially signed transaction.
+	Transaction ClientTransaction
+}
+
+// AddPendingTxResponse tells whether the transaction has been submitted or
+// is waiting for signatures.
+type AddPendingTxResponse struct {
+	// Version of the protocol
+	Version Version
+	// ID of the pending transaction, the hash of its instructions.
+	ID []byte
+	// Submitted is true if the signatures of the transaction already
+	// satisfied the rules of its darcs and it has been submitted.
+	Submitted bool
+}
+
+// SignPendingTx adds signatures to a pending transaction. Once the
+// signatures satisfy the rules of the darc of every instruction, the
+// transaction is submitted and removed from the pool. The signers that did
+// not sign yet are skipped and keep their counters.
+type SignPendingTx struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// ID of the pending transaction.
+	ID []byte
+	// Signatures to add to the instructions.
+	Signatures []InstructionSignature
+}
+
+// InstructionSignature is the signature of one instruction of a pending
+// transaction.
+type InstructionSignature struct {
+	// Index of the instruction in the transaction.
+	Index int
+	// Signature of the instruction, its signer must be one of the signers
+	// of the instruction.
+	Signature darc.Signature
+}
+
+// SignPendingTxResponse tells whether the transaction has been submitted.
+type SignPendingTxResponse struct {
+	// Version of the protocol
+	Version Version
+	// Submitted is true if the transaction got all its signatures and has
+	// been submitted.
+	Submitted bool
+}
+
+// GetPendingTxs asks for the pending transactions of a skipchain.
+type GetPendingTxs struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+}
+
+// GetPendingTxsResponse holds the pending transactions of the conode.
+type GetPendingTxsResponse struct {
+	// Version of the protocol
+	Version Version
+	// Transactions are the pending transactions, the first to expire
+	// first.
+	Transactions []PendingTx
+}
+
+// PendingTx is a transaction that waits for signatures.
+type PendingTx struct {
+	// ID of the pending transaction, the hash of its instructions.
+	ID []byte
+	// Transaction with the signatures added so far.
+	Transaction ClientTransaction
+	// Expiry is the time in seconds since the Unix epoch at which the
+	// transaction is removed from the pool.
+	Expiry int64
+}
+
+// GetDarcReferences asks for what depends on a darc, as stored in its
+// reverse index.
+type GetDarcReferences struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// DarcID is the base ID of the darc.
+	DarcID darc.ID
+}
+
+// GetDarcReferencesResponse lists what depends on a darc. The darc can only
+// be deleted if both lists are empty.
+type GetDarcReferencesResponse struct {
+	// Version of the protocol
+	Version Version
+	// Instances are the instances controlled by the darc, except the darc
+	// itself.
+	Instances []InstanceID
+	// Darcs are the base IDs of the darcs that delegate to the darc.
+	Darcs []darc.ID
+}
+
+// GetDarcHistory asks for the versions of a darc. As every version comes
+// with a proof, they are returned by pages.
+type GetDarcHistory struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+	// DarcID is the base ID of the darc.
+	DarcID darc.ID
+	// Start is the number of state changes of the darc to skip.
+	Start int
+	// Count is the maximum number of state changes of the darc to return
+	// the versions of. If it is 0, or bigger than the maximum of the
+	// service, the maximum is used.
+	Count int `protobuf:"opt"`
+}
+
+// GetDarcHistoryResponse holds one page of the versions of a darc, the
+// oldest first.
+type GetDarcHistoryResponse struct {
+	// Version of the protocol
+	Version Version
+	// Versions of the darc, only the ones stored since the conode keeps the
+	// history of the instances are available.
+	Versions []DarcVersion
+	// Total is the number of state changes of the darc. A page can hold
+	// fewer versions than state changes, as the removal of the darc is not
+	// a version.
+	Total int
+}
+
+// DarcVersion is one version of a darc, as it has been stored by a block.
+type DarcVersion struct {
+	// Darc is this version of the darc.
+	Darc darc.Darc
+	// BlockIndex is the index of the block that stored this version.
+	BlockIndex int
+	// Signatures are the signatures of the instruction that spawned or
+	// evolved the darc to this version. They are empty if the darc has not
+	// been given in the "darc" argument of an instruction, e.g. if another
+	// contract stored it.
+	Signatures []darc.Signature
+	// Proof proves that the darc is in the state after the block with the
+	// index BlockIndex. Later versions of the darc in the same block are
+	// also proven with the state after the block.
+	Proof Proof
+}
+
+// StreamingRequest asks the service to stream every new block of the
+// skipchain to the client, as long as the connection stays open.
+type StreamingRequest struct {
+	// Version of the protocol
+	Version Version
+	// SkipchainID is the hash of the first skipblock
+	SkipchainID skipchain.SkipBlockID
+}
+
+// StreamingResponse is sent to the client for every new block of the
+// skipchain.
+type StreamingResponse struct {
+	// Version of the protocol
+	Version Version
+	// Block is the new skipblock.
+	Block *skipchain.SkipBlock
+	// Body is the decoded payload of the block, it holds the TxResults of
+	// the block.
+	Body *DataBody
+}
+
 // ChainConfig stores all the configuration information for one skipchain. It will
 // be stored under the key "GenesisDarcID || OneNonce", in the collections. The
 // GenesisDarcID is the value of GenesisReferenceID.
@@ -120,6 +454,41 @@ type ChainConfig struct {
 	BlockInterval time.Duration
 	Roster        onet.Roster
 	MaxBlockSize  int
+	// Fees holds the rules to compute the fee of a transaction. If it is
+	// nil, the transactions are free.
+	Fees *FeeRules `protobuf:"opt"`
+	// SnapshotInterval is the number of blocks between two snapshots of
+	// the state. If it is 0, a snapshot is taken every 1000 blocks.
+	SnapshotInterval int `protobuf:"opt"`
+	// Version of the chain, which decides what the service stores in the
+	// collection next to the instances. It is the CurrentVersion of the
+	// node that created the genesis block and can only be raised.
+	Version Version `protobuf:"opt"`
+}
+
+// FeeRules define how much a transaction costs. The fee of a transaction is
+// the sum of PricePerByte times the size of the transaction, and of
+// PricePerInstruction plus the price of the contract for every executed
+// instruction. The fee is paid by the coin given in the transaction and is
+// sent to the RewardCoin.
+type FeeRules struct {
+	// PricePerInstruction is paid for every executed instruction.
+	PricePerInstruction uint64
+	// PricePerByte is paid for every byte of the transaction.
+	PricePerByte uint64
+	// ContractPrices is paid, in addition to the PricePerInstruction, for
+	// every instruction that executes one of these contracts.
+	ContractPrices []ContractPrice
+	// RewardCoin is the coin instance that gets the fees.
+	RewardCoin InstanceID
+}
+
+// ContractPrice is the price of executing an instruction of a contract.
+type ContractPrice struct {
+	// ContractID of the contract.
+	ContractID string
+	// Price is paid for every instruction that executes this contract.
+	Price uint64
 }
 
 // Proof represents everything necessary to verify a given
@@ -147,9 +516,9 @@ type Instruction struct {
 	// InstanceID is either the instance that can spawn a new instance, or the instance
 	// that will be invoked or deleted.
 	InstanceID InstanceID
-	// Nonce is monotonically increasing with regard to the Darc controlling
-	// access to the instance. It is used to prevent replay attacks.
-	// The client has to track what the next nonce should be for a given Darc.
+	// Nonce is a random value chosen by the client so that two otherwise
+	// identical instructions have different hashes. Replay protection is
+	// done using SignerCounter.
 	Nonce Nonce
 	// Index and length prevent a leader from censoring specific instructions from
 	// a client and still keep the other instructions valid.
@@ -165,6 +534,17 @@ type Instruction struct {
 	Delete *Delete
 	// Signatures that are verified using the Darc controlling access to the instance.
 	Signatures []darc.Signature
+	// SignerCounter holds one counter for every signature, in the same
+	// order. It must be the latest counter of the signer plus one. It is
+	// used to prevent replay attacks. The client can get the next expected
+	// counters with GetSignerCounters.
+	SignerCounter []uint64
+	// FeeCoin is the instance of the coin that pays the fee of the
+	// transaction. It is only needed if the ChainConfig defines fees, and
+	// only the first instruction of a transaction may set it, so that it is
+	// covered by the signatures of that instruction. Its signers must be
+	// allowed to "invoke:fetch" on this coin.
+	FeeCoin []byte `protobuf:"opt"`
 }
 
 // Spawn is called upon an existing instance that will spawn a new instance.
@@ -207,6 +587,9 @@ type ClientTransaction struct {
 type TxResult struct {
 	ClientTransaction ClientTransaction
 	Accepted          bool
+	// Error holds the reason why the transaction got refused. It is not
+	// part of the hash of the transactions, so it is only informative.
+	Error string `protobuf:"opt"`
 }
 
 // StateChange is one new state that will be applied to the collection.
@@ -19,6 +19,7 @@ import (
 	"github.com/dedis/cothority/messaging"
 	"github.com/dedis/cothority/skipchain"
 	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/schnorr"
 	"github.com/dedis/kyber/util/random"
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/log"
@@ -39,6 +40,15 @@ const rotationWindow time.Duration = 10
 
 const noTimeout time.Duration = 0
 
+// maxHistoryCount is the maximum number of state changes returned by
+// GetInstanceHistory.
+const maxHistoryCount = 1000
+
+// maxDarcHistoryCount is the maximum number of state changes whose versions
+// are returned by GetDarcHistory. It is lower than maxHistoryCount, as every
+// version needs a proof.
+const maxDarcHistoryCount = 100
+
 const collectTxProtocol = "CollectTxProtocol"
 
 const viewChangeSubFtCosi = "viewchange_sub_ftcosi"
@@ -90,6 +100,10 @@ type Service struct {
 	// restarting after shutdown, answer getTxs requests and so on.
 	txBuffer txBuffer
 
+	// pendingTxs holds the transactions that wait for the signatures of
+	// other signers.
+	pendingTxs pendingTxPool
+
 	heartbeats             heartbeats
 	heartbeatsTimeout      chan string
 	closeLeaderMonitorChan chan bool
@@ -175,6 +189,12 @@ func (s *Service) CreateGenesisBlock(req *CreateGenesisBlock) (
 	bsBuf := make([]byte, 8)
 	binary.PutVarint(bsBuf, int64(req.MaxBlockSize))
 
+	snapBuf := make([]byte, 8)
+	binary.PutVarint(snapBuf, int64(req.SnapshotInterval))
+
+	versionBuf := make([]byte, 8)
+	binary.PutVarint(versionBuf, int64(CurrentVersion))
+
 	rosterBuf, err := protobuf.Encode(&req.Roster)
 	if err != nil {
 		return nil, err
@@ -186,6 +206,8 @@ func (s *Service) CreateGenesisBlock(req *CreateGenesisBlock) (
 			{Name: "darc", Value: darcBuf},
 			{Name: "block_interval", Value: intervalBuf},
 			{Name: "max_block_size", Value: bsBuf},
+			{Name: "snapshot_interval", Value: snapBuf},
+			{Name: "version", Value: versionBuf},
 			{Name: "roster", Value: rosterBuf},
 		},
 	}
@@ -202,7 +224,7 @@ func (s *Service) CreateGenesisBlock(req *CreateGenesisBlock) (
 		}},
 	})
 
-	sb, err := s.createNewBlock(nil, &req.Roster, transaction)
+	sb, err := s.createNewBlock(nil, &req.Roster, transaction, time.Now().UnixNano())
 	if err != nil {
 		return nil, err
 	}
@@ -256,7 +278,7 @@ func (s *Service) AddTransaction(req *AddTxRequest) (*AddTxResponse, error) {
 		ch := s.state.createWaitChannel(ctxHash)
 		defer s.state.deleteWaitChannel(ctxHash)
 
-		blockCh := make(chan skipchain.SkipBlockID, 10)
+		blockCh := make(chan *skipchain.SkipBlock, 10)
 		z := s.state.registerForBlocks(blockCh)
 		defer s.state.unregisterForBlocks(z)
 
@@ -270,15 +292,16 @@ func (s *Service) AddTransaction(req *AddTxRequest) (*AddTxResponse, error) {
 
 		blocksLeft := req.InclusionWait
 
-		for found := false; !found; {
+		for {
 			select {
-			case success := <-ch:
-				if !success {
-					return nil, errors.New("transaction is in block, but got refused")
-				}
-				found = true
-			case id := <-blockCh:
-				if id.Equal(req.SkipchainID) {
+			case res := <-ch:
+				return &AddTxResponse{
+					Version:  CurrentVersion,
+					Accepted: res.Accepted,
+					Error:    res.Error,
+				}, nil
+			case sb := <-blockCh:
+				if sb.SkipChainID().Equal(req.SkipchainID) {
 					blocksLeft--
 				}
 				if blocksLeft == 0 {
@@ -309,9 +332,32 @@ func (s *Service) GetProof(req *GetProof) (resp *GetProofResponse, err error) {
 		err = errors.New("cannot find skipblock while getting proof")
 		return
 	}
-	proof, err := NewProof(s.GetCollectionView(sb.SkipChainID()), s.db(), req.ID, req.Key)
-	if err != nil {
-		return
+	var proof *Proof
+	if req.BlockID == nil {
+		proof, err = NewProof(s.GetCollectionView(sb.SkipChainID()), s.db(), req.ID, req.Key)
+		if err != nil {
+			return
+		}
+	} else {
+		sbAt := s.db().GetByID(req.BlockID)
+		if sbAt == nil || !sbAt.SkipChainID().Equal(sb.SkipChainID()) {
+			err = errors.New("cannot find the requested block in the skipchain")
+			return
+		}
+		var header DataHeader
+		err = protobuf.DecodeWithConstructors(sbAt.Data, &header, network.DefaultConstructors(cothority.Suite))
+		if err != nil {
+			return
+		}
+		var coll CollectionView
+		coll, err = s.getCollection(sb.SkipChainID()).viewAt(header.CollectionRoot)
+		if err != nil {
+			return
+		}
+		proof, err = NewProofAt(coll, s.db(), req.ID, sbAt, req.Key)
+		if err != nil {
+			return
+		}
 	}
 
 	// Sanity check
@@ -325,6 +371,401 @@ func (s *Service) GetProof(req *GetProof) (resp *GetProofResponse, err error) {
 	return
 }
 
+// GetSignerCounters returns the counters that the next instruction of each
+// of the given signers must use.
+func (s *Service) GetSignerCounters(req *GetSignerCounters) (*GetSignerCountersResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if s.db().GetByID(req.SkipchainID) == nil {
+		return nil, errors.New("unknown skipchain")
+	}
+	coll := s.GetCollectionView(req.SkipchainID)
+	counters := make([]uint64, len(req.SignerIDs))
+	for i, id := range req.SignerIDs {
+		ctr, err := getSignerCounter(coll, id)
+		if err != nil {
+			return nil, err
+		}
+		counters[i] = ctr + 1
+	}
+	return &GetSignerCountersResponse{
+		Version:  CurrentVersion,
+		Counters: counters,
+	}, nil
+}
+
+// StreamBlocks is the streaming handler that sends every new block of the
+// requested skipchain to the client, until the client closes the connection.
+// The blocks are queued, so a slow client does not hold back the creation of
+// new blocks.
+func (s *Service) StreamBlocks(req *StreamingRequest) (chan *StreamingResponse, chan bool, error) {
+	if req.Version != CurrentVersion {
+		return nil, nil, errors.New("version mismatch")
+	}
+	if !s.isOurChain(req.SkipchainID) {
+		return nil, nil, errors.New("unknown skipchain")
+	}
+
+	blockCh := make(chan *skipchain.SkipBlock, 10)
+	z := s.state.registerForBlocks(blockCh)
+	outChan := make(chan *StreamingResponse)
+	stopChan := make(chan bool)
+
+	go func() {
+		defer func() {
+			// Drain the block channel while unregistering, else
+			// informBlock might block forever on a full channel.
+			done := make(chan bool)
+			go func() {
+				for {
+					select {
+					case <-blockCh:
+					case <-done:
+						return
+					}
+				}
+			}()
+			s.state.unregisterForBlocks(z)
+			close(done)
+		}()
+
+		var queue []*StreamingResponse
+		for {
+			// A nil channel blocks forever, so nothing is sent as long
+			// as the queue is empty.
+			var out chan *StreamingResponse
+			var next *StreamingResponse
+			if len(queue) > 0 {
+				out = outChan
+				next = queue[0]
+			}
+			select {
+			case sb := <-blockCh:
+				if !sb.SkipChainID().Equal(req.SkipchainID) {
+					continue
+				}
+				var body DataBody
+				err := protobuf.DecodeWithConstructors(sb.Payload, &body, network.DefaultConstructors(cothority.Suite))
+				if err != nil {
+					log.Error(s.ServerIdentity(), "could not unmarshal body", err)
+					continue
+				}
+				queue = append(queue, &StreamingResponse{
+					Version: CurrentVersion,
+					Block:   sb,
+					Body:    &body,
+				})
+			case out <- next:
+				queue = queue[1:]
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+
+	return outChan, stopChan, nil
+}
+
+// Simulate executes the transaction on a clone of the current collection,
+// the same way it would be executed in a new block, and returns the result.
+// Nothing is stored and the transaction is not sent to the leader.
+func (s *Service) Simulate(req *SimulateRequest) (*SimulateResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if len(req.Transaction.Instructions) == 0 {
+		return nil, errors.New("no instructions to simulate")
+	}
+	if !s.isOurChain(req.SkipchainID) {
+		return nil, errors.New("unknown skipchain")
+	}
+	// The state is cloned while no block is applied, so that the
+	// simulation runs on a consistent state.
+	cdb := s.getCollection(req.SkipchainID)
+	cdb.updateMutex.Lock()
+	latest, err := s.db().GetLatestByID(req.SkipchainID)
+	if err != nil {
+		cdb.updateMutex.Unlock()
+		return nil, err
+	}
+	coll := cdb.coll.Clone()
+	cdb.updateMutex.Unlock()
+
+	// The transaction is executed as if it was in the next block.
+	bc := blockContext{index: latest.Index + 1, timestamp: time.Now().UnixNano()}
+	_, scs, cout, err := s.executeTransaction(coll, bc, loadBlockConfig(coll), nil, req.Transaction)
+	resp := &SimulateResponse{
+		Version:      CurrentVersion,
+		Accepted:     err == nil,
+		StateChanges: publicStateChanges(scs),
+		Coins:        cout,
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp, nil
+}
+
+// GetInstanceHistory returns one page of the state changes of an instance,
+// as stored in the history index of the collection.
+func (s *Service) GetInstanceHistory(req *GetInstanceHistory) (*GetInstanceHistoryResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if !s.isOurChain(req.SkipchainID) {
+		return nil, errors.New("unknown skipchain")
+	}
+	if req.Start < 0 || req.Count < 0 {
+		return nil, errors.New("negative start or count")
+	}
+	count := req.Count
+	if count == 0 || count > maxHistoryCount {
+		count = maxHistoryCount
+	}
+	entries, total, err := s.getCollection(req.SkipchainID).getHistory(req.InstanceID.Slice(), req.Start, count)
+	if err != nil {
+		return nil, err
+	}
+	return &GetInstanceHistoryResponse{
+		Version: CurrentVersion,
+		Entries: entries,
+		Total:   total,
+	}, nil
+}
+
+// GetDarcReferences returns the instances controlled by a darc and the darcs
+// that delegate to it.
+func (s *Service) GetDarcReferences(req *GetDarcReferences) (*GetDarcReferencesResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if !s.isOurChain(req.SkipchainID) {
+		return nil, errors.New("unknown skipchain")
+	}
+	refs, _, err := getDarcRefs(&roCollection{s.getCollection(req.SkipchainID).coll}, req.DarcID)
+	if err != nil {
+		return nil, err
+	}
+	resp := &GetDarcReferencesResponse{Version: CurrentVersion}
+	for _, iid := range refs.Instances {
+		resp.Instances = append(resp.Instances, NewInstanceID(iid))
+	}
+	for _, id := range refs.Darcs {
+		resp.Darcs = append(resp.Darcs, darc.ID(id))
+	}
+	return resp, nil
+}
+
+// GetDarcHistory returns one page of the versions of a darc, each with the
+// signatures that authorised it and a proof against the skipchain.
+func (s *Service) GetDarcHistory(req *GetDarcHistory) (*GetDarcHistoryResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if !s.isOurChain(req.SkipchainID) {
+		return nil, errors.New("unknown skipchain")
+	}
+	if req.Start < 0 || req.Count < 0 {
+		return nil, errors.New("negative start or count")
+	}
+	count := req.Count
+	if count == 0 || count > maxDarcHistoryCount {
+		count = maxDarcHistoryCount
+	}
+	entries, total, err := s.getCollection(req.SkipchainID).getHistory(req.DarcID, req.Start, count)
+	if err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, errors.New("no version of this darc found")
+	}
+	resp := &GetDarcHistoryResponse{Version: CurrentVersion, Total: total}
+	for _, e := range entries {
+		sc := e.StateChange
+		if sc.StateAction == Remove || string(sc.ContractID) != ContractDarcID {
+			continue
+		}
+		v, err := s.darcVersion(req.SkipchainID, req.DarcID, e)
+		if err != nil {
+			return nil, fmt.Errorf("version of block %d: %s", e.BlockIndex, err)
+		}
+		resp.Versions = append(resp.Versions, *v)
+	}
+	return resp, nil
+}
+
+// GetSnapshot returns the latest snapshot of the state taken by this conode,
+// signed with its private key.
+func (s *Service) GetSnapshot(req *GetSnapshot) (*GetSnapshotResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if !s.isOurChain(req.SkipchainID) {
+		return nil, errors.New("unknown skipchain")
+	}
+	snap, err := s.getCollection(req.SkipchainID).getSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	sig, err := schnorr.Sign(cothority.Suite, s.getPrivateKey(), snap.Hash())
+	if err != nil {
+		return nil, err
+	}
+	return &GetSnapshotResponse{
+		Version:   CurrentVersion,
+		Snapshot:  *snap,
+		Signature: sig,
+	}, nil
+}
+
+// GetSnapshotNodes returns the requested nodes of the trie of the state, so
+// that a snapshot can be downloaded in chunks.
+func (s *Service) GetSnapshotNodes(req *GetSnapshotNodes) (*GetSnapshotNodesResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if !s.isOurChain(req.SkipchainID) {
+		return nil, errors.New("unknown skipchain")
+	}
+	if len(req.Labels) > maxSnapshotChunk {
+		return nil, fmt.Errorf("cannot return more than %d nodes", maxSnapshotChunk)
+	}
+	cdb := s.getCollection(req.SkipchainID)
+	nodes := make([][]byte, len(req.Labels))
+	for i, label := range req.Labels {
+		node, err := cdb.GetNode(label)
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			return nil, fmt.Errorf("unknown node %x", label)
+		}
+		nodes[i] = node
+	}
+	return &GetSnapshotNodesResponse{
+		Version: CurrentVersion,
+		Nodes:   nodes,
+	}, nil
+}
+
+// AddPendingTx stores a partially signed transaction in the pool of pending
+// transactions, so that the other signers can add their signatures. If the
+// signatures already satisfy the rules of its darcs, it is submitted right
+// away. At least one of the signers must have signed it, and every signer
+// can only add maxPendingTxsPerSigner transactions to the pool.
+func (s *Service) AddPendingTx(req *AddPendingTx) (*AddPendingTxResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if !s.isOurChain(req.SkipchainID) {
+		return nil, errors.New("unknown skipchain")
+	}
+	if len(req.Transaction.Instructions) == 0 {
+		return nil, errors.New("no instructions in the transaction")
+	}
+	_, maxsz, err := s.LoadBlockInfo(req.SkipchainID)
+	if err != nil {
+		return nil, err
+	}
+	if txSize(TxResult{ClientTransaction: req.Transaction}) > maxsz {
+		return nil, errors.New("transaction too large")
+	}
+
+	id := req.Transaction.Instructions.Hash()
+	complete, signers, err := s.checkPendingTx(req.SkipchainID, req.Transaction)
+	if err != nil {
+		return nil, err
+	}
+	// Anybody could add a transaction nobody signed, so that the pool is
+	// only filled by the signers.
+	if len(signers) == 0 {
+		return nil, errors.New("the transaction must be signed by at least one of its signers")
+	}
+	if complete {
+		s.txBuffer.add(string(req.SkipchainID), req.Transaction)
+	} else {
+		err = s.pendingTxs.add(string(req.SkipchainID), PendingTx{
+			ID:          id,
+			Transaction: req.Transaction,
+			Expiry:      time.Now().Add(pendingTxExpiry).Unix(),
+		}, signers)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &AddPendingTxResponse{
+		Version:   CurrentVersion,
+		ID:        id,
+		Submitted: complete,
+	}, nil
+}
+
+// SignPendingTx adds the signatures to a pending transaction. Once the
+// signatures satisfy the rules of its darcs, the transaction is removed from
+// the pool and submitted.
+func (s *Service) SignPendingTx(req *SignPendingTx) (*SignPendingTxResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if !s.isOurChain(req.SkipchainID) {
+		return nil, errors.New("unknown skipchain")
+	}
+
+	key := string(req.SkipchainID)
+	var complete bool
+	err := s.pendingTxs.update(key, req.ID, func(tx *ClientTransaction) error {
+		for _, is := range req.Signatures {
+			if is.Index < 0 || is.Index >= len(tx.Instructions) {
+				return fmt.Errorf("no instruction %d", is.Index)
+			}
+			sigs := tx.Instructions[is.Index].Signatures
+			found := false
+			for i := range sigs {
+				if sigs[i].Signer.Equal(&is.Signature.Signer) {
+					sigs[i].Signature = is.Signature.Signature
+					found = true
+				}
+			}
+			if !found {
+				return fmt.Errorf("%s is not a signer of instruction %d",
+					is.Signature.Signer, is.Index)
+			}
+		}
+		var err error
+		complete, _, err = s.checkPendingTx(req.SkipchainID, *tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if complete {
+		// Another signer might have been faster.
+		if tx, ok := s.pendingTxs.take(key, req.ID); ok {
+			s.txBuffer.add(key, tx)
+		}
+	}
+	return &SignPendingTxResponse{
+		Version:   CurrentVersion,
+		Submitted: complete,
+	}, nil
+}
+
+// GetPendingTxs returns the transactions of the skipchain that wait for
+// signatures.
+func (s *Service) GetPendingTxs(req *GetPendingTxs) (*GetPendingTxsResponse, error) {
+	if req.Version != CurrentVersion {
+		return nil, errors.New("version mismatch")
+	}
+	if !s.isOurChain(req.SkipchainID) {
+		return nil, errors.New("unknown skipchain")
+	}
+	return &GetPendingTxsResponse{
+		Version:      CurrentVersion,
+		Transactions: s.pendingTxs.list(string(req.SkipchainID)),
+	}, nil
+}
+
 // SetPropagationTimeout overrides the default propagation timeout that is used
 // when a new block is announced to the nodes as well as the skipchain
 // propagation timeout.
@@ -339,11 +780,13 @@ func (s *Service) SetPropagationTimeout(p time.Duration) {
 // createNewBlock creates a new block and proposes it to the
 // skipchain-service. Once the block has been created, we
 // inform all nodes to update their internal collections
-// to include the new transactions.
-func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx []TxResult) (*skipchain.SkipBlock, error) {
+// to include the new transactions. The timestamp is stored in the
+// header of the block.
+func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx []TxResult, timestamp int64) (*skipchain.SkipBlock, error) {
 	var sb *skipchain.SkipBlock
 	var mr []byte
-	var coll *collection.Collection
+	var coll *collection.Trie
+	bc := blockContext{timestamp: timestamp}
 
 	if scID.IsNull() {
 		// For a genesis block, we create a throwaway collection.
@@ -356,7 +799,11 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx
 		// We have to register the verification functions in the genesis block
 		sb.VerifierIDs = []skipchain.VerifierID{skipchain.VerifyBase, verifyByzCoin}
 
-		coll = collection.New(&collection.Data{}, &collection.Data{}, &collection.Data{})
+		var err error
+		coll, err = collection.NewTrie(nil, nil, collectionFields()...)
+		if err != nil {
+			return nil, err
+		}
 	} else {
 		// For all other blocks, we try to verify the signature using
 		// the darcs and remove those that do not have a valid
@@ -374,6 +821,7 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx
 		}
 
 		coll = s.getCollection(scID).coll
+		bc.index = sbLatest.Index + 1
 	}
 
 	// Create header of skipblock containing only hashes
@@ -382,7 +830,7 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx
 	var txRes TxResults
 
 	log.Lvl3("Creating state changes")
-	mr, txRes, scs = s.createStateChanges(coll, scID, tx, noTimeout)
+	mr, txRes, scs = s.createStateChanges(coll, scID, bc, tx, noTimeout)
 	if len(txRes) == 0 {
 		return nil, errors.New("no transactions")
 	}
@@ -398,7 +846,7 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx
 		CollectionRoot:        mr,
 		ClientTransactionHash: txRes.Hash(),
 		StateChangesHash:      scs.Hash(),
-		Timestamp:             time.Now().UnixNano(),
+		Timestamp:             timestamp,
 	}
 	sb.Data, err = protobuf.Encode(header)
 	if err != nil {
@@ -446,44 +894,40 @@ func (s *Service) updateCollectionCallback(sbID skipchain.SkipBlockID) error {
 	}
 
 	cdb := s.getCollection(sb.SkipChainID())
+	cdb.updateMutex.Lock()
 	collectionIndex := cdb.getIndex()
 
+	if collectionIndex >= 0 && sb.Index > collectionIndex+1 {
+		// We missed some blocks, like when joining the roster of an
+		// existing skipchain. The blocks are fetched from the other
+		// conodes, so the state is only locked to apply them.
+		cdb.updateMutex.Unlock()
+		log.Lvlf2("%v catching up from block %d to block %d", s.ServerIdentity(), collectionIndex, sb.Index)
+		if err := s.catchUp(cdb, sb); err != nil {
+			log.Error(s.ServerIdentity(), "couldn't catch up:", err)
+			return err
+		}
+		cdb.updateMutex.Lock()
+		collectionIndex = cdb.getIndex()
+	}
+
 	if sb.Index != collectionIndex+1 {
+		cdb.updateMutex.Unlock()
 		log.Lvlf4("%v updating collection for block %d refused, current collection block is %d", s.ServerIdentity(), sb.Index, collectionIndex)
 		return nil
 	}
 
-	var header DataHeader
-	err := protobuf.DecodeWithConstructors(sb.Data, &header, network.DefaultConstructors(cothority.Suite))
+	body, err := s.applyBlock(cdb, sb)
+	cdb.updateMutex.Unlock()
 	if err != nil {
-		log.Error(s.ServerIdentity(), "could not unmarshal header", err)
-		return errors.New("couldn't unmarshal header")
-	}
-
-	var body DataBody
-	err = protobuf.DecodeWithConstructors(sb.Payload, &body, network.DefaultConstructors(cothority.Suite))
-	if err != nil {
-		log.Error(s.ServerIdentity(), "could not unmarshal body", err)
-		return errors.New("couldn't unmarshal body")
-	}
-
-	log.Lvlf2("%s Updating transactions for %x", s.ServerIdentity(), sb.SkipChainID())
-	_, _, scs := s.createStateChanges(cdb.coll, sb.SkipChainID(), body.TxResults, noTimeout)
-
-	log.Lvlf3("%s Storing %d state changes %v", s.ServerIdentity(), len(scs), scs.ShortStrings())
-	if err = cdb.StoreAll(scs, sb.Index); err != nil {
 		return err
 	}
-	if !bytes.Equal(cdb.RootHash(), header.CollectionRoot) {
-		// TODO: if this happens, we've now got a corrupted cdb. See issue #1447.
-		log.Error("hash of collection doesn't correspond to root hash")
-	}
 
 	// Notify all waiting channels
 	for _, t := range body.TxResults {
-		s.state.informWaitChannel(t.ClientTransaction.Instructions.Hash(), t.Accepted)
+		s.state.informWaitChannel(t.ClientTransaction.Instructions.Hash(), t)
 	}
-	s.state.informBlock(sb.SkipChainID())
+	s.state.informBlock(sb)
 
 	// check whether the heartbeat monitor exists, if it doesn't we start a
 	// new one
@@ -564,6 +1008,58 @@ func (s *Service) updateCollectionCallback(sbID skipchain.SkipBlockID) error {
 	return nil
 }
 
+// applyBlock stores the state changes of the transactions of the block in
+// the collection, and takes a snapshot of the state if the index of the
+// block is a multiple of the snapshot interval. It returns the body of the
+// block.
+func (s *Service) applyBlock(cdb *collectionDB, sb *skipchain.SkipBlock) (*DataBody, error) {
+	var header DataHeader
+	err := protobuf.DecodeWithConstructors(sb.Data, &header, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		log.Error(s.ServerIdentity(), "could not unmarshal header", err)
+		return nil, errors.New("couldn't unmarshal header")
+	}
+
+	var body DataBody
+	err = protobuf.DecodeWithConstructors(sb.Payload, &body, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		log.Error(s.ServerIdentity(), "could not unmarshal body", err)
+		return nil, errors.New("couldn't unmarshal body")
+	}
+	// A block whose body has been pruned must not be applied as a block
+	// without transactions.
+	if !bytes.Equal(header.ClientTransactionHash, body.TxResults.Hash()) {
+		return nil, fmt.Errorf("the body of block %d is missing or doesn't match its header", sb.Index)
+	}
+
+	log.Lvlf2("%s Updating transactions for %x", s.ServerIdentity(), sb.SkipChainID())
+	bc := blockContext{index: sb.Index, timestamp: header.Timestamp}
+	_, _, scs := s.createStateChanges(cdb.coll, sb.SkipChainID(), bc, body.TxResults, noTimeout)
+
+	log.Lvlf3("%s Storing %d state changes %v", s.ServerIdentity(), len(scs), scs.ShortStrings())
+	if err = cdb.StoreAll(scs, sb.Index); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(cdb.RootHash(), header.CollectionRoot) {
+		// TODO: if this happens, we've now got a corrupted cdb. See issue #1447.
+		log.Error("hash of collection doesn't correspond to root hash")
+		return &body, nil
+	}
+
+	if sb.Index%snapshotInterval(cdb) == 0 {
+		err = cdb.storeSnapshot(Snapshot{
+			SkipchainID:    sb.SkipChainID(),
+			BlockID:        sb.Hash,
+			Index:          sb.Index,
+			CollectionRoot: header.CollectionRoot,
+		})
+		if err != nil {
+			log.Error(s.ServerIdentity(), "couldn't store snapshot:", err)
+		}
+	}
+	return &body, nil
+}
+
 func isViewChangeTx(txs TxResults) *viewchange.View {
 	if len(txs) != 1 {
 		// view-change block must only have one transaction
@@ -753,7 +1249,10 @@ func (s *Service) startPolling(scID skipchain.SkipBlockID, interval time.Duratio
 				log.Lvl3("Counting how many transactions fit in", interval/2)
 				cdb := s.getCollection(scID)
 				then := time.Now()
-				_, txOut, _ := s.createStateChanges(cdb.coll, scID, txIn, interval/2)
+				// The timestamp of the block is chosen now, so that
+				// the state changes are computed only once.
+				bc := blockContext{index: sb.Index + 1, timestamp: time.Now().UnixNano()}
+				_, txOut, _ := s.createStateChanges(cdb.coll, scID, bc, txIn, interval/2)
 
 				txs = txs[len(txOut):]
 				if len(txs) > 0 {
@@ -761,7 +1260,7 @@ func (s *Service) startPolling(scID skipchain.SkipBlockID, interval time.Duratio
 					log.Warnf("%d transactions (%v bytes) included in block in %v, %d transactions left for the next block", len(txOut), sz, time.Now().Sub(then), len(txs))
 				}
 
-				_, err = s.createNewBlock(scID, sb.Roster, txOut)
+				_, err = s.createNewBlock(scID, sb.Roster, txOut, bc.timestamp)
 				if err != nil {
 					log.Error("couldn't create new block: " + err.Error())
 				}
@@ -819,7 +1318,8 @@ func (s *Service) verifySkipBlock(newID []byte, newSB *skipchain.SkipBlock) bool
 	}
 
 	cdb := s.getCollection(newSB.SkipChainID())
-	mtr, txOut, scs := s.createStateChanges(cdb.coll, newSB.SkipChainID(), body.TxResults, noTimeout)
+	bc := blockContext{index: newSB.Index, timestamp: header.Timestamp}
+	mtr, txOut, scs := s.createStateChanges(cdb.coll, newSB.SkipChainID(), bc, body.TxResults, noTimeout)
 
 	// Check that the locally generated list of accepted/rejected txs match the list
 	// the leader proposed.
@@ -921,11 +1421,11 @@ func txSize(txr ...TxResult) (out int) {
 // State caching is implemented here, which is critical to performance, because
 // on the leader it reduces the number of contract executions by 1/3 and on
 // followers by 1/2.
-func (s *Service) createStateChanges(coll *collection.Collection, scID skipchain.SkipBlockID, txIn TxResults, timeout time.Duration) (merkleRoot []byte, txOut TxResults, states StateChanges) {
+func (s *Service) createStateChanges(coll *collection.Trie, scID skipchain.SkipBlockID, bc blockContext, txIn TxResults, timeout time.Duration) (merkleRoot []byte, txOut TxResults, states StateChanges) {
 	// If what we want is in the cache, then take it from there. Otherwise
 	// ignore the error and compute the state changes.
 	var err error
-	merkleRoot, txOut, states, err = s.stateChangeCache.get(scID, txIn.Hash())
+	merkleRoot, txOut, states, err = s.stateChangeCache.get(scID, bc.hash(txIn.Hash()))
 	if err == nil {
 		log.Lvl3(s.ServerIdentity(), "loaded state changes from cache")
 		return
@@ -946,34 +1446,32 @@ func (s *Service) createStateChanges(coll *collection.Collection, scID skipchain
 	// we need to find out if this is as expensive as it looks, and if so if
 	// we could use some kind of copy-on-write technique.
 
+	// The fees are computed with the configuration at the beginning of the
+	// block.
+	config := loadBlockConfig(coll)
+
+	// executeTransaction never changes the collection it gets, but the
+	// clones of the transactions are squashed into this one, so that they
+	// don't pile up in the collection of the service.
 	cdbTemp := coll.Clone()
 	var cin []Coin
-clientTransactions:
 	for _, tx := range txIn {
 		txsz := txSize(tx)
 
-		// Make a new collection for each instruction. If the instruction is sucessfully
-		// implemented and changes applied, then keep it (via cdbTemp = cdbI.c),
-		// otherwise dump it.
-		cdbI := &roCollection{cdbTemp.Clone()}
-		for _, instr := range tx.ClientTransaction.Instructions {
-			scs, cout, err := s.executeInstruction(cdbI, cin, instr)
-			if err != nil {
-				log.Errorf("%s Call to contract returned error: %s", s.ServerIdentity(), err)
-				tx.Accepted = false
-				txOut = append(txOut, tx)
-				continue clientTransactions
-			}
-			for _, sc := range scs {
-				if err := storeInColl(cdbI.c, &sc); err != nil {
-					log.Error(s.ServerIdentity(), "failed to add to collections with error: "+err.Error())
-					tx.Accepted = false
-					txOut = append(txOut, tx)
-					continue clientTransactions
-				}
-			}
-			states = append(states, scs...)
-			cin = cout
+		collTx, txStates, cout, err := s.executeTransaction(cdbTemp, bc, config, cin, tx.ClientTransaction)
+		if collTx != cdbTemp {
+			// Else every transaction would add a snapshot to the
+			// chain in which the next ones look up the nodes.
+			collTx.Squash()
+		}
+		if err != nil {
+			// A refused transaction might still have paid a fee.
+			tx.Accepted = false
+			tx.Error = err.Error()
+			cdbTemp = collTx
+			states = append(states, txStates...)
+			txOut = append(txOut, tx)
+			continue
 		}
 
 		// We would like to be able to check if this txn is so big it could never fit into a block,
@@ -983,7 +1481,7 @@ clientTransactions:
 		// TODO: In issue #1409, we will refactor things such that we can drop transactions in here.
 		//if txsz > maxsz {
 		//	log.Errorf("%s transaction size %v is bigger than one block (%v), dropping it.", s.ServerIdentity(), txsz, maxsz)
-		//	continue clientTransactions
+		//	continue
 		//}
 
 		// Planning mode:
@@ -1004,19 +1502,152 @@ clientTransactions:
 			}
 		}
 
-		cdbTemp = cdbI.c
+		cdbTemp = collTx
+		states = append(states, txStates...)
+		cin = cout
 		tx.Accepted = true
+		tx.Error = ""
 		txOut = append(txOut, tx)
 		blocksz += txsz
 	}
 
 	// Store the result in the cache before returning.
 	merkleRoot = cdbTemp.GetRoot()
-	s.stateChangeCache.update(scID, txOut.Hash(), merkleRoot, txOut, states)
+	s.stateChangeCache.update(scID, bc.hash(txOut.Hash()), merkleRoot, txOut, states)
 	return
 }
 
-func (s *Service) executeInstruction(cdbI CollectionView, cin []Coin, instr Instruction) (scs StateChanges, cout []Coin, err error) {
+// executeTransaction runs all instructions of the transaction on a clone of
+// coll, as part of the block described by bc, with the fees of the
+// configuration that applies to the block. If the transaction is accepted,
+// it returns the new collection, the state changes and the output coins. If
+// it is refused, the error holds the reason, and the returned collection and
+// state changes only hold the fee that had to be paid anyway. coll itself is
+// never changed.
+func (s *Service) executeTransaction(coll *collection.Trie, bc blockContext, config *ChainConfig, cin []Coin, ctx ClientTransaction) (*collection.Trie, StateChanges, []Coin, error) {
+	// Make a new collection for the transaction. If all instructions are
+	// sucessfully executed and the changes applied, then the caller keeps
+	// it, otherwise it is dumped.
+	cdbI := &blockCollection{roCollection{coll.Clone()}, bc}
+	var txStates, counterStates StateChanges
+	var fee uint64
+	var fees *FeeRules
+	if config != nil {
+		fees = config.Fees
+	}
+	if fees != nil {
+		err := fees.verifyPayer(cdbI, ctx)
+		if err == nil {
+			fee, err = fees.transactionFee(ctx)
+		}
+		if err != nil {
+			return coll, nil, nil, errors.New("couldn't pay fee: " + err.Error())
+		}
+	}
+	for i, instr := range ctx.Instructions {
+		if fees != nil {
+			// If the contract cannot be found, executeInstruction
+			// will fail before any fee has to be paid.
+			if contractID, _, err := instr.GetContractState(cdbI); err == nil {
+				fee, err = fees.addInstructionFee(fee, contractID)
+				if err != nil {
+					return coll, nil, nil, fmt.Errorf("instruction %d: %s", i, err)
+				}
+			}
+		}
+		// A new version of the chain applies from the instruction after
+		// the one that stored it.
+		version := chainVersion(cdbI)
+		scs, counterScs, cout, err := s.executeInstruction(cdbI, version, cin, instr)
+		if err != nil {
+			log.Errorf("%s Call to contract returned error: %s", s.ServerIdentity(), err)
+			err = fmt.Errorf("instruction %d: %s", i, err)
+			if fees != nil && counterScs != nil {
+				// The contract refused the instruction, but the fee
+				// has to be paid anyway.
+				collFee, feeStates := fees.chargeRefused(coll, ctx, fee,
+					append(counterStates, counterScs...))
+				return collFee, feeStates, nil, err
+			}
+			return coll, nil, nil, err
+		}
+		counterStates = append(counterStates, counterScs...)
+		if stateVersion(version, scs) >= versionStateIndexes {
+			var refScs StateChanges
+			if version < versionStateIndexes {
+				// The chain starts to store the reverse indexes
+				// of the darcs, so the instances stored so far
+				// are indexed, too.
+				refScs, err = backfillDarcRefs(cdbI.c, scs)
+			} else {
+				refScs, err = darcRefsStateChanges(cdbI, scs)
+			}
+			if err != nil {
+				return coll, nil, nil, fmt.Errorf("instruction %d: couldn't update darc references: %s", i, err)
+			}
+			scs = append(scs, lastUpdateStateChanges(cdbI, scs, bc)...)
+			scs = append(scs, refScs...)
+		}
+		scs = append(scs, counterScs...)
+		for _, sc := range scs {
+			if err := storeInColl(cdbI.c, &sc); err != nil {
+				log.Error(s.ServerIdentity(), "failed to add to collections with error: "+err.Error())
+				return coll, nil, nil, fmt.Errorf("instruction %d: couldn't store state change: %s", i, err)
+			}
+		}
+		txStates = append(txStates, scs...)
+		cin = cout
+	}
+
+	if fees != nil {
+		feeScs, err := fees.payFee(cdbI, ctx, fee, false)
+		for _, sc := range feeScs {
+			if err != nil {
+				break
+			}
+			err = storeInColl(cdbI.c, &sc)
+		}
+		if err != nil {
+			collFee, feeStates := fees.chargeRefused(coll, ctx, fee, counterStates)
+			return collFee, feeStates, nil, errors.New("couldn't pay fee: " + err.Error())
+		}
+		txStates = append(txStates, feeScs...)
+	}
+	return cdbI.c, txStates, cin, nil
+}
+
+// chainVersion returns the version of the configuration stored in c, or 0 if
+// there is no configuration yet, which is the case before the genesis block.
+func chainVersion(c CollectionView) Version {
+	config, err := loadConfigFromColl(c)
+	if err != nil {
+		return 0
+	}
+	return config.Version
+}
+
+// stateVersion returns the version of the chain that decides whether the
+// service stores its own state next to the state changes scs. If scs store a
+// new configuration, like the genesis transaction or update_config do, its
+// version is used. Else it is the version of the chain before scs.
+func stateVersion(version Version, scs StateChanges) Version {
+	for _, sc := range scs {
+		if sc.StateAction != Remove && string(sc.ContractID) == ContractConfigID {
+			config := ChainConfig{}
+			err := protobuf.DecodeWithConstructors(sc.Value, &config, network.DefaultConstructors(cothority.Suite))
+			if err == nil {
+				return config.Version
+			}
+		}
+	}
+	return version
+}
+
+// executeInstruction verifies the signer counters of the instruction, if the
+// version of the chain stores them, and calls its contract. The state changes
+// of the new counters are returned in counterScs, which is not nil as soon as
+// the counters are verified, even if the contract returns an error.
+func (s *Service) executeInstruction(cdbI CollectionView, version Version, cin []Coin, instr Instruction) (scs, counterScs StateChanges, cout []Coin, err error) {
 	defer func() {
 		if re := recover(); re != nil {
 			err = errors.New(re.(string))
@@ -1036,9 +1667,78 @@ func (s *Service) executeInstruction(cdbI CollectionView, cin []Coin, instr Inst
 		err = errors.New("Leader is dropping instruction of unknown contract: " + contractID)
 		return
 	}
+	if version >= versionStateIndexes {
+		var ctrScs StateChanges
+		ctrScs, err = verifySignerCounters(cdbI, instr)
+		if err != nil {
+			return
+		}
+		counterScs = append(StateChanges{}, ctrScs...)
+	}
+
 	// Now we call the contract function with the data of the key.
 	log.Lvlf3("%s Calling contract %s", s.ServerIdentity(), contractID)
-	return contract(cdbI, instr, cin)
+	scs, cout, err = contract(cdbI, instr, cin)
+	return
+}
+
+// verifySignerCounters checks that every signature of the instruction is
+// valid and that the counter given for its signer is the latest counter
+// stored in the collection plus one. It returns the state changes that
+// store the new counters. The signers that didn't sign a pending
+// transaction that was submitted early are skipped and keep their counter.
+func verifySignerCounters(coll CollectionView, instr Instruction) (StateChanges, error) {
+	if len(instr.Signatures) == 0 {
+		return nil, nil
+	}
+	if len(instr.SignerCounter) != len(instr.Signatures) {
+		return nil, fmt.Errorf("got %d signer counters for %d signatures",
+			len(instr.SignerCounter), len(instr.Signatures))
+	}
+	d, err := getInstanceDarc(coll, instr.InstanceID)
+	if err != nil {
+		return nil, errors.New("darc not found: " + err.Error())
+	}
+	req, err := instr.ToDarcRequest(d.GetBaseID())
+	if err != nil {
+		return nil, errors.New("couldn't create darc request: " + err.Error())
+	}
+	digest := req.Hash()
+
+	var scs StateChanges
+	seen := make(map[string]bool)
+	for i, sig := range instr.Signatures {
+		id := sig.Signer.String()
+		if seen[id] {
+			return nil, errors.New("duplicate signer " + id)
+		}
+		seen[id] = true
+		if len(sig.Signature) == 0 {
+			continue
+		}
+		if err := sig.Signer.VerifyAt(digest, sig.Signature, blockTime(coll)); err != nil {
+			return nil, errors.New("invalid signature of " + id + ": " + err.Error())
+		}
+
+		latest, err := getSignerCounter(coll, id)
+		if err != nil {
+			return nil, err
+		}
+		if instr.SignerCounter[i] != latest+1 {
+			return nil, fmt.Errorf("counter of %s is %d, expected %d",
+				id, instr.SignerCounter[i], latest+1)
+		}
+
+		action := Update
+		if latest == 0 {
+			action = Create
+		}
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, instr.SignerCounter[i])
+		scs = append(scs, NewStateChange(action, NewInstanceID(signerCounterKey(id)),
+			signerCounterContractID, buf, d.GetBaseID()))
+	}
+	return scs, nil
 }
 
 func (s *Service) getLeader(scID skipchain.SkipBlockID) (*network.ServerIdentity, error) {
@@ -1275,7 +1975,7 @@ func (s *Service) startAllChains() error {
 	}
 	s.collectionDB = map[string]*collectionDB{}
 	s.state = bcState{
-		waitChannels: make(map[string]chan bool),
+		waitChannels: make(map[string]chan TxResult),
 	}
 
 	// NOTE: Usually startAllChains is only called when services start up. but for
@@ -1420,6 +2120,7 @@ func newService(c *onet.Context) (onet.Service, error) {
 		ServiceProcessor:       onet.NewServiceProcessor(c),
 		contracts:              make(map[string]ContractFn),
 		txBuffer:               newTxBuffer(),
+		pendingTxs:             newPendingTxPool(),
 		storage:                &omniStorage{},
 		darcToSc:               make(map[string]skipchain.SkipBlockID),
 		stateChangeCache:       newStateChangeCache(),
@@ -1429,9 +2130,14 @@ func newService(c *onet.Context) (onet.Service, error) {
 		viewChangeMan:          newViewChangeManager(),
 	}
 	if err := s.RegisterHandlers(s.CreateGenesisBlock, s.AddTransaction,
-		s.GetProof); err != nil {
+		s.GetProof, s.GetSignerCounters, s.Simulate, s.GetInstanceHistory,
+		s.GetSnapshot, s.GetSnapshotNodes, s.AddPendingTx, s.SignPendingTx,
+		s.GetPendingTxs, s.GetDarcReferences, s.GetDarcHistory); err != nil {
 		log.ErrFatal(err, "Couldn't register messages")
 	}
+	if err := s.RegisterStreamingHandlers(s.StreamBlocks); err != nil {
+		log.ErrFatal(err, "Couldn't register streaming messages")
+	}
 	s.RegisterProcessorFunc(viewChangeMsgID, s.handleViewChangeReq)
 
 	s.registerContract(ContractConfigID, s.ContractConfig)
@@ -1441,6 +2147,8 @@ func newService(c *onet.Context) (onet.Service, error) {
 		return nil, err
 	}
 	s.skService().RegisterStoreSkipblockCallback(s.updateCollectionCallback)
+	s.skService().RegisterPruneGuard(s.pruneGuard)
+	s.skService().RegisterPayloadCheck(s.checkPayload)
 	s.skService().EnableViewChange()
 
 	// Register the view-change cosi protocols.
@@ -12,6 +12,7 @@ import (
 	"github.com/dedis/cothority/byzcoin/darc"
 	"github.com/dedis/cothority/byzcoin/darc/expression"
 	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber/sign/schnorr"
 	"github.com/dedis/kyber/suites"
 	"github.com/dedis/kyber/util/random"
 	"github.com/dedis/onet"
@@ -161,21 +162,25 @@ func testAddTransaction(t *testing.T, sendToIdx int, failure bool) {
 	// the operations below should succeed
 	// add the first tx
 	log.Lvl1("adding the first tx")
-	tx1, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, s.value, s.signer)
+	// Wait for it to be included, so that tx2, which has the next counter,
+	// cannot be processed before tx1 when it is sent to a follower.
+	tx1, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, s.value, s.signer, s.counter+1)
 	require.Nil(t, err)
 	akvresp, err = s.service().AddTransaction(&AddTxRequest{
-		Version:     CurrentVersion,
-		SkipchainID: s.sb.SkipChainID(),
-		Transaction: tx1,
+		Version:       CurrentVersion,
+		SkipchainID:   s.sb.SkipChainID(),
+		Transaction:   tx1,
+		InclusionWait: 10,
 	})
 	require.Nil(t, err)
 	require.NotNil(t, akvresp)
 	require.Equal(t, CurrentVersion, akvresp.Version)
+	require.True(t, akvresp.Accepted)
 
 	// add the second tx
 	log.Lvl1("adding the second tx")
 	value2 := []byte("value2")
-	tx2, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, value2, s.signer)
+	tx2, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, value2, s.signer, s.counter+2)
 	require.Nil(t, err)
 	akvresp, err = s.services[sendToIdx].AddTransaction(&AddTxRequest{
 		Version:     CurrentVersion,
@@ -185,6 +190,7 @@ func testAddTransaction(t *testing.T, sendToIdx int, failure bool) {
 	require.Nil(t, err)
 	require.NotNil(t, akvresp)
 	require.Equal(t, CurrentVersion, akvresp.Version)
+	s.counter += 2
 
 	// try to read the transaction back again
 	log.Lvl1("reading the transactions back")
@@ -278,6 +284,152 @@ func TestService_GetProof(t *testing.T) {
 	require.NotNil(t, err)
 }
 
+func TestService_GetProofAt(t *testing.T) {
+	s := newSer(t, 2, testInterval)
+	defer s.local.CloseAll()
+
+	serKey := s.tx.Instructions[0].Hash()
+	scID := s.sb.SkipChainID()
+	latest, err := s.service().db().GetLatestByID(scID)
+	require.Nil(t, err)
+	require.Equal(t, 1, latest.Index)
+
+	// The key didn't exist in the genesis block.
+	rep, err := s.service().GetProof(&GetProof{
+		Version: CurrentVersion,
+		ID:      scID,
+		Key:     serKey,
+		BlockID: scID,
+	})
+	require.Nil(t, err)
+	require.Nil(t, rep.Proof.Verify(scID))
+	require.True(t, rep.Proof.Latest.Hash.Equal(scID))
+	require.False(t, rep.Proof.InclusionProof.Match())
+
+	rep, err = s.service().GetProof(&GetProof{
+		Version: CurrentVersion,
+		ID:      scID,
+		Key:     serKey,
+		BlockID: latest.Hash,
+	})
+	require.Nil(t, err)
+	require.Nil(t, rep.Proof.Verify(scID))
+	require.True(t, rep.Proof.Latest.Hash.Equal(latest.Hash))
+	_, values, err := rep.Proof.KeyValue()
+	require.Nil(t, err)
+	require.Equal(t, s.value, values[0])
+
+	// The start of the proof cannot be after the requested block.
+	_, err = s.service().GetProof(&GetProof{
+		Version: CurrentVersion,
+		ID:      latest.Hash,
+		Key:     serKey,
+		BlockID: scID,
+	})
+	require.NotNil(t, err)
+
+	_, err = s.service().GetProof(&GetProof{
+		Version: CurrentVersion,
+		ID:      scID,
+		Key:     serKey,
+		BlockID: skipchain.SkipBlockID(serKey),
+	})
+	require.NotNil(t, err)
+}
+
+func TestService_GetSnapshot(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	scID := s.sb.SkipChainID()
+	resp, err := s.service().GetSnapshot(&GetSnapshot{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+	})
+	require.Nil(t, err)
+	// With the default interval, only the genesis block has a snapshot.
+	require.Equal(t, 0, resp.Snapshot.Index)
+	require.True(t, resp.Snapshot.BlockID.Equal(scID))
+	require.Nil(t, schnorr.Verify(cothority.Suite, s.service().ServerIdentity().Public,
+		resp.Snapshot.Hash(), resp.Signature))
+
+	var header DataHeader
+	require.Nil(t, protobuf.DecodeWithConstructors(s.sb.Data, &header, network.DefaultConstructors(cothority.Suite)))
+	require.Equal(t, header.CollectionRoot, resp.Snapshot.CollectionRoot)
+
+	nodes, err := s.service().GetSnapshotNodes(&GetSnapshotNodes{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		Labels:      [][]byte{resp.Snapshot.CollectionRoot},
+	})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(nodes.Nodes))
+
+	_, err = s.service().GetSnapshotNodes(&GetSnapshotNodes{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		Labels:      [][]byte{make([]byte, 32)},
+	})
+	require.NotNil(t, err)
+}
+
+func TestService_FastSync(t *testing.T) {
+	s := newSerN(t, 0, testInterval, 4, false)
+	defer s.local.CloseAll()
+
+	// The last conode is not in the roster of the skipchain.
+	genesisMsg, err := DefaultGenesisMsg(CurrentVersion, onet.NewRoster(s.roster.List[:3]),
+		[]string{"spawn:dummy"}, s.signer.Identity())
+	require.Nil(t, err)
+	genesisMsg.BlockInterval = testInterval
+	genesisMsg.SnapshotInterval = 3
+	s.darc = &genesisMsg.GenesisDarc
+	resp, err := s.service().CreateGenesisBlock(genesisMsg)
+	require.Nil(t, err)
+	s.sb = resp.Skipblock
+	scID := s.sb.SkipChainID()
+
+	for i := 1; i <= 5; i++ {
+		tx, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, []byte{byte(i)}, s.signer, uint64(i))
+		require.Nil(t, err)
+		reply, err := s.service().AddTransaction(&AddTxRequest{
+			Version:       CurrentVersion,
+			SkipchainID:   scID,
+			Transaction:   tx,
+			InclusionWait: 10,
+		})
+		require.Nil(t, err)
+		require.True(t, reply.Accepted)
+	}
+	latest, err := s.service().db().GetLatestByID(scID)
+	require.Nil(t, err)
+	require.Equal(t, 5, latest.Index)
+	sn, err := s.service().getCollection(scID).getSnapshot()
+	require.Nil(t, err)
+	require.Equal(t, 3, sn.Index)
+
+	// The new conode downloads the snapshot of block 3 and applies block
+	// 4, as block 5 is applied once it is stored.
+	joined := s.services[3]
+	cdb := joined.getCollection(scID)
+	require.Equal(t, -1, cdb.getIndex())
+	require.Nil(t, joined.catchUp(cdb, latest))
+	require.Equal(t, 4, cdb.getIndex())
+	sn, err = cdb.getSnapshot()
+	require.Nil(t, err)
+	require.Equal(t, 3, sn.Index)
+
+	sb, err := s.service().getBlockAt(scID, 4)
+	require.Nil(t, err)
+	var header DataHeader
+	require.Nil(t, protobuf.DecodeWithConstructors(sb.Data, &header, network.DefaultConstructors(cothority.Suite)))
+	require.Equal(t, header.CollectionRoot, cdb.RootHash())
+
+	// Catching up again doesn't change anything.
+	require.Nil(t, joined.catchUp(cdb, latest))
+	require.Equal(t, 4, cdb.getIndex())
+}
+
 // Test that inter-instruction dependencies are correctly handled.
 func TestService_Depending(t *testing.T) {
 	s := newSer(t, 1, testInterval)
@@ -287,7 +439,7 @@ func TestService_Depending(t *testing.T) {
 	// the first one having executed.
 
 	// First instruction: spawn a dummy value.
-	in1, err := createInstr(s.darc.GetBaseID(), dummyContract, []byte("something to delete"), s.signer)
+	in1, err := createInstr(s.darc.GetBaseID(), dummyContract, []byte("something to delete"), s.signer, s.counter+1)
 	require.NoError(t, err)
 
 	// Set the length to reflect there are two.
@@ -302,6 +454,9 @@ func TestService_Depending(t *testing.T) {
 		Nonce:      GenNonce(),
 		Index:      1,
 		Length:     2,
+		// The same signer signs both instructions, so the second one
+		// has to use the next counter.
+		SignerCounter: []uint64{s.counter + 2},
 	}
 	in2.SignBy(s.darc.GetBaseID(), s.signer)
 
@@ -309,13 +464,14 @@ func TestService_Depending(t *testing.T) {
 		Instructions: []Instruction{in1, in2},
 	}
 
-	_, err = s.services[0].AddTransaction(&AddTxRequest{
+	resp, err := s.services[0].AddTransaction(&AddTxRequest{
 		Version:       CurrentVersion,
 		SkipchainID:   s.sb.SkipChainID(),
 		Transaction:   tx,
 		InclusionWait: 2,
 	})
 	require.Nil(t, err)
+	require.True(t, resp.Accepted)
 
 	cdb := s.service().getCollection(s.sb.SkipChainID())
 	_, _, _, err = cdb.GetValues(in1.Hash())
@@ -348,7 +504,7 @@ func TestService_LateBlock(t *testing.T) {
 		return ser.verifySkipBlock(newID, newSB)
 	})
 
-	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, s.value, s.signer)
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, s.value, s.signer, s.counter+1)
 	require.Nil(t, err)
 	_, err = ser.AddTransaction(&AddTxRequest{
 		Version:       CurrentVersion,
@@ -379,7 +535,7 @@ func TestService_BadDataHeader(t *testing.T) {
 		return ser.verifySkipBlock(newID, newSB)
 	})
 
-	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, s.value, s.signer)
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, s.value, s.signer, s.counter+1)
 	require.Nil(t, err)
 	_, err = ser.AddTransaction(&AddTxRequest{
 		Version:       CurrentVersion,
@@ -436,6 +592,7 @@ func waitInclusion(t *testing.T, client int) {
 	log.Lvl1("Create wrong transaction and wait")
 	pr, err, err2 = sendTransaction(t, s, client, invalidContract, 10)
 	require.Contains(t, err.Error(), "transaction is in block, but got refused")
+	require.Contains(t, err.Error(), "this invalid contract always returns an error")
 	require.NoError(t, err2)
 
 	// We expect to see only the refused transaction in the block in pr.
@@ -556,15 +713,22 @@ func TestService_BigTx(t *testing.T) {
 }
 
 func sendTransaction(t *testing.T, s *ser, client int, kind string, wait int) (Proof, error, error) {
-	tx, err := createOneClientTx(s.darc.GetBaseID(), kind, s.value, s.signer)
+	tx, err := createOneClientTx(s.darc.GetBaseID(), kind, s.value, s.signer, s.counter+1)
 	require.Nil(t, err)
 	ser := s.services[client]
-	_, err = ser.AddTransaction(&AddTxRequest{
+	resp, err := ser.AddTransaction(&AddTxRequest{
 		Version:       CurrentVersion,
 		SkipchainID:   s.sb.SkipChainID(),
 		Transaction:   tx,
 		InclusionWait: wait,
 	})
+	if err == nil && wait > 0 && !resp.Accepted {
+		err = errors.New("transaction is in block, but got refused: " + resp.Error)
+	}
+	// Only the accepted transactions increase the counter of the signer.
+	if err == nil && kind != invalidContract {
+		s.counter++
+	}
 
 	rep, err2 := ser.GetProof(&GetProof{
 		Version: CurrentVersion,
@@ -584,7 +748,9 @@ func TestService_InvalidVerification(t *testing.T) {
 
 	// tx0 uses the panicing contract, so it should _not_ be stored.
 	value1 := []byte("a")
-	tx0, err := createOneClientTx(s.darc.GetBaseID(), "panic", value1, s.signer)
+	// All three transactions use the same counter, because only the last
+	// one will be accepted.
+	tx0, err := createOneClientTx(s.darc.GetBaseID(), "panic", value1, s.signer, s.counter+1)
 	require.Nil(t, err)
 	akvresp, err := s.service().AddTransaction(&AddTxRequest{
 		Version:     CurrentVersion,
@@ -596,7 +762,7 @@ func TestService_InvalidVerification(t *testing.T) {
 	require.Equal(t, CurrentVersion, akvresp.Version)
 
 	// tx1 uses the invalid contract, so it should _not_ be stored.
-	tx1, err := createOneClientTx(s.darc.GetBaseID(), invalidContract, value1, s.signer)
+	tx1, err := createOneClientTx(s.darc.GetBaseID(), invalidContract, value1, s.signer, s.counter+1)
 	require.Nil(t, err)
 	akvresp, err = s.service().AddTransaction(&AddTxRequest{
 		Version:     CurrentVersion,
@@ -609,7 +775,7 @@ func TestService_InvalidVerification(t *testing.T) {
 
 	// tx2 uses the dummy kind, its value should be stored.
 	value2 := []byte("b")
-	tx2, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, value2, s.signer)
+	tx2, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, value2, s.signer, s.counter+1)
 	akvresp, err = s.service().AddTransaction(&AddTxRequest{
 		Version:       CurrentVersion,
 		SkipchainID:   s.sb.SkipChainID(),
@@ -619,6 +785,7 @@ func TestService_InvalidVerification(t *testing.T) {
 	require.Nil(t, err)
 	require.NotNil(t, akvresp)
 	require.Equal(t, CurrentVersion, akvresp.Version)
+	require.True(t, akvresp.Accepted)
 
 	// Check that tx1 is _not_ stored.
 	pr, err := s.service().GetProof(&GetProof{
@@ -645,6 +812,66 @@ func TestService_InvalidVerification(t *testing.T) {
 	time.Sleep(2 * s.interval)
 }
 
+func TestService_SignerCounter(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	getCounters := func(ids ...string) []uint64 {
+		resp, err := s.service().GetSignerCounters(&GetSignerCounters{
+			Version:     CurrentVersion,
+			SkipchainID: s.sb.SkipChainID(),
+			SignerIDs:   ids,
+		})
+		require.NoError(t, err)
+		return resp.Counters
+	}
+	unknown := darc.NewSignerEd25519(nil, nil)
+	require.Equal(t, []uint64{2, 1}, getCounters(s.signer.Identity().String(),
+		unknown.Identity().String()))
+
+	// Replaying the transaction of newSer must fail.
+	resp, err := s.service().AddTransaction(&AddTxRequest{
+		Version:       CurrentVersion,
+		SkipchainID:   s.sb.SkipChainID(),
+		Transaction:   s.tx,
+		InclusionWait: 10,
+	})
+	require.NoError(t, err)
+	require.False(t, resp.Accepted)
+	require.Contains(t, resp.Error, "expected 2")
+
+	// Skipping a counter must fail, too.
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, s.value, s.signer, s.counter+2)
+	require.NoError(t, err)
+	resp, err = s.service().AddTransaction(&AddTxRequest{
+		Version:       CurrentVersion,
+		SkipchainID:   s.sb.SkipChainID(),
+		Transaction:   tx,
+		InclusionWait: 10,
+	})
+	require.NoError(t, err)
+	require.False(t, resp.Accepted)
+	require.Equal(t, []uint64{2}, getCounters(s.signer.Identity().String()))
+
+	// The next counter is accepted.
+	pr, err, err2 := sendTransaction(t, s, 0, dummyContract, 10)
+	require.NoError(t, err)
+	require.NoError(t, err2)
+	require.True(t, pr.InclusionProof.Match())
+	require.Equal(t, []uint64{3}, getCounters(s.signer.Identity().String()))
+
+	// Wrong version and unknown skipchain
+	_, err = s.service().GetSignerCounters(&GetSignerCounters{
+		Version: CurrentVersion + 1,
+	})
+	require.Error(t, err)
+	_, err = s.service().GetSignerCounters(&GetSignerCounters{
+		Version:     CurrentVersion,
+		SkipchainID: skipchain.SkipBlockID{1, 2, 3},
+	})
+	require.Error(t, err)
+}
+
 func findTx(tx ClientTransaction, res TxResults) TxResult {
 	h := tx.Instructions.Hash()
 	for i := range res {
@@ -773,11 +1000,13 @@ func TestService_StateChange(t *testing.T) {
 	ct1 := ClientTransaction{Instructions: instrs}
 	ct2 := ClientTransaction{Instructions: instrs2}
 
-	_, txOut, scs := s.service().createStateChanges(cdb.coll, s.sb.SkipChainID(), NewTxResults(ct1, ct2), noTimeout)
+	bc := blockContext{index: s.sb.Index + 1, timestamp: time.Now().UnixNano()}
+	_, txOut, scs := s.service().createStateChanges(cdb.coll, s.sb.SkipChainID(), bc, NewTxResults(ct1, ct2), noTimeout)
 	require.Equal(t, 2, len(txOut))
 	require.True(t, txOut[0].Accepted)
 	require.False(t, txOut[1].Accepted)
-	require.Equal(t, n, len(scs))
+	// Every instruction also stores the time of the last update.
+	require.Equal(t, 2*n, len(scs))
 	require.Equal(t, latest, int64(n-1))
 }
 
@@ -819,6 +1048,74 @@ func TestService_DarcEvolution(t *testing.T) {
 	require.True(t, d22.Equal(d2))
 }
 
+func TestService_DarcHistory(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	d2 := s.darc.Copy()
+	require.Nil(t, d2.EvolveFrom(s.darc))
+	s.testDarcEvolution(t, *d2, false)
+
+	resp, err := s.service().GetDarcHistory(&GetDarcHistory{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+		DarcID:      s.darc.GetBaseID(),
+	})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(resp.Versions))
+	require.Equal(t, 0, resp.Versions[0].BlockIndex)
+	require.True(t, resp.Versions[0].Darc.Equal(s.darc))
+	require.True(t, resp.Versions[1].BlockIndex > 0)
+	require.True(t, resp.Versions[1].Darc.Equal(d2))
+	// The evolution has been signed by the owner of the genesis darc.
+	require.Equal(t, 1, len(resp.Versions[1].Signatures))
+	id := s.signer.Identity()
+	require.True(t, resp.Versions[1].Signatures[0].Signer.Equal(&id))
+	for _, v := range resp.Versions {
+		require.Nil(t, v.Proof.Verify(s.sb.SkipChainID()))
+		_, vs, err := v.Proof.KeyValue()
+		require.Nil(t, err)
+		d, err := darc.NewFromProtobuf(vs[0])
+		require.Nil(t, err)
+		require.True(t, d.Equal(&v.Darc))
+	}
+	require.Equal(t, 2, resp.Total)
+
+	// The versions are returned by pages.
+	resp, err = s.service().GetDarcHistory(&GetDarcHistory{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+		DarcID:      s.darc.GetBaseID(),
+		Start:       1,
+		Count:       1,
+	})
+	require.Nil(t, err)
+	require.Equal(t, 2, resp.Total)
+	require.Equal(t, 1, len(resp.Versions))
+	require.True(t, resp.Versions[0].Darc.Equal(d2))
+	_, err = s.service().GetDarcHistory(&GetDarcHistory{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+		DarcID:      s.darc.GetBaseID(),
+		Start:       -1,
+	})
+	require.NotNil(t, err)
+
+	_, err = s.service().GetDarcHistory(&GetDarcHistory{
+		Version:     CurrentVersion,
+		SkipchainID: s.sb.SkipChainID(),
+		DarcID:      darc.ID(genID().Slice()),
+	})
+	require.NotNil(t, err)
+
+	// A darc that has not been given as argument has no signatures.
+	sb, err := s.service().getBlockAt(s.sb.SkipChainID(), resp.Versions[0].BlockIndex)
+	require.Nil(t, err)
+	sigs, err := darcSignatures(sb, []byte("another darc"))
+	require.Nil(t, err)
+	require.Equal(t, 0, len(sigs))
+}
+
 func TestService_DarcSpawn(t *testing.T) {
 	s := newSer(t, 1, testInterval)
 	defer s.local.CloseAll()
@@ -846,6 +1143,7 @@ func TestService_DarcSpawn(t *testing.T) {
 					Value: darc2Buf,
 				}},
 			},
+			SignerCounter: []uint64{s.counter + 1},
 		}},
 	}
 	require.Nil(t, ctx.Instructions[0].SignBy(s.darc.GetBaseID(), s.signer))
@@ -855,6 +1153,86 @@ func TestService_DarcSpawn(t *testing.T) {
 	require.True(t, pr.InclusionProof.Match())
 }
 
+func TestService_DarcDelete(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	scID := s.sb.SkipChainID()
+	counter := s.counter
+	send := func(dID darc.ID, instr *Instruction) bool {
+		counter++
+		instr.Nonce = GenNonce()
+		instr.Length = 1
+		instr.SignerCounter = []uint64{counter}
+		require.Nil(t, instr.SignBy(dID, s.signer))
+		resp, err := s.service().AddTransaction(&AddTxRequest{
+			Version:       CurrentVersion,
+			SkipchainID:   scID,
+			Transaction:   ClientTransaction{Instructions: []Instruction{*instr}},
+			InclusionWait: 5,
+		})
+		require.Nil(t, err)
+		if !resp.Accepted {
+			// A refused transaction doesn't use the counter.
+			counter--
+		}
+		return resp.Accepted
+	}
+
+	id := []darc.Identity{s.signer.Identity()}
+	darc2 := darc.NewDarc(darc.InitRules(id, id), []byte("darc to delete"))
+	require.Nil(t, darc2.Rules.AddRule("spawn:dummy", darc2.Rules.GetSignExpr()))
+	require.Nil(t, darc2.Rules.AddRule("delete", darc2.Rules.GetSignExpr()))
+	darc2Buf, err := darc2.ToProto()
+	require.Nil(t, err)
+	darc2ID := darc2.GetBaseID()
+	require.True(t, send(s.darc.GetBaseID(), &Instruction{
+		InstanceID: NewInstanceID(s.darc.GetBaseID()),
+		Spawn: &Spawn{
+			ContractID: ContractDarcID,
+			Args:       Arguments{{Name: "darc", Value: darc2Buf}},
+		},
+	}))
+	dummy := &Instruction{
+		InstanceID: NewInstanceID(darc2ID),
+		Spawn: &Spawn{
+			ContractID: dummyContract,
+			Args:       Arguments{{Name: "data", Value: []byte("dummy")}},
+		},
+	}
+	require.True(t, send(darc2ID, dummy))
+	dummyID := NewInstanceID(dummy.Hash())
+
+	refs, err := s.service().GetDarcReferences(&GetDarcReferences{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		DarcID:      darc2ID,
+	})
+	require.Nil(t, err)
+	require.Equal(t, []InstanceID{dummyID}, refs.Instances)
+	require.Equal(t, 0, len(refs.Darcs))
+
+	// The darc cannot be deleted as long as it controls the dummy.
+	deleteDarc := &Instruction{
+		InstanceID: NewInstanceID(darc2ID),
+		Delete:     &Delete{},
+	}
+	require.False(t, send(darc2ID, deleteDarc))
+	require.True(t, send(darc2ID, &Instruction{
+		InstanceID: dummyID,
+		Delete:     &Delete{},
+	}))
+	require.True(t, send(darc2ID, deleteDarc))
+
+	resp, err := s.service().GetProof(&GetProof{
+		Version: CurrentVersion,
+		Key:     darc2ID,
+		ID:      scID,
+	})
+	require.Nil(t, err)
+	require.False(t, resp.Proof.InclusionProof.Match())
+}
+
 func TestService_DarcDelegation(t *testing.T) {
 	s := newSer(t, 1, testInterval)
 	defer s.local.CloseAll()
@@ -884,6 +1262,7 @@ func TestService_DarcDelegation(t *testing.T) {
 					Value: darc2Buf,
 				}},
 			},
+			SignerCounter: []uint64{s.counter + 1},
 		}},
 	}
 	require.Nil(t, ctx.Instructions[0].SignBy(s.darc.GetBaseID(), s.signer))
@@ -915,6 +1294,7 @@ func TestService_DarcDelegation(t *testing.T) {
 					Value: darc3Buf,
 				}},
 			},
+			SignerCounter: []uint64{s.counter + 2},
 		}},
 	}
 
@@ -924,6 +1304,206 @@ func TestService_DarcDelegation(t *testing.T) {
 	require.True(t, pr.InclusionProof.Match())
 }
 
+func TestService_PendingTx(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	// Spawn a darc where two signers must sign to spawn a dummy, and any
+	// of them can delete it.
+	signer2 := darc.NewSignerEd25519(nil, nil)
+	ids := []darc.Identity{s.signer.Identity(), signer2.Identity()}
+	d2 := darc.NewDarc(darc.InitRules(ids[:1], ids[:1]), []byte("multi-sig darc"))
+	require.Nil(t, d2.Rules.AddRule("spawn:dummy", expression.InitAndExpr(
+		s.signer.Identity().String(), signer2.Identity().String())))
+	require.Nil(t, d2.Rules.AddRule("delete", expression.InitOrExpr(
+		s.signer.Identity().String(), signer2.Identity().String())))
+	d2Buf, err := d2.ToProto()
+	require.Nil(t, err)
+	ctx := ClientTransaction{
+		Instructions: []Instruction{{
+			InstanceID: NewInstanceID(s.darc.GetBaseID()),
+			Nonce:      GenNonce(),
+			Index:      0,
+			Length:     1,
+			Spawn: &Spawn{
+				ContractID: ContractDarcID,
+				Args:       Arguments{{Name: "darc", Value: d2Buf}},
+			},
+			SignerCounter: []uint64{s.counter + 1},
+		}},
+	}
+	require.Nil(t, ctx.Instructions[0].SignBy(s.darc.GetBaseID(), s.signer))
+	s.sendTx(t, ctx)
+	s.waitProof(t, NewInstanceID(d2.GetBaseID()))
+
+	// The transaction holds both signers, but only the first one signs
+	// before it is added to the pool.
+	instr := Instruction{
+		InstanceID: NewInstanceID(d2.GetBaseID()),
+		Nonce:      GenNonce(),
+		Index:      0,
+		Length:     1,
+		Spawn: &Spawn{
+			ContractID: dummyContract,
+			Args:       Arguments{{Name: "data", Value: []byte("pending")}},
+		},
+		Signatures: []darc.Signature{
+			{Signer: s.signer.Identity()},
+			{Signer: signer2.Identity()},
+		},
+		SignerCounter: []uint64{s.counter + 2, 1},
+	}
+	sig, err := instr.CoSign(d2.GetBaseID(), s.signer)
+	require.Nil(t, err)
+	instr.Signatures[0] = sig
+	ctx = ClientTransaction{Instructions: Instructions{instr}}
+
+	scID := s.sb.SkipChainID()
+	addResp, err := s.service().AddPendingTx(&AddPendingTx{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		Transaction: ctx,
+	})
+	require.Nil(t, err)
+	require.False(t, addResp.Submitted)
+	require.Equal(t, ctx.Instructions.Hash(), addResp.ID)
+
+	listResp, err := s.service().GetPendingTxs(&GetPendingTxs{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+	})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(listResp.Transactions))
+	require.Equal(t, addResp.ID, listResp.Transactions[0].ID)
+
+	// A signer that is not in the instruction is refused.
+	signer3 := darc.NewSignerEd25519(nil, nil)
+	instr.Signatures = append(instr.Signatures, darc.Signature{Signer: signer3.Identity()})
+	sig3, err := instr.CoSign(d2.GetBaseID(), signer3)
+	require.Nil(t, err)
+	_, err = s.service().SignPendingTx(&SignPendingTx{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		ID:          addResp.ID,
+		Signatures:  []InstructionSignature{{Index: 0, Signature: sig3}},
+	})
+	require.NotNil(t, err)
+
+	// The second signature completes the transaction, which is submitted.
+	sig2, err := ctx.Instructions[0].CoSign(d2.GetBaseID(), signer2)
+	require.Nil(t, err)
+	signResp, err := s.service().SignPendingTx(&SignPendingTx{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		ID:          addResp.ID,
+		Signatures:  []InstructionSignature{{Index: 0, Signature: sig2}},
+	})
+	require.Nil(t, err)
+	require.True(t, signResp.Submitted)
+	s.waitProof(t, NewInstanceID(ctx.Instructions[0].Hash()))
+
+	listResp, err = s.service().GetPendingTxs(&GetPendingTxs{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+	})
+	require.Nil(t, err)
+	require.Equal(t, 0, len(listResp.Transactions))
+
+	// A transaction with outdated counters is refused.
+	instr.Nonce = GenNonce()
+	instr.Signatures = instr.Signatures[:2]
+	sig, err = instr.CoSign(d2.GetBaseID(), s.signer)
+	require.Nil(t, err)
+	instr.Signatures[0] = sig
+	_, err = s.service().AddPendingTx(&AddPendingTx{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		Transaction: ClientTransaction{Instructions: Instructions{instr}},
+	})
+	require.NotNil(t, err)
+
+	// A transaction without any signature is refused, and a signer can
+	// only add a limited number of transactions.
+	instr.SignerCounter = []uint64{s.counter + 3, 2}
+	addPending := func(signer darc.Signer) error {
+		instr.Nonce = GenNonce()
+		instr.Signatures = []darc.Signature{
+			{Signer: s.signer.Identity()},
+			{Signer: signer2.Identity()},
+		}
+		if signer != nil {
+			sig, err := instr.CoSign(d2.GetBaseID(), signer)
+			require.Nil(t, err)
+			for i := range instr.Signatures {
+				if instr.Signatures[i].Signer.Equal(&sig.Signer) {
+					instr.Signatures[i] = sig
+				}
+			}
+		}
+		_, err := s.service().AddPendingTx(&AddPendingTx{
+			Version:     CurrentVersion,
+			SkipchainID: scID,
+			Transaction: ClientTransaction{Instructions: Instructions{instr}},
+		})
+		return err
+	}
+	require.NotNil(t, addPending(nil))
+	for i := 0; i < maxPendingTxsPerSigner; i++ {
+		require.Nil(t, addPending(s.signer))
+	}
+	require.NotNil(t, addPending(s.signer))
+	require.Nil(t, addPending(signer2))
+
+	// The OR rule of the deletion is satisfied by the signature of the
+	// second signer, so the transaction is submitted right away, and
+	// the counter of the first signer doesn't change.
+	dummyID := NewInstanceID(ctx.Instructions[0].Hash())
+	del := Instruction{
+		InstanceID: dummyID,
+		Nonce:      GenNonce(),
+		Index:      0,
+		Length:     1,
+		Delete:     &Delete{},
+		Signatures: []darc.Signature{
+			{Signer: s.signer.Identity()},
+			{Signer: signer2.Identity()},
+		},
+		SignerCounter: []uint64{s.counter + 3, 2},
+	}
+	sig2, err = del.CoSign(d2.GetBaseID(), signer2)
+	require.Nil(t, err)
+	del.Signatures[1] = sig2
+	addResp, err = s.service().AddPendingTx(&AddPendingTx{
+		Version:     CurrentVersion,
+		SkipchainID: scID,
+		Transaction: ClientTransaction{Instructions: Instructions{del}},
+	})
+	require.Nil(t, err)
+	require.True(t, addResp.Submitted)
+
+	var ctrs *GetSignerCountersResponse
+	for i := 0; i < 10; i++ {
+		ctrs, err = s.service().GetSignerCounters(&GetSignerCounters{
+			Version:     CurrentVersion,
+			SkipchainID: scID,
+			SignerIDs:   []string{s.signer.Identity().String(), signer2.Identity().String()},
+		})
+		require.Nil(t, err)
+		if ctrs.Counters[1] == 3 {
+			break
+		}
+		time.Sleep(testInterval)
+	}
+	require.Equal(t, []uint64{s.counter + 3, 3}, ctrs.Counters)
+	proofResp, err := s.service().GetProof(&GetProof{
+		Version: CurrentVersion,
+		Key:     dummyID.Slice(),
+		ID:      scID,
+	})
+	require.Nil(t, err)
+	require.False(t, proofResp.Proof.InclusionProof.Match())
+}
+
 func TestService_GetLeader(t *testing.T) {
 	s := newSer(t, 1, testInterval)
 	defer s.local.CloseAll()
@@ -1000,6 +1580,201 @@ func TestService_SetBadConfig(t *testing.T) {
 	}
 }
 
+func TestService_ChainVersion(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	coll := s.service().getCollection(s.sb.SkipChainID()).coll
+	config := loadBlockConfig(coll)
+	require.NotNil(t, config)
+	require.Equal(t, CurrentVersion, config.Version)
+
+	countInternal := func(scs StateChanges) (n int) {
+		for _, sc := range scs {
+			if isInternalContract(string(sc.ContractID)) {
+				n++
+			}
+		}
+		return
+	}
+	bc := blockContext{index: s.sb.Index + 1, timestamp: time.Now().UnixNano()}
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, s.value, s.signer, s.counter+1)
+	require.Nil(t, err)
+	_, scs, _, err := s.service().executeTransaction(coll, bc, config, nil, tx)
+	require.Nil(t, err)
+	require.NotEqual(t, 0, countInternal(scs))
+
+	// An older chain has a configuration without version and nothing
+	// stored by the service.
+	oldColl := coll.Clone()
+	oldConfig := *config
+	oldConfig.Version = 1
+	configBuf, err := protobuf.Encode(&oldConfig)
+	require.Nil(t, err)
+	keys, err := oldColl.Keys()
+	require.Nil(t, err)
+	for _, key := range keys {
+		_, contractID, _, err := (&roCollection{oldColl}).GetValues(key)
+		require.Nil(t, err)
+		if isInternalContract(contractID) {
+			require.Nil(t, oldColl.Remove(key))
+		}
+	}
+	sc := NewStateChange(Update, ConfigInstanceID, ContractConfigID, configBuf, s.darc.GetBaseID())
+	require.Nil(t, storeInColl(oldColl, &sc))
+
+	// It neither stores its own state nor checks the signer counters.
+	tx, err = createOneClientTx(s.darc.GetBaseID(), dummyContract, s.value, s.signer, 42)
+	require.Nil(t, err)
+	_, _, _, err = s.service().executeTransaction(coll, bc, config, nil, tx)
+	require.NotNil(t, err)
+	oldColl, scs, _, err = s.service().executeTransaction(oldColl, bc, &oldConfig, nil, tx)
+	require.Nil(t, err)
+	require.Equal(t, 0, countInternal(scs))
+	dummyID := NewInstanceID(tx.Instructions[0].Hash())
+
+	// Darcs cannot be deleted, as their references are unknown.
+	del := ClientTransaction{Instructions: []Instruction{{
+		InstanceID:    NewInstanceID(s.darc.GetBaseID()),
+		Nonce:         GenNonce(),
+		Index:         0,
+		Length:        1,
+		Delete:        &Delete{},
+		SignerCounter: []uint64{1},
+	}}}
+	require.Nil(t, del.Instructions[0].SignBy(s.darc.GetBaseID(), s.signer))
+	_, _, _, err = s.service().executeTransaction(oldColl, bc, &oldConfig, nil, del)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "before the chain stores their references")
+
+	// Raising the version indexes the instances stored so far.
+	upgrade, _ := createConfigTx(t, s, false, false)
+	upgraded, scs, _, err := s.service().executeTransaction(oldColl, bc, &oldConfig, nil, upgrade)
+	require.Nil(t, err)
+	require.NotEqual(t, 0, countInternal(scs))
+	require.Equal(t, CurrentVersion, chainVersion(&roCollection{upgraded}))
+	refs, _, err := getDarcRefs(&roCollection{upgraded}, s.darc.GetBaseID())
+	require.Nil(t, err)
+	require.Equal(t, 2, len(refs.Instances))
+	require.Contains(t, refs.Instances, ConfigInstanceID.Slice())
+	require.Contains(t, refs.Instances, dummyID.Slice())
+
+	// The version can only be raised up to the current version.
+	updateConfig := func(version Version) error {
+		newConfig := *config
+		newConfig.Version = version
+		configBuf, err := protobuf.Encode(&newConfig)
+		require.Nil(t, err)
+		inst := Instruction{
+			InstanceID: ConfigInstanceID,
+			Invoke: &Invoke{
+				Command: "update_config",
+				Args:    Arguments{{Name: "config", Value: configBuf}},
+			},
+		}
+		_, _, err = invokeContractConfig(&roCollection{coll}, inst, nil)
+		return err
+	}
+	require.Nil(t, updateConfig(CurrentVersion))
+	require.NotNil(t, updateConfig(1))
+	require.NotNil(t, updateConfig(CurrentVersion+1))
+}
+
+func TestService_RefusedTxPaysFee(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+	for i := range s.hosts {
+		RegisterContract(s.hosts[i], feeCoinContractID, feeCoinContractFunc)
+	}
+
+	d2 := s.darc.Copy()
+	require.Nil(t, d2.EvolveFrom(s.darc))
+	require.Nil(t, d2.Rules.AddRule("spawn:"+feeCoinContractID, d2.Rules.GetSignExpr()))
+	require.Nil(t, d2.Rules.AddRule(feeFetchAction, d2.Rules.GetSignExpr()))
+	s.testDarcEvolution(t, *d2, false)
+	s.counter++
+
+	addTx := func(tx ClientTransaction) *AddTxResponse {
+		resp, err := s.service().AddTransaction(&AddTxRequest{
+			Version:       CurrentVersion,
+			SkipchainID:   s.sb.SkipChainID(),
+			Transaction:   tx,
+			InclusionWait: 10,
+		})
+		require.Nil(t, err)
+		return resp
+	}
+	spawnCoin := func(value uint64) InstanceID {
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, value)
+		tx, err := createOneClientTx(s.darc.GetBaseID(), feeCoinContractID, buf, s.signer, s.counter+1)
+		require.Nil(t, err)
+		require.True(t, addTx(tx).Accepted)
+		s.counter++
+		return NewInstanceID(tx.Instructions[0].Hash())
+	}
+	coinValue := func(id InstanceID) uint64 {
+		resp, err := s.service().GetProof(&GetProof{
+			Version: CurrentVersion,
+			Key:     id.Slice(),
+			ID:      s.sb.SkipChainID(),
+		})
+		require.Nil(t, err)
+		_, vs, err := resp.Proof.KeyValue()
+		require.Nil(t, err)
+		var coin Coin
+		require.Nil(t, protobuf.Decode(vs[0], &coin))
+		return coin.Value
+	}
+	payer := spawnCoin(100)
+	other := spawnCoin(100)
+	reward := spawnCoin(0)
+
+	config, err := s.service().LoadConfig(s.sb.SkipChainID())
+	require.Nil(t, err)
+	config.Fees = &FeeRules{PricePerInstruction: 10, RewardCoin: reward}
+	configBuf, err := protobuf.Encode(config)
+	require.Nil(t, err)
+	ctx := ClientTransaction{
+		Instructions: []Instruction{{
+			InstanceID: NewInstanceID(nil),
+			Nonce:      GenNonce(),
+			Index:      0,
+			Length:     1,
+			Invoke: &Invoke{
+				Command: "update_config",
+				Args:    []Argument{{Name: "config", Value: configBuf}},
+			},
+			SignerCounter: []uint64{s.counter + 1},
+		}},
+	}
+	require.Nil(t, ctx.Instructions[0].SignBy(s.darc.GetBaseID(), s.signer))
+	require.True(t, addTx(ctx).Accepted)
+	s.counter++
+
+	// The contract refuses the transaction, but the fee is paid.
+	tx, err := createOneClientTx(s.darc.GetBaseID(), invalidContract, s.value, s.signer, s.counter+1)
+	require.Nil(t, err)
+	tx.Instructions[0].FeeCoin = payer.Slice()
+	require.Nil(t, tx.Instructions[0].SignBy(s.darc.GetBaseID(), s.signer))
+	require.False(t, addTx(tx).Accepted)
+	s.counter++
+	require.Equal(t, uint64(90), coinValue(payer))
+	require.Equal(t, uint64(10), coinValue(reward))
+
+	// Replacing the fee coin invalidates the signature, so nothing is
+	// charged.
+	tx, err = createOneClientTx(s.darc.GetBaseID(), invalidContract, s.value, s.signer, s.counter+1)
+	require.Nil(t, err)
+	tx.Instructions[0].FeeCoin = payer.Slice()
+	require.Nil(t, tx.Instructions[0].SignBy(s.darc.GetBaseID(), s.signer))
+	tx.Instructions[0].FeeCoin = other.Slice()
+	require.False(t, addTx(tx).Accepted)
+	require.Equal(t, uint64(100), coinValue(other))
+	require.Equal(t, uint64(90), coinValue(payer))
+	require.Equal(t, uint64(10), coinValue(reward))
+}
+
 // TestService_ViewChange is an end-to-end test for view-change. We kill the
 // first nFailures nodes, where the nodes at index 0 is the current leader. The
 // node at index nFailures should become the new leader. Then, we try to send a
@@ -1064,7 +1839,7 @@ func testViewChange(t *testing.T, nHosts, nFailures int, interval time.Duration)
 
 	// try to send a transaction to the node on index nFailures+1, which is
 	// a follower (not the new leader)
-	tx1, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, s.value, s.signer)
+	tx1, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, s.value, s.signer, s.counter+1)
 	require.NoError(t, err)
 	s.sendTxTo(t, tx1, nFailures+1)
 
@@ -1141,18 +1916,20 @@ func TestService_StateChangeCache(t *testing.T) {
 		Value:       []byte{},
 	}}, 0)
 	coll := collDB.coll
-	tx1, err := createOneClientTx(s.darc.GetBaseID(), contractID, []byte{}, s.signer)
+	tx1, err := createOneClientTx(s.darc.GetBaseID(), contractID, []byte{}, s.signer, s.counter+1)
 	require.Nil(t, err)
 
 	// Add a second tx that is invalid because it is for an unknown contract.
-	tx2, err := createOneClientTx(s.darc.GetBaseID(), contractID+"x", []byte{}, s.signer)
+	tx2, err := createOneClientTx(s.darc.GetBaseID(), contractID+"x", []byte{}, s.signer, s.counter+2)
 	require.Nil(t, err)
 
 	txs := NewTxResults(tx1, tx2)
 	require.NoError(t, err)
-	root, txOut, states := s.service().createStateChanges(coll, scID, txs, noTimeout)
+	bc := blockContext{index: 1, timestamp: time.Now().UnixNano()}
+	root, txOut, states := s.service().createStateChanges(coll, scID, bc, txs, noTimeout)
 	require.Equal(t, 2, len(txOut))
-	require.Equal(t, 0, len(states))
+	// The only state change is the update of the signer counter.
+	require.Equal(t, 1, len(states))
 	require.Equal(t, 1, ctr)
 
 	// If we call createStateChanges on the new txOut (as it will happen in production
@@ -1160,7 +1937,7 @@ func TestService_StateChangeCache(t *testing.T) {
 	// createStateChanges when making the block), then it should load it from the
 	// cache, which means that ctr is still one (we do not call the
 	// contract twice).
-	root1, txOut1, states1 := s.service().createStateChanges(coll, scID, txOut, noTimeout)
+	root1, txOut1, states1 := s.service().createStateChanges(coll, scID, bc, txOut, noTimeout)
 	require.Equal(t, 1, ctr)
 	require.Equal(t, root, root1)
 	require.Equal(t, txOut, txOut1)
@@ -1170,7 +1947,7 @@ func TestService_StateChangeCache(t *testing.T) {
 	// again, i.e., ctr == 2.
 	s.service().stateChangeCache = newStateChangeCache()
 	require.NoError(t, err)
-	root2, txOut2, states2 := s.service().createStateChanges(coll, scID, txs, noTimeout)
+	root2, txOut2, states2 := s.service().createStateChanges(coll, scID, bc, txs, noTimeout)
 	require.Equal(t, root, root2)
 	require.Equal(t, txOut, txOut2)
 	require.Equal(t, states, states2)
@@ -1181,11 +1958,24 @@ func createConfigTx(t *testing.T, s *ser, intervalBad, szBad bool) (ClientTransa
 	var config ChainConfig
 	switch {
 	case intervalBad:
-		config = ChainConfig{-1, *s.roster.RandomSubset(s.services[1].ServerIdentity(), 2), defaultMaxBlockSize}
+		config = ChainConfig{
+			BlockInterval: -1,
+			Roster:        *s.roster.RandomSubset(s.services[1].ServerIdentity(), 2),
+			MaxBlockSize:  defaultMaxBlockSize,
+		}
 	case szBad:
-		config = ChainConfig{420 * time.Millisecond, *s.roster.RandomSubset(s.services[1].ServerIdentity(), 2), 30 * 1e6}
+		config = ChainConfig{
+			BlockInterval: 420 * time.Millisecond,
+			Roster:        *s.roster.RandomSubset(s.services[1].ServerIdentity(), 2),
+			MaxBlockSize:  30 * 1e6,
+		}
 	default:
-		config = ChainConfig{420 * time.Millisecond, *s.roster, 424242}
+		config = ChainConfig{
+			BlockInterval: 420 * time.Millisecond,
+			Roster:        *s.roster,
+			MaxBlockSize:  424242,
+			Version:       CurrentVersion,
+		}
 	}
 	configBuf, err := protobuf.Encode(&config)
 	require.NoError(t, err)
@@ -1203,13 +1993,14 @@ func createConfigTx(t *testing.T, s *ser, intervalBad, szBad bool) (ClientTransa
 					Value: configBuf,
 				}},
 			},
+			SignerCounter: []uint64{s.counter + 1},
 		}},
 	}
 	require.NoError(t, ctx.Instructions[0].SignBy(s.darc.GetBaseID(), s.signer))
 	return ctx, config
 }
 
-func darcToTx(t *testing.T, d2 darc.Darc, signer darc.Signer) ClientTransaction {
+func darcToTx(t *testing.T, d2 darc.Darc, signer darc.Signer, counter uint64) ClientTransaction {
 	d2Buf, err := d2.ToProto()
 	require.Nil(t, err)
 	invoke := Invoke{
@@ -1222,11 +2013,12 @@ func darcToTx(t *testing.T, d2 darc.Darc, signer darc.Signer) ClientTransaction
 		},
 	}
 	instr := Instruction{
-		InstanceID: NewInstanceID(d2.GetBaseID()),
-		Nonce:      GenNonce(),
-		Index:      0,
-		Length:     1,
-		Invoke:     &invoke,
+		InstanceID:    NewInstanceID(d2.GetBaseID()),
+		Nonce:         GenNonce(),
+		Index:         0,
+		Length:        1,
+		Invoke:        &invoke,
+		SignerCounter: []uint64{counter},
 	}
 	require.Nil(t, instr.SignBy(d2.GetBaseID(), signer))
 	return ClientTransaction{
@@ -1245,6 +2037,8 @@ type ser struct {
 	signer   darc.Signer
 	tx       ClientTransaction
 	interval time.Duration
+	// counter is the latest counter of signer.
+	counter uint64
 }
 
 func (s *ser) service() *Service {
@@ -1294,7 +2088,7 @@ func (s *ser) sendTxTo(t *testing.T, ctx ClientTransaction, idx int) {
 
 // caller gives us a darc, and we try to make an evolution request.
 func (s *ser) testDarcEvolution(t *testing.T, d2 darc.Darc, fail bool) (pr *Proof) {
-	ctx := darcToTx(t, d2, s.signer)
+	ctx := darcToTx(t, d2, s.signer, s.counter+1)
 	s.sendTx(t, ctx)
 	for i := 0; i < 10; i++ {
 		resp, err := s.service().GetProof(&GetProof{
@@ -1351,16 +2145,18 @@ func newSerN(t *testing.T, step int, interval time.Duration, n int, viewchange b
 			require.Nil(t, err)
 			s.sb = resp.Skipblock
 		case 1:
-			tx, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, s.value, s.signer)
+			tx, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, s.value, s.signer, 1)
 			require.Nil(t, err)
 			s.tx = tx
-			_, err = s.service().AddTransaction(&AddTxRequest{
+			resp, err := s.service().AddTransaction(&AddTxRequest{
 				Version:       CurrentVersion,
 				SkipchainID:   s.sb.SkipChainID(),
 				Transaction:   tx,
 				InclusionWait: 10,
 			})
 			require.Nil(t, err)
+			require.True(t, resp.Accepted)
+			s.counter = 1
 		default:
 			require.Fail(t, "no such step")
 		}
@@ -1401,6 +2197,28 @@ func dummyContractFunc(cdb CollectionView, inst Instruction, c []Coin) ([]StateC
 	}
 }
 
+// feeCoinContractFunc spawns a coin holding the value given in the data
+// argument. It stands in for the coin contract, which cannot be imported
+// here.
+func feeCoinContractFunc(cdb CollectionView, inst Instruction, c []Coin) ([]StateChange, []Coin, error) {
+	if inst.GetType() != SpawnType {
+		return nil, nil, errors.New("only spawn is supported")
+	}
+	_, _, darcID, err := cdb.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, err
+	}
+	coinBuf, err := protobuf.Encode(&Coin{
+		Value: binary.LittleEndian.Uint64(inst.Spawn.Args.Search("data")),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return []StateChange{
+		NewStateChange(Create, NewInstanceID(inst.Hash()), feeCoinContractID, coinBuf, darcID),
+	}, nil, nil
+}
+
 func slowContractFunc(cdb CollectionView, inst Instruction, c []Coin) ([]StateChange, []Coin, error) {
 	// This has to sleep for less than testInterval / 2 or else it will
 	// block the system from processing txs. See #1359.
@@ -90,6 +90,10 @@ func (s *SimulationService) Run(config *onet.SimulationConfig) error {
 		return errors.New("couldn't create genesis block: " + err.Error())
 	}
 
+	// The signer is new, so its counter starts at 1 and is increased with
+	// every instruction it signs.
+	counter := uint64(1)
+
 	// Create two accounts and mint 'Transaction' coins on first account.
 	coins := make([]byte, 8)
 	coins[7] = byte(1)
@@ -103,6 +107,7 @@ func (s *SimulationService) Run(config *onet.SimulationConfig) error {
 				Spawn: &byzcoin.Spawn{
 					ContractID: contracts.ContractCoinID,
 				},
+				SignerCounter: []uint64{counter},
 			},
 			{
 				InstanceID: byzcoin.NewInstanceID(gm.GenesisDarc.GetBaseID()),
@@ -112,6 +117,7 @@ func (s *SimulationService) Run(config *onet.SimulationConfig) error {
 				Spawn: &byzcoin.Spawn{
 					ContractID: contracts.ContractCoinID,
 				},
+				SignerCounter: []uint64{counter + 1},
 			},
 		},
 	}
@@ -122,6 +128,7 @@ func (s *SimulationService) Run(config *onet.SimulationConfig) error {
 			return errors.New("signing of instruction failed: " + err.Error())
 		}
 	}
+	counter += 2
 	coinAddr1 := tx.Instructions[0].DeriveID("")
 	coinAddr2 := tx.Instructions[1].DeriveID("")
 
@@ -146,6 +153,7 @@ func (s *SimulationService) Run(config *onet.SimulationConfig) error {
 						Name:  "coins",
 						Value: coins}},
 				},
+				SignerCounter: []uint64{counter},
 			},
 		},
 	}
@@ -156,6 +164,7 @@ func (s *SimulationService) Run(config *onet.SimulationConfig) error {
 	if err != nil {
 		return errors.New("couldn't mint coin: " + err.Error())
 	}
+	counter++
 
 	coinOne := make([]byte, 8)
 	coinOne[0] = byte(1)
@@ -206,7 +215,9 @@ func (s *SimulationService) Run(config *onet.SimulationConfig) error {
 								Value: coinAddr2.Slice(),
 							}},
 					},
+					SignerCounter: []uint64{counter},
 				})
+				counter++
 				err = byzcoin.SignInstruction(&tx.Instructions[i], gm.GenesisDarc.GetBaseID(), signer)
 				if err != nil {
 					return errors.New("signature error: " + err.Error())
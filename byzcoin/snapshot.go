@@ -0,0 +1,394 @@
+package byzcoin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoin/collection"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/kyber/sign/schnorr"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// defaultSnapshotInterval is used if the SnapshotInterval of the ChainConfig
+// is not set.
+const defaultSnapshotInterval = 1000
+
+// maxSnapshotChunk is the maximum number of nodes of the trie that can be
+// requested at once with GetSnapshotNodes.
+const maxSnapshotChunk = 1000
+
+// Hash returns the hash of the snapshot, which is signed by the conodes
+// sending it.
+func (sn Snapshot) Hash() []byte {
+	h := sha256.New()
+	h.Write(sn.SkipchainID)
+	h.Write(sn.BlockID)
+	h.Write([]byte(fmt.Sprintf("%d", sn.Index)))
+	h.Write(sn.CollectionRoot)
+	return h.Sum(nil)
+}
+
+// snapshotInterval returns the number of blocks between two snapshots, as
+// defined by the configuration stored in coll.
+func snapshotInterval(coll CollectionView) int {
+	config, err := loadConfigFromColl(coll)
+	if err != nil || config.SnapshotInterval <= 0 {
+		return defaultSnapshotInterval
+	}
+	return config.SnapshotInterval
+}
+
+// pruneGuard returns the index of the oldest block of the skipchain whose
+// body must be kept: the conodes that catch up with our latest snapshot need
+// the bodies of the blocks after it. Without a snapshot, they catch up from
+// the genesis block, so no block is pruned.
+func (s *Service) pruneGuard(scID skipchain.SkipBlockID) int {
+	if !s.isOurChain(scID) {
+		return math.MaxInt32
+	}
+	sn, err := s.getCollection(scID).getSnapshot()
+	if err != nil {
+		return 1
+	}
+	return sn.Index + 1
+}
+
+// checkPayload makes sure that the body of a block of one of our chains
+// matches the hash of the transactions in its header. The skipchain service
+// uses it to refuse the wrong bodies an archive could return for pruned
+// blocks, as the body is not part of the hash of the block.
+func (s *Service) checkPayload(sb *skipchain.SkipBlock) error {
+	if !s.isOurChain(sb.SkipChainID()) {
+		return nil
+	}
+	var header DataHeader
+	err := protobuf.DecodeWithConstructors(sb.Data, &header, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return errors.New("couldn't unmarshal header: " + err.Error())
+	}
+	var body DataBody
+	err = protobuf.DecodeWithConstructors(sb.Payload, &body, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return errors.New("couldn't unmarshal body: " + err.Error())
+	}
+	if !bytes.Equal(header.ClientTransactionHash, body.TxResults.Hash()) {
+		return fmt.Errorf("the body of block %d doesn't match its header", sb.Index)
+	}
+	return nil
+}
+
+// storeSnapshot remembers the snapshot as the latest one of the collection.
+func (c *collectionDB) storeSnapshot(sn Snapshot) error {
+	buf, err := protobuf.Encode(&sn)
+	if err != nil {
+		return err
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(c.bucketName))
+		if bucket == nil {
+			return errors.New("bucket does not exist")
+		}
+		return bucket.Put([]byte{dbMeta, dbMetaSnapshot}, buf)
+	})
+}
+
+// getSnapshot returns the latest snapshot of the collection.
+func (c *collectionDB) getSnapshot() (*Snapshot, error) {
+	var buf []byte
+	err := c.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(c.bucketName))
+		if bucket == nil {
+			return errors.New("bucket does not exist")
+		}
+		buf = dup(bucket.Get([]byte{dbMeta, dbMetaSnapshot}))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) == 0 {
+		return nil, errors.New("no snapshot available")
+	}
+	sn := &Snapshot{}
+	if err = protobuf.Decode(buf, sn); err != nil {
+		return nil, err
+	}
+	return sn, nil
+}
+
+// storeNodes stores nodes of the trie that have been downloaded from
+// another conode.
+func (c *collectionDB) storeNodes(nodes map[[sha256.Size]byte][]byte) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(c.bucketName))
+		if bucket == nil {
+			return errors.New("bucket does not exist")
+		}
+		for label, node := range nodes {
+			if err := bucket.Put(append([]byte{dbNode}, label[:]...), node); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// restore replaces the state of the collection with the trie with the given
+// root, which must already be stored, as the state after the block with the
+// given index.
+func (c *collectionDB) restore(root []byte, index int) error {
+	if err := c.coll.Reset(root); err != nil {
+		return err
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(c.bucketName))
+		if bucket == nil {
+			return errors.New("bucket does not exist")
+		}
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, uint32(index))
+		if err := bucket.Put([]byte{dbMeta, dbMetaIndex}, b); err != nil {
+			return err
+		}
+		return bucket.Put([]byte{dbMeta, dbMetaRoot}, root)
+	})
+}
+
+// catchUp brings the collection up to the block before latest, when blocks
+// have been missed, like when a conode joins the roster. If another conode
+// of the roster has a more recent snapshot, the state is downloaded from it.
+// The remaining blocks are then fetched and applied one by one. The
+// updateMutex of cdb must not be held, as it is only taken to change the
+// state, but not while fetching from the other conodes.
+func (s *Service) catchUp(cdb *collectionDB, latest *skipchain.SkipBlock) error {
+	cdb.catchUpMutex.Lock()
+	defer cdb.catchUpMutex.Unlock()
+
+	genesis, err := s.fetchBlock(latest.Roster, latest.SkipChainID(), false)
+	if err != nil {
+		return err
+	}
+	from, err := s.fastSync(cdb, genesis, latest)
+	if err != nil {
+		log.Warn(s.ServerIdentity(), "couldn't use a snapshot:", err)
+	}
+	index := cdb.getIndex()
+	if from == nil {
+		from, err = s.walkTo(latest.Roster, genesis, index)
+		if err != nil {
+			return err
+		}
+	}
+
+	for index+1 < latest.Index {
+		sb, err := s.walkTo(latest.Roster, from, index+1)
+		if err != nil {
+			return err
+		}
+		cdb.updateMutex.Lock()
+		// The state might have been updated while the block was
+		// fetched.
+		if cdb.getIndex() == index {
+			log.Lvlf2("%s catching up with block %d", s.ServerIdentity(), sb.Index)
+			_, err = s.applyBlock(cdb, sb)
+		}
+		index = cdb.getIndex()
+		cdb.updateMutex.Unlock()
+		if err != nil {
+			return err
+		}
+		if from, err = s.walkTo(latest.Roster, sb, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fastSync asks the other conodes of the roster of latest for their latest
+// snapshot. The first snapshot that is more recent than the state of cdb and
+// older than latest is verified and downloaded, and replaces the state of
+// cdb. It returns the block of the snapshot, or nil if no snapshot has been
+// used. The updateMutex of cdb is only held to replace the state.
+func (s *Service) fastSync(cdb *collectionDB, genesis, latest *skipchain.SkipBlock) (*skipchain.SkipBlock, error) {
+	cl := onet.NewClient(cothority.Suite, ServiceName)
+	defer cl.Close()
+	index := cdb.getIndex()
+
+	var lastErr error
+	for _, si := range latest.Roster.List {
+		if si.Equal(s.ServerIdentity()) {
+			continue
+		}
+		resp := &GetSnapshotResponse{}
+		err := cl.SendProtobuf(si, &GetSnapshot{
+			Version:     CurrentVersion,
+			SkipchainID: genesis.Hash,
+		}, resp)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		sn := resp.Snapshot
+		if sn.Index <= index || sn.Index >= latest.Index {
+			continue
+		}
+		sb, err := s.verifySnapshot(si, genesis, latest, resp)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		log.Lvlf2("%s downloading snapshot of block %d from %s", s.ServerIdentity(), sn.Index, si)
+		fetch := func(labels [][]byte) ([][]byte, error) {
+			resp := &GetSnapshotNodesResponse{}
+			err := cl.SendProtobuf(si, &GetSnapshotNodes{
+				Version:     CurrentVersion,
+				SkipchainID: genesis.Hash,
+				Labels:      labels,
+			}, resp)
+			return resp.Nodes, err
+		}
+		err = collection.SyncTrie(sn.CollectionRoot, maxSnapshotChunk, fetch, cdb.storeNodes)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err = cdb.restoreSnapshot(sn); err != nil {
+			return nil, err
+		}
+		return sb, nil
+	}
+	return nil, lastErr
+}
+
+// restoreSnapshot replaces the state of the collection with the snapshot,
+// whose nodes must already be stored, unless the state has been updated past
+// the snapshot in the meantime.
+func (c *collectionDB) restoreSnapshot(sn Snapshot) error {
+	c.updateMutex.Lock()
+	defer c.updateMutex.Unlock()
+	if c.getIndex() >= sn.Index {
+		return nil
+	}
+	if err := c.restore(sn.CollectionRoot, sn.Index); err != nil {
+		return err
+	}
+	return c.storeSnapshot(sn)
+}
+
+// verifySnapshot checks the signature of the snapshot sent by si, and that
+// its root is the one stored in its block. It returns the block.
+func (s *Service) verifySnapshot(si *network.ServerIdentity, genesis, latest *skipchain.SkipBlock,
+	resp *GetSnapshotResponse) (*skipchain.SkipBlock, error) {
+	sn := resp.Snapshot
+	if !sn.SkipchainID.Equal(genesis.Hash) {
+		return nil, errors.New("snapshot of another skipchain")
+	}
+	if err := schnorr.Verify(cothority.Suite, si.Public, sn.Hash(), resp.Signature); err != nil {
+		return nil, errors.New("wrong signature on snapshot: " + err.Error())
+	}
+	sb, err := s.walkTo(latest.Roster, genesis, sn.Index)
+	if err != nil {
+		return nil, err
+	}
+	if !sb.Hash.Equal(sn.BlockID) {
+		return nil, errors.New("the snapshot is not for a block of the skipchain")
+	}
+	var header DataHeader
+	err = protobuf.DecodeWithConstructors(sb.Data, &header, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header.CollectionRoot, sn.CollectionRoot) {
+		return nil, errors.New("the root of the snapshot is not the one of its block")
+	}
+	return sb, nil
+}
+
+// walkTo follows the forward links from the block from up to the block with
+// the given index and returns it. As the forward links are signed by the
+// roster of the block they come from, the returned block can be trusted as
+// much as from. The blocks that are not stored locally are fetched from the
+// roster.
+func (s *Service) walkTo(roster *onet.Roster, from *skipchain.SkipBlock, index int) (*skipchain.SkipBlock, error) {
+	for from.Index < index {
+		links := from.ForwardLink
+		if len(links) == 0 {
+			// Our copy of the block might not have the forward
+			// links yet.
+			remote, err := s.fetchBlock(roster, from.Hash, true)
+			if err != nil {
+				return nil, err
+			}
+			for _, fl := range remote.ForwardLink {
+				if !fl.From.Equal(from.Hash) {
+					return nil, errors.New("forward link from another block")
+				}
+				if err = fl.Verify(cothority.Suite, from.Roster.Publics()); err != nil {
+					return nil, err
+				}
+			}
+			links = remote.ForwardLink
+		}
+
+		// Take the highest link that doesn't jump over the index.
+		var next *skipchain.SkipBlock
+		for i := len(links) - 1; i >= 0 && next == nil; i-- {
+			if links[i] == nil || links[i].IsEmpty() {
+				continue
+			}
+			sb, err := s.fetchBlock(roster, links[i].To, false)
+			if err != nil {
+				return nil, err
+			}
+			if sb.Index <= index {
+				next = sb
+			}
+		}
+		if next == nil {
+			return nil, fmt.Errorf("cannot reach block %d from block %d", index, from.Index)
+		}
+		from = next
+	}
+	if from.Index != index {
+		return nil, fmt.Errorf("cannot reach block %d", index)
+	}
+	return from, nil
+}
+
+// fetchBlock returns the block with the given ID. Unless remote is true, the
+// local copy is returned if there is one. Else the block is asked to the
+// other conodes of the roster and is only returned if its hash is correct.
+func (s *Service) fetchBlock(roster *onet.Roster, id skipchain.SkipBlockID, remote bool) (*skipchain.SkipBlock, error) {
+	if !remote {
+		if sb := s.db().GetByID(id); sb != nil {
+			return sb, nil
+		}
+	}
+	cl := skipchain.NewClient()
+	defer cl.Close()
+	for _, si := range roster.List {
+		if si.Equal(s.ServerIdentity()) {
+			continue
+		}
+		sb := &skipchain.SkipBlock{}
+		if err := cl.SendProtobuf(si, &skipchain.GetSingleBlock{ID: id}, sb); err != nil {
+			log.Lvl2("couldn't get block from", si, err)
+			continue
+		}
+		if sb.CalculateHash().Equal(id) {
+			return sb, nil
+		}
+	}
+	return nil, fmt.Errorf("couldn't fetch block %x", id)
+}
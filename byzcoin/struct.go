@@ -1,6 +1,8 @@
 package byzcoin
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -12,6 +14,7 @@ import (
 	"github.com/dedis/cothority/skipchain"
 	"github.com/dedis/onet/log"
 	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
 )
 
 func init() {
@@ -19,11 +22,19 @@ func init() {
 		DataHeader{}, DataBody{})
 }
 
+// collectionDB holds the global state in a trie whose nodes are stored in
+// a bolt bucket. Only the nodes that are needed are read from the disk.
 type collectionDB struct {
 	db         *bolt.DB
 	bucketName []byte
-	coll       *collection.Collection
+	coll       *collection.Trie
 	scID       skipchain.SkipBlockID
+	// updateMutex serializes the updates of the state from new blocks,
+	// including the catching up with missed blocks.
+	updateMutex sync.Mutex
+	// catchUpMutex serializes the catching up with missed blocks, which
+	// fetches the blocks and the snapshots without holding updateMutex.
+	catchUpMutex sync.Mutex
 }
 
 // A CollectionView is an interface that defines the read-only operations
@@ -44,7 +55,7 @@ type CollectionView interface {
 // safety, not real security. If the holder of the CollectionView chooses to
 // use package unsafe, then it's all over; they can get write access.
 type roCollection struct {
-	c *collection.Collection
+	c *collection.Trie
 }
 
 // Get returns the collection.Getter for the key.
@@ -62,13 +73,13 @@ func (r *roCollection) GetValues(key []byte) (value []byte, contractID string, d
 // which can be registered with the ByzCoin service.
 type ContractFn func(coll CollectionView, inst Instruction, inCoins []Coin) (sc []StateChange, outCoins []Coin, err error)
 
-// newCollectionDB initialises a structure and reads all key/value pairs to store
-// it in the collection.
+// newCollectionDB initialises a structure and opens the trie stored in the
+// bucket. If the bucket holds key/value pairs in the format used before the
+// trie, they are moved into the trie.
 func newCollectionDB(db *bolt.DB, name []byte) *collectionDB {
 	c := &collectionDB{
 		db:         db,
 		bucketName: name,
-		coll:       collection.New(collection.Data{}, collection.Data{}, collection.Data{}),
 	}
 	c.db.Update(func(tx *bolt.Tx) error {
 		_, err := tx.CreateBucket(name)
@@ -77,15 +88,22 @@ func newCollectionDB(db *bolt.DB, name []byte) *collectionDB {
 		}
 		return nil
 	})
-	err := c.loadAll()
+	err := c.loadTrie()
 	if err != nil {
 		log.Error("unable to load collection from disk:", err)
+		c.coll, _ = collection.NewTrie(c, nil, collectionFields()...)
 	}
 
 	// TODO: Check the merkle tree root.
 	return c
 }
 
+// collectionFields returns the fields of the values stored in the
+// collection: the value, the contract ID and the darc ID.
+func collectionFields() []collection.Field {
+	return []collection.Field{collection.Data{}, collection.Data{}, collection.Data{}}
+}
+
 // dup makes a copy of in. We use this with results from BoltDB
 // because BoltDB's docs say, "The returned value is only valid for
 // the life of the transaction."
@@ -98,21 +116,56 @@ const (
 	dbContract
 	dbDarcID
 	dbMeta
+	dbNode
+	dbHistory
 )
 
 const (
 	dbMetaIndex byte = iota
+	dbMetaRoot
+	dbMetaSnapshot
 )
 
-func (c *collectionDB) loadAll() error {
-	return c.db.View(func(tx *bolt.Tx) error {
-		// Assume bucket exists and has keys
+// loadTrie opens the trie whose root is stored in the bucket. If there is
+// no root yet, the key/value pairs of the old format are added to a new trie.
+func (c *collectionDB) loadTrie() error {
+	var root []byte
+	err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(c.bucketName))
+		if b == nil {
+			return errors.New("bucket does not exist")
+		}
+		if r := b.Get([]byte{dbMeta, dbMetaRoot}); r != nil {
+			root = dup(r)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if root != nil {
+		c.coll, err = collection.NewTrie(c, root, collectionFields()...)
+		return err
+	}
+
+	c.coll, err = collection.NewTrie(c, nil, collectionFields()...)
+	if err != nil {
+		return err
+	}
+	return c.migrate()
+}
+
+// migrate moves the key/value pairs stored by older versions, which were
+// read into memory at startup, into the trie.
+func (c *collectionDB) migrate() error {
+	var legacy [][]byte
+	err := c.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(c.bucketName))
 		cur := b.Cursor()
 
 		for k, v := cur.First(); k != nil; k, v = cur.Next() {
 			// Only look at value keys
-			if len(k) > 0 && k[0] != dbValue {
+			if len(k) == 0 || k[0] != dbValue {
 				continue
 			}
 
@@ -133,13 +186,63 @@ func (c *collectionDB) loadAll() error {
 			if err != nil {
 				return err
 			}
+			legacy = append(legacy, dup(k[1:]))
 		}
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	if len(legacy) > 0 {
+		log.Lvlf2("Moving %d instances of %s into the trie", len(legacy), c.bucketName)
+	}
+	return c.coll.Flush(func(root []byte, nodes map[[sha256.Size]byte][]byte) error {
+		return c.db.Update(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket([]byte(c.bucketName))
+			for _, id := range legacy {
+				key := append([]byte{0}, id...)
+				for _, prefix := range []byte{dbValue, dbContract, dbDarcID} {
+					key[0] = prefix
+					if err := bucket.Delete(key); err != nil {
+						return err
+					}
+				}
+			}
+			return putNodes(bucket, root, nodes)
+		})
+	})
+}
+
+// GetNode implements collection.NodeStore and returns the encoded node of
+// the trie with the given label.
+func (c *collectionDB) GetNode(label []byte) (node []byte, err error) {
+	err = c.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(c.bucketName))
+		if bucket == nil {
+			return errors.New("bucket does not exist")
+		}
+		if v := bucket.Get(append([]byte{dbNode}, label...)); v != nil {
+			node = dup(v)
+		}
+		return nil
+	})
+	return
+}
+
+// putNodes stores the nodes of the trie in the bucket, together with the
+// root of the trie.
+func putNodes(bucket *bolt.Bucket, root []byte, nodes map[[sha256.Size]byte][]byte) error {
+	for label, node := range nodes {
+		if err := bucket.Put(append([]byte{dbNode}, label[:]...), node); err != nil {
+			return err
+		}
+	}
+	return bucket.Put([]byte{dbMeta, dbMetaRoot}, root)
 }
 
-func storeInColl(coll *collection.Collection, t *StateChange) error {
+func storeInColl(coll *collection.Trie, t *StateChange) error {
 	switch t.StateAction {
 	case Create:
 		return coll.Add(t.InstanceID, t.Value, t.ContractID, []byte(t.DarcID))
@@ -187,6 +290,10 @@ func (c *collectionDB) getIndex() int {
 	return int(out)
 }
 
+// StoreAll applies the state changes to the trie and stores the new nodes
+// together with the index of the block holding the state changes. The state
+// changes are also added to the history of their instances, except the ones
+// of the values the service stores next to the instances.
 // FIXME: if there is an error, the data in collection may not be consistent
 // with boltdb.
 func (c *collectionDB) StoreAll(ts StateChanges, index int) error {
@@ -195,55 +302,86 @@ func (c *collectionDB) StoreAll(ts StateChanges, index int) error {
 			return err
 		}
 	}
-	return c.db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(c.bucketName))
-		if bucket == nil {
-			return errors.New("bucket does not exist")
-		}
-
-		b := make([]byte, 4)
-		binary.LittleEndian.PutUint32(b, uint32(index))
-		if err := bucket.Put([]byte{dbMeta, dbMetaIndex}, b); err != nil {
-			return err
-		}
-
-		for _, t := range ts {
-			key := make([]byte, 1+len(t.InstanceID))
-			copy(key[1:], t.InstanceID)
+	return c.coll.Flush(func(root []byte, nodes map[[sha256.Size]byte][]byte) error {
+		return c.db.Update(func(tx *bolt.Tx) error {
+			bucket := tx.Bucket([]byte(c.bucketName))
+			if bucket == nil {
+				return errors.New("bucket does not exist")
+			}
 
-			switch t.StateAction {
-			case Create, Update:
-				key[0] = dbValue
-				if err := bucket.Put(key, t.Value); err != nil {
-					return err
-				}
-				key[0] = dbContract
-				if err := bucket.Put(key, t.ContractID); err != nil {
-					return err
-				}
-				key[0] = dbDarcID
-				if err := bucket.Put(key, t.DarcID); err != nil {
-					return err
-				}
-			case Remove:
-				key[0] = dbValue
-				if err := bucket.Delete(key); err != nil {
-					return err
+			b := make([]byte, 4)
+			binary.LittleEndian.PutUint32(b, uint32(index))
+			if err := bucket.Put([]byte{dbMeta, dbMetaIndex}, b); err != nil {
+				return err
+			}
+			for i, t := range ts {
+				if isInternalContract(string(t.ContractID)) {
+					continue
 				}
-				key[0] = dbContract
-				if err := bucket.Delete(key); err != nil {
+				buf, err := protobuf.Encode(&t)
+				if err != nil {
 					return err
 				}
-				key[0] = dbDarcID
-				if err := bucket.Delete(key); err != nil {
+				if err = bucket.Put(historyKey(t.InstanceID, index, i), buf); err != nil {
 					return err
 				}
-			default:
-				return errors.New("invalid state action")
 			}
+			return putNodes(bucket, root, nodes)
+		})
+	})
+}
+
+// historyKey returns the key under which the state change at position pos
+// in the block with the given index is stored. The keys of an instance share
+// the same prefix and are sorted by block index and position.
+func historyKey(iid []byte, index, pos int) []byte {
+	h := sha256.Sum256(iid)
+	key := append([]byte{dbHistory}, h[:]...)
+	key = append(key, make([]byte, 8)...)
+	binary.BigEndian.PutUint32(key[len(key)-8:], uint32(index))
+	binary.BigEndian.PutUint32(key[len(key)-4:], uint32(pos))
+	return key
+}
+
+// getHistory returns at most count state changes of the instance, skipping
+// the first start ones, and the total number of its state changes. Only the
+// state changes stored since the history is kept are available.
+func (c *collectionDB) getHistory(iid []byte, start, count int) (entries []HistoryEntry, total int, err error) {
+	prefix := historyKey(iid, 0, 0)[:1+sha256.Size]
+	err = c.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(c.bucketName))
+		if bucket == nil {
+			return errors.New("bucket does not exist")
+		}
+		cur := bucket.Cursor()
+		for k, v := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cur.Next() {
+			total++
+			if total <= start || len(entries) >= count {
+				continue
+			}
+			var sc StateChange
+			if err := protobuf.Decode(v, &sc); err != nil {
+				return err
+			}
+			entries = append(entries, HistoryEntry{
+				BlockIndex:  int(binary.BigEndian.Uint32(k[len(prefix):])),
+				StateChange: sc,
+			})
 		}
 		return nil
 	})
+	return
+}
+
+// viewAt returns the state of the collection when its root was the given
+// one. As the nodes of the trie are never removed, all the states since the
+// collection is stored in a trie are available.
+func (c *collectionDB) viewAt(root []byte) (CollectionView, error) {
+	coll, err := collection.NewTrie(c, root, collectionFields()...)
+	if err != nil {
+		return nil, errors.New("the state of this block is not available: " + err.Error())
+	}
+	return &roCollection{coll}, nil
 }
 
 // RootHash returns the hash of the root node in the merkle tree.
@@ -300,24 +438,15 @@ func getValueContract(coll CollectionView, key []byte) (value []byte, contract s
 
 // tryHash returns the merkle root of the collection as if the key value pairs
 // in the transactions had been added, without actually adding it.
-func (c *collectionDB) tryHash(ts []StateChange) (mr []byte, rerr error) {
+func (c *collectionDB) tryHash(ts []StateChange) ([]byte, error) {
+	coll := c.coll.Clone()
 	for _, sc := range ts {
-		err := c.coll.Add(sc.InstanceID, sc.Value, sc.ContractID, []byte(sc.DarcID))
+		err := coll.Add(sc.InstanceID, sc.Value, sc.ContractID, []byte(sc.DarcID))
 		if err != nil {
-			rerr = err
-			return
+			return nil, err
 		}
-		// remove the pair after we got the merkle root.
-		defer func(k []byte) {
-			err = c.coll.Remove(k)
-			if err != nil {
-				rerr = err
-				mr = nil
-			}
-		}(sc.InstanceID)
 	}
-	mr = c.coll.GetRoot()
-	return
+	return coll.GetRoot(), nil
 }
 
 func getInstanceDarc(c CollectionView, iid InstanceID) (*darc.Darc, error) {
@@ -339,6 +468,36 @@ func getInstanceDarc(c CollectionView, iid InstanceID) (*darc.Darc, error) {
 	return darc.NewFromProtobuf(value)
 }
 
+// signerCounterContractID is stored as the contract of the signer counters.
+// As no contract is registered under this name, the counters cannot be
+// changed by instructions.
+const signerCounterContractID = "signercounter"
+
+// signerCounterKey returns the key under which the counter of the signer
+// with the given identity string is stored in the collection.
+func signerCounterKey(id string) []byte {
+	h := sha256.New()
+	h.Write([]byte("signercounter_"))
+	h.Write([]byte(id))
+	return h.Sum(nil)
+}
+
+// getSignerCounter returns the latest counter of the given signer. If the
+// signer never signed an accepted instruction, 0 is returned.
+func getSignerCounter(c CollectionView, id string) (uint64, error) {
+	value, _, _, err := c.GetValues(signerCounterKey(id))
+	if err == errKeyNotSet {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(value) != 8 {
+		return 0, errors.New("invalid length of signer counter")
+	}
+	return binary.LittleEndian.Uint64(value), nil
+}
+
 // RegisterContract stores the contract in a map and will
 // call it whenever a contract needs to be done.
 // GetService makes it possible to give either an `onet.Context` or
@@ -376,29 +535,29 @@ type bcState struct {
 	sync.Mutex
 	// waitChannels will be informed by Service.updateCollection that a
 	// given ClientTransaction has been included. updateCollection will
-	// send true for a valid ClientTransaction and false for an invalid
-	// ClientTransaction.
-	waitChannels map[string]chan bool
+	// send the TxResult of the ClientTransaction, which tells whether it
+	// has been accepted or not.
+	waitChannels map[string]chan TxResult
 	// blockListeners will be notified every time a block is created.
 	// It is up to them to filter out block creations on chains they are not
 	// interested in.
-	blockListeners []chan skipchain.SkipBlockID
+	blockListeners []chan *skipchain.SkipBlock
 }
 
-func (bc *bcState) createWaitChannel(ctxHash []byte) chan bool {
+func (bc *bcState) createWaitChannel(ctxHash []byte) chan TxResult {
 	bc.Lock()
 	defer bc.Unlock()
-	ch := make(chan bool, 1)
+	ch := make(chan TxResult, 1)
 	bc.waitChannels[string(ctxHash)] = ch
 	return ch
 }
 
-func (bc *bcState) informWaitChannel(ctxHash []byte, valid bool) {
+func (bc *bcState) informWaitChannel(ctxHash []byte, res TxResult) {
 	bc.Lock()
 	defer bc.Unlock()
 	ch := bc.waitChannels[string(ctxHash)]
 	if ch != nil {
-		ch <- valid
+		ch <- res
 	}
 }
 
@@ -408,17 +567,17 @@ func (bc *bcState) deleteWaitChannel(ctxHash []byte) {
 	delete(bc.waitChannels, string(ctxHash))
 }
 
-func (bc *bcState) informBlock(id skipchain.SkipBlockID) {
+func (bc *bcState) informBlock(sb *skipchain.SkipBlock) {
 	bc.Lock()
 	defer bc.Unlock()
 	for _, x := range bc.blockListeners {
 		if x != nil {
-			x <- id
+			x <- sb
 		}
 	}
 }
 
-func (bc *bcState) registerForBlocks(ch chan skipchain.SkipBlockID) int {
+func (bc *bcState) registerForBlocks(ch chan *skipchain.SkipBlock) int {
 	bc.Lock()
 	defer bc.Unlock()
 
@@ -454,5 +613,12 @@ func (c ChainConfig) sanityCheck() error {
 	if c.MaxBlockSize > 8*1e6 {
 		return errors.New("max block size is greater than 8 megs")
 	}
+	if c.SnapshotInterval < 0 {
+		return errors.New("snapshot interval is negative")
+	}
+	if c.Version > CurrentVersion {
+		return fmt.Errorf("version %d is newer than the supported version %d",
+			c.Version, CurrentVersion)
+	}
 	return nil
 }
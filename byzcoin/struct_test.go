@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/cothority/byzcoin/collection"
 	"github.com/stretchr/testify/require"
 )
 
@@ -155,3 +156,187 @@ func TestCollectionDBtryHash(t *testing.T) {
 	mrReal := cdb.RootHash()
 	require.Equal(t, mrTrial, mrReal)
 }
+
+func TestCollectionDBMigrate(t *testing.T) {
+	tmpDB, err := ioutil.TempFile("", "tmpDB")
+	require.Nil(t, err)
+	tmpDB.Close()
+	defer os.Remove(tmpDB.Name())
+
+	db, err := bolt.Open(tmpDB.Name(), 0600, nil)
+	require.Nil(t, err)
+
+	// Store the instances like the versions before the trie did.
+	require.Nil(t, db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(testName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 8; i++ {
+			id := []byte(fmt.Sprintf("Key%d", i))
+			for prefix, value := range map[byte]string{
+				dbValue:    fmt.Sprintf("value%d", i),
+				dbContract: "myContract",
+				dbDarcID:   "darc",
+			} {
+				if err := b.Put(append([]byte{prefix}, id...), []byte(value)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}))
+
+	cdb := newCollectionDB(db, testName)
+	coll, err := collection.NewTrie(nil, nil, collectionFields()...)
+	require.Nil(t, err)
+	for i := 0; i < 8; i++ {
+		id := []byte(fmt.Sprintf("Key%d", i))
+		require.Nil(t, coll.Add(id, []byte(fmt.Sprintf("value%d", i)), []byte("myContract"), []byte("darc")))
+		v, c, d, err := cdb.GetValues(id)
+		require.Nil(t, err)
+		require.Equal(t, fmt.Sprintf("value%d", i), string(v))
+		require.Equal(t, "myContract", c)
+		require.Equal(t, "darc", string(d))
+	}
+	require.Equal(t, coll.GetRoot(), cdb.RootHash())
+
+	// The old keys are gone and the trie is found again.
+	require.Nil(t, db.View(func(tx *bolt.Tx) error {
+		require.Nil(t, tx.Bucket(testName).Get(append([]byte{dbValue}, "Key0"...)))
+		return nil
+	}))
+	cdb2 := newCollectionDB(db, testName)
+	require.Equal(t, coll.GetRoot(), cdb2.RootHash())
+	_, _, _, err = cdb2.GetValues([]byte("Key7"))
+	require.Nil(t, err)
+}
+
+func TestCollectionDBHistory(t *testing.T) {
+	tmpDB, err := ioutil.TempFile("", "tmpDB")
+	require.Nil(t, err)
+	tmpDB.Close()
+	defer os.Remove(tmpDB.Name())
+
+	db, err := bolt.Open(tmpDB.Name(), 0600, nil)
+	require.Nil(t, err)
+
+	cdb := newCollectionDB(db, testName)
+	key := []byte("first")
+	other := []byte("second")
+	require.Nil(t, cdb.StoreAll([]StateChange{
+		{StateAction: Create, InstanceID: key, Value: []byte("0"), ContractID: []byte("c")},
+		{StateAction: Create, InstanceID: other, Value: []byte("x"), ContractID: []byte("c")},
+	}, 0))
+	for i := 1; i < 5; i++ {
+		require.Nil(t, cdb.StoreAll([]StateChange{
+			{StateAction: Update, InstanceID: key, Value: []byte{byte('0' + i)}, ContractID: []byte("c")},
+		}, i))
+	}
+	require.Nil(t, cdb.StoreAll([]StateChange{
+		{StateAction: Remove, InstanceID: key, ContractID: []byte("c")},
+	}, 5))
+
+	entries, total, err := cdb.getHistory(key, 0, 10)
+	require.Nil(t, err)
+	require.Equal(t, 6, total)
+	require.Equal(t, 6, len(entries))
+	for i, e := range entries {
+		require.Equal(t, i, e.BlockIndex)
+	}
+	require.Equal(t, Create, entries[0].StateChange.StateAction)
+	require.Equal(t, []byte("3"), entries[3].StateChange.Value)
+	require.Equal(t, Remove, entries[5].StateChange.StateAction)
+
+	entries, total, err = cdb.getHistory(key, 2, 3)
+	require.Nil(t, err)
+	require.Equal(t, 6, total)
+	require.Equal(t, 3, len(entries))
+	require.Equal(t, 2, entries[0].BlockIndex)
+
+	entries, total, err = cdb.getHistory(other, 0, 10)
+	require.Nil(t, err)
+	require.Equal(t, 1, total)
+	require.Equal(t, []byte("x"), entries[0].StateChange.Value)
+
+	entries, total, err = cdb.getHistory([]byte("unknown"), 0, 10)
+	require.Nil(t, err)
+	require.Equal(t, 0, total)
+	require.Equal(t, 0, len(entries))
+
+	// The values stored by the service are not in the history.
+	internal := lastUpdateKey(key)
+	require.Nil(t, cdb.StoreAll([]StateChange{
+		{StateAction: Create, InstanceID: internal, Value: []byte("t"), ContractID: []byte(lastUpdateContractID)},
+	}, 6))
+	_, total, err = cdb.getHistory(internal, 0, 10)
+	require.Nil(t, err)
+	require.Equal(t, 0, total)
+}
+
+func TestCollectionDBSnapshot(t *testing.T) {
+	tmpDB, err := ioutil.TempFile("", "tmpDB")
+	require.Nil(t, err)
+	tmpDB.Close()
+	defer os.Remove(tmpDB.Name())
+
+	db, err := bolt.Open(tmpDB.Name(), 0600, nil)
+	require.Nil(t, err)
+
+	cdb := newCollectionDB(db, testName)
+	_, err = cdb.getSnapshot()
+	require.NotNil(t, err)
+
+	for i := 0; i < 3; i++ {
+		require.Nil(t, cdb.StoreAll([]StateChange{{
+			StateAction: Create,
+			InstanceID:  []byte(fmt.Sprintf("key%d", i)),
+			Value:       []byte("value"),
+			ContractID:  []byte("c"),
+		}}, i))
+	}
+	snap := Snapshot{
+		SkipchainID:    []byte("chain"),
+		BlockID:        []byte("block"),
+		Index:          2,
+		CollectionRoot: cdb.RootHash(),
+	}
+	require.Nil(t, cdb.storeSnapshot(snap))
+	stored, err := cdb.getSnapshot()
+	require.Nil(t, err)
+	require.Equal(t, snap, *stored)
+	require.Equal(t, snap.Hash(), stored.Hash())
+
+	require.Nil(t, cdb.StoreAll([]StateChange{{
+		StateAction: Create,
+		InstanceID:  []byte("key3"),
+		Value:       []byte("value"),
+		ContractID:  []byte("c"),
+	}}, 3))
+
+	// Download the snapshot into another collection.
+	cdb2 := newCollectionDB(db, []byte("coll2"))
+	fetch := func(labels [][]byte) ([][]byte, error) {
+		nodes := make([][]byte, len(labels))
+		for i, label := range labels {
+			nodes[i], err = cdb.GetNode(label)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return nodes, nil
+	}
+	require.Nil(t, collection.SyncTrie(snap.CollectionRoot, 2, fetch, cdb2.storeNodes))
+	require.Nil(t, cdb2.restore(snap.CollectionRoot, snap.Index))
+	require.Equal(t, snap.CollectionRoot, cdb2.RootHash())
+	require.Equal(t, 2, cdb2.getIndex())
+	_, _, _, err = cdb2.GetValues([]byte("key2"))
+	require.Nil(t, err)
+	_, _, _, err = cdb2.GetValues([]byte("key3"))
+	require.NotNil(t, err)
+
+	// The restored state survives a restart.
+	cdb2 = newCollectionDB(db, []byte("coll2"))
+	require.Equal(t, snap.CollectionRoot, cdb2.RootHash())
+	require.Equal(t, 2, cdb2.getIndex())
+}
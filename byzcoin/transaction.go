@@ -103,6 +103,16 @@ func (instr Instruction) Hash() []byte {
 		h.Write([]byte(a.Name))
 		h.Write(a.Value)
 	}
+	b = make([]byte, 8)
+	for _, ctr := range instr.SignerCounter {
+		binary.LittleEndian.PutUint64(b, ctr)
+		h.Write(b)
+	}
+	// The fee coin is followed by its length, so that it cannot be
+	// mistaken for a counter.
+	h.Write(instr.FeeCoin)
+	binary.LittleEndian.PutUint64(b, uint64(len(instr.FeeCoin)))
+	h.Write(b)
 	return h.Sum(nil)
 }
 
@@ -215,6 +225,7 @@ func (instr Instruction) String() string {
 	out += fmt.Sprintf("\tindex: %d\n\tlength: %d\n", instr.Index, instr.Length)
 	out += fmt.Sprintf("\taction: %s\n", instr.Action())
 	out += fmt.Sprintf("\tsignatures: %d\n", len(instr.Signatures))
+	out += fmt.Sprintf("\tsigner counters: %v\n", instr.SignerCounter)
 	return out
 }
 
@@ -255,6 +266,32 @@ func (instr *Instruction) SignBy(darcID darc.ID, signers ...darc.Signer) error {
 	return nil
 }
 
+// CoSign returns the signature of the instruction by the signer, which must
+// already be one of the signers of instr.Signatures. Unlike SignBy, it
+// doesn't need the other signers, so it is used to add signatures to a
+// pending transaction.
+func (instr Instruction) CoSign(darcID darc.ID, signer darc.Signer) (darc.Signature, error) {
+	id := signer.Identity()
+	found := false
+	for _, sig := range instr.Signatures {
+		if sig.Signer.Equal(&id) {
+			found = true
+		}
+	}
+	if !found {
+		return darc.Signature{}, errors.New("signer is not a signer of the instruction")
+	}
+	req, err := instr.ToDarcRequest(darcID)
+	if err != nil {
+		return darc.Signature{}, err
+	}
+	sig, err := signer.Sign(req.Hash())
+	if err != nil {
+		return darc.Signature{}, err
+	}
+	return darc.Signature{Signature: sig, Signer: id}, nil
+}
+
 // ToDarcRequest converts the Instruction content into a darc.Request.
 func (instr Instruction) ToDarcRequest(baseID darc.ID) (*darc.Request, error) {
 	action := instr.Action()
@@ -296,8 +333,19 @@ func (instr Instruction) VerifyDarcSignature(coll CollectionView) error {
 	}
 	// Verify the request is signed by appropriate identities.
 	// A callback is required to get any delegated DARC(s) during
-	// expression evaluation.
-	err = req.VerifyWithCB(d, func(str string, latest bool) *darc.Darc {
+	// expression evaluation. The rules can also compare the attributes
+	// of the block and of the instance.
+	err = req.VerifyWithAttrs(d, getDarcFromColl(coll), darcAttributes(coll, instr.InstanceID))
+	if err != nil {
+		return errors.New("request verification failed: " + err.Error())
+	}
+	return nil
+}
+
+// getDarcFromColl returns a callback that loads the darcs referenced in an
+// expression from the collection.
+func getDarcFromColl(coll CollectionView) darc.GetDarc {
+	return func(str string, latest bool) *darc.Darc {
 		if len(str) < 5 || string(str[0:5]) != "darc:" {
 			return nil
 		}
@@ -310,11 +358,7 @@ func (instr Instruction) VerifyDarcSignature(coll CollectionView) error {
 			return nil
 		}
 		return d
-	})
-	if err != nil {
-		return errors.New("request verification failed: " + err.Error())
 	}
-	return nil
 }
 
 // Instructions is a slice of Instruction
@@ -18,7 +18,7 @@ func TestTransaction_Signing(t *testing.T) {
 	d.Rules.AddRule("spawn:dummy_kind", d.Rules.GetSignExpr())
 	require.Nil(t, d.Verify(true))
 
-	instr, err := createInstr(d.GetBaseID(), "dummy_kind", []byte("dummy_value"), signer)
+	instr, err := createInstr(d.GetBaseID(), "dummy_kind", []byte("dummy_value"), signer, 1)
 	require.Nil(t, err)
 
 	require.Nil(t, instr.SignBy(d.GetBaseID(), signer))
@@ -28,8 +28,8 @@ func TestTransaction_Signing(t *testing.T) {
 	require.Nil(t, req.Verify(d))
 }
 
-func createOneClientTx(dID darc.ID, kind string, value []byte, signer darc.Signer) (ClientTransaction, error) {
-	instr, err := createInstr(dID, kind, value, signer)
+func createOneClientTx(dID darc.ID, kind string, value []byte, signer darc.Signer, counter uint64) (ClientTransaction, error) {
+	instr, err := createInstr(dID, kind, value, signer, counter)
 	if err != nil {
 		return ClientTransaction{}, err
 	}
@@ -39,16 +39,17 @@ func createOneClientTx(dID darc.ID, kind string, value []byte, signer darc.Signe
 	return t, err
 }
 
-func createInstr(dID darc.ID, contractID string, value []byte, signer darc.Signer) (Instruction, error) {
+func createInstr(dID darc.ID, contractID string, value []byte, signer darc.Signer, counter uint64) (Instruction, error) {
 	instr := Instruction{
 		InstanceID: NewInstanceID(dID),
 		Spawn: &Spawn{
 			ContractID: contractID,
 			Args:       Arguments{{Name: "data", Value: value}},
 		},
-		Nonce:  GenNonce(),
-		Index:  0,
-		Length: 1,
+		Nonce:         GenNonce(),
+		Index:         0,
+		Length:        1,
+		SignerCounter: []uint64{counter},
 	}
 	err := instr.SignBy(dID, signer)
 	return instr, err
@@ -330,7 +330,14 @@ func (s *Service) createViewChangeBlock(req viewchange.NewViewReq, multisig []by
 		return errors.New("roster size is too small, must be >= 4")
 	}
 
-	_, _, genDarcID, err := s.GetCollectionView(req.GetGen()).GetValues(NewInstanceID(nil).Slice())
+	coll := s.GetCollectionView(req.GetGen())
+	_, _, genDarcID, err := coll.GetValues(NewInstanceID(nil).Slice())
+	if err != nil {
+		return err
+	}
+
+	signer := darc.NewSignerEd25519(s.ServerIdentity().Public, s.getPrivateKey())
+	ctr, err := getSignerCounter(coll, signer.Identity().String())
 	if err != nil {
 		return err
 	}
@@ -359,14 +366,14 @@ func (s *Service) createViewChangeBlock(req viewchange.NewViewReq, multisig []by
 					},
 				},
 			},
+			SignerCounter: []uint64{ctr + 1},
 		}},
 	}
-	signer := darc.NewSignerEd25519(s.ServerIdentity().Public, s.getPrivateKey())
 	if err = ctx.Instructions[0].SignBy(genDarcID, signer); err != nil {
 		return err
 	}
 
-	_, err = s.createNewBlock(req.GetGen(), rotateRoster(sb.Roster, req.GetView().LeaderIndex), []TxResult{TxResult{ctx, false}})
+	_, err = s.createNewBlock(req.GetGen(), rotateRoster(sb.Roster, req.GetView().LeaderIndex), []TxResult{TxResult{ClientTransaction: ctx, Accepted: false}}, time.Now().UnixNano())
 	return err
 }
 
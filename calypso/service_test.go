@@ -133,6 +133,7 @@ type ts struct {
 	gbReply    *byzcoin.CreateGenesisBlockResponse
 	genesisMsg *byzcoin.CreateGenesisBlock
 	gDarc      *darc.Darc
+	signerCtr  uint64
 }
 
 func (s *ts) addRead(t *testing.T, write *byzcoin.Proof) byzcoin.InstanceID {
@@ -154,6 +155,7 @@ func (s *ts) addRead(t *testing.T, write *byzcoin.Proof) byzcoin.InstanceID {
 				ContractID: ContractReadID,
 				Args:       byzcoin.Arguments{{Name: "read", Value: readBuf}},
 			},
+			SignerCounter: []uint64{s.nextCounter()},
 		}},
 	}
 	require.Nil(t, ctx.Instructions[0].SignBy(s.gDarc.GetID(), s.signer))
@@ -238,6 +240,7 @@ func (s *ts) addWrite(t *testing.T, key []byte) byzcoin.InstanceID {
 				ContractID: ContractWriteID,
 				Args:       byzcoin.Arguments{{Name: "write", Value: writeBuf}},
 			},
+			SignerCounter: []uint64{s.nextCounter()},
 		}},
 	}
 	require.Nil(t, ctx.Instructions[0].SignBy(s.gDarc.GetID(), s.signer))
@@ -246,6 +249,14 @@ func (s *ts) addWrite(t *testing.T, key []byte) byzcoin.InstanceID {
 	return ctx.Instructions[0].DeriveID("")
 }
 
+// nextCounter returns the counter to be used for the next instruction signed
+// by s.signer. All instructions of the tests are accepted, so we don't need
+// to ask ByzCoin for it.
+func (s *ts) nextCounter() uint64 {
+	s.signerCtr++
+	return s.signerCtr
+}
+
 func (s *ts) closeAll(t *testing.T) {
 	require.Nil(t, s.cl.Close())
 	s.local.CloseAll()
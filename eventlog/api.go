@@ -21,6 +21,9 @@ type Client struct {
 	Signers  []darc.Signer
 	Instance byzcoin.InstanceID
 	c        *onet.Client
+	// signerCtrs are the next counters of the Signers. They are fetched
+	// from ByzCoin on the first use, and then kept up to date locally.
+	signerCtrs []uint64
 }
 
 // NewClient creates a new client to talk to the eventlog service.
@@ -36,11 +39,16 @@ func NewClient(ol *byzcoin.Client) *Client {
 // return once the new eventlog has been committed into the ledger (or after
 // a timeout). Upon non-error return, c.Instance will be correctly set.
 func (c *Client) Create() error {
+	ctrs, err := c.getSignerCounters()
+	if err != nil {
+		return err
+	}
 	instr := byzcoin.Instruction{
-		InstanceID: byzcoin.NewInstanceID(c.DarcID),
-		Index:      0,
-		Length:     1,
-		Spawn:      &byzcoin.Spawn{ContractID: contractName},
+		InstanceID:    byzcoin.NewInstanceID(c.DarcID),
+		Index:         0,
+		Length:        1,
+		Spawn:         &byzcoin.Spawn{ContractID: contractName},
+		SignerCounter: nextCounters(ctrs, 0),
 	}
 	if err := instr.SignBy(c.DarcID, c.Signers...); err != nil {
 		return err
@@ -49,26 +57,75 @@ func (c *Client) Create() error {
 		Instructions: []byzcoin.Instruction{instr},
 	}
 	if _, err := c.ByzCoin.AddTransactionAndWait(tx, 2); err != nil {
+		// We don't know whether the transaction got accepted, so we
+		// need to fetch the counters again.
+		c.signerCtrs = nil
 		return err
 	}
+	c.incrementSignerCounters(1)
 
 	c.Instance = instr.DeriveID("")
 	return nil
 }
 
+// getSignerCounters returns the next counters of the signers. They are
+// fetched from ByzCoin if they are not known yet.
+func (c *Client) getSignerCounters() ([]uint64, error) {
+	if len(c.signerCtrs) == len(c.Signers) {
+		return c.signerCtrs, nil
+	}
+	ids := make([]string, len(c.Signers))
+	for i, signer := range c.Signers {
+		ids[i] = signer.Identity().String()
+	}
+	reply, err := c.ByzCoin.GetSignerCounters(ids...)
+	if err != nil {
+		return nil, err
+	}
+	if len(reply.Counters) != len(c.Signers) {
+		return nil, errors.New("wrong number of signer counters")
+	}
+	c.signerCtrs = reply.Counters
+	return c.signerCtrs, nil
+}
+
+// incrementSignerCounters marks n more instructions as signed by all the
+// signers.
+func (c *Client) incrementSignerCounters(n uint64) {
+	for i := range c.signerCtrs {
+		c.signerCtrs[i] += n
+	}
+}
+
+// nextCounters returns the counters to be used by the instruction that
+// comes n instructions after the one using the counters ctrs.
+func nextCounters(ctrs []uint64, n uint64) []uint64 {
+	out := make([]uint64, len(ctrs))
+	for i, ctr := range ctrs {
+		out[i] = ctr + n
+	}
+	return out
+}
+
 // A LogID is an opaque unique identifier useful to find a given log message later
 // via GetEvent.
 type LogID []byte
 
 // Log asks the service to log events.
 func (c *Client) Log(ev ...Event) ([]LogID, error) {
-	tx, keys, err := makeTx(c.DarcID, c.Instance, ev, c.Signers)
+	ctrs, err := c.getSignerCounters()
+	if err != nil {
+		return nil, err
+	}
+	tx, keys, err := makeTx(c.DarcID, c.Instance, ev, c.Signers, ctrs)
 	if err != nil {
 		return nil, err
 	}
 	if _, err := c.ByzCoin.AddTransaction(*tx); err != nil {
+		c.signerCtrs = nil
 		return nil, err
 	}
+	c.incrementSignerCounters(uint64(len(ev)))
 	return keys, nil
 }
 
@@ -99,7 +156,10 @@ func (c *Client) GetEvent(key []byte) (*Event, error) {
 	return &e, nil
 }
 
-func makeTx(darcID darc.ID, id byzcoin.InstanceID, msgs []Event, signers []darc.Signer) (*byzcoin.ClientTransaction, []LogID, error) {
+// makeTx creates a transaction with one instruction per message. The
+// instructions are signed by all the signers, the first one using the
+// counters ctrs.
+func makeTx(darcID darc.ID, id byzcoin.InstanceID, msgs []Event, signers []darc.Signer, ctrs []uint64) (*byzcoin.ClientTransaction, []LogID, error) {
 	// We need the identity part of the signatures before
 	// calling ToDarcRequest() below, because the identities
 	// go into the message digest.
@@ -132,7 +192,8 @@ func makeTx(darcID darc.ID, id byzcoin.InstanceID, msgs []Event, signers []darc.
 				Command: contractName,
 				Args:    []byzcoin.Argument{argEvent},
 			},
-			Signatures: append([]darc.Signature{}, sigs...),
+			Signatures:    append([]darc.Signature{}, sigs...),
+			SignerCounter: nextCounters(ctrs, uint64(i)),
 		}
 	}
 	for i := range tx.Instructions {
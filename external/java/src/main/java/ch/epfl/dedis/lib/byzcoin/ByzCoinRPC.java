@@ -18,6 +18,8 @@ import org.slf4j.Logger;
 import org.slf4j.LoggerFactory;
 
 import java.time.Duration;
+import java.util.ArrayList;
+import java.util.List;
 
 import static java.time.temporal.ChronoUnit.NANOS;
 
@@ -36,7 +38,7 @@ public class ByzCoinRPC {
     private SkipBlock genesis;
     private SkipBlock latest;
     private SkipchainRPC skipchain;
-    public static final int currentVersion = 1;
+    public static final int currentVersion = 2;
 
     private final Logger logger = LoggerFactory.getLogger(ByzCoinRPC.class);
 
@@ -114,12 +116,13 @@ public class ByzCoinRPC {
     /**
      * Sends a transaction to byzcoin and waits for up to 'wait' blocks for the transaction to be
      * included in the global state. If more than 'wait' blocks are created and the transaction is not
-     * included, an exception will be raised.
+     * included, or if it is included but got refused, an exception will be raised.
      *
      * @param t is the client transaction holding one or more instructions to be sent to byzcoin.
      * @param wait indicates the number of blocks to wait for the transaction to be included.
      * @return ClientTransactionID the transaction ID
-     * @throws CothorityException if the transaction has not been included within 'wait' blocks.
+     * @throws CothorityException if the transaction has not been included within 'wait' blocks, or
+     *                            if it got refused.
      */
     public ClientTransactionId sendTransactionAndWait(ClientTransaction t, int wait) throws CothorityException {
         ByzCoinProto.AddTxRequest.Builder request =
@@ -130,17 +133,43 @@ public class ByzCoinRPC {
         request.setInclusionwait(wait);
 
         ByteString msg = roster.sendMessage("ByzCoin/AddTxRequest", request.build());
+        ByzCoinProto.AddTxResponse reply;
         try {
-            ByzCoinProto.AddTxResponse reply =
-                    ByzCoinProto.AddTxResponse.parseFrom(msg);
-            // TODO do something with the reply?
-            logger.info("Successfully stored request - waiting for inclusion");
+            reply = ByzCoinProto.AddTxResponse.parseFrom(msg);
         } catch (InvalidProtocolBufferException e) {
             throw new CothorityCommunicationException(e);
         }
+        if (wait > 0 && !reply.getAccepted()) {
+            throw new CothorityException("transaction is in block, but got refused: " + reply.getError());
+        }
+        logger.info("Successfully stored request - waiting for inclusion");
         return t.getId();
     }
 
+    /**
+     * Gets the counters that the next instruction signed by the given identities must use.
+     *
+     * @param ids the string representation of the identities, as returned by Identity.toString
+     * @return the counters, in the same order as the identities
+     * @throws CothorityException
+     */
+    public List<Long> getSignerCounters(List<String> ids) throws CothorityException {
+        ByzCoinProto.GetSignerCounters.Builder request =
+                ByzCoinProto.GetSignerCounters.newBuilder();
+        request.setVersion(currentVersion);
+        request.setSkipchainid(ByteString.copyFrom(skipchain.getID().getId()));
+        request.addAllSignerids(ids);
+
+        ByteString msg = roster.sendMessage("ByzCoin/GetSignerCounters", request.build());
+        try {
+            ByzCoinProto.GetSignerCountersResponse reply =
+                    ByzCoinProto.GetSignerCountersResponse.parseFrom(msg);
+            return new ArrayList<>(reply.getCountersList());
+        } catch (InvalidProtocolBufferException e) {
+            throw new CothorityCommunicationException(e);
+        }
+    }
+
     /**
      * Gets a proof from byzcoin to show that a given instance is in the
      * global state.
@@ -25,6 +25,8 @@ public class Instruction {
     private Invoke invoke;
     private Delete delete;
     private List<Signature> signatures;
+    private List<Long> signerCounters = new ArrayList<>();
+    private InstanceId feeCoin;
 
     /**
      * Use this constructor if it is a spawn instruction, i.e. you want to create a new object.
@@ -90,6 +92,10 @@ public class Instruction {
         if (inst.hasDelete()) {
             this.delete = new Delete(inst.getDelete());
         }
+        this.signerCounters = new ArrayList<>(inst.getSignercounterList());
+        if (inst.hasFeecoin()) {
+            this.feeCoin = new InstanceId(inst.getFeecoin());
+        }
     }
 
     /**
@@ -106,6 +112,22 @@ public class Instruction {
         this.signatures = signatures;
     }
 
+    /**
+     * Setter for the signer counters. They must be set before signing, in the same order as the signers, and be
+     * the counters returned by ByzCoinRPC.getSignerCounters.
+     */
+    public void setSignerCounters(List<Long> signerCounters) {
+        this.signerCounters = new ArrayList<>(signerCounters);
+    }
+
+    /**
+     * Setter for the coin instance paying the fee of the transaction. Only the first instruction of a transaction
+     * can set it, before signing.
+     */
+    public void setFeeCoin(InstanceId feeCoin) {
+        this.feeCoin = feeCoin;
+    }
+
     /**
      * This method computes the sha256 hash of the instruction.
      *
@@ -133,6 +155,15 @@ public class Instruction {
                 digest.update(a.getName().getBytes());
                 digest.update(a.getValue());
             }
+            for (Long ctr : this.signerCounters) {
+                digest.update(longToArr8(ctr));
+            }
+            byte[] fee = new byte[0];
+            if (this.feeCoin != null) {
+                fee = this.feeCoin.getId();
+            }
+            digest.update(fee);
+            digest.update(longToArr8(fee.length));
             return digest.digest();
         } catch (NoSuchAlgorithmException e) {
             throw new RuntimeException(e);
@@ -160,6 +191,10 @@ public class Instruction {
         for (Signature s : this.signatures) {
             b.addSignatures(s.toProto());
         }
+        b.addAllSignercounter(this.signerCounters);
+        if (this.feeCoin != null) {
+            b.setFeecoin(this.feeCoin.toByteString());
+        }
         return b.build();
     }
 
@@ -198,7 +233,8 @@ public class Instruction {
 
     /**
      * Have a list of signers sign the instruction. The instruction will *not* be accepted by byzcoin if it is not
-     * signed. The signature will not be valid if the instruction is modified after signing.
+     * signed. The signature will not be valid if the instruction is modified after signing, so the signer
+     * counters and the fee coin must be set before.
      *
      * @param signers - the list of signers.
      * @throws CothorityCryptoException
@@ -292,6 +328,20 @@ public class Instruction {
         return signatures;
     }
 
+    /**
+     * @return the counters of the signers, in the same order as the signatures.
+     */
+    public List<Long> getSignerCounters() {
+        return signerCounters;
+    }
+
+    /**
+     * @return the coin instance paying the fee, or null if there is none.
+     */
+    public InstanceId getFeeCoin() {
+        return feeCoin;
+    }
+
     /**
      * TODO: define how nonces are used.
      * @return generates a nonce to be used in the instructions.
@@ -309,4 +359,11 @@ public class Instruction {
         b.putInt(x);
         return b.array();
     }
+
+    private static byte[] longToArr8(long x) {
+        ByteBuffer b = ByteBuffer.allocate(8);
+        b.order(ByteOrder.LITTLE_ENDIAN);
+        b.putLong(x);
+        return b.array();
+    }
 }
@@ -75,12 +75,13 @@ public class DarcInstance {
      *
      * @param newDarc the darc to replace the old darc.
      * @param owner   must have its identity in the "Invoke_Evolve" rule
+     * @param ownerCtr the next counter of the owner, see ByzCoinRPC.getSignerCounters
      * @param pos     position of the instruction in the ClientTransaction
      * @param len     total number of instructions in the ClientTransaction
      * @return Instruction to be sent to byzcoin
      * @throws CothorityCryptoException
      */
-    public Instruction evolveDarcInstruction(Darc newDarc, Signer owner, int pos, int len) throws CothorityCryptoException {
+    public Instruction evolveDarcInstruction(Darc newDarc, Signer owner, Long ownerCtr, int pos, int len) throws CothorityCryptoException {
         newDarc.increaseVersion();
         newDarc.setPrevId(darc);
         newDarc.setBaseId(darc.getBaseId());
@@ -91,6 +92,7 @@ public class DarcInstance {
         Invoke inv = new Invoke("evolve", ContractId, newDarc.toProto().toByteArray());
         byte[] d = newDarc.getBaseId().getId();
         Instruction inst = new Instruction(new InstanceId(d), Instruction.genNonce(), pos, len, inv);
+        inst.setSignerCounters(Arrays.asList(ownerCtr));
         try {
             Request r = new Request(darc.getBaseId(), "invoke:evolve", inst.hash(),
                     Arrays.asList(owner.getIdentity()), null);
@@ -104,7 +106,8 @@ public class DarcInstance {
     }
 
     public void evolveDarc(Darc newDarc, Signer owner) throws CothorityException {
-        Instruction inst = evolveDarcInstruction(newDarc, owner, 0, 1);
+        Long ownerCtr = bc.getSignerCounters(Arrays.asList(owner.getIdentity().toString())).get(0);
+        Instruction inst = evolveDarcInstruction(newDarc, owner, ownerCtr, 0, 1);
         ClientTransaction ct = new ClientTransaction(Arrays.asList(inst));
         bc.sendTransaction(ct);
     }
@@ -145,16 +148,18 @@ public class DarcInstance {
      *
      * @param contractID the id of the contract to create
      * @param s          the signer that is authorized to spawn this contract
+     * @param sCtr       the next counter of the signer, see ByzCoinRPC.getSignerCounters
      * @param args       arguments to give to the contract
      * @param pos        position in the ClientTransaction
      * @param len        total length of the ClientTransaction
      * @return the instruction to be added to the ClientTransaction
      * @throws CothorityCryptoException
      */
-    public Instruction spawnContractInstruction(String contractID, Signer s, List<Argument> args, int pos, int len)
+    public Instruction spawnContractInstruction(String contractID, Signer s, Long sCtr, List<Argument> args, int pos, int len)
             throws CothorityCryptoException {
         Spawn sp = new Spawn(contractID, args);
         Instruction inst = new Instruction(new InstanceId(darc.getBaseId().getId()), Instruction.genNonce(), pos, len, sp);
+        inst.setSignerCounters(Arrays.asList(sCtr));
         try {
             Request r = new Request(darc.getBaseId(), "spawn:" + contractID, inst.hash(),
                     Arrays.asList(s.getIdentity()), null);
@@ -177,7 +182,8 @@ public class DarcInstance {
      * @throws CothorityException
      */
     public ClientTransactionId spawnContract(String contractID, Signer s, List<Argument> args) throws CothorityException {
-        Instruction inst = spawnContractInstruction(contractID, s, args, 0, 1);
+        Long sCtr = bc.getSignerCounters(Arrays.asList(s.getIdentity().toString())).get(0);
+        Instruction inst = spawnContractInstruction(contractID, s, sCtr, args, 0, 1);
         ClientTransaction ct = new ClientTransaction(Arrays.asList(inst));
         return bc.sendTransaction(ct);
     }
@@ -191,7 +197,8 @@ public class DarcInstance {
      * @throws CothorityException
      */
     public Proof spawnContractAndWait(String contractID, Signer s, List<Argument> args, int wait) throws CothorityException {
-        Instruction inst = spawnContractInstruction(contractID, s, args, 0, 1);
+        Long sCtr = bc.getSignerCounters(Arrays.asList(s.getIdentity().toString())).get(0);
+        Instruction inst = spawnContractInstruction(contractID, s, sCtr, args, 0, 1);
         ClientTransaction ct = new ClientTransaction(Arrays.asList(inst));
         bc.sendTransactionAndWait(ct, wait);
         InstanceId iid = inst.deriveId("");
@@ -182,6 +182,7 @@ public class EventLogInstance {
         }
         Spawn spawn = new Spawn(ContractId, new ArrayList<>());
         Instruction instr = new Instruction(new InstanceId(darcId.getId()), Instruction.genNonce(), 0, 1, spawn);
+        instr.setSignerCounters(bc.getSignerCounters(signerIds(signers)));
         instr.signBy(darcId, signers);
 
         ClientTransaction tx = new ClientTransaction(Arrays.asList(instr));
@@ -212,7 +213,18 @@ public class EventLogInstance {
         }
     }
 
-    private Pair<ClientTransaction, List<InstanceId>> makeTx(List<Event> events, DarcId darcId, List<Signer> signers) throws CothorityCryptoException {
+    private List<String> signerIds(List<Signer> signers) {
+        List<String> ids = new ArrayList<>();
+        for (Signer signer : signers) {
+            ids.add(signer.getIdentity().toString());
+        }
+        return ids;
+    }
+
+    private Pair<ClientTransaction, List<InstanceId>> makeTx(List<Event> events, DarcId darcId, List<Signer> signers) throws CothorityException {
+        // Every instruction is signed by all the signers, so their counters
+        // increase with every instruction.
+        List<Long> counters = bc.getSignerCounters(signerIds(signers));
         List<Instruction> instrs = new ArrayList<>();
         List<InstanceId> keys = new ArrayList<>();
         int idx = 0;
@@ -221,6 +233,11 @@ public class EventLogInstance {
             args.add(new Argument("event", e.toProto().toByteArray()));
             Invoke invoke = new Invoke(ContractId, args);
             Instruction instr = new Instruction(instance.getId(), Instruction.genNonce(), idx, events.size(), invoke);
+            List<Long> instrCounters = new ArrayList<>();
+            for (Long ctr : counters) {
+                instrCounters.add(ctr + idx);
+            }
+            instr.setSignerCounters(instrCounters);
             instr.signBy(darcId, signers);
             instrs.add(instr);
             keys.add(instr.deriveId(""));
@@ -63,14 +63,16 @@ public class ValueInstance {
      *
      * @param newValue the value to replace the old value.
      * @param owner    must have its identity in the "invoke:update" rule
+     * @param ownerCtr the next counter of the owner, see ByzCoinRPC.getSignerCounters
      * @param pos      position of the instruction in the ClientTransaction
      * @param len      total number of instructions in the ClientTransaction
      * @return Instruction to be sent to byzcoin
      * @throws CothorityCryptoException
      */
-    public Instruction evolveValueInstruction(byte[] newValue, Signer owner, int pos, int len) throws CothorityCryptoException {
+    public Instruction evolveValueInstruction(byte[] newValue, Signer owner, Long ownerCtr, int pos, int len) throws CothorityCryptoException {
         Invoke inv = new Invoke("update", ContractId, newValue);
         Instruction inst = new Instruction(instance.getId(), Instruction.genNonce(), pos, len, inv);
+        inst.setSignerCounters(Arrays.asList(ownerCtr));
         try {
             Request r = new Request(instance.getDarcId(), "invoke:update", inst.hash(),
                     Arrays.asList(owner.getIdentity()), null);
@@ -84,7 +86,8 @@ public class ValueInstance {
     }
 
     public void evolveValue(byte[] newValue, Signer owner) throws CothorityException {
-        Instruction inst = evolveValueInstruction(newValue, owner, 0, 1);
+        Long ownerCtr = bc.getSignerCounters(Arrays.asList(owner.getIdentity().toString())).get(0);
+        Instruction inst = evolveValueInstruction(newValue, owner, ownerCtr, 0, 1);
         ClientTransaction ct = new ClientTransaction(Arrays.asList(inst));
         bc.sendTransaction(ct);
     }
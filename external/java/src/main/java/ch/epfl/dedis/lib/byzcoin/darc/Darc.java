@@ -18,7 +18,6 @@ import java.security.NoSuchAlgorithmException;
 import java.util.ArrayList;
 import java.util.Arrays;
 import java.util.List;
-import java.util.stream.Collectors;
 
 /**
  * Darc stands for distributed access right control. It provides a powerful access control policy that supports logical
@@ -304,17 +303,15 @@ public class Darc {
      */
     public static Rules initRules(List<Identity> owners, List<Identity> signers) {
         Rules rs = new Rules();
-        List<String> ownerIDs = owners.stream().map(Identity::toString).collect(Collectors.toList());
         try {
-            rs.addRule("invoke:evolve", String.join(" & ", ownerIDs).getBytes());
+            rs.addRule("invoke:evolve", Expression.initAndExpr(owners));
         } catch (CothorityAlreadyExistsException e) {
             throw new RuntimeException("this should never happen because we are adding a rule to a new object");
         }
 
         if (signers != null) {
-            List<String> signerIDs = signers.stream().map(Identity::toString).collect(Collectors.toList());
             try {
-                rs.addRule("_sign", String.join(" | ", signerIDs).getBytes());
+                rs.addRule("_sign", Expression.initOrExpr(signers));
             } catch (CothorityAlreadyExistsException e) {
                 throw new RuntimeException("this should never happen because we are adding a rule to a new object");
             }
@@ -0,0 +1,51 @@
+package ch.epfl.dedis.lib.byzcoin.darc;
+
+import java.util.List;
+import java.util.stream.Collectors;
+
+/**
+ * Expression has helpers to create the expressions of the rules of a darc. The expressions are parsed and evaluated
+ * by the conodes, see byzcoin/darc/expression for the grammar.
+ */
+public final class Expression {
+    private Expression() {
+    }
+
+    /**
+     * Creates an expression where all the identities must sign.
+     *
+     * @param ids the identities
+     * @return the expression
+     */
+    public static byte[] initAndExpr(List<Identity> ids) {
+        return String.join(" & ", toStrings(ids)).getBytes();
+    }
+
+    /**
+     * Creates an expression where any of the identities can sign.
+     *
+     * @param ids the identities
+     * @return the expression
+     */
+    public static byte[] initOrExpr(List<Identity> ids) {
+        return String.join(" | ", toStrings(ids)).getBytes();
+    }
+
+    /**
+     * Creates an expression where at least n of the identities must sign.
+     *
+     * @param n   the number of identities that must sign, between 1 and the number of identities
+     * @param ids the identities, each of them can only be given once
+     * @return the expression
+     */
+    public static byte[] initThresholdExpr(int n, List<Identity> ids) {
+        if (n < 1 || n > ids.size()) {
+            throw new IllegalArgumentException("the threshold must be between 1 and the number of identities");
+        }
+        return String.format("threshold(%d, %s)", n, String.join(", ", toStrings(ids))).getBytes();
+    }
+
+    private static List<String> toStrings(List<Identity> ids) {
+        return ids.stream().map(Identity::toString).collect(Collectors.toList());
+    }
+}
@@ -8,6 +8,7 @@ import ch.epfl.dedis.lib.byzcoin.darc.Signer;
 import org.slf4j.Logger;
 import org.slf4j.LoggerFactory;
 
+import java.util.ArrayList;
 import java.util.Arrays;
 import java.util.List;
 
@@ -62,6 +63,11 @@ public class ReaderInstance {
 
         Spawn spawn = new Spawn(ContractId, Arrays.asList(arg));
         Instruction instr = new Instruction(new InstanceId(darcID.getId()), Instruction.genNonce(), 0, 1, spawn);
+        List<String> ids = new ArrayList<>();
+        for (Signer signer : signers) {
+            ids.add(signer.getIdentity().toString());
+        }
+        instr.setSignerCounters(bc.getSignerCounters(ids));
         instr.signBy(darcID, signers);
 
         ClientTransaction tx = new ClientTransaction(Arrays.asList(instr));
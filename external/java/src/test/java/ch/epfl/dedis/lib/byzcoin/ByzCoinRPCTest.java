@@ -8,6 +8,7 @@ import ch.epfl.dedis.lib.byzcoin.contracts.DarcInstance;
 import ch.epfl.dedis.lib.byzcoin.contracts.ValueInstance;
 import ch.epfl.dedis.lib.byzcoin.darc.*;
 import ch.epfl.dedis.lib.exception.CothorityCommunicationException;
+import ch.epfl.dedis.lib.exception.CothorityException;
 import org.junit.jupiter.api.BeforeEach;
 import org.junit.jupiter.api.Test;
 import org.slf4j.Logger;
@@ -55,13 +56,20 @@ public class ByzCoinRPCTest {
         logger.info("genesisDarc is: {}", genesisDarc.getId());
         Darc newDarc = genesisDarc.copy();
         newDarc.setRule("spawn:darc", "all".getBytes());
-        Instruction instr = dc.evolveDarcInstruction(newDarc, admin, 0, 1);
+        List<Long> counters = bc.getSignerCounters(Arrays.asList(admin.getIdentity().toString()));
+        assertEquals(Arrays.asList(1L), counters);
+        Instruction instr = dc.evolveDarcInstruction(newDarc, admin, counters.get(0), 0, 1);
         logger.info("DC is: {}", dc.getId());
         bc.sendTransactionAndWait(new ClientTransaction(Arrays.asList(instr)), 10);
 
         dc.update();
         logger.info("darc-version is: {}", dc.getDarc().getVersion());
         assertEquals(newDarc.getVersion(), dc.getDarc().getVersion());
+        assertEquals(Arrays.asList(2L), bc.getSignerCounters(Arrays.asList(admin.getIdentity().toString())));
+
+        // The same instruction is refused, as its counter has been used.
+        assertThrows(CothorityException.class, () ->
+                bc.sendTransactionAndWait(new ClientTransaction(Arrays.asList(instr)), 10));
     }
 
     @Test
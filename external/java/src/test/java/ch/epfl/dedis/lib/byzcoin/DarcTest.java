@@ -1,6 +1,7 @@
 package ch.epfl.dedis.lib.byzcoin;
 
 import ch.epfl.dedis.lib.byzcoin.darc.Darc;
+import ch.epfl.dedis.lib.byzcoin.darc.Expression;
 import ch.epfl.dedis.lib.byzcoin.darc.SignerEd25519;
 import ch.epfl.dedis.lib.exception.CothorityCryptoException;
 import org.junit.jupiter.api.BeforeAll;
@@ -50,4 +51,13 @@ public class DarcTest {
         byte[] oldExpression = darc.removeAction(spawn);
         assertArrayEquals(spawnExression, oldExpression);
     }
-}
\ No newline at end of file
+
+    @Test
+    void thresholdExpression() {
+        byte[] expr = Expression.initThresholdExpr(1, Arrays.asList(owner.getIdentity(), user.getIdentity()));
+        assertEquals(String.format("threshold(1, %s, %s)", owner.getIdentity().toString(),
+                user.getIdentity().toString()), new String(expr));
+        assertThrows(IllegalArgumentException.class,
+                () -> Expression.initThresholdExpr(3, Arrays.asList(owner.getIdentity(), user.getIdentity())));
+    }
+}
@@ -69,13 +69,14 @@ class ByzCoinRPC {
    * @return {number}
    */
   static get currentVersion() {
-    return 1;
+    return 2;
   }
 
   /**
    * Sends a transaction to byzcoin and waits for up to 'wait' blocks for the
    * transaction to be included in the global state. If more than 'wait' blocks
-   * are created and the transaction is not included, an exception will be raised.
+   * are created and the transaction is not included, or if it is included but
+   * got refused, an exception will be raised.
    *
    * @param {ClientTransaction} transaction - is the client transaction holding
    * one or more instructions to be sent to byzcoin.
@@ -92,7 +93,12 @@ class ByzCoinRPC {
     };
     return this._socket
       .send("AddTxRequest", "AddTxResponse", addTxRequest)
-      .then(() => {
+      .then(reply => {
+        if (wait > 0 && !reply.accepted) {
+          throw new Error(
+            "transaction is in block, but got refused: " + reply.error
+          );
+        }
         console.log("Successfully stored request - waiting for inclusion");
       })
       .catch(e => {
@@ -106,6 +112,28 @@ class ByzCoinRPC {
       });
   }
 
+  /**
+   * Gets the counters that the next instruction signed by the given
+   * identities must use.
+   *
+   * @param {string[]} ids - the string representation of the identities
+   * @return {Promise<number[]>} - the counters, in the same order as ids
+   */
+  getSignerCounters(ids) {
+    const request = {
+      version: ByzCoinRPC.currentVersion,
+      skipchainid: this._skipchainID,
+      signerids: ids
+    };
+    return this._socket
+      .send("GetSignerCounters", "GetSignerCountersResponse", request)
+      .then(reply => {
+        return reply.counters.map(
+          ctr => (typeof ctr === "number" ? ctr : ctr.toNumber())
+        );
+      });
+  }
+
   /**
    * Gets a proof from byzcoin to show that a given instance is in the
    * global state.
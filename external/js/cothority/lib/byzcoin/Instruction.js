@@ -18,6 +18,10 @@ class Instruction {
    * @param {Invoke} [invokeInst] - the invoke object
    * @param {Delete} [deleteInst] - the delete object
    * @param {Signature[]} [signatures] - the list of signatures
+   * @param {number[]} [signerCounter] - the counters of the signers, in the
+   * same order as the signatures
+   * @param {Uint8Array} [feeCoin] - the coin instance paying the fee, only
+   * allowed in the first instruction of a transaction
    */
   constructor(
     instanceId,
@@ -27,7 +31,9 @@ class Instruction {
     spawnInst,
     invokeInst,
     deleteInst,
-    signatures
+    signatures,
+    signerCounter,
+    feeCoin
   ) {
     this._instanceId = instanceId;
     this._nonce = nonce;
@@ -37,6 +43,8 @@ class Instruction {
     this._invokeInst = invokeInst;
     this._deleteInst = deleteInst;
     this._signatures = signatures;
+    this._signerCounter = signerCounter === undefined ? [] : signerCounter;
+    this._feeCoin = feeCoin;
   }
 
   /**
@@ -128,6 +136,27 @@ class Instruction {
     this._signatures = sig.slice(0);
   }
 
+  /**
+   * Set the counters of the signers. They must be set before signing, in the
+   * same order as the signers, and be the counters returned by
+   * ByzCoinRPC.getSignerCounters.
+   *
+   * @param {number[]} counters
+   */
+  set signerCounter(counters) {
+    this._signerCounter = counters.slice(0);
+  }
+
+  /**
+   * Set the coin instance paying the fee of the transaction. Only the first
+   * instruction of a transaction can set it, before signing.
+   *
+   * @param {Uint8Array} id
+   */
+  set feeCoin(id) {
+    this._feeCoin = id;
+  }
+
   /**
    * This method computes the sha256 hash of the instruction.
    *
@@ -154,6 +183,13 @@ class Instruction {
       hash.update(arg.name);
       hash.update(arg.value);
     });
+    this._signerCounter.forEach(ctr => {
+      hash.update(this.uint64ToArr8(ctr));
+    });
+    const feeCoin =
+      this._feeCoin === undefined ? new Uint8Array(0) : this._feeCoin;
+    hash.update(feeCoin);
+    hash.update(this.uint64ToArr8(feeCoin.length));
 
     const b = hash.digest();
     return new Uint8Array(
@@ -198,7 +234,8 @@ class Instruction {
 
   /**
    * Have a list of signers sign the instruction. The instruction will *not* be accepted by byzcoin if it is not
-   * signed. The signature will not be valid if the instruction is modified after signing.
+   * signed. The signature will not be valid if the instruction is modified after signing, so the signer counters
+   * and the fee coin must be set before.
    *
    * @param {Uint8Array} darcId
    * @param {Signer[]} signers
@@ -231,8 +268,12 @@ class Instruction {
       nonce: this._nonce,
       index: this._index,
       length: this._length,
-      signatures: this._signatures.map(sig => sig.toProtobufValidMessage())
+      signatures: this._signatures.map(sig => sig.toProtobufValidMessage()),
+      signercounter: this._signerCounter
     };
+    if (this._feeCoin !== undefined) {
+      object.feecoin = this._feeCoin;
+    }
 
     if (this._spawnInst !== undefined) {
       object.spawn = this._spawnInst.toProtobufValidMessage();
@@ -255,6 +296,17 @@ class Instruction {
 
     return new Uint8Array(buffer);
   }
+
+  /**
+   *
+   * @param {number} x
+   */
+  uint64ToArr8(x) {
+    let buffer = new ArrayBuffer(8);
+    new DataView(buffer).setBigUint64(0, BigInt(x), true);
+
+    return new Uint8Array(buffer);
+  }
 }
 
 module.exports = Instruction;
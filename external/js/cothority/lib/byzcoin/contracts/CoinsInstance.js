@@ -77,10 +77,15 @@ class CoinsInstance {
       invoke
     );
 
-    inst.signBy(this._instance.darcId, [signer]);
-    const trans = new ClientTransaction([inst]);
+    return this._bc
+      .getSignerCounters([signer.identity.toString()])
+      .then(counters => {
+        inst.signerCounter = counters;
+        inst.signBy(this._instance.darcId, [signer]);
+        const trans = new ClientTransaction([inst]);
 
-    return this._bc.sendTransactionAndWait(trans, 10);
+        return this._bc.sendTransactionAndWait(trans, 10);
+      });
   }
 
   /**
@@ -83,10 +83,15 @@ class PopPartyInstance {
       1,
       invoke
     );
-    inst.signBy(this._instance.darcId, [signer]);
-    const clientTransaction = new ClientTransaction([inst]);
+    return this._bc
+      .getSignerCounters([signer.identity.toString()])
+      .then(counters => {
+        inst.signerCounter = counters;
+        inst.signBy(this._instance.darcId, [signer]);
+        const clientTransaction = new ClientTransaction([inst]);
 
-    return this._bc.sendTransactionAndWait(clientTransaction, 10);
+        return this._bc.sendTransactionAndWait(clientTransaction, 10);
+      });
   }
 
   /**
@@ -0,0 +1,49 @@
+/**
+ * Expression has helpers to create the expressions of the rules of a darc.
+ * The expressions are parsed and evaluated by the conodes, see
+ * byzcoin/darc/expression for the grammar.
+ */
+class Expression {
+  /**
+   * Creates an expression where all the identities must sign.
+   *
+   * @param {Identity[]} ids - the identities
+   * @return {Uint8Array} - the expression
+   */
+  static initAndExpr(ids) {
+    return toBytes(ids.map(id => id.toString()).join(" & "));
+  }
+
+  /**
+   * Creates an expression where any of the identities can sign.
+   *
+   * @param {Identity[]} ids - the identities
+   * @return {Uint8Array} - the expression
+   */
+  static initOrExpr(ids) {
+    return toBytes(ids.map(id => id.toString()).join(" | "));
+  }
+
+  /**
+   * Creates an expression where at least n of the identities must sign.
+   *
+   * @param {number} n - the number of identities that must sign, between 1
+   * and the number of identities
+   * @param {Identity[]} ids - the identities, each of them can only be given
+   * once
+   * @return {Uint8Array} - the expression
+   */
+  static initThresholdExpr(n, ids) {
+    if (!Number.isInteger(n) || n < 1 || n > ids.length) {
+      throw "the threshold must be between 1 and the number of identities";
+    }
+    const args = ids.map(id => id.toString()).join(", ");
+    return toBytes("threshold(" + n + ", " + args + ")");
+  }
+}
+
+function toBytes(expr) {
+  return Uint8Array.from(expr, c => c.charCodeAt(0));
+}
+
+module.exports = Expression;
@@ -202,11 +202,17 @@ func (s *Service) ReadMessage(rm *ReadMessage) (*ReadMessageReply, error) {
 		return nil, errors.New("couldn't marshal party public key: " + err.Error())
 	}
 	partyCoin.Write(pubBuf)
+	cl := byzcoin.NewClient(party.ByzCoinID, *party.FinalStatement.Desc.Roster)
+	counters, err := cl.GetSignerCounters(party.Signer.Identity().String())
+	if err != nil {
+		return nil, errors.New("couldn't get signer counter: " + err.Error())
+	}
 	ctx := byzcoin.ClientTransaction{
 		Instructions: []byzcoin.Instruction{{
-			InstanceID: byzcoin.NewInstanceID(partyCoin.Sum(nil)),
-			Index:      0,
-			Length:     1,
+			InstanceID:    byzcoin.NewInstanceID(partyCoin.Sum(nil)),
+			Index:         0,
+			Length:        1,
+			SignerCounter: []uint64{counters.Counters[0]},
 			Invoke: &byzcoin.Invoke{
 				Command: "transfer",
 				Args: []byzcoin.Argument{{
@@ -224,7 +230,6 @@ func (s *Service) ReadMessage(rm *ReadMessage) (*ReadMessageReply, error) {
 	if err != nil {
 		return nil, errors.New("couldn't sign: " + err.Error())
 	}
-	cl := byzcoin.NewClient(party.ByzCoinID, *party.FinalStatement.Desc.Roster)
 	_, err = cl.AddTransactionAndWait(ctx, 10)
 	if err != nil {
 		return nil, errors.New("couldn't send reward: " + err.Error())
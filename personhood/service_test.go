@@ -406,6 +406,16 @@ func (s *sStruct) createParty(t *testing.T, orgs, attendees int) {
 	require.Nil(t, err)
 }
 
+func (s *sStruct) nextCounter(t *testing.T, sig darc.Signer) uint64 {
+	reply, err := s.ols.GetSignerCounters(&byzcoin.GetSignerCounters{
+		Version:     byzcoin.CurrentVersion,
+		SkipchainID: s.olID,
+		SignerIDs:   []string{sig.Identity().String()},
+	})
+	require.Nil(t, err)
+	return reply.Counters[0]
+}
+
 func (s *sStruct) createPoPSpawn(t *testing.T) {
 	log.Lvl2("Publishing the party to the ledger")
 
@@ -414,9 +424,10 @@ func (s *sStruct) createPoPSpawn(t *testing.T) {
 	dID := s.gMsg.GenesisDarc.GetBaseID()
 	ctx := byzcoin.ClientTransaction{
 		Instructions: byzcoin.Instructions{byzcoin.Instruction{
-			InstanceID: byzcoin.NewInstanceID(dID),
-			Index:      0,
-			Length:     1,
+			InstanceID:    byzcoin.NewInstanceID(dID),
+			Index:         0,
+			Length:        1,
+			SignerCounter: []uint64{s.nextCounter(t, s.signer)},
 			Spawn: &byzcoin.Spawn{
 				ContractID: pop.ContractPopParty,
 				Args: byzcoin.Arguments{{
@@ -428,13 +439,14 @@ func (s *sStruct) createPoPSpawn(t *testing.T) {
 	}
 	err = ctx.Instructions[0].SignBy(dID, s.signer)
 	require.Nil(t, err)
-	_, err = s.ols.AddTransaction(&byzcoin.AddTxRequest{
+	resp, err := s.ols.AddTransaction(&byzcoin.AddTxRequest{
 		Version:       byzcoin.CurrentVersion,
 		SkipchainID:   s.olID,
 		Transaction:   ctx,
 		InclusionWait: 10,
 	})
 	require.Nil(t, err)
+	require.True(t, resp.Accepted)
 	s.popI = ctx.Instructions[0].DeriveID("")
 }
 
@@ -447,9 +459,10 @@ func (s *sStruct) invokePoPFinalize(t *testing.T) {
 	require.Nil(t, err)
 	ctx := byzcoin.ClientTransaction{
 		Instructions: byzcoin.Instructions{byzcoin.Instruction{
-			InstanceID: s.popI,
-			Index:      0,
-			Length:     1,
+			InstanceID:    s.popI,
+			Index:         0,
+			Length:        1,
+			SignerCounter: []uint64{s.nextCounter(t, s.signer)},
 			Invoke: &byzcoin.Invoke{
 				Command: "Finalize",
 				Args: byzcoin.Arguments{
@@ -468,13 +481,14 @@ func (s *sStruct) invokePoPFinalize(t *testing.T) {
 	dID := s.gMsg.GenesisDarc.GetBaseID()
 	err = ctx.Instructions[0].SignBy(dID, s.signer)
 	require.Nil(t, err)
-	_, err = s.ols.AddTransaction(&byzcoin.AddTxRequest{
+	resp, err := s.ols.AddTransaction(&byzcoin.AddTxRequest{
 		Version:       byzcoin.CurrentVersion,
 		SkipchainID:   s.olID,
 		Transaction:   ctx,
 		InclusionWait: 10,
 	})
 	require.Nil(t, err)
+	require.True(t, resp.Accepted)
 	serCoinID := sha256.New()
 	serCoinID.Write(ctx.Instructions[0].InstanceID.Slice())
 	serCoinID.Write(sBuf)
@@ -556,9 +570,10 @@ func (s *sStruct) coinTransfer(t *testing.T, from, to byzcoin.InstanceID, coins
 	binary.LittleEndian.PutUint64(cBuf, coins)
 	ctx := byzcoin.ClientTransaction{
 		Instructions: []byzcoin.Instruction{{
-			InstanceID: from,
-			Index:      0,
-			Length:     1,
+			InstanceID:    from,
+			Index:         0,
+			Length:        1,
+			SignerCounter: []uint64{s.nextCounter(t, sig)},
 			Invoke: &byzcoin.Invoke{
 				Command: "transfer",
 				Args: []byzcoin.Argument{{
@@ -573,11 +588,12 @@ func (s *sStruct) coinTransfer(t *testing.T, from, to byzcoin.InstanceID, coins
 		}},
 	}
 	require.Nil(t, ctx.Instructions[0].SignBy(d.GetBaseID(), sig))
-	_, err := s.ols.AddTransaction(&byzcoin.AddTxRequest{
+	resp, err := s.ols.AddTransaction(&byzcoin.AddTxRequest{
 		Version:       byzcoin.CurrentVersion,
 		SkipchainID:   s.olID,
 		Transaction:   ctx,
 		InclusionWait: 10,
 	})
 	require.Nil(t, err)
+	require.True(t, resp.Accepted)
 }
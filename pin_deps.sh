@@ -0,0 +1,17 @@
+#!/usr/bin/env bash
+set -e -u
+
+# `go get` fetches the latest version of every dependency. The ones listed
+# here change their API without notice, so they are checked out at a known
+# version afterwards.
+pinned=(
+  "github.com/perlin-network/life 05c0e0f7eaea"
+  "github.com/go-interpreter/wagon v0.6.0"
+)
+
+gopath=$( go env GOPATH )
+for dep in "${pinned[@]}"; do
+  set -- $dep
+  echo "Pinning $1 to $2"
+  git -C "$gopath/src/$1" checkout -q "$2"
+done
@@ -738,6 +738,11 @@ func bcStore(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	olc := byzcoin.NewClient(cfg.ByzCoinID, cfg.Roster)
+	counters, err := olc.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return err
+	}
 	inst := byzcoin.Instruction{
 		InstanceID: byzcoin.NewInstanceID(cfg.GenesisDarc.GetBaseID()),
 		Nonce:      byzcoin.Nonce{},
@@ -750,6 +755,7 @@ func bcStore(c *cli.Context) error {
 				Value: orgDarcBuf,
 			}},
 		},
+		SignerCounter: []uint64{counters.Counters[0]},
 	}
 	err = inst.SignBy(cfg.GenesisDarc.GetBaseID(), *signer)
 	if err != nil {
@@ -759,7 +765,6 @@ func bcStore(c *cli.Context) error {
 		Instructions: byzcoin.Instructions{inst},
 	}
 	log.Info("Contacting ByzCoin to store the new darc")
-	olc := byzcoin.NewClient(cfg.ByzCoinID, cfg.Roster)
 	_, err = olc.AddTransactionAndWait(ct, 10)
 	if err != nil {
 		return err
@@ -781,6 +786,7 @@ func bcStore(c *cli.Context) error {
 				Value: partyConfigBuf,
 			}},
 		},
+		SignerCounter: []uint64{counters.Counters[0] + 1},
 	}
 	err = inst.SignBy(orgDarc.GetBaseID(), *signer)
 	if err != nil {
@@ -867,12 +873,18 @@ func bcFinalize(c *cli.Context) error {
 		return errors.New("Couldn't get point: " + err.Error())
 	}
 
+	counters, err := ocl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return errors.New("couldn't get signer counter: " + err.Error())
+	}
+
 	log.Info("Sending finalize-instruction")
 	ctx := byzcoin.ClientTransaction{
 		Instructions: byzcoin.Instructions{byzcoin.Instruction{
-			InstanceID: partyInstance,
-			Index:      0,
-			Length:     1,
+			InstanceID:    partyInstance,
+			Index:         0,
+			Length:        1,
+			SignerCounter: []uint64{counters.Counters[0]},
 			Invoke: &byzcoin.Invoke{
 				Command: "Finalize",
 				Args: byzcoin.Arguments{
@@ -1053,14 +1065,20 @@ func bcCoinTransfer(c *cli.Context) error {
 	// 	return errors.New("cannot unmarshal source darc: " + err.Error())
 	// }
 
+	counters, err := ocl.GetSignerCounters(srcSigner.Identity().String())
+	if err != nil {
+		return errors.New("couldn't get signer counter: " + err.Error())
+	}
+
 	log.Info("Transferring coins")
 	amountBuf := make([]byte, 8)
 	binary.LittleEndian.PutUint64(amountBuf, amount)
 	ctx := byzcoin.ClientTransaction{
 		Instructions: byzcoin.Instructions{byzcoin.Instruction{
-			InstanceID: byzcoin.NewInstanceID(srcAddr),
-			Index:      0,
-			Length:     1,
+			InstanceID:    byzcoin.NewInstanceID(srcAddr),
+			Index:         0,
+			Length:        1,
+			SignerCounter: []uint64{counters.Counters[0] + 1},
 			Invoke: &byzcoin.Invoke{
 				Command: "transfer",
 				Args: byzcoin.Arguments{{
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
@@ -19,8 +20,11 @@ import (
 	"github.com/BurntSushi/toml"
 	bolt "github.com/coreos/bbolt"
 	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoin"
 	"github.com/dedis/cothority/identity"
 	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/cothority/skipchain/lightclient"
+	status "github.com/dedis/cothority/status/service"
 	"github.com/dedis/kyber"
 	"github.com/dedis/kyber/util/encoding"
 	"github.com/dedis/kyber/util/key"
@@ -29,6 +33,7 @@ import (
 	"github.com/dedis/onet/cfgpath"
 	"github.com/dedis/onet/log"
 	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
 	"gopkg.in/urfave/cli.v1"
 )
 
@@ -245,6 +250,40 @@ func followDel(c *cli.Context) error {
 	log.Infof("Successfully deleted following of skipchain %x in conode %v.", scid, link.Conode)
 	return nil
 }
+func prune(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return errors.New("please give skipchain-id and ip:port of the conode")
+	}
+	cfg := getConfigOrFail(c)
+	scid, err := hex.DecodeString(c.Args().First())
+	if err != nil {
+		return err
+	}
+	link, err := findLinkFromAddress(cfg, c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	var archives []*network.ServerIdentity
+	for _, addr := range c.StringSlice("archive") {
+		lookup := network.NewServerIdentity(cothority.Suite.Point().Null(), network.NewAddress(network.PlainTCP, addr))
+		resp, err := status.NewClient().Request(lookup)
+		if err != nil {
+			return fmt.Errorf("couldn't get the identity of archive %s: %s", addr, err)
+		}
+		archives = append(archives, resp.ServerIdentity)
+	}
+	keep := c.Int("keep")
+	err = skipchain.NewClient().SetPruning(link.Conode, link.Private, scid, keep, archives)
+	if err != nil {
+		return err
+	}
+	if keep == 0 {
+		log.Infof("Conode %s keeps all blocks of skipchain %x.", link.Conode, scid)
+	} else {
+		log.Infof("Conode %s keeps the payload of the last %d blocks of skipchain %x.", link.Conode, keep, scid)
+	}
+	return nil
+}
 func followList(c *cli.Context) error {
 	if c.NArg() != 1 {
 		return errors.New("please give ip:port of the host to list")
@@ -405,6 +444,289 @@ func scPrint(c *cli.Context) error {
 	return nil
 }
 
+// Writes all blocks of a skipchain to an archive file
+func scExport(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return errors.New("please give skipchain-id and archive file")
+	}
+	cfg := getConfigOrFail(c)
+	sb, err := cfg.Db.GetFuzzy(c.Args().First())
+	cfg.Db.Close()
+	if err != nil {
+		return err
+	}
+	if sb == nil {
+		return errors.New("didn't find this skipchain")
+	}
+	cl := skipchain.NewClient()
+	guc, err := cl.GetUpdateChain(sb.Roster, sb.Hash)
+	if err != nil {
+		return err
+	}
+	latest := guc.Update[len(guc.Update)-1]
+	genesis := latest.SkipChainID()
+
+	f, err := os.Create(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	aw, err := skipchain.NewArchiveWriter(f, genesis, latest.Index+1)
+	if err != nil {
+		return err
+	}
+	for next := 0; next <= latest.Index; {
+		blocks, err := cl.GetBlocksByIndexRange(latest.Roster, genesis, next, latest.Index+1)
+		if err != nil {
+			return err
+		}
+		if len(blocks) == 0 {
+			return fmt.Errorf("couldn't get block %d", next)
+		}
+		for _, sb := range blocks {
+			if sb.Index > 0 && len(sb.Payload) == 0 {
+				sb, err = fetchPayload(cl, latest.Roster, sb)
+				if err != nil {
+					return err
+				}
+			}
+			if err := aw.WriteBlock(sb); err != nil {
+				return err
+			}
+		}
+		next = blocks[len(blocks)-1].Index + 1
+	}
+	log.Infof("Exported %d blocks of skipchain %x to %s", latest.Index+1, genesis, c.Args().Get(1))
+	return f.Close()
+}
+
+// fetchPayload returns the block sb together with its payload. Unlike
+// GetBlocksByIndexRange, GetSingleBlock fetches the payload of pruned blocks
+// from the archives, and fails if no archive has it, so that the export
+// doesn't silently miss payloads. Blocks without payload are returned as is.
+func fetchPayload(cl *skipchain.Client, roster *onet.Roster, sb *skipchain.SkipBlock) (*skipchain.SkipBlock, error) {
+	full, err := cl.GetSingleBlock(roster, sb.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get the payload of block %d: %s", sb.Index, err)
+	}
+	if !full.CalculateHash().Equal(sb.Hash) {
+		return nil, fmt.Errorf("got a wrong block for block %d", sb.Index)
+	}
+	return full, nil
+}
+
+// Verifies the blocks of an archive file and stores them in the local cache
+func scImport(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("please give archive file")
+	}
+	f, err := os.Open(c.Args().First())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ar, err := skipchain.NewArchiveReader(f)
+	if err != nil {
+		return err
+	}
+	var blocks []*skipchain.SkipBlock
+	for {
+		sb, err := ar.ReadBlock()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, sb)
+	}
+	// Blocks added while the archive was written can be the target of
+	// forward links, which are dropped as their target is missing.
+	known := map[string]bool{}
+	for _, sb := range blocks {
+		known[string(sb.Hash)] = true
+	}
+	for _, sb := range blocks {
+		for i, fl := range sb.ForwardLink {
+			if !fl.IsEmpty() && !known[string(fl.To)] {
+				sb.ForwardLink = sb.ForwardLink[:i]
+				break
+			}
+		}
+	}
+
+	cfg := getConfigOrFail(c)
+	if err := verifyBlocks(cfg.Db, blocks); err != nil {
+		cfg.Db.Close()
+		return errors.New("couldn't verify the archive: " + err.Error())
+	}
+	if _, err := cfg.Db.StoreBlocks(blocks); err != nil {
+		cfg.Db.Close()
+		return err
+	}
+	log.Infof("Imported %d blocks of skipchain %x", len(blocks), ar.Header.SkipChainID)
+	return cfg.save(c)
+}
+
+// verifyBlocks checks the links of all blocks with
+// SkipBlockDB.VerifyLinksWithRotation in a temporary database, so that
+// nothing is stored in db if one of them is wrong. The parent blocks are
+// taken from db.
+func verifyBlocks(db *skipchain.SkipBlockDB, blocks []*skipchain.SkipBlock) error {
+	tmp, err := ioutil.TempFile("", "scmgr-import")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	bdb, err := bolt.Open(tmp.Name(), 0600, nil)
+	if err != nil {
+		return err
+	}
+	defer bdb.Close()
+	err = bdb.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket(bucketName)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	tmpDb := skipchain.NewSkipBlockDB(bdb, bucketName)
+
+	if parent := blocks[0].ParentBlockID; !parent.IsNull() {
+		sb := db.GetByID(parent)
+		if sb == nil {
+			return errors.New("import the parent skipchain first")
+		}
+		tmpDb.Store(sb)
+	}
+	if _, err := tmpDb.StoreBlocks(blocks); err != nil {
+		return err
+	}
+	for _, sb := range blocks {
+		if err := tmpDb.VerifyLinksWithRotation(sb); err != nil {
+			return fmt.Errorf("block %d: %s", sb.Index, err)
+		}
+	}
+	return nil
+}
+
+// lightClientPath returns the file where the light client of the skipchain
+// pins its head.
+func lightClientPath(c *cli.Context, genesis skipchain.SkipBlockID) (string, error) {
+	dir := c.GlobalString("config")
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return "", err
+	}
+	return path.Join(dir, fmt.Sprintf("lightclient-%x.bin", []byte(genesis))), nil
+}
+
+// loadLightClient returns the light client of the skipchain given as first
+// argument and updates its head.
+func loadLightClient(c *cli.Context) (*lightclient.Client, error) {
+	genesis, err := hex.DecodeString(c.Args().First())
+	if err != nil {
+		return nil, err
+	}
+	fn, err := lightClientPath(c, genesis)
+	if err != nil {
+		return nil, err
+	}
+	lc, err := lightclient.Load(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("skipchain is not pinned, use 'scmgr verify pin' first")
+		}
+		return nil, err
+	}
+	if err := lc.Update(); err != nil {
+		return nil, errors.New("couldn't update the head: " + err.Error())
+	}
+	return lc, nil
+}
+
+// Pins the genesis block of a skipchain for the light client
+func verifyPin(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return errors.New("please give group-file and skipchain-id")
+	}
+	group := readGroupArgs(c, 0)
+	genesis, err := hex.DecodeString(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	sb, err := skipchain.NewClient().GetSingleBlock(group.Roster, genesis)
+	if err != nil {
+		return err
+	}
+	if !sb.Hash.Equal(genesis) {
+		return errors.New("got another block than the genesis block")
+	}
+	fn, err := lightClientPath(c, genesis)
+	if err != nil {
+		return err
+	}
+	lc, err := lightclient.New(sb, fn)
+	if err != nil {
+		return err
+	}
+	if err := lc.Update(); err != nil {
+		return err
+	}
+	log.Infof("Pinned skipchain %x at block %d: %x", genesis, lc.Head.Index, lc.Head.Hash)
+	return nil
+}
+
+// Verifies that a block is part of a pinned skipchain
+func verifyBlock(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return errors.New("please give skipchain-id and skipblock-id")
+	}
+	lc, err := loadLightClient(c)
+	if err != nil {
+		return err
+	}
+	id, err := hex.DecodeString(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	sb, err := lc.VerifyBlockID(id)
+	if err != nil {
+		return errors.New("verification failed: " + err.Error())
+	}
+	log.Infof("Block %x is block %d of skipchain %x", sb.Hash, sb.Index, lc.Genesis.Hash)
+	return nil
+}
+
+// Verifies a byzcoin proof against a pinned skipchain
+func verifyProof(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return errors.New("please give skipchain-id and proof-file")
+	}
+	lc, err := loadLightClient(c)
+	if err != nil {
+		return err
+	}
+	buf, err := ioutil.ReadFile(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	var p byzcoin.Proof
+	err = protobuf.DecodeWithConstructors(buf, &p, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return errors.New("couldn't decode proof: " + err.Error())
+	}
+	if err := lc.VerifyProof(&p); err != nil {
+		return errors.New("verification failed: " + err.Error())
+	}
+	if p.InclusionProof.Match() {
+		log.Infof("Proof of presence of key %x in block %d is valid", p.InclusionProof.Key, p.Latest.Index)
+	} else {
+		log.Infof("Proof of absence of key %x in block %d is valid", p.InclusionProof.Key, p.Latest.Index)
+	}
+	return nil
+}
+
 // Joins a given skipchain
 func dnsFetch(c *cli.Context) error {
 	if c.NArg() != 2 {
@@ -92,6 +92,51 @@ func getCommands() cli.Commands {
 			},
 		},
 
+		{
+			Name:      "prune",
+			Usage:     "only keep the payload of the most recent blocks of a skipchain on a conode",
+			ArgsUsage: "skipchain-id ip:port",
+			Action:    prune,
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "keep, k",
+					Usage: "number of most recent blocks to keep in full, 0 to keep all",
+				},
+				cli.StringSliceFlag{
+					Name:  "archive, a",
+					Usage: "IP:Port - conode that keeps all blocks, can be given more than once",
+				},
+			},
+		},
+
+		{
+			Name:    "verify",
+			Usage:   "verify blocks and proofs against a locally pinned skipchain",
+			Aliases: []string{"v"},
+			Subcommands: cli.Commands{
+				{
+					Name:      "pin",
+					Usage:     "trust the genesis block of a skipchain and pin its latest block",
+					ArgsUsage: groupsDef + " skipchain-id",
+					Action:    verifyPin,
+				},
+				{
+					Name:      "block",
+					Usage:     "verify that a block is part of a pinned skipchain",
+					Aliases:   []string{"b"},
+					ArgsUsage: "skipchain-id skipblock-id",
+					Action:    verifyBlock,
+				},
+				{
+					Name:      "proof",
+					Usage:     "verify a byzcoin proof against a pinned skipchain",
+					Aliases:   []string{"p"},
+					ArgsUsage: "skipchain-id proof-file",
+					Action:    verifyProof,
+				},
+			},
+		},
+
 		{
 			Name:    "skipchain",
 			Usage:   "work with skipchains in cothority",
@@ -149,6 +194,20 @@ func getCommands() cli.Commands {
 						},
 					},
 				},
+				{
+					Name:      "export",
+					Usage:     "write all blocks of a skipchain to an archive file",
+					Aliases:   []string{"e"},
+					ArgsUsage: "skipchain-id archive-file",
+					Action:    scExport,
+				},
+				{
+					Name:      "import",
+					Usage:     "verify the blocks of an archive file and store them in the local cache",
+					Aliases:   []string{"i"},
+					ArgsUsage: "archive-file",
+					Action:    scImport,
+				},
 			},
 		},
 
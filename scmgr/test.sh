@@ -25,6 +25,8 @@ main(){
 	run testFollow
 	run testNewChain
 	run testFailure
+	run testVerify
+	run testExport
 	stopTest
 }
 
@@ -224,6 +226,31 @@ testFailure() {
 	testOK runSc skipchain block add --roster public.toml $ID
 }
 
+testVerify(){
+	startCl
+	setupGenesis
+	testOK runSc skipchain block add --roster public.toml $ID
+	testFail runSc verify block $ID $ID
+	testFail runSc verify pin public.toml 1234
+	testOK runSc verify pin public.toml $ID
+	testGrep "block 0 of skipchain" runSc verify block $ID $ID
+	testFail runSc verify block $ID 1234
+	testFail runSc verify proof $ID public.toml
+}
+
+testExport(){
+	startCl
+	setupGenesis
+	testOK runSc skipchain block add --roster public.toml $ID
+	testOK runSc skipchain block add --roster public.toml $ID
+	testFail runSc skipchain export 1234 chain.bin
+	testOK runSc skipchain export $ID chain.bin
+	rm -rf "$CFG"
+	testFail runSc skipchain import public.toml
+	testGrep "Imported 3 blocks" runSc skipchain import chain.bin
+	testGrep $ID runSc scdns list -l
+}
+
 setupGenesis(){
 	runGrepSed "Created new" "s/.* //" runSc skipchain create ${1:-public.toml}
 	ID=$SED
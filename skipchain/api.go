@@ -314,6 +314,20 @@ func (c *Client) GetSingleBlockByIndex(roster *onet.Roster, genesis SkipBlockID,
 	return
 }
 
+// GetBlocksByIndexRange returns the blocks of the skipchain from index start
+// up to, but not including, index end. The conode returns at most 100 blocks
+// per request, and stops at the first block it doesn't know, so fewer blocks
+// than asked for can be returned.
+func (c *Client) GetBlocksByIndexRange(roster *onet.Roster, genesis SkipBlockID, start, end int) ([]*SkipBlock, error) {
+	reply := &GetBlocksByIndexRangeReply{}
+	err := c.SendProtobuf(roster.RandomServerIdentity(),
+		&GetBlocksByIndexRange{genesis, start, end}, reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Blocks, nil
+}
+
 // CreateLinkPrivate asks the conode to create a link by sending a public
 // key of the client, signed by the private key of the conode. The reasoning is
 // that an administrator should well be able to copy the private.toml-file from
@@ -411,6 +425,41 @@ func (c *Client) DelFollow(si *network.ServerIdentity, clientPriv kyber.Scalar,
 	return c.SendProtobuf(si, &DelFollow{SkipchainID: scid, Signature: sig}, nil)
 }
 
+// SetPruning sets the pruning policy of the skipchain scid on the conode si:
+// only the payload of the keep most recent blocks is kept. The payload of the
+// older blocks is asked to the archives when needed. A keep of 0 removes the
+// policy. The client must be linked to the conode.
+func (c *Client) SetPruning(si *network.ServerIdentity, clientPriv kyber.Scalar, scid SkipBlockID,
+	keep int, archives []*network.ServerIdentity) error {
+	sig, err := schnorr.Sign(cothority.Suite, clientPriv, pruningMessage(scid, keep, archives))
+	if err != nil {
+		return errors.New("couldn't sign message:" + err.Error())
+	}
+	return c.SendProtobuf(si, &SetPruning{
+		SkipchainID: scid,
+		Keep:        keep,
+		Archives:    archives,
+		Signature:   sig,
+	}, nil)
+}
+
+// GetForkEvidence returns the evidence of forks of the skipchain scid that the
+// conode si has seen, or of all skipchains if scid is nil. Every evidence is
+// verified before it is returned.
+func (c *Client) GetForkEvidence(si *network.ServerIdentity, scid SkipBlockID) ([]*ForkEvidence, error) {
+	reply := &GetForkEvidenceReply{}
+	err := c.SendProtobuf(si, &GetForkEvidence{SkipChainID: scid}, reply)
+	if err != nil {
+		return nil, err
+	}
+	for _, fe := range reply.Evidence {
+		if err := fe.Verify(); err != nil {
+			return nil, errors.New("got wrong evidence: " + err.Error())
+		}
+	}
+	return reply.Evidence, nil
+}
+
 // ListFollow returns the list of latest skipblock of all skipchains that are followed
 // for authentication purposes.
 func (c *Client) ListFollow(si *network.ServerIdentity, clientPriv kyber.Scalar) (*ListFollowReply, error) {
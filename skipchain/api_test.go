@@ -280,6 +280,40 @@ func TestClient_GetSingleBlockByIndex(t *testing.T) {
 	require.NotNil(t, err)
 }
 
+func TestClient_GetBlocksByIndexRange(t *testing.T) {
+	nbrHosts := 3
+	l := onet.NewTCPTest(cothority.Suite)
+	_, roster, _ := l.GenTree(nbrHosts, true)
+	defer l.CloseAll()
+
+	c := newTestClient(l)
+	sb1, err := c.CreateGenesis(roster, 1, 1, VerificationNone, nil, nil)
+	log.ErrFatal(err)
+	latest := sb1
+	for i := 0; i < 3; i++ {
+		reply, err := c.StoreSkipBlock(latest, roster, nil)
+		log.ErrFatal(err)
+		latest = reply.Latest
+	}
+
+	blocks, err := c.GetBlocksByIndexRange(roster, sb1.Hash, 1, 3)
+	log.ErrFatal(err)
+	require.Equal(t, 2, len(blocks))
+	require.Equal(t, 1, blocks[0].Index)
+	require.Equal(t, 2, blocks[1].Index)
+
+	// The range stops at the latest block.
+	blocks, err = c.GetBlocksByIndexRange(roster, sb1.Hash, 2, 10)
+	log.ErrFatal(err)
+	require.Equal(t, 2, len(blocks))
+	require.True(t, latest.Hash.Equal(blocks[1].Hash))
+
+	_, err = c.GetBlocksByIndexRange(roster, sb1.Hash, 3, 1)
+	require.NotNil(t, err)
+	_, err = c.GetBlocksByIndexRange(roster, SkipBlockID{1, 2, 3}, 0, 1)
+	require.NotNil(t, err)
+}
+
 func TestClient_CreateLinkPrivate(t *testing.T) {
 	ls := linked(1)
 	defer ls.local.CloseAll()
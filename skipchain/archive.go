@@ -0,0 +1,179 @@
+package skipchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// ArchiveVersion is the version of the archive format written by
+// ArchiveWriter. ArchiveReader refuses archives with a newer version.
+const ArchiveVersion = 1
+
+// archiveMagic starts every archive.
+var archiveMagic = []byte("skipchain-archive")
+
+// maxArchiveFrame is the biggest frame accepted by ArchiveReader, so that a
+// corrupted length doesn't allocate all the memory.
+const maxArchiveFrame = 1 << 28
+
+// An archive holds all the blocks of a skipchain, with their forward links and
+// their payload. After the magic bytes, it is a sequence of frames, each
+// made of the length of the data as 4 bytes in big-endian, the data, and the
+// sha256 checksum of the data. The first frame holds the ArchiveHeader, and
+// the following frames hold the blocks in the order of their index, all
+// protobuf-encoded.
+
+// ArchiveHeader describes the content of an archive.
+type ArchiveHeader struct {
+	Version     int
+	SkipChainID SkipBlockID
+	// Count is the number of blocks in the archive, starting with the
+	// genesis block.
+	Count int
+}
+
+// ArchiveWriter writes the blocks of a skipchain to an archive.
+type ArchiveWriter struct {
+	w       io.Writer
+	header  ArchiveHeader
+	written int
+}
+
+// NewArchiveWriter writes the header of an archive of count blocks of the
+// skipchain scid to w.
+func NewArchiveWriter(w io.Writer, scid SkipBlockID, count int) (*ArchiveWriter, error) {
+	aw := &ArchiveWriter{
+		w: w,
+		header: ArchiveHeader{
+			Version:     ArchiveVersion,
+			SkipChainID: scid,
+			Count:       count,
+		},
+	}
+	if _, err := w.Write(archiveMagic); err != nil {
+		return nil, err
+	}
+	if err := aw.writeFrame(&aw.header); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+// WriteBlock writes the next block of the skipchain to the archive.
+func (aw *ArchiveWriter) WriteBlock(sb *SkipBlock) error {
+	if aw.written >= aw.header.Count {
+		return errors.New("archive is already full")
+	}
+	if sb.Index != aw.written {
+		return fmt.Errorf("expected block %d, got block %d", aw.written, sb.Index)
+	}
+	if !sb.SkipChainID().Equal(aw.header.SkipChainID) {
+		return errors.New("block is from another skipchain")
+	}
+	if err := aw.writeFrame(sb); err != nil {
+		return err
+	}
+	aw.written++
+	return nil
+}
+
+func (aw *ArchiveWriter) writeFrame(msg interface{}) error {
+	buf, err := protobuf.Encode(msg)
+	if err != nil {
+		return err
+	}
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(buf)))
+	sum := sha256.Sum256(buf)
+	for _, b := range [][]byte{length, buf, sum[:]} {
+		if _, err := aw.w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ArchiveReader reads the blocks of a skipchain from an archive.
+type ArchiveReader struct {
+	r io.Reader
+	// Header is the header of the archive.
+	Header ArchiveHeader
+	read   int
+}
+
+// NewArchiveReader reads and checks the header of the archive in r.
+func NewArchiveReader(r io.Reader) (*ArchiveReader, error) {
+	magic := make([]byte, len(archiveMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, errors.New("couldn't read archive: " + err.Error())
+	}
+	if !bytes.Equal(magic, archiveMagic) {
+		return nil, errors.New("not a skipchain archive")
+	}
+	ar := &ArchiveReader{r: r}
+	if err := ar.readFrame(&ar.Header); err != nil {
+		return nil, errors.New("couldn't read header: " + err.Error())
+	}
+	if ar.Header.Version > ArchiveVersion {
+		return nil, fmt.Errorf("archive version %d is not supported", ar.Header.Version)
+	}
+	if ar.Header.Count <= 0 {
+		return nil, errors.New("archive holds no blocks")
+	}
+	return ar, nil
+}
+
+// ReadBlock returns the next block of the archive, or io.EOF once all blocks
+// have been read. The hash, the skipchain and the index of every block are
+// checked, but not its links.
+func (ar *ArchiveReader) ReadBlock() (*SkipBlock, error) {
+	if ar.read >= ar.Header.Count {
+		return nil, io.EOF
+	}
+	sb := &SkipBlock{}
+	if err := ar.readFrame(sb); err != nil {
+		return nil, fmt.Errorf("couldn't read block %d: %s", ar.read, err)
+	}
+	if sb.SkipBlockFix == nil || !sb.CalculateHash().Equal(sb.Hash) {
+		return nil, fmt.Errorf("wrong hash of block %d", ar.read)
+	}
+	if sb.Index != ar.read {
+		return nil, fmt.Errorf("expected block %d, got block %d", ar.read, sb.Index)
+	}
+	if !sb.SkipChainID().Equal(ar.Header.SkipChainID) {
+		return nil, fmt.Errorf("block %d is from another skipchain", sb.Index)
+	}
+	ar.read++
+	return sb, nil
+}
+
+func (ar *ArchiveReader) readFrame(msg interface{}) error {
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(ar.r, length); err != nil {
+		return err
+	}
+	l := binary.BigEndian.Uint32(length)
+	if l > maxArchiveFrame {
+		return errors.New("frame too big")
+	}
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(ar.r, buf); err != nil {
+		return err
+	}
+	sum := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(ar.r, sum); err != nil {
+		return err
+	}
+	if s := sha256.Sum256(buf); !bytes.Equal(s[:], sum) {
+		return errors.New("wrong checksum")
+	}
+	return protobuf.DecodeWithConstructors(buf, msg, network.DefaultConstructors(cothority.Suite))
+}
@@ -0,0 +1,71 @@
+package skipchain
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchive(t *testing.T) {
+	var blocks []*SkipBlock
+	for i := 0; i < 3; i++ {
+		sb := NewSkipBlock()
+		sb.Index = i
+		sb.Data = []byte{byte(i)}
+		sb.Payload = []byte{byte(i), 1}
+		if i > 0 {
+			sb.GenesisID = blocks[0].Hash
+		}
+		sb.Hash = sb.CalculateHash()
+		blocks = append(blocks, sb)
+	}
+	blocks[0].ForwardLink = []*ForwardLink{NewForwardLink(blocks[0], blocks[1])}
+
+	var buf bytes.Buffer
+	aw, err := NewArchiveWriter(&buf, blocks[0].Hash, len(blocks))
+	require.Nil(t, err)
+	require.NotNil(t, aw.WriteBlock(blocks[1]))
+	for _, sb := range blocks {
+		require.Nil(t, aw.WriteBlock(sb))
+	}
+	require.NotNil(t, aw.WriteBlock(blocks[2]))
+	archive := buf.Bytes()
+
+	ar, err := NewArchiveReader(bytes.NewReader(archive))
+	require.Nil(t, err)
+	require.Equal(t, ArchiveVersion, ar.Header.Version)
+	require.Equal(t, len(blocks), ar.Header.Count)
+	for _, sb := range blocks {
+		read, err := ar.ReadBlock()
+		require.Nil(t, err)
+		require.True(t, sb.Hash.Equal(read.Hash))
+		require.Equal(t, sb.Payload, read.Payload)
+		require.Equal(t, len(sb.ForwardLink), len(read.ForwardLink))
+	}
+	_, err = ar.ReadBlock()
+	require.Equal(t, io.EOF, err)
+
+	// A corrupted archive is refused.
+	corrupted := append([]byte{}, archive...)
+	corrupted[len(corrupted)-40]++
+	ar, err = NewArchiveReader(bytes.NewReader(corrupted))
+	require.Nil(t, err)
+	var last error
+	for last == nil {
+		_, last = ar.ReadBlock()
+	}
+	require.NotEqual(t, io.EOF, last)
+
+	_, err = NewArchiveReader(bytes.NewReader(archive[1:]))
+	require.NotNil(t, err)
+
+	// An archive with missing blocks is refused.
+	ar, err = NewArchiveReader(bytes.NewReader(archive[:len(archive)-10]))
+	require.Nil(t, err)
+	for last = nil; last == nil; {
+		_, last = ar.ReadBlock()
+	}
+	require.NotEqual(t, io.EOF, last)
+}
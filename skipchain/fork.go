@@ -0,0 +1,143 @@
+package skipchain
+
+import (
+	"encoding/binary"
+	"errors"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/dedis/cothority"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// ForkEvidence proves that the roster of a block signed two different forward
+// links at the same height, so that the skipchain has been forked.
+type ForkEvidence struct {
+	SkipChainID SkipBlockID
+	// Index is the index of the block both links start from.
+	Index int
+	// Height is the height of both forward links.
+	Height int
+	// Roster is the roster of the block, which signed both links.
+	Roster *onet.Roster
+	// Known is the link that has been stored first.
+	Known *ForwardLink
+	// Conflicting is the link that has been seen later.
+	Conflicting *ForwardLink
+}
+
+// Verify checks that both links start from the same block, point to different
+// blocks and are signed by the roster. As a view-change rotates the roster,
+// every rotation of the roster is accepted.
+func (fe *ForkEvidence) Verify() error {
+	if fe.Known == nil || fe.Conflicting == nil || fe.Roster == nil {
+		return errors.New("incomplete evidence")
+	}
+	if !fe.Known.From.Equal(fe.Conflicting.From) {
+		return errors.New("links start from different blocks")
+	}
+	if fe.Known.To.Equal(fe.Conflicting.To) {
+		return errors.New("links point to the same block")
+	}
+	for _, fl := range []*ForwardLink{fe.Known, fe.Conflicting} {
+		if err := fl.VerifyWithRotation(cothority.Suite, fe.Roster.Publics()); err != nil {
+			return errors.New("wrong signature of link: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// checkFork returns the evidence for every forward link of sb that conflicts
+// with a forward link of the known copy of the same block. Conflicting links
+// without a valid signature are ignored, as anybody could have made them.
+func checkFork(known, sb *SkipBlock) []*ForkEvidence {
+	var evidence []*ForkEvidence
+	for i, fl := range sb.ForwardLink {
+		if i >= len(known.ForwardLink) {
+			break
+		}
+		old := known.ForwardLink[i]
+		if fl.IsEmpty() || old.IsEmpty() || fl.To.Equal(old.To) {
+			continue
+		}
+		fe := &ForkEvidence{
+			SkipChainID: known.SkipChainID(),
+			Index:       known.Index,
+			Height:      i,
+			Roster:      known.Roster,
+			Known:       old.Copy(),
+			Conflicting: fl.Copy(),
+		}
+		if err := fe.Verify(); err != nil {
+			log.Lvlf2("Ignoring conflicting forward link of block %d: %s", known.Index, err)
+			continue
+		}
+		evidence = append(evidence, fe)
+	}
+	return evidence
+}
+
+// forkKey returns the key of the evidence in the fork bucket, so that the
+// same conflicting link is only stored once.
+func forkKey(fe *ForkEvidence) []byte {
+	key := append([]byte{}, fe.Known.From...)
+	h := make([]byte, 4)
+	binary.BigEndian.PutUint32(h, uint32(fe.Height))
+	key = append(key, h...)
+	return append(key, fe.Conflicting.To...)
+}
+
+// StoreForkEvidence stores the evidence in the fork bucket.
+func (db *SkipBlockDB) StoreForkEvidence(evidence []*ForkEvidence) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(db.forkBucketName)
+		for _, fe := range evidence {
+			log.Errorf("Skipchain %x is forked: block %d signed links to %x and %x at height %d",
+				fe.SkipChainID, fe.Index, fe.Known.To, fe.Conflicting.To, fe.Height)
+			val, err := network.Marshal(fe)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(forkKey(fe), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetForkEvidence returns all the evidence of forks of the skipchain, or of
+// all skipchains if scid is empty.
+func (db *SkipBlockDB) GetForkEvidence(scid SkipBlockID) ([]*ForkEvidence, error) {
+	var evidence []*ForkEvidence
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(db.forkBucketName).ForEach(func(k, v []byte) error {
+			buf := make([]byte, len(v))
+			copy(buf, v)
+			_, msg, err := network.Unmarshal(buf, cothority.Suite)
+			if err != nil {
+				return err
+			}
+			fe, ok := msg.(*ForkEvidence)
+			if !ok {
+				return errors.New("stored bytes are not fork evidence")
+			}
+			if len(scid) == 0 || fe.SkipChainID.Equal(scid) {
+				evidence = append(evidence, fe)
+			}
+			return nil
+		})
+	})
+	return evidence, err
+}
+
+// GetForkEvidence returns the evidence of forks of a skipchain this conode
+// has seen, or of all skipchains if no SkipChainID is given.
+func (s *Service) GetForkEvidence(req *GetForkEvidence) (*GetForkEvidenceReply, error) {
+	evidence, err := s.db.GetForkEvidence(req.SkipChainID)
+	if err != nil {
+		return nil, err
+	}
+	return &GetForkEvidenceReply{Evidence: evidence}, nil
+}
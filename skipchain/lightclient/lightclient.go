@@ -0,0 +1,243 @@
+// Package lightclient verifies skipblocks and byzcoin proofs with nothing
+// more than a trusted genesis block. It follows the highest-level forward
+// links of the skipchain, verifies every link with the roster of the last
+// trusted block, and pins the latest trusted block in a file, so that later
+// verifications only need to check the blocks added since.
+package lightclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+	"github.com/dedis/protobuf"
+)
+
+// Client holds the trusted genesis block of a skipchain and the latest block
+// of that skipchain that has been verified.
+type Client struct {
+	// Genesis is the genesis block the client trusts.
+	Genesis *skipchain.SkipBlock
+	// Head is the latest block whose forward links have been verified from
+	// the genesis block on.
+	Head *skipchain.SkipBlock
+	path string
+	cl   *skipchain.Client
+}
+
+// pinned is what is stored in the file of a client.
+type pinned struct {
+	Genesis *skipchain.SkipBlock
+	Head    *skipchain.SkipBlock
+}
+
+// New returns a client that trusts the given genesis block and pins its head
+// in the file at path.
+func New(genesis *skipchain.SkipBlock, path string) (*Client, error) {
+	if genesis.Index != 0 {
+		return nil, errors.New("not a genesis block")
+	}
+	if !genesis.CalculateHash().Equal(genesis.Hash) {
+		return nil, errors.New("wrong hash of genesis block")
+	}
+	c := &Client{
+		Genesis: genesis,
+		Head:    genesis,
+		path:    path,
+		cl:      skipchain.NewClient(),
+	}
+	if err := c.Save(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Load returns the client that has been saved in the file at path.
+func Load(path string) (*Client, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p pinned
+	err = protobuf.DecodeWithConstructors(buf, &p, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, errors.New("couldn't decode pinned blocks: " + err.Error())
+	}
+	if p.Genesis == nil || p.Head == nil {
+		return nil, errors.New("missing pinned blocks")
+	}
+	return &Client{
+		Genesis: p.Genesis,
+		Head:    p.Head,
+		path:    path,
+		cl:      skipchain.NewClient(),
+	}, nil
+}
+
+// Save writes the genesis block and the head of the client to its file.
+func (c *Client) Save() error {
+	buf, err := protobuf.Encode(&pinned{Genesis: c.Genesis, Head: c.Head})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, buf, 0600)
+}
+
+// Update asks the roster of the head for the newer blocks of the skipchain
+// and moves the head to the latest of them. Every forward link is verified
+// with the roster of the block it starts from, so that a roster change is
+// only accepted if the previous roster signed it.
+func (c *Client) Update() error {
+	reply, err := c.cl.GetUpdateChain(c.Head.Roster, c.Head.Hash)
+	if err != nil {
+		return err
+	}
+	if len(reply.Update) == 0 || !reply.Update[0].Hash.Equal(c.Head.Hash) {
+		return errors.New("update doesn't start at the head")
+	}
+	trusted := c.Head
+	for i, sb := range reply.Update[1:] {
+		if err := c.verifyLink(trusted, reply.Update[i], sb); err != nil {
+			return err
+		}
+		trusted = sb
+	}
+	if trusted.Index == c.Head.Index {
+		return nil
+	}
+	log.Lvlf2("Moving head of %x from block %d to block %d", c.Genesis.Hash,
+		c.Head.Index, trusted.Index)
+	c.Head = trusted
+	return c.Save()
+}
+
+// verifyLink checks that the block from, as returned by a conode, holds a
+// forward link to the block to which is signed by the roster of the trusted
+// copy of from.
+func (c *Client) verifyLink(trusted, from, to *skipchain.SkipBlock) error {
+	if !from.Hash.Equal(trusted.Hash) {
+		return fmt.Errorf("block %d is not the trusted one", from.Index)
+	}
+	if !to.CalculateHash().Equal(to.Hash) {
+		return fmt.Errorf("wrong hash of block %d", to.Index)
+	}
+	if !to.SkipChainID().Equal(c.Genesis.Hash) {
+		return fmt.Errorf("block %d is from another skipchain", to.Index)
+	}
+	for _, fl := range from.ForwardLink {
+		if fl.IsEmpty() || !fl.From.Equal(from.Hash) || !fl.To.Equal(to.Hash) {
+			continue
+		}
+		if err := fl.VerifyWithRotation(cothority.Suite, trusted.Roster.Publics()); err != nil {
+			return fmt.Errorf("forward link from block %d to block %d: %s",
+				from.Index, to.Index, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no forward link from block %d to block %d", from.Index, to.Index)
+}
+
+// VerifyBlock checks that the block is part of the skipchain. If the block is
+// newer than the head, the client is updated first. Older blocks are reached
+// from the genesis block by following the highest forward links that don't
+// jump over them.
+func (c *Client) VerifyBlock(sb *skipchain.SkipBlock) error {
+	if !sb.CalculateHash().Equal(sb.Hash) {
+		return errors.New("wrong hash of block")
+	}
+	if sb.Index > c.Head.Index {
+		if err := c.Update(); err != nil {
+			return err
+		}
+		if sb.Index > c.Head.Index {
+			return fmt.Errorf("block %d is newer than the latest block %d", sb.Index, c.Head.Index)
+		}
+	}
+	for _, known := range []*skipchain.SkipBlock{c.Genesis, c.Head} {
+		if sb.Index == known.Index {
+			if !sb.Hash.Equal(known.Hash) {
+				return fmt.Errorf("block %d is not part of the skipchain", sb.Index)
+			}
+			return nil
+		}
+	}
+
+	trusted := c.Genesis
+	for trusted.Index < sb.Index {
+		from, err := c.cl.GetSingleBlock(c.Head.Roster, trusted.Hash)
+		if err != nil {
+			return err
+		}
+		next, err := c.nextBlock(from, sb.Index)
+		if err != nil {
+			return err
+		}
+		if err := c.verifyLink(trusted, from, next); err != nil {
+			return err
+		}
+		trusted = next
+	}
+	if trusted.Index != sb.Index || !trusted.Hash.Equal(sb.Hash) {
+		return fmt.Errorf("block %d is not part of the skipchain", sb.Index)
+	}
+	return nil
+}
+
+// nextBlock fetches the block pointed to by the highest forward link of from
+// that doesn't go beyond the block with index max.
+func (c *Client) nextBlock(from *skipchain.SkipBlock, max int) (*skipchain.SkipBlock, error) {
+	for h := len(from.ForwardLink) - 1; h >= 0; h-- {
+		fl := from.ForwardLink[h]
+		if fl.IsEmpty() {
+			continue
+		}
+		next, err := c.cl.GetSingleBlock(c.Head.Roster, fl.To)
+		if err != nil {
+			return nil, err
+		}
+		if next.Index <= max {
+			return next, nil
+		}
+	}
+	return nil, fmt.Errorf("block %d has no forward link", from.Index)
+}
+
+// VerifyBlockID fetches the block with the given ID and checks that it is
+// part of the skipchain.
+func (c *Client) VerifyBlockID(id skipchain.SkipBlockID) (*skipchain.SkipBlock, error) {
+	sb, err := c.cl.GetSingleBlock(c.Head.Roster, id)
+	if err != nil {
+		return nil, err
+	}
+	if !sb.Hash.Equal(id) {
+		return nil, errors.New("got another block than requested")
+	}
+	if err := c.VerifyBlock(sb); err != nil {
+		return nil, err
+	}
+	return sb, nil
+}
+
+// VerifyProof checks the byzcoin proof against the collection root of its
+// latest block, and that this block is part of the skipchain. Unlike
+// byzcoin.Proof.Verify, it doesn't need the links of the proof.
+func (c *Client) VerifyProof(p *byzcoin.Proof) error {
+	if !p.InclusionProof.Consistent() {
+		return byzcoin.ErrorVerifyCollection
+	}
+	var header byzcoin.DataHeader
+	err := protobuf.DecodeWithConstructors(p.Latest.Data, &header, network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(p.InclusionProof.TreeRootHash(), header.CollectionRoot) {
+		return byzcoin.ErrorVerifyCollectionRoot
+	}
+	return c.VerifyBlock(&p.Latest)
+}
@@ -0,0 +1,84 @@
+package lightclient
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoin"
+	"github.com/dedis/cothority/skipchain"
+	"github.com/dedis/onet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	l := onet.NewTCPTest(cothority.Suite)
+	_, ro, _ := l.GenTree(4, true)
+	defer l.CloseAll()
+
+	dir, err := ioutil.TempDir("", "lightclient")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "head.bin")
+
+	cl := skipchain.NewClient()
+	genesis, err := cl.CreateGenesis(ro, 2, 3, skipchain.VerificationNone, nil, nil)
+	require.Nil(t, err)
+	lc, err := New(genesis, path)
+	require.Nil(t, err)
+
+	// The roster changes at block 3, which must be signed by the
+	// previous roster.
+	blocks := []*skipchain.SkipBlock{genesis}
+	for i := 1; i < 6; i++ {
+		roster := ro
+		if i >= 3 {
+			roster = onet.NewRoster(ro.List[1:])
+		}
+		reply, err := cl.StoreSkipBlock(blocks[i-1], roster, []byte{byte(i)})
+		require.Nil(t, err)
+		blocks = append(blocks, reply.Latest)
+	}
+
+	require.Nil(t, lc.Update())
+	require.Equal(t, 5, lc.Head.Index)
+	require.True(t, lc.Head.Hash.Equal(blocks[5].Hash))
+
+	// The head is pinned in the file.
+	lc, err = Load(path)
+	require.Nil(t, err)
+	require.True(t, lc.Genesis.Hash.Equal(genesis.Hash))
+	require.True(t, lc.Head.Hash.Equal(blocks[5].Hash))
+
+	for _, sb := range blocks {
+		got, err := lc.VerifyBlockID(sb.Hash)
+		require.Nil(t, err)
+		require.Equal(t, sb.Index, got.Index)
+	}
+
+	// A block of another skipchain is refused.
+	other, err := cl.CreateGenesis(ro, 2, 3, skipchain.VerificationNone, []byte{1}, nil)
+	require.Nil(t, err)
+	require.NotNil(t, lc.VerifyBlock(other))
+	reply, err := cl.StoreSkipBlock(other, nil, []byte{2})
+	require.Nil(t, err)
+	require.NotNil(t, lc.VerifyBlock(reply.Latest))
+
+	// A block with a wrong hash is refused.
+	wrong := blocks[2].Copy()
+	wrong.Data = []byte{0}
+	require.NotNil(t, lc.VerifyBlock(wrong))
+
+	// A genesis block must have a correct hash.
+	wrong = genesis.Copy()
+	wrong.Data = []byte{0}
+	_, err = New(wrong, path)
+	require.NotNil(t, err)
+	_, err = New(blocks[1], path)
+	require.NotNil(t, err)
+
+	// A proof whose collection root doesn't match its block is refused.
+	require.NotNil(t, lc.VerifyProof(&byzcoin.Proof{Latest: *blocks[5]}))
+}
@@ -17,6 +17,9 @@ func init() {
 		&GetUpdateChainReply{},
 		// Request updated block
 		&GetSingleBlock{},
+		// Request a range of blocks
+		&GetBlocksByIndexRange{},
+		&GetBlocksByIndexRangeReply{},
 		// Fetch all skipchains
 		&GetAllSkipchains{},
 		&GetAllSkipchainsReply{},
@@ -42,6 +45,11 @@ func init() {
 		&ListFollow{},
 		// Returns the genesis-blocks of all skipchains we follow
 		&ListFollowReply{},
+		// Sets the pruning policy of a skipchain
+		&SetPruning{},
+		// Request the evidence of forks
+		&GetForkEvidence{},
+		&GetForkEvidenceReply{},
 		// - Internal calls
 		// Propagation
 		&PropagateSkipBlocks{},
@@ -50,6 +58,7 @@ func init() {
 		// - Data structures
 		&SkipBlockFix{},
 		&SkipBlock{},
+		&ForkEvidence{},
 		// Own service
 		&Service{},
 		// - Protocol messages
@@ -151,6 +160,22 @@ type GetSingleBlockByIndex struct {
 	Index   int
 }
 
+// GetBlocksByIndexRange asks for the blocks of a skipchain from index Start up
+// to, but not including, index End. The reply may hold fewer blocks, if the
+// range is too big or not all blocks are known, so the client has to ask again
+// for the rest.
+type GetBlocksByIndexRange struct {
+	Genesis SkipBlockID
+	Start   int
+	End     int
+}
+
+// GetBlocksByIndexRangeReply holds the contiguous blocks starting at the
+// requested index.
+type GetBlocksByIndexRangeReply struct {
+	Blocks []*SkipBlock
+}
+
 // Internal calls
 
 // GetBlock asks for an updated block, in case for a conode that is not
@@ -299,6 +324,30 @@ type DelFollow struct {
 	Signature   []byte
 }
 
+// SetPruning sets the pruning policy of a skipchain on the conode: only the
+// payload of the Keep most recent blocks is kept, and the payload of older
+// blocks is fetched from the Archives when asked for. A Keep of 0 removes the
+// policy. The Signature is on "setpruning:" + the SkipchainID + Keep as 8
+// bytes in little-endian + the IDs of the Archives.
+type SetPruning struct {
+	SkipchainID SkipBlockID
+	Keep        int
+	Archives    []*network.ServerIdentity
+	Signature   []byte
+}
+
+// GetForkEvidence asks a conode for the evidence of forks of a skipchain it
+// has seen, or of all skipchains if SkipChainID is empty.
+type GetForkEvidence struct {
+	SkipChainID SkipBlockID
+}
+
+// GetForkEvidenceReply holds the evidence of forks, each with two conflicting
+// forward links signed by the same roster.
+type GetForkEvidenceReply struct {
+	Evidence []*ForkEvidence
+}
+
 // ListFollow returns all followed lists all skipchains we follow.
 // The signature has to be on the following message:
 // "listfollow:" + the public key of the conode
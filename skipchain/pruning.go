@@ -0,0 +1,218 @@
+package skipchain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
+)
+
+// PruningPolicy defines which blocks of a skipchain keep their payload on
+// this conode. It is local to the conode, other conodes can have other
+// policies for the same skipchain.
+type PruningPolicy struct {
+	SkipChainID SkipBlockID
+	// Keep is the number of most recent blocks whose payload is kept. The
+	// genesis block is never pruned.
+	Keep int
+	// Archives are the conodes that keep all the blocks with their payload,
+	// and which are asked for the pruned blocks.
+	Archives []*network.ServerIdentity
+	// PrunedBefore is the index of the oldest block that has not been
+	// pruned yet.
+	PrunedBefore int
+}
+
+// pruningMessage returns the message that is signed to set a pruning policy.
+func pruningMessage(scid SkipBlockID, keep int, archives []*network.ServerIdentity) []byte {
+	msg := append([]byte("setpruning:"), scid...)
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(keep))
+	msg = append(msg, b...)
+	for _, si := range archives {
+		msg = append(msg, si.ID[:]...)
+	}
+	return msg
+}
+
+// SetPruning sets the pruning policy of a skipchain on this conode, or
+// removes it if Keep is 0. As pruning drops the payloads for good, the
+// request must be signed by a linked client, and is refused if no client is
+// linked.
+func (s *Service) SetPruning(req *SetPruning) (*EmptyReply, error) {
+	if len(s.Storage.Clients) == 0 {
+		return nil, errors.New("pruning needs a linked client")
+	}
+	if !s.verifySigs(pruningMessage(req.SkipchainID, req.Keep, req.Archives), req.Signature) {
+		return nil, errors.New("wrong signature of unknown signer")
+	}
+	if req.Keep < 0 {
+		return nil, errors.New("the number of blocks to keep must not be negative")
+	}
+	if s.db.GetByID(req.SkipchainID) == nil {
+		return nil, errors.New("unknown skipchain")
+	}
+
+	s.storageMutex.Lock()
+	var policies []*PruningPolicy
+	prunedBefore := 1
+	for _, p := range s.Storage.Pruning {
+		if p.SkipChainID.Equal(req.SkipchainID) {
+			prunedBefore = p.PrunedBefore
+			continue
+		}
+		policies = append(policies, p)
+	}
+	if req.Keep > 0 {
+		log.Lvlf2("%s: keeping the payload of the last %d blocks of %x", s.ServerIdentity(),
+			req.Keep, req.SkipchainID)
+		policies = append(policies, &PruningPolicy{
+			SkipChainID:  req.SkipchainID,
+			Keep:         req.Keep,
+			Archives:     req.Archives,
+			PrunedBefore: prunedBefore,
+		})
+	}
+	s.Storage.Pruning = policies
+	s.storageMutex.Unlock()
+	s.save()
+
+	if err := s.pruneChain(req.SkipchainID); err != nil {
+		return nil, err
+	}
+	return &EmptyReply{}, nil
+}
+
+// RegisterPruneGuard sets a function that returns, for a skipchain, the index
+// of the oldest block whose payload must not be pruned, whatever the pruning
+// policy. It is used by the services that still need the payload of some
+// older blocks.
+func (s *Service) RegisterPruneGuard(f func(SkipBlockID) int) {
+	s.pruneGuard = f
+}
+
+// RegisterPayloadCheck sets a function that checks the payload of a block
+// against the rest of the block. As the payload is not part of the hash of
+// the block, it is the only way to make sure an archive returns the correct
+// payload of a pruned block. Blocks failing the check are refused.
+func (s *Service) RegisterPayloadCheck(f func(*SkipBlock) error) {
+	s.payloadCheck = f
+}
+
+// pruningPolicy returns a copy of the pruning policy of the skipchain, or
+// nil if it has none.
+func (s *Service) pruningPolicy(scid SkipBlockID) *PruningPolicy {
+	s.storageMutex.Lock()
+	defer s.storageMutex.Unlock()
+	for _, p := range s.Storage.Pruning {
+		if p.SkipChainID.Equal(scid) {
+			cp := *p
+			return &cp
+		}
+	}
+	return nil
+}
+
+// pruneChain drops the payload of the blocks of the skipchain that are older
+// than what its pruning policy keeps.
+func (s *Service) pruneChain(scid SkipBlockID) error {
+	policy := s.pruningPolicy(scid)
+	if policy == nil {
+		return nil
+	}
+	latest, err := s.db.GetLatestByID(scid)
+	if err != nil {
+		return err
+	}
+	before := latest.Index + 1 - policy.Keep
+	if s.pruneGuard != nil {
+		if guard := s.pruneGuard(scid); guard < before {
+			before = guard
+		}
+	}
+	if before <= policy.PrunedBefore {
+		return nil
+	}
+	n, err := s.db.PruneBlocks(scid, policy.PrunedBefore, before)
+	if err != nil {
+		return err
+	}
+	log.Lvlf3("%s: pruned %d blocks of %x before index %d", s.ServerIdentity(), n, scid, before)
+
+	s.storageMutex.Lock()
+	for _, p := range s.Storage.Pruning {
+		if p.SkipChainID.Equal(scid) && p.PrunedBefore < before {
+			p.PrunedBefore = before
+		}
+	}
+	s.storageMutex.Unlock()
+	s.save()
+	return nil
+}
+
+// GetFullBlock returns the block with the given ID together with its
+// payload. If the payload of the block has been pruned, the block is fetched
+// from the archive conodes of the pruning policy of its skipchain.
+func (s *Service) GetFullBlock(id SkipBlockID) (*SkipBlock, error) {
+	sb := s.db.GetByID(id)
+	if sb == nil {
+		return nil, errors.New("No such block")
+	}
+	policy := s.pruningPolicy(sb.SkipChainID())
+	if policy == nil || sb.Index == 0 || sb.Index >= policy.PrunedBefore || len(sb.Payload) > 0 {
+		return sb, nil
+	}
+	for _, si := range policy.Archives {
+		if si.Equal(s.ServerIdentity()) {
+			continue
+		}
+		full, err := s.getArchivedBlock(si, id)
+		if err != nil {
+			log.Lvl2(s.ServerIdentity(), "couldn't get block from archive", si, err)
+			continue
+		}
+		return full, nil
+	}
+	return nil, fmt.Errorf("the payload of block %d has been pruned and no archive has it", sb.Index)
+}
+
+// getArchivedBlock asks the archive conode si for the block with the given
+// ID, using the GetBlocks protocol.
+func (s *Service) getArchivedBlock(si *network.ServerIdentity, id SkipBlockID) (*SkipBlock, error) {
+	tr := onet.NewRoster([]*network.ServerIdentity{s.ServerIdentity(), si}).GenerateStar()
+	pi, err := s.CreateProtocol(ProtocolGetBlocks, tr)
+	if err != nil {
+		return nil, err
+	}
+	pisc := pi.(*GetBlocks)
+	pisc.GetBlocks = &ProtoGetBlocks{SBID: id, Count: 1}
+	if err := pi.Start(); err != nil {
+		return nil, err
+	}
+	select {
+	case blocks := <-pisc.GetBlocksReply:
+		if len(blocks) == 0 {
+			return nil, errors.New("the archive doesn't know the block")
+		}
+		if !blocks[0].CalculateHash().Equal(id) {
+			return nil, errors.New("the archive returned another block")
+		}
+		if len(blocks[0].Payload) == 0 {
+			return nil, errors.New("the archive has pruned the block too")
+		}
+		if s.payloadCheck != nil {
+			if err := s.payloadCheck(blocks[0]); err != nil {
+				return nil, errors.New("the archive returned a wrong payload: " + err.Error())
+			}
+		}
+		return blocks[0], nil
+	case <-time.After(s.propTimeout):
+		return nil, errors.New("timeout waiting for GetBlocks reply")
+	case <-s.closing:
+		return nil, errors.New("closing")
+	}
+}
@@ -0,0 +1,122 @@
+package skipchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	bolt "github.com/coreos/bbolt"
+
+	"github.com/dedis/cothority"
+	"github.com/dedis/kyber/sign/schnorr"
+	"github.com/dedis/kyber/util/key"
+	"github.com/dedis/onet"
+	"github.com/dedis/onet/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Pruning(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer waitPropagationFinished(t, local)
+	defer local.CloseAll()
+	servers, ro, genService := local.MakeSRS(cothority.Suite, 3, skipchainSID)
+	service := genService.(*Service)
+
+	genesis := NewSkipBlock()
+	genesis.Roster = ro
+	genesis.MaximumHeight = 1
+	genesis.BaseHeight = 1
+	genesis.VerifierIDs = VerificationNone
+	genesis.Payload = []byte{0}
+	reply, err := service.StoreSkipBlock(&StoreSkipBlock{NewBlock: genesis})
+	require.Nil(t, err)
+	scid := reply.Latest.Hash
+	// Once linked, the client has to sign the new blocks.
+	kp := key.NewKeyPair(cothority.Suite)
+	addBlock := func(i byte) {
+		sb := NewSkipBlock()
+		sb.Roster = ro
+		sb.Data = []byte{i}
+		sb.Payload = []byte{i}
+		sig, err := schnorr.Sign(cothority.Suite, kp.Private, sb.CalculateHash())
+		require.Nil(t, err)
+		_, err = service.StoreSkipBlock(&StoreSkipBlock{TargetSkipChainID: scid, NewBlock: sb,
+			Signature: &sig})
+		require.Nil(t, err)
+	}
+	for i := byte(1); i <= 4; i++ {
+		addBlock(i)
+	}
+	payload := func(index int) []byte {
+		sb, err := service.db.GetByIndex(scid, index)
+		require.Nil(t, err)
+		require.NotNil(t, sb)
+		return sb.Payload
+	}
+
+	setPruning := func(scid SkipBlockID, keep int, archives []*network.ServerIdentity) error {
+		sig, err := schnorr.Sign(cothority.Suite, kp.Private, pruningMessage(scid, keep, archives))
+		require.Nil(t, err)
+		_, err = service.SetPruning(&SetPruning{
+			SkipchainID: scid,
+			Keep:        keep,
+			Archives:    archives,
+			Signature:   sig,
+		})
+		return err
+	}
+	archives := []*network.ServerIdentity{servers[1].ServerIdentity}
+
+	// Only a linked client can prune.
+	require.NotNil(t, setPruning(scid, 2, archives))
+	service.AddClientKey(kp.Public)
+	_, err = service.SetPruning(&SetPruning{SkipchainID: scid, Keep: 2, Archives: archives})
+	require.NotNil(t, err)
+
+	// Keeping the last two blocks prunes the blocks 1 and 2, but not the
+	// genesis block.
+	require.Nil(t, setPruning(scid, 2, archives))
+	require.Equal(t, []byte{0}, payload(0))
+	require.Empty(t, payload(1))
+	require.Empty(t, payload(2))
+	require.Equal(t, []byte{3}, payload(3))
+
+	// The pruned blocks are still linked and served in full by the
+	// archive.
+	sb, err := service.GetSingleBlockByIndex(&GetSingleBlockByIndex{Genesis: scid, Index: 1})
+	require.Nil(t, err)
+	require.Equal(t, []byte{1}, sb.Payload)
+	require.NotEmpty(t, sb.ForwardLink)
+
+	// The payload from the archive must pass the check of the application.
+	service.RegisterPayloadCheck(func(sb *SkipBlock) error {
+		if !bytes.Equal(sb.Data, sb.Payload) {
+			return errors.New("payload doesn't match the data")
+		}
+		return nil
+	})
+	_, err = service.GetSingleBlockByIndex(&GetSingleBlockByIndex{Genesis: scid, Index: 1})
+	require.Nil(t, err)
+	archive := local.GetServices(servers, skipchainSID)[1].(*Service)
+	wrong, err := archive.db.GetByIndex(scid, 2)
+	require.Nil(t, err)
+	wrong.Payload = []byte{9}
+	err = archive.db.Update(func(tx *bolt.Tx) error {
+		return archive.db.storeToTx(tx, wrong)
+	})
+	require.Nil(t, err)
+	_, err = service.GetSingleBlockByIndex(&GetSingleBlockByIndex{Genesis: scid, Index: 2})
+	require.NotNil(t, err)
+
+	// New blocks prune the older ones.
+	addBlock(5)
+	require.Empty(t, payload(3))
+	require.Equal(t, []byte{4}, payload(4))
+
+	// Without archive, the payload of pruned blocks is lost.
+	require.Nil(t, setPruning(scid, 2, nil))
+	_, err = service.GetSingleBlockByIndex(&GetSingleBlockByIndex{Genesis: scid, Index: 1})
+	require.NotNil(t, err)
+
+	require.NotNil(t, setPruning(SkipBlockID{1, 2, 3}, 2, nil))
+}
@@ -39,7 +39,13 @@ const bftNewBlock = "SkipchainBFTNew"
 const bftFollowBlock = "SkipchainBFTFollow"
 
 var storageKey = []byte("skipchainconfig")
-var dbVersion = 1
+
+// dbVersion 2 adds the index of the blocks by genesis ID and index.
+var dbVersion = 2
+
+// maxBlocksInRange is the maximum number of blocks returned by
+// GetBlocksByIndexRange.
+const maxBlocksInRange = 100
 
 // If this flag is set, then we relax our forward-link signature verification
 // to accept the aggregate signature by the public keys of the rotated roster.
@@ -77,6 +83,12 @@ type Service struct {
 	closedMutex             sync.Mutex
 	working                 sync.WaitGroup
 	closing                 chan bool
+	// pruneGuard returns the index of the oldest block of a skipchain
+	// whose payload is still needed.
+	pruneGuard func(SkipBlockID) int
+	// payloadCheck verifies the payload of a block fetched from an
+	// archive, as the payload is not part of the hash of the block.
+	payloadCheck func(*SkipBlock) error
 }
 
 type chainLocker struct {
@@ -152,6 +164,8 @@ type Storage struct {
 	// to this service. Once a client is linked to a service, only blocks signed
 	// by this client will be allowed.
 	Clients []kyber.Point
+	// Pruning holds the pruning policies of the skipchains.
+	Pruning []*PruningPolicy
 }
 
 // StoreSkipBlock stores a new skipblock in the system. This can be either a
@@ -537,14 +551,10 @@ func (s *Service) getLastBlock(roster *onet.Roster, latest SkipBlockID) (*SkipBl
 }
 
 // GetSingleBlock searches for the given block and returns it. If no such block is
-// found, a nil is returned.
+// found, a nil is returned. The payload of a pruned block is fetched from the
+// archive conodes.
 func (s *Service) GetSingleBlock(id *GetSingleBlock) (*SkipBlock, error) {
-	sb := s.db.GetByID(id.ID)
-	if sb == nil {
-		return nil, errors.New("No such block")
-
-	}
-	return sb, nil
+	return s.GetFullBlock(id.ID)
 }
 
 // GetSingleBlockByIndex searches for the given block and returns it. If no such block is
@@ -557,18 +567,40 @@ func (s *Service) GetSingleBlockByIndex(id *GetSingleBlockByIndex) (*SkipBlock,
 	if sb.Index == id.Index {
 		return sb, nil
 	}
-	for len(sb.ForwardLink) > 0 {
-		sb = s.db.GetByID(sb.ForwardLink[0].To)
-		if sb == nil {
-			return nil, errors.New("didn't find block in forward link")
+	if id.Index > sb.Index {
+		sb, err := s.db.GetByIndex(sb.SkipChainID(), id.Index)
+		if err != nil {
+			return nil, err
 		}
-		if sb.Index == id.Index {
-			return sb, nil
+		if sb != nil {
+			return s.GetFullBlock(sb.Hash)
 		}
 	}
 	return nil, errors.New("No block with this index found")
 }
 
+// GetBlocksByIndexRange returns the blocks of a skipchain from index Start up
+// to, but not including, index End. At most maxBlocksInRange blocks are
+// returned, and the range stops at the first block that is not known. The
+// payload of pruned blocks is not fetched from the archives.
+func (s *Service) GetBlocksByIndexRange(req *GetBlocksByIndexRange) (*GetBlocksByIndexRangeReply, error) {
+	if req.Start < 0 || req.End < req.Start {
+		return nil, errors.New("invalid range")
+	}
+	if s.db.GetByID(req.Genesis) == nil {
+		return nil, errors.New("No such genesis-block")
+	}
+	end := req.End
+	if end-req.Start > maxBlocksInRange {
+		end = req.Start + maxBlocksInRange
+	}
+	blocks, err := s.db.GetByIndexRange(req.Genesis, req.Start, end)
+	if err != nil {
+		return nil, err
+	}
+	return &GetBlocksByIndexRangeReply{Blocks: blocks}, nil
+}
+
 // GetAllSkipchains currently returns a list of all the known blocks.
 // This is a bug, but for backwards compatibility it is being left as is.
 //
@@ -967,6 +999,9 @@ func (s *Service) forwardLinkLevel0(src, dst *SkipBlock) error {
 	if _, err := s.db.StoreBlocks([]*SkipBlock{src, dst}); err != nil {
 		return errors.New("couldn't store new forward link or new block: " + err.Error())
 	}
+	if err := s.pruneChain(dst.SkipChainID()); err != nil {
+		log.Error(s.ServerIdentity(), "couldn't prune blocks:", err)
+	}
 	var proof []*SkipBlock
 	pointer := s.db.GetByID(dst.SkipChainID())
 	for {
@@ -1304,6 +1339,12 @@ func (s *Service) propagateSkipBlock(msg network.Message) {
 	_, err := s.db.StoreBlocks(sbs.SkipBlocks)
 	if err != nil {
 		log.Error(err)
+		return
+	}
+	if len(sbs.SkipBlocks) > 0 {
+		if err := s.pruneChain(sbs.SkipBlocks[0].SkipChainID()); err != nil {
+			log.Error(s.ServerIdentity(), "couldn't prune blocks:", err)
+		}
 	}
 }
 
@@ -1497,6 +1538,23 @@ func (s *Service) tryLoad() error {
 	return nil
 }
 
+// migrate updates the database from an older version. Version 1 didn't have
+// the index of the blocks.
+func (s *Service) migrate() error {
+	ver, err := s.LoadVersion()
+	if err != nil {
+		return err
+	}
+	if ver >= dbVersion {
+		return nil
+	}
+	log.Lvl2("Building the index of the skipblocks")
+	if err := s.db.BuildIndex(); err != nil {
+		return err
+	}
+	return s.SaveVersion(dbVersion)
+}
+
 // sliceToArr does what the name suggests, we need it to turn a slice into
 // something hashable.
 func sliceToArr(msg []byte) [32]byte {
@@ -1519,9 +1577,12 @@ func newSkipchainService(c *onet.Context) (onet.Service, error) {
 	if err := s.tryLoad(); err != nil {
 		return nil, err
 	}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
 	log.ErrFatal(s.RegisterHandlers(s.StoreSkipBlock, s.GetUpdateChain,
-		s.GetSingleBlock, s.GetSingleBlockByIndex, s.GetAllSkipchains,
-		s.GetAllSkipChainIDs,
+		s.GetSingleBlock, s.GetSingleBlockByIndex, s.GetBlocksByIndexRange,
+		s.GetAllSkipchains, s.GetAllSkipChainIDs, s.SetPruning, s.GetForkEvidence,
 		s.CreateLinkPrivate, s.Unlink, s.AddFollow, s.ListFollow,
 		s.DelFollow, s.Listlink))
 	s.ServiceProcessor.RegisterStatusReporter("Skipblock", s.db)
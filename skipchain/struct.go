@@ -373,13 +373,28 @@ func NewSkipBlock() *SkipBlock {
 // VerifyForwardSignatures returns whether all signatures in the forward-links
 // are correctly signed by the aggregate public key of the roster.
 func (sb *SkipBlock) VerifyForwardSignatures() error {
+	return sb.verifyForwardSignatures(false)
+}
+
+// VerifyForwardSignaturesWithRotation is like VerifyForwardSignatures, but
+// also accepts forward-links signed by a rotation of the roster, as done
+// by a view-change.
+func (sb *SkipBlock) VerifyForwardSignaturesWithRotation() error {
+	return sb.verifyForwardSignatures(true)
+}
+
+func (sb *SkipBlock) verifyForwardSignatures(rotation bool) error {
 	for _, fl := range sb.ForwardLink {
 		if fl.IsEmpty() {
 			// This means it's an empty forward-link to correctly place a higher-order
 			// forward-link in place.
 			continue
 		}
-		if err := fl.Verify(cothority.Suite, sb.Roster.Publics()); err != nil {
+		verify := fl.Verify
+		if rotation {
+			verify = fl.VerifyWithRotation
+		}
+		if err := verify(cothority.Suite, sb.Roster.Publics()); err != nil {
 			return errors.New("Wrong signature in forward-link: " + err.Error())
 		}
 	}
@@ -555,32 +570,45 @@ func (fl *ForwardLink) Copy() *ForwardLink {
 // be in the same order as the Roster that signed the message.
 // It returns nil if the signature is correct, or an error if not.
 func (fl *ForwardLink) Verify(suite cosi.Suite, pubs []kyber.Point) error {
-	if bytes.Compare(fl.Signature.Msg, fl.Hash()) != 0 {
-		return errors.New("wrong hash of forward link")
-	}
 	// If we allow view-change, then we should try to verify the signature
 	// using all the valid rotations of the given public key slice.
 	if enableViewChange {
-		n := len(pubs)
-		if n == 0 {
-			return errors.New("no public keys")
-		}
-		for i := 0; i < n; i++ {
-			err := cosi.Verify(suite, pubs, fl.Signature.Msg, fl.Signature.Sig,
-				cosi.NewThresholdPolicy(byzcoinx.Threshold(n)))
-			if err == nil {
-				return nil
-			}
-			pubs = append(pubs[1:], pubs[0])
-			continue
-		}
-		return errors.New("no successful view-change verification")
+		return fl.VerifyWithRotation(suite, pubs)
+	}
+	if bytes.Compare(fl.Signature.Msg, fl.Hash()) != 0 {
+		return errors.New("wrong hash of forward link")
 	}
 	// This calculation must match the one in byzcoinx.
 	return cosi.Verify(suite, pubs, fl.Signature.Msg, fl.Signature.Sig,
 		cosi.NewThresholdPolicy(byzcoinx.Threshold(len(pubs))))
 }
 
+// VerifyWithRotation checks the signature against all the rotations of the
+// list of public keys, as a view-change rotates the roster that signs the
+// forward link. Unlike Verify, it doesn't depend on view-change being
+// enabled, so that clients can verify the skipchains of services that use
+// view-change.
+func (fl *ForwardLink) VerifyWithRotation(suite cosi.Suite, pubs []kyber.Point) error {
+	if bytes.Compare(fl.Signature.Msg, fl.Hash()) != 0 {
+		return errors.New("wrong hash of forward link")
+	}
+	n := len(pubs)
+	if n == 0 {
+		return errors.New("no public keys")
+	}
+	rotated := make([]kyber.Point, n)
+	for i := 0; i < n; i++ {
+		copy(rotated, pubs[i:])
+		copy(rotated[n-i:], pubs[:i])
+		err := cosi.Verify(suite, rotated, fl.Signature.Msg, fl.Signature.Sig,
+			cosi.NewThresholdPolicy(byzcoinx.Threshold(n)))
+		if err == nil {
+			return nil
+		}
+	}
+	return errors.New("no successful view-change verification")
+}
+
 // IsEmpty indicates whether this forwardlink is merely a placeholder for
 // higher-order forwardlinks to be in the correct place.
 func (fl *ForwardLink) IsEmpty() bool {
@@ -593,19 +621,40 @@ func (fl *ForwardLink) IsEmpty() bool {
 type SkipBlockDB struct {
 	*bolt.DB
 	bucketName []byte
+	// indexBucketName is the bucket that maps the genesis ID and the index
+	// of every block to its hash.
+	indexBucketName []byte
+	// forkBucketName is the bucket that holds the evidence of forks.
+	forkBucketName []byte
 	// latestBlocks is used as a simple caching mechanism
 	latestBlocks map[string]SkipBlockID
 	latestMutex  sync.Mutex
 	callback     func(SkipBlockID) error
 }
 
-// NewSkipBlockDB returns an initialized SkipBlockDB structure.
+// NewSkipBlockDB returns an initialized SkipBlockDB structure. The bucket
+// of the index of the blocks is created next to the bucket bn if it doesn't
+// exist yet.
 func NewSkipBlockDB(db *bolt.DB, bn []byte) *SkipBlockDB {
-	return &SkipBlockDB{
-		DB:           db,
-		bucketName:   bn,
-		latestBlocks: map[string]SkipBlockID{},
+	sbdb := &SkipBlockDB{
+		DB:              db,
+		bucketName:      bn,
+		indexBucketName: append(append([]byte{}, bn...), []byte("_index")...),
+		forkBucketName:  append(append([]byte{}, bn...), []byte("_forks")...),
+		latestBlocks:    map[string]SkipBlockID{},
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{sbdb.indexBucketName, sbdb.forkBucketName} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("couldn't create index and fork buckets:", err)
 	}
+	return sbdb
 }
 
 // GetStatus is a function that returns the status report of the db.
@@ -618,6 +667,8 @@ func (db *SkipBlockDB) GetStatus() *onet.Status {
 
 		total := s.BranchInuse + s.LeafInuse
 		out["Bytes"] = strconv.Itoa(total)
+
+		out["ForkEvidence"] = strconv.Itoa(tx.Bucket(db.forkBucketName).Stats().KeyN)
 		return nil
 	})
 	return &onet.Status{Field: out}
@@ -645,6 +696,7 @@ func (db *SkipBlockDB) GetByID(sbID SkipBlockID) *SkipBlock {
 // so that the db is consistent at every moment.
 func (db *SkipBlockDB) StoreBlocks(blocks []*SkipBlock) ([]SkipBlockID, error) {
 	var result []SkipBlockID
+	var forks []*ForkEvidence
 	err := db.Update(func(tx *bolt.Tx) error {
 		fl := blocks[len(blocks)-1].ForwardLink
 		if len(fl) > 0 {
@@ -658,6 +710,9 @@ func (db *SkipBlockDB) StoreBlocks(blocks []*SkipBlock) ([]SkipBlockID, error) {
 				return errors.New("failed to get skipblock with error: " + err.Error())
 			}
 			if sbOld != nil {
+				// Different forward-links for the same block are kept as
+				// evidence of a fork.
+				forks = append(forks, checkFork(sbOld, sb)...)
 				// If this skipblock already exists, only copy forward-links and
 				// new children.
 				if len(sb.ForwardLink) > len(sbOld.ForwardLink) {
@@ -707,6 +762,13 @@ func (db *SkipBlockDB) StoreBlocks(blocks []*SkipBlock) ([]SkipBlockID, error) {
 		return nil
 	})
 
+	// The evidence is stored even if the blocks are refused.
+	if len(forks) > 0 {
+		if err := db.StoreForkEvidence(forks); err != nil {
+			log.Error("couldn't store fork evidence:", err)
+		}
+	}
+
 	// Run the callback if it exists, we have to do this outside of the
 	// boltdb transaction because the callback might also make updates to
 	// the database. Otherwise there will be a deadlock.
@@ -815,21 +877,40 @@ func (db *SkipBlockDB) GetResponsible(sb *SkipBlock) (*SkipBlock, error) {
 // VerifyLinks makes sure that all forward- and backward-links are correct.
 // It takes a skipblock to verify and returns nil in case of success.
 func (db *SkipBlockDB) VerifyLinks(sb *SkipBlock) error {
+	return db.verifyLinks(sb, false)
+}
+
+// VerifyLinksWithRotation is like VerifyLinks, but also accepts
+// forward-links signed by a rotation of the roster, as done by a
+// view-change. It is used by clients, which cannot know whether the service
+// of the skipchain enabled view-change.
+func (db *SkipBlockDB) VerifyLinksWithRotation(sb *SkipBlock) error {
+	return db.verifyLinks(sb, true)
+}
+
+func (db *SkipBlockDB) verifyLinks(sb *SkipBlock, rotation bool) error {
 	if len(sb.BackLinkIDs) == 0 {
 		return errors.New("need at least one backlink")
 	}
 
-	if err := sb.VerifyForwardSignatures(); err != nil {
+	if err := sb.verifyForwardSignatures(rotation); err != nil {
 		return errors.New("Wrong signatures: " + err.Error())
 	}
 
+	// Verify our forward-links don't conflict with a stored copy of us
+	if known := db.GetByID(sb.Hash); known != nil {
+		if len(checkFork(known, sb)) > 0 {
+			return errors.New("forward-links conflict with the stored block, the skipchain is forked")
+		}
+	}
+
 	// Verify if we're in the responsible-list
 	if !sb.ParentBlockID.IsNull() {
 		parent := db.GetByID(sb.ParentBlockID)
 		if parent == nil {
 			return errors.New("Didn't find parent")
 		}
-		if err := parent.VerifyForwardSignatures(); err != nil {
+		if err := parent.verifyForwardSignatures(rotation); err != nil {
 			return err
 		}
 		found := false
@@ -858,10 +939,10 @@ func (db *SkipBlockDB) VerifyLinks(sb *SkipBlock) error {
 		}
 		return errors.New("Didn't find height-0 skipblock in db")
 	}
-	if err := sbBack.VerifyForwardSignatures(); err != nil {
+	if err := sbBack.verifyForwardSignatures(rotation); err != nil {
 		return err
 	}
-	if !sbBack.GetForward(0).Hash().Equal(sb.Hash) {
+	if fl := sbBack.GetForward(0); fl == nil || !fl.To.Equal(sb.Hash) {
 		return errors.New("didn't find our block in forward-links")
 	}
 	return nil
@@ -950,6 +1031,108 @@ func (db *SkipBlockDB) GetFuzzy(id string) (*SkipBlock, error) {
 	return sb, nil
 }
 
+// GetByIndex returns the block of the skipchain with the given index, or nil
+// if it is not in the database.
+func (db *SkipBlockDB) GetByIndex(genesis SkipBlockID, index int) (*SkipBlock, error) {
+	var sb *SkipBlock
+	err := db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(db.indexBucketName).Get(indexKey(genesis, index))
+		if id == nil {
+			return nil
+		}
+		var err error
+		sb, err = db.getFromTx(tx, id)
+		return err
+	})
+	return sb, err
+}
+
+// GetByIndexRange returns the blocks of the skipchain from index start up to,
+// but not including, index end. It stops at the first block that is not in
+// the database, so the returned blocks are always contiguous.
+func (db *SkipBlockDB) GetByIndexRange(genesis SkipBlockID, start, end int) ([]*SkipBlock, error) {
+	var blocks []*SkipBlock
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(db.indexBucketName)
+		for i := start; i < end; i++ {
+			id := b.Get(indexKey(genesis, i))
+			if id == nil {
+				return nil
+			}
+			sb, err := db.getFromTx(tx, id)
+			if err != nil {
+				return err
+			}
+			if sb == nil {
+				return nil
+			}
+			blocks = append(blocks, sb)
+		}
+		return nil
+	})
+	return blocks, err
+}
+
+// PruneBlocks drops the payload of the blocks of the skipchain with an index
+// from start up to, but not including, end. The rest of the blocks, with
+// their forward links, is kept, so that they can still be used in proofs. It
+// returns the number of blocks that have been pruned.
+func (db *SkipBlockDB) PruneBlocks(genesis SkipBlockID, start, end int) (int, error) {
+	var n int
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(db.indexBucketName)
+		for i := start; i < end; i++ {
+			id := b.Get(indexKey(genesis, i))
+			if id == nil {
+				continue
+			}
+			sb, err := db.getFromTx(tx, id)
+			if err != nil {
+				return err
+			}
+			if sb == nil || len(sb.Payload) == 0 {
+				continue
+			}
+			sb.Payload = nil
+			if err := db.storeToTx(tx, sb); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// BuildIndex adds all the blocks of the database to the index, which is
+// needed for databases that were created before the index existed.
+func (db *SkipBlockDB) BuildIndex() error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(db.indexBucketName)
+		return tx.Bucket(db.bucketName).ForEach(func(k, v []byte) error {
+			_, sbMsg, err := network.Unmarshal(v, cothority.Suite)
+			if err != nil {
+				return err
+			}
+			sb, ok := sbMsg.(*SkipBlock)
+			if !ok {
+				return nil
+			}
+			return b.Put(indexKey(sb.SkipChainID(), sb.Index), sb.Hash)
+		})
+	})
+}
+
+// indexKey returns the key of the block with the given index in the index
+// bucket. The index is stored in big-endian, so that the blocks of a
+// skipchain are sorted by index.
+func indexKey(genesis SkipBlockID, index int) []byte {
+	key := make([]byte, len(genesis)+8)
+	copy(key, genesis)
+	binary.BigEndian.PutUint64(key[len(genesis):], uint64(index))
+	return key
+}
+
 // GetSkipchains returns all latest skipblocks from all skipchains.
 func (db *SkipBlockDB) GetSkipchains() (map[string]*SkipBlock, error) {
 	return db.getAll()
@@ -964,7 +1147,11 @@ func (db *SkipBlockDB) storeToTx(tx *bolt.Tx, sb *SkipBlock) error {
 	if err != nil {
 		return err
 	}
-	return tx.Bucket([]byte(db.bucketName)).Put(key, val)
+	err = tx.Bucket([]byte(db.bucketName)).Put(key, val)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(db.indexBucketName).Put(indexKey(sb.SkipChainID(), sb.Index), key)
 }
 
 // getFromTx returns the skipblock identified by sbID.
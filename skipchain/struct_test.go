@@ -8,8 +8,13 @@ import (
 
 	bolt "github.com/coreos/bbolt"
 	"github.com/dedis/cothority"
+	"github.com/dedis/cothority/byzcoinx"
+	"github.com/dedis/kyber"
+	"github.com/dedis/kyber/sign/cosi"
+	"github.com/dedis/kyber/util/key"
 	"github.com/dedis/onet"
 	"github.com/dedis/onet/log"
+	"github.com/dedis/onet/network"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -83,6 +88,56 @@ func TestSkipBlock_VerifySignatures(t *testing.T) {
 	require.NotNil(t, db.VerifyLinks(block1))
 }
 
+func TestForwardLink_VerifyWithRotation(t *testing.T) {
+	var pubs []kyber.Point
+	var privs []kyber.Scalar
+	for i := 0; i < 4; i++ {
+		kp := key.NewKeyPair(cothority.Suite)
+		pubs = append(pubs, kp.Public)
+		privs = append(privs, kp.Private)
+	}
+	// After a view-change, the roster starts with the second node, and
+	// the last node of the rotated roster doesn't sign.
+	rotated := append(append([]kyber.Point{}, pubs[1:]...), pubs[0])
+	signers := append([]kyber.Scalar{}, privs[1:]...)
+	fl := &ForwardLink{From: SkipBlockID{1}, To: SkipBlockID{2}}
+
+	mask, err := cosi.NewMask(cothority.Suite, rotated, nil)
+	require.Nil(t, err)
+	V := cothority.Suite.Point().Null()
+	var vs []kyber.Scalar
+	for i := range signers {
+		require.Nil(t, mask.SetBit(i, true))
+		v, commit := cosi.Commit(cothority.Suite)
+		vs = append(vs, v)
+		V.Add(V, commit)
+	}
+	ch, err := cosi.Challenge(cothority.Suite, V, mask.AggregatePublic, fl.Hash())
+	require.Nil(t, err)
+	r := cothority.Suite.Scalar().Zero()
+	for i, priv := range signers {
+		resp, err := cosi.Response(cothority.Suite, priv, vs[i], ch)
+		require.Nil(t, err)
+		r.Add(r, resp)
+	}
+	sig, err := cosi.Sign(cothority.Suite, V, r, mask)
+	require.Nil(t, err)
+	fl.Signature = byzcoinx.FinalSignature{Msg: fl.Hash(), Sig: sig}
+
+	if !enableViewChange {
+		require.NotNil(t, fl.Verify(cothority.Suite, pubs))
+	}
+	require.Nil(t, fl.Verify(cothority.Suite, rotated))
+	require.Nil(t, fl.VerifyWithRotation(cothority.Suite, pubs))
+	require.Nil(t, fl.VerifyWithRotation(cothority.Suite, rotated))
+
+	// Another roster is refused in any rotation.
+	other := append([]kyber.Point{}, pubs...)
+	other[2] = key.NewKeyPair(cothority.Suite).Public
+	require.NotNil(t, fl.VerifyWithRotation(cothority.Suite, other))
+	require.NotNil(t, fl.VerifyWithRotation(cothority.Suite, nil))
+}
+
 func TestSkipBlock_Hash1(t *testing.T) {
 	sbd1 := NewSkipBlock()
 	sbd1.Data = []byte("1")
@@ -205,6 +260,142 @@ func TestSkipBlock_Payload(t *testing.T) {
 	require.Equal(t, h, sb.CalculateHash())
 }
 
+func TestSkipBlockDB_GetByIndex(t *testing.T) {
+	db, fname := setupSkipBlockDB(t)
+	defer db.Close()
+	defer os.Remove(fname)
+
+	var blocks []*SkipBlock
+	for i := 0; i < 3; i++ {
+		sb := NewSkipBlock()
+		sb.Index = i
+		sb.Data = []byte{byte(i)}
+		sb.Hash = sb.CalculateHash()
+		if i > 0 {
+			sb.GenesisID = blocks[0].Hash
+		}
+		blocks = append(blocks, sb)
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, sb := range blocks {
+			require.Nil(t, db.storeToTx(tx, sb))
+		}
+		return nil
+	})
+	require.Nil(t, err)
+
+	check := func() {
+		for i, sb := range blocks {
+			found, err := db.GetByIndex(blocks[0].Hash, i)
+			require.Nil(t, err)
+			require.NotNil(t, found)
+			require.True(t, sb.Hash.Equal(found.Hash))
+		}
+		found, err := db.GetByIndex(blocks[0].Hash, 3)
+		require.Nil(t, err)
+		require.Nil(t, found)
+
+		rng, err := db.GetByIndexRange(blocks[0].Hash, 1, 5)
+		require.Nil(t, err)
+		require.Equal(t, 2, len(rng))
+		require.True(t, blocks[1].Hash.Equal(rng[0].Hash))
+		require.True(t, blocks[2].Hash.Equal(rng[1].Hash))
+	}
+	check()
+
+	// An index lost in an older database is built again from the blocks.
+	err = db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(db.indexBucketName); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(db.indexBucketName)
+		return err
+	})
+	require.Nil(t, err)
+	found, err := db.GetByIndex(blocks[0].Hash, 1)
+	require.Nil(t, err)
+	require.Nil(t, found)
+	require.Nil(t, db.BuildIndex())
+	check()
+}
+
+func TestSkipBlockDB_ForkEvidence(t *testing.T) {
+	db, fname := setupSkipBlockDB(t)
+	defer db.Close()
+	defer os.Remove(fname)
+
+	kp := key.NewKeyPair(cothority.Suite)
+	si := network.NewServerIdentity(kp.Public, network.NewAddress(network.PlainTCP, "0:2000"))
+	roster := onet.NewRoster([]*network.ServerIdentity{si})
+	genesis := NewSkipBlock()
+	genesis.Roster = roster
+	genesis.BackLinkIDs = []SkipBlockID{{1, 2, 3, 4}}
+	genesis.Hash = genesis.CalculateHash()
+	db.Store(genesis)
+
+	newBlock := func(data byte) *SkipBlock {
+		sb := NewSkipBlock()
+		sb.Index = 1
+		sb.Roster = roster
+		sb.GenesisID = genesis.Hash
+		sb.BackLinkIDs = []SkipBlockID{genesis.Hash}
+		sb.Data = []byte{data}
+		sb.Hash = sb.CalculateHash()
+		return sb
+	}
+	withLink := func(to *SkipBlock, priv kyber.Scalar) *SkipBlock {
+		from := genesis.Copy()
+		from.ForwardLink = []*ForwardLink{signLink(t, from, to, priv)}
+		return from
+	}
+	blockA := newBlock(1)
+	blockB := newBlock(2)
+	_, err := db.StoreBlocks([]*SkipBlock{withLink(blockA, kp.Private), blockA})
+	require.Nil(t, err)
+	require.Nil(t, db.VerifyLinks(withLink(blockA, kp.Private)))
+	require.Nil(t, db.VerifyLinks(blockA))
+	require.NotNil(t, db.VerifyLinks(blockB))
+
+	// A conflicting link that is not signed by the roster is no evidence.
+	fake := withLink(blockB, key.NewKeyPair(cothority.Suite).Private)
+	db.StoreBlocks([]*SkipBlock{fake, blockB})
+	evidence, err := db.GetForkEvidence(nil)
+	require.Nil(t, err)
+	require.Equal(t, 0, len(evidence))
+
+	forked := withLink(blockB, kp.Private)
+	require.NotNil(t, db.VerifyLinks(forked))
+	db.StoreBlocks([]*SkipBlock{forked, blockB})
+	evidence, err = db.GetForkEvidence(genesis.Hash)
+	require.Nil(t, err)
+	require.Equal(t, 1, len(evidence))
+	require.Nil(t, evidence[0].Verify())
+	require.Equal(t, 0, evidence[0].Height)
+	require.True(t, evidence[0].Known.To.Equal(blockA.Hash))
+	require.True(t, evidence[0].Conflicting.To.Equal(blockB.Hash))
+	require.Equal(t, "1", db.GetStatus().Field["ForkEvidence"])
+
+	evidence, err = db.GetForkEvidence(SkipBlockID{1, 2, 3})
+	require.Nil(t, err)
+	require.Equal(t, 0, len(evidence))
+}
+
+// signLink returns the forward link from from to to, signed by priv alone.
+func signLink(t *testing.T, from, to *SkipBlock, priv kyber.Scalar) *ForwardLink {
+	fl := NewForwardLink(from, to)
+	v, V := cosi.Commit(cothority.Suite)
+	ch, err := cosi.Challenge(cothority.Suite, V, from.Roster.Aggregate, fl.Hash())
+	require.Nil(t, err)
+	resp, err := cosi.Response(cothority.Suite, priv, v, ch)
+	require.Nil(t, err)
+	mask, err := cosi.NewMask(cothority.Suite, from.Roster.Publics(), from.Roster.Publics()[0])
+	require.Nil(t, err)
+	sig, err := cosi.Sign(cothority.Suite, V, resp, mask)
+	require.Nil(t, err)
+	fl.Signature = byzcoinx.FinalSignature{Msg: fl.Hash(), Sig: sig}
+	return fl
+}
+
 // setupSkipBlockDB initialises a database with a bucket called 'skipblock-test' inside.
 // The caller is responsible to close and remove the database file after using it.
 func setupSkipBlockDB(t *testing.T) (*SkipBlockDB, string) {